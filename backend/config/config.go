@@ -2,8 +2,13 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -62,6 +67,108 @@ func Get(key string) string {
 	return cfg[key] // Returns empty string if key doesn't exist
 }
 
+// GetInt returns the value for a given key parsed as an integer.
+// It returns defaultValue if the key is missing or not a valid integer.
+func GetInt(key string, defaultValue int) int {
+	val := strings.TrimSpace(Get(key))
+	if val == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("Warning: Config key '%s' has non-integer value '%s', using default %d", key, val, defaultValue)
+		return defaultValue
+	}
+	return i
+}
+
+// GetBool returns the value for a given key parsed as a boolean ("true", "1", "false", "0", ...).
+// It returns defaultValue if the key is missing or not a valid boolean.
+func GetBool(key string, defaultValue bool) bool {
+	val := strings.TrimSpace(Get(key))
+	if val == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("Warning: Config key '%s' has non-boolean value '%s', using default %t", key, val, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// LogLevel returns the normalized LOG_LEVEL setting: "silent", "error", "warn" or "info".
+// "debug" is treated as "info". Missing or unknown values fall back to "warn".
+func LogLevel() string {
+	level := strings.ToLower(strings.TrimSpace(Get("LOG_LEVEL")))
+	switch level {
+	case "silent", "error", "warn", "info":
+		return level
+	case "debug":
+		return "info"
+	case "warning":
+		return "warn"
+	case "":
+		return "warn"
+	default:
+		log.Printf("Warning: Unknown LOG_LEVEL '%s', using 'warn'", level)
+		return "warn"
+	}
+}
+
+// ListenAddress returns the host:port the API server binds to, from the HOST and PORT settings.
+// Each falls back to the environment variable of the same name, then to 127.0.0.1 and 8080,
+// so the unauthenticated API is only reachable locally unless explicitly exposed.
+func ListenAddress() (string, error) {
+	host := strings.TrimSpace(Get("HOST"))
+	if host == "" {
+		host = strings.TrimSpace(os.Getenv("HOST"))
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	portStr := strings.TrimSpace(Get("PORT"))
+	if portStr == "" {
+		portStr = strings.TrimSpace(os.Getenv("PORT"))
+	}
+	if portStr == "" {
+		portStr = "8080"
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("invalid PORT '%s', must be an integer between 1 and 65535", portStr)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// DataDir returns the base directory for stored artifacts, from the DATA_DIR setting (default "data",
+// relative to the working directory).
+func DataDir() string {
+	dir := strings.TrimSpace(Get("DATA_DIR"))
+	if dir == "" {
+		return "data"
+	}
+	return filepath.Clean(dir)
+}
+
+// ScanDir returns the directory holding every artifact of a scan (screenshots, katana output,
+// temporary files): <DATA_DIR>/scans/scan_<id>.
+func ScanDir(scanID uint) string {
+	return filepath.Join(DataDir(), "scans", fmt.Sprintf("scan_%d", scanID))
+}
+
+// WordlistDir returns the directory of the wordlist files templates can name, from the WORDLIST_DIR setting
+// (default <DATA_DIR>/wordlists).
+func WordlistDir() string {
+	dir := strings.TrimSpace(Get("WORDLIST_DIR"))
+	if dir == "" {
+		return filepath.Join(DataDir(), "wordlists")
+	}
+	return filepath.Clean(dir)
+}
+
 // GetAll returns a copy of the entire configuration map.
 func GetAll() map[string]string {
 	LoadConfig() // Ensure config is loaded
@@ -75,23 +182,39 @@ func GetAll() map[string]string {
 	return copyCfg
 }
 
-// Save saves the current configuration map back to the JSON file.
+// Save replaces the configuration with newCfg and writes it to the JSON file.
 func Save(newCfg map[string]string) error {
 	LoadConfig() // Ensure config is loaded initially (though we overwrite)
 	mu.Lock()
 	defer mu.Unlock()
 
-	// Update the global cfg variable
-	cfg = make(map[string]string, len(newCfg))
+	updated := make(map[string]string, len(newCfg))
 	for k, v := range newCfg {
-		// Optionally filter out empty keys before saving
-		// if v != "" {
-		//  cfg[k] = v
-		// }
-		cfg[k] = v // Saving all keys for now, including potentially empty ones
+		updated[k] = v // Saving all keys, including empty ones
 	}
+	return writeConfig(updated)
+}
+
+// Merge updates the given keys of the configuration, keeping all others, and writes it to the JSON file.
+// The configuration is left unchanged if it can't be written.
+func Merge(updates map[string]string) error {
+	LoadConfig()
+	mu.Lock()
+	defer mu.Unlock()
+
+	updated := make(map[string]string, len(cfg)+len(updates))
+	for k, v := range cfg {
+		updated[k] = v
+	}
+	for k, v := range updates {
+		updated[k] = v
+	}
+	return writeConfig(updated)
+}
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+// writeConfig writes updated to the JSON file and makes it the configuration. The caller holds mu.
+func writeConfig(updated map[string]string) error {
+	data, err := json.MarshalIndent(updated, "", "  ")
 	if err != nil {
 		log.Printf("Error marshalling config to JSON: %v", err)
 		return err
@@ -102,6 +225,7 @@ func Save(newCfg map[string]string) error {
 		log.Printf("Error writing config file '%s': %v", configFilePath, err)
 		return err
 	}
+	cfg = updated
 	log.Printf("Configuration saved successfully to %s", configFilePath)
 	return nil
 }
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Setting groups (Setting.Group)
+const (
+	GroupServer      = "server"
+	GroupAPIKeys     = "api_keys"
+	GroupScanning    = "scanning"
+	GroupScreenshots = "screenshots"
+	GroupData        = "data"
+	GroupDigest      = "digest"
+	GroupWebhooks    = "webhooks"
+)
+
+// Setting value types (Setting.Type)
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeBool   = "bool"
+)
+
+// Setting describes a configuration key kasm reads, for documentation, the settings template and
+// validation on save.
+type Setting struct {
+	Key         string `json:"key"`
+	Group       string `json:"group"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Default     string `json:"default,omitempty"` // Value used when the key is unset, empty if it has none
+	Secret      bool   `json:"secret"`            // Credential; never echo its value back
+	Source      string `json:"source,omitempty"`  // Subfinder source the credential belongs to, by its subfinder name
+	Secondary   bool   `json:"-"`                 // Second credential of a multi-key source (e.g. a secret to an ID)
+
+	Validate func(value string) error `json:"-"` // Additional check of a non-empty value, after the type check
+}
+
+// Settings is the catalog of every configuration key kasm reads. Keep it in sync when adding a setting:
+// it drives the settings template, validation on save and the subfinder API key lookup.
+var Settings = []Setting{
+	{Key: "HOST", Group: GroupServer, Type: TypeString, Validate: validHost, Default: "127.0.0.1", Description: "Address the API server binds to (falls back to the HOST environment variable). The API is unauthenticated, only expose it deliberately."},
+	{Key: "PORT", Group: GroupServer, Type: TypeInt, Validate: intRange(1, 65535), Default: "8080", Description: "Port the API server listens on (falls back to the PORT environment variable)."},
+	{Key: "LOG_LEVEL", Group: GroupServer, Type: TypeString, Validate: oneOf("silent", "error", "warn", "warning", "info", "debug"), Default: "warn", Description: "Log level of the application and database logs: silent, error, warn or info (debug is treated as info). Below info, HTTP requests are not logged. Scan log tails keep every line."},
+	{Key: "SEED_DEFAULT_TEMPLATES", Group: GroupServer, Type: TypeBool, Default: "true", Description: "Seed scan templates at startup. Templates with an existing name are never overwritten."},
+	{Key: "SEED_TEMPLATES_FILE", Group: GroupServer, Type: TypeString, Description: "JSON file with the scan templates to seed instead of the built-in ones."},
+
+	{Key: "SHODAN_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "shodan", Description: "Shodan API key."},
+	{Key: "CENSYS_API_ID", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "censys", Description: "Censys API ID, used together with CENSYS_API_SECRET."},
+	{Key: "CENSYS_API_SECRET", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "censys", Secondary: true, Description: "Censys API secret."},
+	{Key: "BINARYEDGE_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "binaryedge", Description: "BinaryEdge API key."},
+	{Key: "VIRUSTOTAL_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "virustotal", Description: "VirusTotal API key."},
+	{Key: "SECURITYTRAILS_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "securitytrails", Description: "SecurityTrails API key."},
+	{Key: "CHAOS_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "chaos", Description: "ProjectDiscovery Chaos API key."},
+	{Key: "GITHUB_TOKEN", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "github", Description: "GitHub token for code search."},
+	{Key: "ZOOMEYE_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "zoomeyeapi", Description: "ZoomEye API key, optionally prefixed with the API host as host:key (zoomeye.org by default)."},
+	{Key: "FOFA_EMAIL", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "fofa", Description: "FOFA account email, used together with FOFA_API_KEY."},
+	{Key: "FOFA_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "fofa", Secondary: true, Description: "FOFA API key."},
+	{Key: "HUNTER_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "hunter", Description: "Hunter API key."},
+	{Key: "QUAKE_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "quake", Description: "360 Quake API key."},
+	{Key: "NETLAS_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "netlas", Description: "Netlas API key."},
+	{Key: "INTELX_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "intelx", Description: "Intelligence X API key."},
+	{Key: "LEAKIX_API_KEY", Group: GroupAPIKeys, Type: TypeString, Secret: true, Source: "leakix", Description: "LeakIX API key."},
+	{Key: "SUBFINDER_PROVIDER_CONFIG", Group: GroupAPIKeys, Type: TypeString, Description: "Subfinder provider-config.yaml merged with the keys above, for sources without a setting of their own."},
+
+	{Key: "MAX_OUTBOUND_CONNECTIONS", Group: GroupScanning, Type: TypeInt, Validate: intRange(0, 0), Default: "50", Description: "Requests to scan targets in flight at once across all scans (tech detection, soft-404 calibration, probes, screenshots). 0 disables the cap."},
+	{Key: "TECH_DETECT_WORKERS", Group: GroupScanning, Type: TypeInt, Validate: intRange(1, 0), Default: "10", Description: "URLs fetched in parallel during technology detection."},
+	{Key: "TECH_DETECT_PER_HOST", Group: GroupScanning, Type: TypeInt, Validate: intRange(1, 0), Default: "2", Description: "Parallel technology detection requests to a single host."},
+	{Key: "RATE_LIMIT_RETRIES", Group: GroupScanning, Type: TypeInt, Validate: intRange(0, 0), Default: "3", Description: "Retries with backoff when a target answers 429 Too Many Requests."},
+	{Key: "CAPTURE_STATUS_CODES", Group: GroupScanning, Type: TypeString, Validate: validStatusCodeList, Description: "2xx/3xx status codes or classes (e.g. 200,3xx) whose request/response pairs URL scans and endpoint refreshes store. Crawls only save 2xx/3xx responses as endpoints, so other codes are refused. Empty disables capture."},
+	{Key: "HOSTNAME_DENY_SUFFIXES", Group: GroupScanning, Type: TypeString, Validate: validHostSuffixList, Description: "Comma-separated hostname suffixes (e.g. local,internal,corp.example.com) whose hosts discovery and crawling never save. Matching is per label. Empty saves every in-scope host."},
+	{Key: "ALLOW_INTERNAL_TARGETS", Group: GroupScanning, Type: TypeBool, Default: "false", Description: "Let screenshot batches of explicit URLs, session logins and probes reach loopback, private and link-local addresses. Off, URLs resolving to them are refused."},
+	{Key: "TLS_VERIFY", Group: GroupScanning, Type: TypeBool, Default: "false", Description: "Require valid TLS certificates for technology detection, crawling and screenshots, and record whether each saved subdomain's certificate verifies. Off, invalid certificates are accepted."},
+	{Key: "VERIFY_STORE_IPS", Group: GroupScanning, Type: TypeBool, Default: "true", Description: "Store the IPv4 address httpx resolved while verifying subdomains as their IP address. The template's dns tool, if enabled, overrides it."},
+	{Key: "VERIFY_SUBDOMAIN_TARGET", Group: GroupScanning, Type: TypeBool, Default: "true", Description: "Check with httpx that the target of a subdomain scan answers before scanning it. An unreachable target is marked inactive and its URL scan, technology detection, sensitive files and screenshots are skipped."},
+	{Key: "URL_SAVE_WORKERS", Group: GroupScanning, Type: TypeInt, Validate: intRange(1, 32), Default: "1", Description: "Workers saving URL scan results in parallel. Results of the same endpoint always go to the same worker."},
+	{Key: "FOLLOW_UP_MAX_SCANS", Group: GroupScanning, Type: TypeInt, Validate: intRange(0, 0), Default: "50", Description: "Follow-up scans a single scan may enqueue."},
+	{Key: "MULTI_DOMAIN_SCAN_CONCURRENCY", Group: GroupScanning, Type: TypeInt, Validate: intRange(1, 10), Default: "2", Description: "Root domains a multi-domain scan scans at once."},
+
+	{Key: "SCAN_DEDUP_WINDOW_MINUTES", Group: GroupScanning, Type: TypeInt, Validate: intRange(0, 0), Default: "0", Description: "Starting a scan returns the existing scan instead if one of the same target is running or completed within this many minutes, unless the request sets force. 0 disables the check."},
+	{Key: "HOST_REQUEST_DELAY_MS", Group: GroupScanning, Type: TypeInt, Validate: intRange(0, 60000), Default: "0", Description: "Minimum delay in milliseconds between requests to the same host by katana, tech detection and screenshots, across all scans. Scan templates can set their own. 0 disables it."},
+
+	{Key: "SCREENSHOT_MAX_BYTES", Group: GroupScreenshots, Type: TypeInt, Validate: intRange(0, 0), Default: "10485760", Description: "Captures larger than this many bytes are recorded as skipped instead of saved."},
+	{Key: "SCREENSHOT_MAX_HEIGHT", Group: GroupScreenshots, Type: TypeInt, Validate: intRange(0, 0), Default: "10000", Description: "Height in CSS pixels full-page captures are clipped to."},
+	{Key: "SCREENSHOT_RETRIES", Group: GroupScreenshots, Type: TypeInt, Validate: intRange(0, 10), Default: "2", Description: "Retries with backoff when a capture fails on a timeout or other transient error. Unreachable hosts are not retried."},
+	{Key: "SCREENSHOT_FULL_PAGE", Group: GroupScreenshots, Type: TypeBool, Default: "false", Description: "Capture the whole page instead of the viewport."},
+	{Key: "SCREENSHOT_EXCLUDED_EXTENSIONS", Group: GroupScreenshots, Type: TypeString, Validate: validExtensionList, Description: "Comma-separated extensions (e.g. js,css,zip) of URLs never screenshotted when their content type is unknown. Empty uses the built-in list of scripts, styles, documents, archives and media; none excludes nothing. See GET /api/screenshot-eligibility."},
+	{Key: "SCREENSHOT_CONTENT_TYPES", Group: GroupScreenshots, Type: TypeString, Validate: validMediaTypeList, Description: "Comma-separated media types (e.g. text/html,application/pdf) of responses that are screenshotted. Empty screenshots HTML only."},
+	{Key: "SCREENSHOT_BATCH_CONCURRENCY", Group: GroupScreenshots, Type: TypeInt, Validate: intRange(1, 20), Default: "3", Description: "Captures in parallel for POST /api/screenshots/batch when the request does not set a concurrency."},
+
+	{Key: "DATA_DIR", Group: GroupData, Type: TypeString, Default: "data", Description: "Base directory for stored artifacts. Each scan keeps its screenshots, katana output and temporary files in scans/scan_<id> below it."},
+	{Key: "WORDLIST_DIR", Group: GroupData, Type: TypeString, Description: "Directory of the wordlist files tools can name with their wordlist option, by a path relative to it. Files outside it are never read. Empty uses wordlists below DATA_DIR."},
+	{Key: "SCAN_RETENTION_DAYS", Group: GroupData, Type: TypeInt, Validate: intRange(0, 0), Description: "Default age in days after which finished scans are pruned by POST /api/scans/prune."},
+	{Key: "SCAN_RETENTION_KEEP", Group: GroupData, Type: TypeInt, Validate: intRange(0, 0), Default: "5", Description: "Latest finished scans kept per target regardless of age when pruning."},
+	{Key: "IMPORT_MAX_UPLOAD_BYTES", Group: GroupData, Type: TypeInt, Validate: intRange(1, 0), Default: "10485760", Description: "Maximum size of an import file."},
+	{Key: "IMPORT_MAX_LINE_LENGTH", Group: GroupData, Type: TypeInt, Validate: intRange(1, 0), Default: "8192", Description: "Maximum characters per line of an import file."},
+	{Key: "GRAPH_BATCH_SIZE", Group: GroupData, Type: TypeInt, Validate: intRange(100, 100000), Default: "1000", Description: "Rows loaded per query when building the graph of GET /api/graph, which is then cached until the data changes."},
+
+	{Key: "DIGEST_INTERVAL_HOURS", Group: GroupDigest, Type: TypeInt, Validate: intRange(0, 0), Default: "0", Description: "Email a digest of the changes across all domains every this many hours. 0 disables scheduled digests."},
+	{Key: "DIGEST_RECIPIENTS", Group: GroupDigest, Type: TypeString, Description: "Comma-separated email addresses digests are sent to."},
+	{Key: "DIGEST_SEND_EMPTY", Group: GroupDigest, Type: TypeBool, Default: "false", Description: "Also send digests when nothing changed."},
+	{Key: "SMTP_HOST", Group: GroupDigest, Type: TypeString, Validate: validHost, Description: "SMTP server digests are sent through."},
+	{Key: "SMTP_PORT", Group: GroupDigest, Type: TypeInt, Validate: intRange(1, 65535), Default: "587", Description: "SMTP server port. 465 uses implicit TLS, other ports STARTTLS when offered."},
+	{Key: "SMTP_USERNAME", Group: GroupDigest, Type: TypeString, Description: "SMTP username, leave empty for servers without authentication."},
+	{Key: "SMTP_PASSWORD", Group: GroupDigest, Type: TypeString, Secret: true, Description: "SMTP password."},
+	{Key: "SMTP_FROM", Group: GroupDigest, Type: TypeString, Description: "Sender address of digest emails."},
+
+	{Key: "SUBDOMAIN_WEBHOOK_URL", Group: GroupWebhooks, Type: TypeString, Secret: true, Validate: validWebhookURL, Description: "URL new subdomains are POSTed to as JSON while scans save them, instead of only at the end of a scan. Empty disables the webhook."},
+	{Key: "SUBDOMAIN_WEBHOOK_DELAY_SECONDS", Group: GroupWebhooks, Type: TypeInt, Validate: intRange(0, 3600), Default: "10", Description: "Seconds new subdomains are collected into one request after the first is found. 0 sends every save right away."},
+	{Key: "SUBDOMAIN_WEBHOOK_MAX_BATCH", Group: GroupWebhooks, Type: TypeInt, Validate: intRange(1, 1000), Default: "100", Description: "Subdomains per webhook request. A full batch is sent without waiting for the delay."},
+}
+
+// SubfinderKeys returns the settings keys of the subfinder API key sources: source -> primary key
+// (key, ID, username or email) and, for multi-key sources, source -> secondary key.
+func SubfinderKeys() (primary map[string]string, secondary map[string]string) {
+	primary, secondary = make(map[string]string), make(map[string]string)
+	for _, setting := range Settings {
+		if setting.Source == "" {
+			continue
+		}
+		if setting.Secondary {
+			secondary[setting.Source] = setting.Key
+		} else {
+			primary[setting.Source] = setting.Key
+		}
+	}
+	return primary, secondary
+}
+
+// Lookup returns the catalog entry of a settings key.
+func Lookup(key string) (Setting, bool) {
+	for _, setting := range Settings {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Check validates a value for the setting. Empty values mean "unset" and are always valid.
+func (s Setting) Check(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	switch s.Type {
+	case TypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+	case TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+	}
+	if s.Validate != nil {
+		return s.Validate(value)
+	}
+	return nil
+}
+
+// ValidateSettings checks settings about to be saved and returns an error message per invalid key.
+// Keys missing from the catalog are reported unless allowUnknown is set, with the known keys they
+// most likely meant (e.g. SHODAN_KEY -> SHODAN_API_KEY).
+func ValidateSettings(values map[string]string, allowUnknown bool) map[string]string {
+	errs := make(map[string]string)
+	for key, value := range values {
+		setting, known := Lookup(key)
+		if !known {
+			if !allowUnknown {
+				errs[key] = unknownKeyMessage(key)
+			}
+			continue
+		}
+		if err := setting.Check(value); err != nil {
+			errs[key] = err.Error()
+		}
+	}
+	return errs
+}
+
+// unknownKeyMessage explains an unknown key, suggesting known keys with the same first word.
+func unknownKeyMessage(key string) string {
+	prefix, _, _ := strings.Cut(strings.ToUpper(strings.TrimSpace(key)), "_")
+	var suggestions []string
+	for _, setting := range Settings {
+		if settingPrefix, _, _ := strings.Cut(setting.Key, "_"); prefix != "" && settingPrefix == prefix {
+			suggestions = append(suggestions, setting.Key)
+		}
+	}
+	if len(suggestions) == 0 {
+		return "unknown setting"
+	}
+	sort.Strings(suggestions)
+	return fmt.Sprintf("unknown setting, did you mean %s?", strings.Join(suggestions, " or "))
+}
+
+// intRange returns a validator for integers between min and max inclusive; max 0 means no upper bound.
+func intRange(min, max int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		if n < min || (max > 0 && n > max) {
+			if max > 0 {
+				return fmt.Errorf("must be between %d and %d", min, max)
+			}
+			return fmt.Errorf("must be at least %d", min)
+		}
+		return nil
+	}
+}
+
+// oneOf returns a validator accepting the given values, case-insensitively.
+func oneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, candidate := range allowed {
+			if strings.EqualFold(value, candidate) {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// validHost accepts an IP address or hostname to bind to.
+func validHost(value string) error {
+	if net.ParseIP(value) != nil {
+		return nil
+	}
+	if strings.ContainsAny(value, " /:") {
+		return fmt.Errorf("must be an IP address or hostname")
+	}
+	return nil
+}
+
+// validWebhookURL accepts an absolute http or https URL.
+func validWebhookURL(value string) error {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	return nil
+}
+
+// validHostSuffixList accepts comma-separated hostname suffixes, optionally with a leading "*." or ".".
+func validHostSuffixList(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		suffix := strings.Trim(strings.TrimPrefix(strings.TrimSpace(entry), "*"), ".")
+		if suffix == "" {
+			continue
+		}
+		if strings.ContainsAny(suffix, " /:*") || strings.Contains(suffix, "..") {
+			return fmt.Errorf("invalid entry '%s', use hostname suffixes like local or internal.example.com", strings.TrimSpace(entry))
+		}
+	}
+	return nil
+}
+
+// validExtensionList accepts "none" or comma-separated file extensions with or without their dot.
+func validExtensionList(value string) error {
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		ext := strings.TrimPrefix(strings.TrimSpace(entry), ".")
+		if strings.ContainsAny(ext, " ./\\?#;") {
+			return fmt.Errorf("invalid entry '%s', use extensions like pdf or .zip", strings.TrimSpace(entry))
+		}
+	}
+	return nil
+}
+
+// validMediaTypeList accepts comma-separated media types like text/html, without parameters.
+func validMediaTypeList(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if typ, subtype, ok := strings.Cut(entry, "/"); !ok || typ == "" || subtype == "" || strings.ContainsAny(entry, " ;*") || strings.Count(entry, "/") > 1 {
+			return fmt.Errorf("invalid entry '%s', use media types like text/html", entry)
+		}
+	}
+	return nil
+}
+
+// validStatusCodeList accepts comma-separated 2xx/3xx status codes (200-399) or the classes 2xx and 3xx,
+// the responses URL scans save as endpoints and can therefore capture.
+func validStatusCodeList(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "2xx" || entry == "3xx" {
+			continue
+		}
+		if code, err := strconv.Atoi(entry); err != nil || code < 200 || code > 399 {
+			return fmt.Errorf("invalid entry '%s', use 2xx/3xx status codes or classes like 200,3xx", entry)
+		}
+	}
+	return nil
+}
@@ -2,9 +2,13 @@ package database
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"rewrite-go/config"
 	"rewrite-go/models" // Import the models package
+	"strings"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -20,14 +24,15 @@ func ConnectDatabase() {
 	// This path assumes the executable is run from within the 'new' directory.
 	dbPath := "./asm_go.db" // Path relative to the 'new' directory
 
-	// Configure GORM logger (optional, similar to echo=True)
+	// Configure GORM logger from LOG_LEVEL (Info logs every SQL statement, similar to echo=True)
+	logLevel := gormLogLevel(config.LogLevel())
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
 		logger.Config{
-			SlowThreshold:             0,           // Log all SQL
-			LogLevel:                  logger.Info, // LogLevel
-			IgnoreRecordNotFoundError: true,        // Ignore ErrRecordNotFound error for logger
-			Colorful:                  true,        // Disable color
+			SlowThreshold:             200 * time.Millisecond, // Report slow queries at Warn level and above
+			LogLevel:                  logLevel,               // LogLevel
+			IgnoreRecordNotFoundError: true,                   // Ignore ErrRecordNotFound error for logger
+			Colorful:                  true,                   // Disable color
 		},
 	)
 
@@ -42,12 +47,27 @@ func ConnectDatabase() {
 	log.Println("Database connection successfully opened")
 }
 
+// gormLogLevel maps a LOG_LEVEL value (see config.LogLevel) to a GORM logger level.
+func gormLogLevel(level string) logger.LogLevel {
+	switch level {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "info":
+		return logger.Info
+	default:
+		return logger.Warn
+	}
+}
+
 // MigrateDatabase runs GORM's auto-migration feature.
 func MigrateDatabase() {
 	if DB == nil {
-		log.Fatal("Database connection is not initialized. Call ConnectDatabase first.")
+		log.Fatal("Error: Database connection is not initialized. Call ConnectDatabase first.")
 	}
 	log.Println("Running database migrations...")
+	dedupeEndpointTechnologies(DB)
 	// GORM needs pointers to the structs for migration
 	err := DB.AutoMigrate(
 		&models.Organization{},
@@ -62,6 +82,16 @@ func MigrateDatabase() {
 		&models.Scan{},
 		&models.ScanTemplate{},
 		&models.Screenshot{}, // Add the new Screenshot model
+		&models.DigestRun{},
+		&models.Session{},
+		&models.ExternalLink{},
+		&models.EndpointStatusHistory{},
+		&models.TagRule{},
+		&models.SubdomainTag{},
+		&models.TLSCheck{},
+		&models.SensitiveFile{},
+		&models.ScopeRule{},
+		&models.TechFingerprint{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
@@ -72,9 +102,109 @@ func MigrateDatabase() {
 	seedDefaultScanTemplates(DB)
 }
 
-// seedDefaultScanTemplates inserts default scan templates if they don't exist.
+// dedupeEndpointTechnologies removes the duplicate endpoint/technology links rescans used to append, keeping
+// the latest of each pair, so the unique index on the pair can be created.
+func dedupeEndpointTechnologies(db *gorm.DB) {
+	if !db.Migrator().HasTable(&models.EndpointTechnology{}) || db.Migrator().HasIndex(&models.EndpointTechnology{}, "idx_endpoint_technology") {
+		return
+	}
+	result := db.Exec("DELETE FROM endpoint_technologies WHERE rowid NOT IN (SELECT MAX(rowid) FROM endpoint_technologies GROUP BY endpoint_id, technology_id)")
+	if result.Error != nil {
+		log.Fatal("Failed to remove duplicate endpoint technologies:", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d duplicate endpoint technology links.", result.RowsAffected)
+	}
+}
+
+// seedTemplate is a scan template in a SEED_TEMPLATES_FILE. Sections use the same structure as the scan template API.
+type seedTemplate struct {
+	Name                 string                    `json:"name"`
+	Description          string                    `json:"description"`
+	SubdomainScanConfig  *models.ScanSectionConfig `json:"subdomain_scan_config"`
+	URLScanConfig        *models.ScanSectionConfig `json:"url_scan_config"`
+	ParameterScanConfig  *models.ScanSectionConfig `json:"parameter_scan_config"`
+	TechDetectEnabled    bool                      `json:"tech_detect_enabled"`
+	ScreenshotEnabled    bool                      `json:"screenshot_enabled"`
+	ScreenshotTargetOnly bool                      `json:"screenshot_target_only"`
+	ScreenshotCriteria   []string                  `json:"screenshot_criteria"`
+	ScreenshotRetry      bool                      `json:"screenshot_retry"`
+	ScreenshotPaths      []string                  `json:"screenshot_paths"`
+	ScreenshotMobile     bool                      `json:"screenshot_mobile"`
+	TechDetectNewOnly    bool                      `json:"tech_detect_new_only"`
+	HostRequestDelayMs   int                       `json:"host_request_delay_ms"`
+}
+
+// loadSeedTemplates reads the templates to seed from a JSON file holding an array of seedTemplate.
+// Sections left out are disabled.
+func loadSeedTemplates(path string) ([]models.ScanTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []seedTemplate
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	sectionJSON := func(section *models.ScanSectionConfig) string {
+		if section == nil {
+			section = &models.ScanSectionConfig{Enabled: false, Tools: map[string]models.ScanToolConfig{}}
+		}
+		encoded, _ := json.Marshal(section)
+		return string(encoded)
+	}
+
+	templates := make([]models.ScanTemplate, 0, len(entries))
+	for i, entry := range entries {
+		name := strings.TrimSpace(entry.Name)
+		if name == "" {
+			return nil, fmt.Errorf("template %d has no name", i+1)
+		}
+		templates = append(templates, models.ScanTemplate{
+			Name:                 name,
+			Description:          entry.Description,
+			SubdomainScanConfig:  sectionJSON(entry.SubdomainScanConfig),
+			URLScanConfig:        sectionJSON(entry.URLScanConfig),
+			ParameterScanConfig:  sectionJSON(entry.ParameterScanConfig),
+			TechDetectEnabled:    entry.TechDetectEnabled,
+			ScreenshotEnabled:    entry.ScreenshotEnabled,
+			ScreenshotTargetOnly: entry.ScreenshotTargetOnly,
+			ScreenshotCriteria:   strings.Join(entry.ScreenshotCriteria, ","),
+			ScreenshotRetry:      entry.ScreenshotRetry,
+			ScreenshotPaths:      strings.Join(entry.ScreenshotPaths, ","),
+			ScreenshotMobile:     entry.ScreenshotMobile,
+			TechDetectNewOnly:    entry.TechDetectNewOnly,
+			HostRequestDelayMs:   entry.HostRequestDelayMs,
+		})
+	}
+	return templates, nil
+}
+
+// seedDefaultScanTemplates inserts the default scan templates if they don't exist. Seeding is skipped with
+// SEED_DEFAULT_TEMPLATES=false, and SEED_TEMPLATES_FILE replaces the built-in templates with those of a
+// JSON file (see loadSeedTemplates). Existing templates with the same name are never overwritten.
 func seedDefaultScanTemplates(db *gorm.DB) {
+	if !config.GetBool("SEED_DEFAULT_TEMPLATES", true) {
+		log.Println("Seeding of default scan templates is disabled (SEED_DEFAULT_TEMPLATES=false).")
+		return
+	}
+	if path := strings.TrimSpace(config.Get("SEED_TEMPLATES_FILE")); path != "" {
+		templates, err := loadSeedTemplates(path)
+		if err != nil {
+			log.Printf("Warning: Failed to load seed templates from '%s', using the built-in defaults: %v", path, err)
+		} else {
+			log.Printf("Seeding %d scan templates from %s...", len(templates), path)
+			createSeedTemplates(db, templates)
+			return
+		}
+	}
 	log.Println("Seeding default scan templates...")
+	createSeedTemplates(db, builtInScanTemplates())
+}
+
+// builtInScanTemplates returns the scan templates seeded when no SEED_TEMPLATES_FILE is configured.
+func builtInScanTemplates() []models.ScanTemplate {
 
 	// --- Define Default Configurations using the nested structure ---
 
@@ -158,6 +288,11 @@ func seedDefaultScanTemplates(db *gorm.DB) {
 		},
 	}
 
+	return templates
+}
+
+// createSeedTemplates creates the templates whose name is not taken yet.
+func createSeedTemplates(db *gorm.DB, templates []models.ScanTemplate) {
 	for _, tmpl := range templates {
 		// Check if a template with the same name already exists
 		var existing models.ScanTemplate
@@ -167,26 +302,26 @@ func seedDefaultScanTemplates(db *gorm.DB) {
 			if result.Error == gorm.ErrRecordNotFound {
 				// Template doesn't exist, create it
 				if err := db.Create(&tmpl).Error; err != nil {
-					log.Printf("Failed to create default template '%s': %v\n", tmpl.Name, err)
+					log.Printf("Failed to create seed template '%s': %v\n", tmpl.Name, err)
 				} else {
-					log.Printf("Created default template: '%s'\n", tmpl.Name)
+					log.Printf("Created seed template: '%s'\n", tmpl.Name)
 				}
 			} else {
 				// Other database error
 				log.Printf("Error checking for template '%s': %v\n", tmpl.Name, result.Error)
 			}
 		} else {
-			log.Printf("Default template '%s' already exists, skipping.\n", tmpl.Name)
+			log.Printf("Seed template '%s' already exists, skipping.\n", tmpl.Name)
 		}
 	}
-	log.Println("Finished seeding default scan templates.")
+	log.Println("Finished seeding scan templates.")
 }
 
 // GetDB returns the initialized GORM DB instance.
 // In a real app, you might manage sessions differently (e.g., per request).
 func GetDB() *gorm.DB {
 	if DB == nil {
-		log.Fatal("Database connection is not initialized.")
+		log.Fatal("Error: Database connection is not initialized.")
 	}
 	return DB
 }
@@ -0,0 +1,299 @@
+// Package digest assembles "what changed" digests across all monitored root domains and sends them by
+// email, on demand or on the DIGEST_INTERVAL_HOURS schedule.
+package digest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxItemsPerSection limits how many entries of each section the email lists per root domain; the
+// digest itself (and the preview API) always has all of them.
+const maxItemsPerSection = 50
+
+// Digest holds the changes of all root domains in a period.
+type Digest struct {
+	Since   time.Time       `json:"since"`
+	Until   time.Time       `json:"until"`
+	Totals  Totals          `json:"totals"`
+	Domains []DomainChanges `json:"domains"` // Only root domains with changes, by organization and domain name
+}
+
+// Totals counts the changes of a digest.
+type Totals struct {
+	NewSubdomains    int `json:"new_subdomains"`
+	NewEndpoints     int `json:"new_endpoints"`
+	ChangedEndpoints int `json:"changed_endpoints"`
+	NewTechnologies  int `json:"new_technologies"`
+}
+
+// Changes returns the number of changes.
+func (t Totals) Changes() int {
+	return t.NewSubdomains + t.NewEndpoints + t.ChangedEndpoints + t.NewTechnologies
+}
+
+// DomainChanges holds the changes of one root domain.
+type DomainChanges struct {
+	RootDomainID     uint               `json:"root_domain_id"`
+	Domain           string             `json:"domain"`
+	Organization     string             `json:"organization"`
+	NewSubdomains    []SubdomainChange  `json:"new_subdomains"`
+	NewEndpoints     []EndpointChange   `json:"new_endpoints"`
+	ChangedEndpoints []EndpointChange   `json:"changed_endpoints"` // Existing endpoints answering with a different status code or content type
+	NewTechnologies  []TechnologyChange `json:"new_technologies"`  // Technologies detected on a subdomain for the first time
+}
+
+// SubdomainChange is a subdomain discovered in the period.
+type SubdomainChange struct {
+	SubdomainID  uint      `json:"subdomain_id"`
+	Hostname     string    `json:"hostname"`
+	IsActive     bool      `json:"is_active"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
+// EndpointChange is an endpoint discovered or changed in the period.
+type EndpointChange struct {
+	EndpointID  uint      `json:"endpoint_id"`
+	Hostname    string    `json:"hostname"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	At          time.Time `json:"at"` // Discovered or changed
+}
+
+// TechnologyChange is a technology first detected on a subdomain in the period.
+type TechnologyChange struct {
+	SubdomainID  uint      `json:"subdomain_id"`
+	Hostname     string    `json:"hostname"`
+	TechnologyID uint      `json:"technology_id"`
+	Technology   string    `json:"technology"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+// Build assembles the changes in (since, until]. Changes are found from the timestamps scans keep on each
+// asset: discovered_at of subdomains and endpoints, changed_at of endpoints and detected_at of technologies.
+func Build(db *gorm.DB, since, until time.Time) (*Digest, error) {
+	digest := &Digest{Since: since, Until: until, Domains: []DomainChanges{}}
+	domains := make(map[uint]*DomainChanges)
+	domainOf := func(rootDomainID uint) *DomainChanges {
+		if d, ok := domains[rootDomainID]; ok {
+			return d
+		}
+		d := &DomainChanges{
+			RootDomainID:     rootDomainID,
+			NewSubdomains:    []SubdomainChange{},
+			NewEndpoints:     []EndpointChange{},
+			ChangedEndpoints: []EndpointChange{},
+			NewTechnologies:  []TechnologyChange{},
+		}
+		domains[rootDomainID] = d
+		return d
+	}
+
+	var subdomains []struct {
+		SubdomainChange
+		RootDomainID uint
+	}
+	if err := db.Table("subdomains").
+		Select("id AS subdomain_id, hostname, is_active, discovered_at, root_domain_id").
+		Where("discovered_at > ? AND discovered_at <= ?", since, until).
+		Order("hostname").Scan(&subdomains).Error; err != nil {
+		return nil, fmt.Errorf("failed to query new subdomains: %w", err)
+	}
+	for _, sub := range subdomains {
+		d := domainOf(sub.RootDomainID)
+		d.NewSubdomains = append(d.NewSubdomains, sub.SubdomainChange)
+	}
+
+	type endpointRow struct {
+		EndpointChange
+		RootDomainID uint
+	}
+	var newEndpoints []endpointRow
+	if err := db.Table("endpoints e").
+		Select("e.id AS endpoint_id, s.hostname, e.method, e.path, e.status_code, e.content_type, e.discovered_at AS at, s.root_domain_id").
+		Joins("JOIN subdomains s ON s.id = e.subdomain_id").
+		Where("e.discovered_at > ? AND e.discovered_at <= ?", since, until).
+		Order("s.hostname, e.path, e.method").Scan(&newEndpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to query new endpoints: %w", err)
+	}
+	for _, ep := range newEndpoints {
+		d := domainOf(ep.RootDomainID)
+		d.NewEndpoints = append(d.NewEndpoints, ep.EndpointChange)
+	}
+
+	// Endpoints discovered in the period are reported as new only, even if a later scan changed them
+	var changedEndpoints []endpointRow
+	if err := db.Table("endpoints e").
+		Select("e.id AS endpoint_id, s.hostname, e.method, e.path, e.status_code, e.content_type, e.changed_at AS at, s.root_domain_id").
+		Joins("JOIN subdomains s ON s.id = e.subdomain_id").
+		Where("e.changed_at > ? AND e.changed_at <= ? AND e.discovered_at <= ?", since, until, since).
+		Order("s.hostname, e.path, e.method").Scan(&changedEndpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to query changed endpoints: %w", err)
+	}
+	for _, ep := range changedEndpoints {
+		d := domainOf(ep.RootDomainID)
+		d.ChangedEndpoints = append(d.ChangedEndpoints, ep.EndpointChange)
+	}
+
+	// A technology is new to a subdomain if it was not detected there before the period. Repeated
+	// detections within the period are reported once, at the first.
+	var technologies []struct {
+		TechnologyChange
+		RootDomainID uint
+	}
+	if err := db.Raw(`SELECT st.subdomain_id, s.hostname, st.technology_id, t.name AS technology, st.detected_at, s.root_domain_id
+		FROM subdomain_technologies st
+		JOIN subdomains s ON s.id = st.subdomain_id
+		JOIN technologies t ON t.id = st.technology_id
+		WHERE st.detected_at > @since AND st.detected_at <= @until
+			AND NOT EXISTS (SELECT 1 FROM subdomain_technologies prev
+				WHERE prev.subdomain_id = st.subdomain_id AND prev.technology_id = st.technology_id AND prev.detected_at <= @since)
+		ORDER BY s.hostname, t.name, st.detected_at`,
+		map[string]interface{}{"since": since, "until": until}).Scan(&technologies).Error; err != nil {
+		return nil, fmt.Errorf("failed to query new technologies: %w", err)
+	}
+	type subdomainTech struct{ subdomainID, technologyID uint }
+	seenTechs := make(map[subdomainTech]bool)
+	for _, tech := range technologies {
+		key := subdomainTech{tech.SubdomainID, tech.TechnologyID}
+		if seenTechs[key] {
+			continue
+		}
+		seenTechs[key] = true
+		d := domainOf(tech.RootDomainID)
+		d.NewTechnologies = append(d.NewTechnologies, tech.TechnologyChange)
+	}
+
+	if len(domains) == 0 {
+		return digest, nil
+	}
+
+	ids := make([]uint, 0, len(domains))
+	for id := range domains {
+		ids = append(ids, id)
+	}
+	var names []struct {
+		ID           uint
+		Domain       string
+		Organization string
+	}
+	if err := db.Table("root_domains rd").
+		Select("rd.id, rd.domain, o.name AS organization").
+		Joins("LEFT JOIN organizations o ON o.id = rd.organization_id").
+		Where("rd.id IN ?", ids).Scan(&names).Error; err != nil {
+		return nil, fmt.Errorf("failed to query root domains: %w", err)
+	}
+	for _, name := range names {
+		domains[name.ID].Domain = name.Domain
+		domains[name.ID].Organization = name.Organization
+	}
+
+	for _, d := range domains {
+		digest.Totals.NewSubdomains += len(d.NewSubdomains)
+		digest.Totals.NewEndpoints += len(d.NewEndpoints)
+		digest.Totals.ChangedEndpoints += len(d.ChangedEndpoints)
+		digest.Totals.NewTechnologies += len(d.NewTechnologies)
+		digest.Domains = append(digest.Domains, *d)
+	}
+	sort.Slice(digest.Domains, func(i, k int) bool {
+		a, b := digest.Domains[i], digest.Domains[k]
+		if a.Organization != b.Organization {
+			return a.Organization < b.Organization
+		}
+		return a.Domain < b.Domain
+	})
+	return digest, nil
+}
+
+// Subject returns the email subject of the digest.
+func (d *Digest) Subject() string {
+	return fmt.Sprintf("kasm digest: %d changes across %d domains (%s)", d.Totals.Changes(), len(d.Domains), d.Until.Format("2006-01-02"))
+}
+
+// Text renders the digest as the plain-text email body.
+func (d *Digest) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Changes from %s to %s\n\n", d.Since.UTC().Format(time.RFC1123), d.Until.UTC().Format(time.RFC1123))
+	fmt.Fprintf(&b, "New subdomains:     %d\n", d.Totals.NewSubdomains)
+	fmt.Fprintf(&b, "New endpoints:      %d\n", d.Totals.NewEndpoints)
+	fmt.Fprintf(&b, "Changed endpoints:  %d\n", d.Totals.ChangedEndpoints)
+	fmt.Fprintf(&b, "New technologies:   %d\n", d.Totals.NewTechnologies)
+	if len(d.Domains) == 0 {
+		b.WriteString("\nNothing changed.\n")
+		return b.String()
+	}
+
+	for _, domain := range d.Domains {
+		title := domain.Domain
+		if domain.Organization != "" {
+			title = fmt.Sprintf("%s (%s)", domain.Domain, domain.Organization)
+		}
+		fmt.Fprintf(&b, "\n== %s ==\n", title)
+
+		var lines []string
+		for _, sub := range domain.NewSubdomains {
+			line := sub.Hostname
+			if !sub.IsActive {
+				line += " (inactive)"
+			}
+			lines = append(lines, line)
+		}
+		writeSection(&b, "New subdomains", lines)
+
+		lines = lines[:0]
+		for _, ep := range domain.NewEndpoints {
+			lines = append(lines, endpointLine(ep))
+		}
+		writeSection(&b, "New endpoints", lines)
+
+		lines = lines[:0]
+		for _, ep := range domain.ChangedEndpoints {
+			lines = append(lines, endpointLine(ep))
+		}
+		writeSection(&b, "Changed endpoints", lines)
+
+		lines = lines[:0]
+		for _, tech := range domain.NewTechnologies {
+			lines = append(lines, fmt.Sprintf("%s on %s", tech.Technology, tech.Hostname))
+		}
+		writeSection(&b, "New technologies", lines)
+	}
+	return b.String()
+}
+
+// writeSection writes a titled list, truncated to maxItemsPerSection entries. Empty sections are left out.
+func writeSection(b *strings.Builder, title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s (%d):\n", title, len(lines))
+	for i, line := range lines {
+		if i == maxItemsPerSection {
+			fmt.Fprintf(b, "  ... and %d more\n", len(lines)-maxItemsPerSection)
+			break
+		}
+		fmt.Fprintf(b, "  - %s\n", line)
+	}
+}
+
+// endpointLine formats an endpoint as "GET host/path [200 text/html]".
+func endpointLine(ep EndpointChange) string {
+	line := fmt.Sprintf("%s %s%s", ep.Method, ep.Hostname, ep.Path)
+	var details []string
+	if ep.StatusCode != 0 {
+		details = append(details, fmt.Sprint(ep.StatusCode))
+	}
+	if ep.ContentType != "" {
+		details = append(details, ep.ContentType)
+	}
+	if len(details) > 0 {
+		line += " [" + strings.Join(details, " ") + "]"
+	}
+	return line
+}
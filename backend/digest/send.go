@@ -0,0 +1,235 @@
+package digest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"rewrite-go/config"
+	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Digest run statuses (models.DigestRun.Status)
+const (
+	StatusSent   = "sent"
+	StatusEmpty  = "empty"
+	StatusFailed = "failed"
+)
+
+const (
+	defaultSMTPPort        = 587
+	smtpTimeout            = 30 * time.Second
+	schedulerCheckInterval = 5 * time.Minute
+	firstDigestPeriod      = 24 * time.Hour // Period of the first digest when no run is recorded and no schedule is set
+)
+
+var (
+	ErrNotConfigured  = errors.New("email digests are not configured, set SMTP_HOST, SMTP_FROM and DIGEST_RECIPIENTS")
+	ErrAlreadyRunning = errors.New("a digest is already being sent")
+	ErrSendFailed     = errors.New("failed to send digest email")
+)
+
+// runMu serializes digest runs, so a manual run and the scheduler never send the same period twice.
+var runMu sync.Mutex
+
+// Recipients returns the DIGEST_RECIPIENTS addresses.
+func Recipients() []string {
+	var recipients []string
+	for _, address := range strings.Split(config.Get("DIGEST_RECIPIENTS"), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	return recipients
+}
+
+// Configured reports whether the SMTP server, sender and recipients are set.
+func Configured() bool {
+	return strings.TrimSpace(config.Get("SMTP_HOST")) != "" && strings.TrimSpace(config.Get("SMTP_FROM")) != "" && len(Recipients()) > 0
+}
+
+// LastPeriodEnd returns the end of the last digest run that did not fail, or false if there is none.
+func LastPeriodEnd(db *gorm.DB) (time.Time, bool, error) {
+	var run models.DigestRun
+	err := db.Where("status <> ?", StatusFailed).Order("period_end desc").First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return run.PeriodEnd, true, nil
+}
+
+// DefaultSince returns the start of the next digest: the end of the last successful run, or one schedule
+// interval (a day if unscheduled) ago for the first digest.
+func DefaultSince(db *gorm.DB, now time.Time) (time.Time, error) {
+	last, ok, err := LastPeriodEnd(db)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query digest runs: %w", err)
+	}
+	if ok {
+		return last, nil
+	}
+	if hours := config.GetInt("DIGEST_INTERVAL_HOURS", 0); hours > 0 {
+		return now.Add(-time.Duration(hours) * time.Hour), nil
+	}
+	return now.Add(-firstDigestPeriod), nil
+}
+
+// Run builds the digest of the changes since the last successful run and emails it to the recipients.
+// Empty digests are only sent if DIGEST_SEND_EMPTY is set. Every run is recorded; a failed run is
+// retried over the same period by the next one.
+func Run() (*models.DigestRun, error) {
+	if !Configured() {
+		return nil, ErrNotConfigured
+	}
+	if !runMu.TryLock() {
+		return nil, ErrAlreadyRunning
+	}
+	defer runMu.Unlock()
+
+	db := database.GetDB()
+	until := time.Now()
+	since, err := DefaultSince(db, until)
+	if err != nil {
+		return nil, err
+	}
+
+	job := jobs.Start(jobs.TypeMaintenance, "Send change digest", nil)
+	run := &models.DigestRun{PeriodStart: since, PeriodEnd: until, Recipients: strings.Join(Recipients(), ",")}
+	digest, err := Build(db, since, until)
+	if err == nil {
+		run.Changes = digest.Totals.Changes()
+		if run.Changes == 0 && !config.GetBool("DIGEST_SEND_EMPTY", false) {
+			run.Status = StatusEmpty
+		} else {
+			job.SetPhase("sending email")
+			if sendErr := sendMail(Recipients(), digest.Subject(), digest.Text()); sendErr != nil {
+				err = fmt.Errorf("%w: %v", ErrSendFailed, sendErr)
+			}
+		}
+	}
+	if err != nil {
+		run.Status = StatusFailed
+		run.Error = err.Error()
+	} else if run.Status == "" {
+		run.Status = StatusSent
+	}
+	job.Finish(err)
+
+	if saveErr := db.Create(run).Error; saveErr != nil {
+		return nil, fmt.Errorf("failed to record digest run: %w", saveErr)
+	}
+	if err != nil {
+		log.Printf("Digest for %s - %s failed: %v", since.Format(time.RFC3339), until.Format(time.RFC3339), err)
+		return run, err
+	}
+	log.Printf("Digest for %s - %s: %d changes, %s.", since.Format(time.RFC3339), until.Format(time.RFC3339), run.Changes, run.Status)
+	return run, nil
+}
+
+// StartScheduler runs digests every DIGEST_INTERVAL_HOURS hours until ctx is done. The setting is re-read
+// on every check, so scheduling can be enabled or changed (0 disables it) without a restart. After a
+// failed run the next attempt waits a full interval as well.
+func StartScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(schedulerCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			hours := config.GetInt("DIGEST_INTERVAL_HOURS", 0)
+			if hours <= 0 || !Configured() {
+				continue
+			}
+			var last models.DigestRun
+			err := database.GetDB().Order("created_at desc").First(&last).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Digest scheduler: failed to query digest runs: %v", err)
+				continue
+			}
+			if err == nil && time.Since(last.CreatedAt) < time.Duration(hours)*time.Hour {
+				continue
+			}
+			if _, err := Run(); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+				log.Printf("Digest scheduler: %v", err)
+			}
+		}
+	}()
+}
+
+// sendMail sends a plain-text email through the configured SMTP server. Port 465 uses implicit TLS,
+// other ports upgrade with STARTTLS when the server offers it. SMTP_USERNAME enables PLAIN authentication.
+func sendMail(recipients []string, subject, body string) error {
+	host := strings.TrimSpace(config.Get("SMTP_HOST"))
+	port := config.GetInt("SMTP_PORT", defaultSMTPPort)
+	from := strings.TrimSpace(config.Get("SMTP_FROM"))
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+	if port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake with %s failed: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %w", addr, err)
+		}
+	}
+	if username := config.Get("SMTP_USERNAME"); username != "" {
+		if err := client.Auth(smtp.PlainAuth("", username, config.Get("SMTP_PASSWORD"), host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("SMTP server rejected sender %s: %w", from, err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP server rejected recipient %s: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n",
+		from, strings.Join(recipients, ", "), subject, time.Now().Format(time.RFC1123Z))
+	if _, err := w.Write([]byte(header + strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return fmt.Errorf("failed to write digest email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected digest email: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Activity event types (ActivityEvent.Type)
+const (
+	ActivityScanStarted         = "scan_started"
+	ActivityScanFinished        = "scan_finished"               // Completed, failed or cancelled, see Status
+	ActivityScanCancelledEarly  = "scan_cancelled_before_start" // Cancelled while pending, so never started
+	ActivityDomainAdded         = "domain_added"
+	ActivitySubdomainDiscovered = "subdomain_discovered"
+	ActivityImportStarted       = "import_started"
+	ActivityImportFinished      = "import_finished"
+)
+
+// ActivityEvent is one entry of the activity feed. Only the IDs relevant to the event are set.
+type ActivityEvent struct {
+	Type         string    `json:"type"`
+	At           time.Time `json:"at"`
+	Summary      string    `json:"summary"`
+	Status       string    `json:"status,omitempty"` // Scan or import status
+	ScanID       *uint     `json:"scan_id,omitempty"`
+	RootDomainID *uint     `json:"root_domain_id,omitempty"`
+	SubdomainID  *uint     `json:"subdomain_id,omitempty"`
+	JobID        string    `json:"job_id,omitempty"`
+}
+
+// ActivityResponse is the merged activity feed, newest first.
+type ActivityResponse struct {
+	Events []ActivityEvent `json:"events"`
+}
+
+// GetActivity handles GET requests for the recent activity feed across the instance: scans started and
+// finished (or cancelled before they started), root domains added, subdomains discovered and imports run, newest first, up to limit
+// (default 50, max 500). Imports are only tracked in memory, so only recent imports of this process appear.
+func GetActivity(c *gin.Context) {
+	limit, ok := parseIntQuery(c, "limit", 50, 1, 500)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+
+	// Each source contributes at most limit events, so the merged feed is exact after truncation
+	var events []ActivityEvent
+
+	var startedScans []models.Scan
+	if err := db.Preload("RootDomain").Preload("Subdomain").
+		Where("status <> ? AND NOT (status = ? AND results_summary = ?)", "pending", "cancelled", scanner.ScanCancelledBeforeStartSummary).
+		Order("started_at desc").Limit(limit).Find(&startedScans).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve scans", err.Error())
+		return
+	}
+	for _, scan := range startedScans {
+		events = append(events, scanActivity(ActivityScanStarted, scan.StartedAt, scan,
+			fmt.Sprintf("%s scan of %s started", scan.ScanType, scanTargetHost(&scan))))
+	}
+
+	var finishedScans []models.Scan
+	if err := db.Preload("RootDomain").Preload("Subdomain").
+		Where("completed_at IS NOT NULL").Order("completed_at desc").Limit(limit).Find(&finishedScans).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve scans", err.Error())
+		return
+	}
+	for _, scan := range finishedScans {
+		if scan.Status == "cancelled" && scan.ResultsSummary == scanner.ScanCancelledBeforeStartSummary {
+			events = append(events, scanActivity(ActivityScanCancelledEarly, *scan.CompletedAt, scan,
+				fmt.Sprintf("%s scan of %s cancelled before it started", scan.ScanType, scanTargetHost(&scan))))
+			continue
+		}
+		events = append(events, scanActivity(ActivityScanFinished, *scan.CompletedAt, scan,
+			fmt.Sprintf("%s scan of %s %s", scan.ScanType, scanTargetHost(&scan), scan.Status)))
+	}
+
+	var domains []models.RootDomain
+	if err := db.Order("created_at desc").Limit(limit).Find(&domains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve domains", err.Error())
+		return
+	}
+	for _, domain := range domains {
+		domainID := domain.ID
+		events = append(events, ActivityEvent{
+			Type:         ActivityDomainAdded,
+			At:           domain.CreatedAt,
+			Summary:      fmt.Sprintf("Root domain %s added", domain.Domain),
+			RootDomainID: &domainID,
+		})
+	}
+
+	var subdomains []models.Subdomain
+	if err := db.Order("discovered_at desc").Limit(limit).Find(&subdomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains", err.Error())
+		return
+	}
+	for _, sub := range subdomains {
+		subdomainID, domainID := sub.ID, sub.RootDomainID
+		events = append(events, ActivityEvent{
+			Type:         ActivitySubdomainDiscovered,
+			At:           sub.DiscoveredAt,
+			Summary:      fmt.Sprintf("Subdomain %s discovered", sub.Hostname),
+			ScanID:       sub.ScanID,
+			RootDomainID: &domainID,
+			SubdomainID:  &subdomainID,
+		})
+	}
+
+	for _, job := range jobs.List() {
+		if job.Type != jobs.TypeImport {
+			continue
+		}
+		events = append(events, ActivityEvent{
+			Type:    ActivityImportStarted,
+			At:      job.StartedAt,
+			Summary: job.Description + " started",
+			Status:  job.Status,
+			JobID:   job.ID,
+		})
+		if job.FinishedAt != nil {
+			events = append(events, ActivityEvent{
+				Type:    ActivityImportFinished,
+				At:      *job.FinishedAt,
+				Summary: fmt.Sprintf("%s %s", job.Description, job.Status),
+				Status:  job.Status,
+				JobID:   job.ID,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, k int) bool { return events[i].At.After(events[k].At) })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	if events == nil {
+		events = []ActivityEvent{}
+	}
+
+	c.JSON(http.StatusOK, ActivityResponse{Events: events})
+}
+
+// scanActivity builds a scan event.
+func scanActivity(eventType string, at time.Time, scan models.Scan, summary string) ActivityEvent {
+	scanID, domainID := scan.ID, scan.RootDomainID
+	return ActivityEvent{
+		Type:         eventType,
+		At:           at,
+		Summary:      summary,
+		Status:       scan.Status,
+		ScanID:       &scanID,
+		RootDomainID: &domainID,
+		SubdomainID:  scan.SubdomainID,
+	}
+}
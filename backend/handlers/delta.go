@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- Response Structs ---
+
+// DeltaSubdomain is a subdomain discovered within a delta.
+type DeltaSubdomain struct {
+	ID           uint      `json:"id"`
+	RootDomainID uint      `json:"root_domain_id"`
+	Hostname     string    `json:"hostname"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	IsActive     bool      `json:"is_active"`
+	ScanID       *uint     `json:"scan_id,omitempty"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
+// DeltaEndpoint is an endpoint discovered within a delta.
+type DeltaEndpoint struct {
+	ID           uint      `json:"id"`
+	SubdomainID  uint      `json:"subdomain_id"`
+	Hostname     string    `json:"hostname"`
+	Path         string    `json:"path"`
+	Method       string    `json:"method"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ScanID       *uint     `json:"scan_id,omitempty"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
+// DeltaTechnology is a technology detected on a subdomain or endpoint within a delta. Exactly one of
+// SubdomainID and EndpointID is set.
+type DeltaTechnology struct {
+	TechnologyID uint      `json:"technology_id"`
+	Name         string    `json:"name"`
+	Category     string    `json:"category,omitempty"`
+	SubdomainID  *uint     `json:"subdomain_id,omitempty"`
+	EndpointID   *uint     `json:"endpoint_id,omitempty"`
+	Hostname     string    `json:"hostname"`
+	Confidence   *float64  `json:"confidence,omitempty"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+// DeltaResponse lists the assets of an organization discovered after Since, oldest first. If HasMore is
+// set, the next page is requested with since=NextSince.
+type DeltaResponse struct {
+	Since        time.Time         `json:"since"`
+	NextSince    time.Time         `json:"next_since"` // Time of the newest asset returned, or since if none was
+	HasMore      bool              `json:"has_more"`
+	Subdomains   []DeltaSubdomain  `json:"subdomains"`
+	Endpoints    []DeltaEndpoint   `json:"endpoints"`
+	Technologies []DeltaTechnology `json:"technologies"`
+}
+
+// deltaItem is an asset of any kind, for merging the kinds by time.
+type deltaItem struct {
+	at         time.Time
+	subdomain  *DeltaSubdomain
+	endpoint   *DeltaEndpoint
+	technology *DeltaTechnology
+}
+
+// --- Handler Functions ---
+
+// GetOrganizationDelta handles GET requests for the subdomains, endpoints and technology detections of an
+// organization discovered after since (RFC 3339, required), so that integrations can sync incrementally.
+// At most limit assets are returned (default 500, max 5000), oldest first. Times are compared as instants
+// at millisecond precision, whatever their offset. A page never ends partway through the assets sharing a
+// millisecond, so polling with next_since misses nothing; a single millisecond with more than limit assets
+// is returned whole.
+func GetOrganizationDelta(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("org_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
+		return
+	}
+	since, ok := parseTimeQuery(c, "since")
+	if !ok {
+		return
+	}
+	if since == nil {
+		RespondError(c, http.StatusBadRequest, "since is required")
+		return
+	}
+	limit, ok := parseIntQuery(c, "limit", 500, 1, 5000)
+	if !ok {
+		return
+	}
+	sinceUTC := since.UTC()
+	since = &sinceUTC
+
+	db := database.GetDB()
+	var organization models.Organization
+	if err := db.Select("id").First(&organization, uint(orgID)).Error; err != nil {
+		respondLookupError(c, err, "Organization not found", "Failed to retrieve organization")
+		return
+	}
+
+	// Each kind contributes its limit+1 oldest assets: any asset not fetched is no older than the
+	// (limit+1)th of the merged list, where the page is cut
+	items, err := fetchDeltaItems(db, organization.ID, func(q *gorm.DB, column string) *gorm.DB {
+		return q.Where(deltaAfter(column), *since).Order("julianday(" + column + ")").Limit(limit + 1)
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve delta", err.Error())
+		return
+	}
+
+	hasMore := len(items) > limit
+	if hasMore {
+		cut := items[limit].at.Round(time.Millisecond) // SQLite rounds julianday() to the millisecond
+		page := items[:0]
+		for _, item := range items {
+			if item.at.Round(time.Millisecond).Before(cut) {
+				page = append(page, item)
+			}
+		}
+		items = page
+		if len(items) == 0 {
+			// More than limit assets share the oldest millisecond, return all of them. Nothing is older.
+			items, err = fetchDeltaItems(db, organization.ID, func(q *gorm.DB, column string) *gorm.DB {
+				return q.Where(deltaAfter(column)+" AND julianday("+column+") <= julianday(?)", *since, cut)
+			})
+			if err != nil {
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve delta", err.Error())
+				return
+			}
+		}
+	}
+
+	response := DeltaResponse{
+		Since:        *since,
+		NextSince:    *since,
+		HasMore:      hasMore,
+		Subdomains:   []DeltaSubdomain{},
+		Endpoints:    []DeltaEndpoint{},
+		Technologies: []DeltaTechnology{},
+	}
+	for _, item := range items {
+		switch {
+		case item.subdomain != nil:
+			response.Subdomains = append(response.Subdomains, *item.subdomain)
+		case item.endpoint != nil:
+			response.Endpoints = append(response.Endpoints, *item.endpoint)
+		case item.technology != nil:
+			response.Technologies = append(response.Technologies, *item.technology)
+		}
+		response.NextSince = item.at.UTC()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// deltaAfter is the condition of a timestamp column being after the time bound to it. Stored times are text
+// with the offset they were written with, so they are compared as instants through julianday() rather than
+// as strings.
+func deltaAfter(column string) string {
+	return "julianday(" + column + ") > julianday(?)"
+}
+
+// fetchDeltaItems loads the subdomains, endpoints and technology detections of an organization selected
+// by window, which filters and orders a query on the given timestamp column, merged oldest first.
+func fetchDeltaItems(db *gorm.DB, orgID uint, window func(q *gorm.DB, column string) *gorm.DB) ([]deltaItem, error) {
+	var items []deltaItem
+
+	var subdomains []DeltaSubdomain
+	query := db.Table("subdomains s").
+		Select("s.id, s.root_domain_id, s.hostname, s.ip_address, s.is_active, s.scan_id, s.discovered_at").
+		Joins("JOIN root_domains rd ON rd.id = s.root_domain_id").
+		Where("rd.organization_id = ?", orgID)
+	if err := window(query, "s.discovered_at").Order("s.id").Scan(&subdomains).Error; err != nil {
+		return nil, err
+	}
+	for i := range subdomains {
+		items = append(items, deltaItem{at: subdomains[i].DiscoveredAt, subdomain: &subdomains[i]})
+	}
+
+	var endpoints []DeltaEndpoint
+	query = db.Table("endpoints e").
+		Select("e.id, e.subdomain_id, s.hostname, e.path, e.method, e.status_code, e.content_type, e.scan_id, e.discovered_at").
+		Joins("JOIN subdomains s ON s.id = e.subdomain_id").
+		Joins("JOIN root_domains rd ON rd.id = s.root_domain_id").
+		Where("rd.organization_id = ?", orgID)
+	if err := window(query, "e.discovered_at").Order("e.id").Scan(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	for i := range endpoints {
+		items = append(items, deltaItem{at: endpoints[i].DiscoveredAt, endpoint: &endpoints[i]})
+	}
+
+	var subdomainTechs []DeltaTechnology
+	query = db.Table("subdomain_technologies st").
+		Select("st.technology_id, t.name, t.category, st.subdomain_id, s.hostname, st.confidence, st.detected_at").
+		Joins("JOIN technologies t ON t.id = st.technology_id").
+		Joins("JOIN subdomains s ON s.id = st.subdomain_id").
+		Joins("JOIN root_domains rd ON rd.id = s.root_domain_id").
+		Where("rd.organization_id = ?", orgID)
+	if err := window(query, "st.detected_at").Order("st.subdomain_id, st.technology_id").Scan(&subdomainTechs).Error; err != nil {
+		return nil, err
+	}
+	for i := range subdomainTechs {
+		items = append(items, deltaItem{at: subdomainTechs[i].DetectedAt, technology: &subdomainTechs[i]})
+	}
+
+	var endpointTechs []DeltaTechnology
+	query = db.Table("endpoint_technologies et").
+		Select("et.technology_id, t.name, t.category, et.endpoint_id, s.hostname, et.confidence, et.detected_at").
+		Joins("JOIN technologies t ON t.id = et.technology_id").
+		Joins("JOIN endpoints e ON e.id = et.endpoint_id").
+		Joins("JOIN subdomains s ON s.id = e.subdomain_id").
+		Joins("JOIN root_domains rd ON rd.id = s.root_domain_id").
+		Where("rd.organization_id = ?", orgID)
+	if err := window(query, "et.detected_at").Order("et.endpoint_id, et.technology_id").Scan(&endpointTechs).Error; err != nil {
+		return nil, err
+	}
+	for i := range endpointTechs {
+		items = append(items, deltaItem{at: endpointTechs[i].DetectedAt, technology: &endpointTechs[i]})
+	}
+
+	sort.SliceStable(items, func(i, k int) bool { return items[i].at.Before(items[k].at) })
+	return items, nil
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/digest"
+	"rewrite-go/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Response Structs ---
+
+// DigestRunListResponse lists digest runs, newest first.
+type DigestRunListResponse struct {
+	Runs []models.DigestRun `json:"runs"`
+}
+
+// --- Handler Functions ---
+
+// PreviewDigest handles GET requests for the digest that would be sent now, without sending it. since
+// (RFC 3339 or YYYY-MM-DD) defaults to the end of the last digest run. format=text returns the email body.
+func PreviewDigest(c *gin.Context) {
+	db := database.GetDB()
+	until := time.Now()
+	since, ok := parseTimeQuery(c, "since")
+	if !ok {
+		return
+	}
+	if since == nil {
+		defaultSince, err := digest.DefaultSince(db, until)
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to determine digest period", err.Error())
+			return
+		}
+		since = &defaultSince
+	}
+
+	d, err := digest.Build(db, *since, until)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to build digest", err.Error())
+		return
+	}
+	switch c.Query("format") {
+	case "", "json":
+		c.JSON(http.StatusOK, d)
+	case "text":
+		c.String(http.StatusOK, "Subject: %s\n\n%s", d.Subject(), d.Text())
+	default:
+		RespondError(c, http.StatusBadRequest, "Invalid format, must be json or text")
+	}
+}
+
+// SendDigest handles POST requests sending the digest of the changes since the last run now, regardless
+// of the schedule. Returns the recorded run; failed runs are recorded as well (see GetDigestRuns).
+func SendDigest(c *gin.Context) {
+	run, err := digest.Run()
+	switch {
+	case errors.Is(err, digest.ErrNotConfigured):
+		RespondError(c, http.StatusBadRequest, "Email digests are not configured", err.Error())
+	case errors.Is(err, digest.ErrAlreadyRunning):
+		RespondError(c, http.StatusConflict, "A digest is already being sent")
+	case errors.Is(err, digest.ErrSendFailed):
+		RespondError(c, http.StatusBadGateway, "Failed to send digest", err.Error())
+	case err != nil:
+		RespondError(c, http.StatusInternalServerError, "Failed to run digest", err.Error())
+	default:
+		c.JSON(http.StatusOK, run)
+	}
+}
+
+// GetDigestRuns handles GET requests listing recent digest runs, newest first (limit, default 20).
+func GetDigestRuns(c *gin.Context) {
+	limit, ok := parseIntQuery(c, "limit", 20, 1, 200)
+	if !ok {
+		return
+	}
+	runs := []models.DigestRun{}
+	if err := database.GetDB().Order("created_at desc").Limit(limit).Find(&runs).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve digest runs", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, DigestRunListResponse{Runs: runs})
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"rewrite-go/database"
+	"rewrite-go/jobs"
 	"rewrite-go/models"
 	"rewrite-go/scanner" // Import the scanner package
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +30,11 @@ type DomainCreate struct {
 	OrganizationID uint   `json:"organization_id" binding:"required"`
 }
 
+// DomainReassign represents the request body for moving a root domain to another organization.
+type DomainReassign struct {
+	OrganizationID uint `json:"organization_id" binding:"required"`
+}
+
 // DomainResponse represents the response structure for a root domain.
 type DomainResponse struct {
 	ID             uint       `json:"id"`
@@ -34,15 +45,100 @@ type DomainResponse struct {
 	// Note: TotalSubdomains and TotalEndpoints are added to models.RootDomain
 }
 
+// DomainTreeEndpoint is an endpoint node in a domain asset tree.
+type DomainTreeEndpoint struct {
+	ID           uint              `json:"id"`
+	Path         string            `json:"path"`
+	Method       string            `json:"method"`
+	StatusCode   int               `json:"status_code,omitempty"`
+	ContentType  string            `json:"content_type,omitempty"`
+	Technologies []TechnologyBasic `json:"technologies"`
+}
+
+// DomainTreeSubdomain is a subdomain node in a domain asset tree.
+type DomainTreeSubdomain struct {
+	ID                 uint                 `json:"id"`
+	Hostname           string               `json:"hostname"`
+	IPAddress          string               `json:"ip_address,omitempty"`
+	IsActive           bool                 `json:"is_active"`
+	DiscoveredAt       time.Time            `json:"discovered_at"`
+	LastSeenAt         *time.Time           `json:"last_seen_at,omitempty"`
+	Technologies       []TechnologyBasic    `json:"technologies"`
+	TotalEndpoints     int64                `json:"total_endpoints"`
+	EndpointsTruncated bool                 `json:"endpoints_truncated"` // True when more endpoints exist than endpoint_limit
+	Endpoints          []DomainTreeEndpoint `json:"endpoints,omitempty"` // Only included for depth >= 2
+}
+
+// DomainTreeResponse represents a root domain with its nested subdomains, endpoints and technologies.
+type DomainTreeResponse struct {
+	DomainResponse
+	Depth           int                   `json:"depth"`
+	Page            int                   `json:"page"`
+	PageSize        int                   `json:"page_size"`
+	EndpointLimit   int                   `json:"endpoint_limit"`
+	TotalSubdomains int64                 `json:"total_subdomains"`
+	Subdomains      []DomainTreeSubdomain `json:"subdomains"`
+}
+
+// RootSubdomainRepair reports the changes made to one root domain's root-level subdomain entry.
+type RootSubdomainRepair struct {
+	RootDomainID     uint   `json:"root_domain_id"`
+	Domain           string `json:"domain"`
+	SubdomainID      uint   `json:"subdomain_id"`      // The canonical root-level entry
+	Created          bool   `json:"created"`           // Entry was missing and has been created
+	DuplicatesMerged int    `json:"duplicates_merged"` // Variant entries (case, trailing dot) merged into it
+}
+
+// RootSubdomainRepairResponse summarizes a root-level subdomain repair run.
+type RootSubdomainRepairResponse struct {
+	DomainsChecked   int                   `json:"domains_checked"`
+	EntriesCreated   int                   `json:"entries_created"`
+	DuplicatesMerged int                   `json:"duplicates_merged"`
+	Repairs          []RootSubdomainRepair `json:"repairs"` // Only domains that changed
+}
+
+// StatusBucket counts a domain's endpoints with one status code or class. Endpoints never answered
+// (status code 0) are in class "none".
+type StatusBucket struct {
+	StatusCode *int   `json:"status_code,omitempty"` // Only set when grouping by code
+	Class      string `json:"class"`                 // 1xx to 5xx, or none
+	Count      int64  `json:"count"`
+}
+
+// StatusDistributionResponse is the status code distribution of a root domain's endpoints.
+type StatusDistributionResponse struct {
+	DomainID uint           `json:"domain_id"`
+	GroupBy  string         `json:"group_by"` // code or class
+	Total    int64          `json:"total"`
+	Buckets  []StatusBucket `json:"buckets"` // Ascending by status code, none first
+}
+
+// ContentTypeCount counts a domain's endpoints served with one media type.
+type ContentTypeCount struct {
+	ContentType string `json:"content_type"` // Media type without parameters, e.g. application/json
+	Count       int64  `json:"count"`
+}
+
+// ContentTypesResponse is the content types of a root domain's endpoints.
+type ContentTypesResponse struct {
+	DomainID     uint               `json:"domain_id"`
+	Total        int64              `json:"total"`
+	Unknown      int64              `json:"unknown"`       // Endpoints with no content type recorded
+	ContentTypes []ContentTypeCount `json:"content_types"` // Most common first
+}
+
 // Note: ScanStartRequest and ScanConfig structs are now defined in models/models.go
 
+// errDomainExists signals that a root domain is already present in the target organization.
+var errDomainExists = errors.New("domain already exists in organization")
+
 // --- Handler Functions ---
 
 // CreateDomain handles POST requests to create a new root domain.
 func CreateDomain(c *gin.Context) {
 	var input DomainCreate
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -50,7 +146,7 @@ func CreateDomain(c *gin.Context) {
 	// Note: This library focuses on eTLD+1, similar to tldextract's domain+suffix
 	parsedDomain, err := publicsuffix.Parse(input.Domain)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain format", "details": err.Error()})
+		RespondError(c, http.StatusBadRequest, "Invalid domain format", err.Error())
 		return
 	}
 	// Reconstruct the root domain (e.g., "google.com" from "www.google.com")
@@ -62,9 +158,9 @@ func CreateDomain(c *gin.Context) {
 	var organization models.Organization
 	if err := db.First(&organization, input.OrganizationID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Organization with ID %d not found", input.OrganizationID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Organization with ID %d not found", input.OrganizationID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify organization", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to verify organization", err.Error())
 		}
 		return
 	}
@@ -74,11 +170,11 @@ func CreateDomain(c *gin.Context) {
 	errCheck := db.Where("domain = ? AND organization_id = ?", rootDomain, input.OrganizationID).First(&existingDomain).Error
 	if errCheck == nil {
 		// Domain already exists for this organization
-		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Domain '%s' already exists in organization ID %d", rootDomain, input.OrganizationID)})
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Domain '%s' already exists in organization ID %d", rootDomain, input.OrganizationID))
 		return
 	} else if !errors.Is(errCheck, gorm.ErrRecordNotFound) {
 		// Handle potential database errors during the check
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for existing domain", "details": errCheck.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to check for existing domain", errCheck.Error())
 		return
 	}
 	// If errCheck is gorm.ErrRecordNotFound, the domain does not exist, proceed.
@@ -93,7 +189,7 @@ func CreateDomain(c *gin.Context) {
 	if result.Error != nil {
 		// The duplicate check is now handled above.
 		// Handle other potential creation errors.
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create domain", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to create domain", result.Error.Error())
 		return
 	}
 
@@ -114,7 +210,7 @@ func GetDomains(c *gin.Context) {
 
 	result := db.Find(&domains)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve domains", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve domains", result.Error.Error())
 		return
 	}
 
@@ -136,7 +232,7 @@ func GetDomain(c *gin.Context) {
 	idStr := c.Param("domain_id")
 	domainID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
 		return
 	}
 
@@ -146,9 +242,9 @@ func GetDomain(c *gin.Context) {
 	result := db.First(&domain, uint(domainID))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Domain with ID %d not found", domainID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Domain with ID %d not found", domainID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve domain", "details": result.Error.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve domain", result.Error.Error())
 		}
 		return
 	}
@@ -167,6 +263,331 @@ func GetDomain(c *gin.Context) {
 	c.JSON(http.StatusOK, domain)
 }
 
+// GetDomainStatusDistribution handles GET requests counting a root domain's endpoints per status code,
+// or per class (2xx, 4xx, ...) with group=class.
+func GetDomainStatusDistribution(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+	groupBy := c.DefaultQuery("group", "code")
+	if groupBy != "code" && groupBy != "class" {
+		RespondError(c, http.StatusBadRequest, "Invalid group, must be one of: code, class")
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.Select("id").First(&domain, uint(domainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+		return
+	}
+
+	var rows []struct {
+		StatusCode int
+		Count      int64
+	}
+	if err := db.Table("endpoints").
+		Select("COALESCE(endpoints.status_code, 0) AS status_code, COUNT(*) AS count").
+		Joins("JOIN subdomains ON subdomains.id = endpoints.subdomain_id").
+		Where("subdomains.root_domain_id = ?", domain.ID).
+		Group("COALESCE(endpoints.status_code, 0)").Order("status_code").
+		Scan(&rows).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count endpoints by status code", err.Error())
+		return
+	}
+
+	response := StatusDistributionResponse{DomainID: domain.ID, GroupBy: groupBy, Buckets: []StatusBucket{}}
+	classBuckets := make(map[string]int) // Class -> index in Buckets, when grouping by class
+	for _, row := range rows {
+		response.Total += row.Count
+		class := "none"
+		if row.StatusCode >= 100 && row.StatusCode <= 599 {
+			class = fmt.Sprintf("%dxx", row.StatusCode/100)
+		}
+		if groupBy == "class" {
+			if i, ok := classBuckets[class]; ok {
+				response.Buckets[i].Count += row.Count
+				continue
+			}
+			classBuckets[class] = len(response.Buckets)
+			response.Buckets = append(response.Buckets, StatusBucket{Class: class, Count: row.Count})
+			continue
+		}
+		statusCode := row.StatusCode
+		response.Buckets = append(response.Buckets, StatusBucket{StatusCode: &statusCode, Class: class, Count: row.Count})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDomainContentTypes handles GET requests counting a root domain's endpoints per content type.
+// Parameters like charset are dropped, so "text/html" and "text/html; charset=utf-8" are counted together.
+func GetDomainContentTypes(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.Select("id").First(&domain, uint(domainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+		return
+	}
+
+	var rows []struct {
+		ContentType string
+		Count       int64
+	}
+	if err := db.Table("endpoints").
+		Select("COALESCE(endpoints.content_type, '') AS content_type, COUNT(*) AS count").
+		Joins("JOIN subdomains ON subdomains.id = endpoints.subdomain_id").
+		Where("subdomains.root_domain_id = ?", domain.ID).
+		Group("COALESCE(endpoints.content_type, '')").
+		Scan(&rows).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count endpoints by content type", err.Error())
+		return
+	}
+
+	response := ContentTypesResponse{DomainID: domain.ID, ContentTypes: []ContentTypeCount{}}
+	indexes := make(map[string]int) // Media type -> index in ContentTypes
+	for _, row := range rows {
+		response.Total += row.Count
+		mediaType := strings.ToLower(strings.TrimSpace(row.ContentType))
+		if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+			mediaType = parsed
+		}
+		if mediaType == "" {
+			response.Unknown += row.Count
+			continue
+		}
+		if i, ok := indexes[mediaType]; ok {
+			response.ContentTypes[i].Count += row.Count
+			continue
+		}
+		indexes[mediaType] = len(response.ContentTypes)
+		response.ContentTypes = append(response.ContentTypes, ContentTypeCount{ContentType: mediaType, Count: row.Count})
+	}
+	slices.SortFunc(response.ContentTypes, func(a, b ContentTypeCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.ContentType, b.ContentType))
+	})
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDomainTree handles GET requests returning a root domain's asset tree in one call.
+// depth=1 includes subdomains with their technologies, depth=2 (default) adds endpoints.
+// Subdomains are paginated (page, page_size) and endpoints are capped per subdomain (endpoint_limit).
+func GetDomainTree(c *gin.Context) {
+	idStr := c.Param("domain_id")
+	domainID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+
+	depth, ok := parseIntQuery(c, "depth", 2, 1, 2)
+	if !ok {
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+	endpointLimit, ok := parseIntQuery(c, "endpoint_limit", 100, 1, 500)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.First(&domain, uint(domainID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Domain with ID %d not found", domainID))
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve domain", err.Error())
+		}
+		return
+	}
+
+	response := DomainTreeResponse{
+		DomainResponse: DomainResponse{
+			ID:             domain.ID,
+			Domain:         domain.Domain,
+			OrganizationID: domain.OrganizationID,
+			CreatedAt:      domain.CreatedAt,
+			LastScannedAt:  domain.LastScannedAt,
+		},
+		Depth:         depth,
+		Page:          page,
+		PageSize:      pageSize,
+		EndpointLimit: endpointLimit,
+		Subdomains:    []DomainTreeSubdomain{},
+	}
+
+	subdomainQuery := db.Model(&models.Subdomain{}).Where("root_domain_id = ?", domain.ID)
+	if err := subdomainQuery.Count(&response.TotalSubdomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count subdomains", err.Error())
+		return
+	}
+
+	// Only the requested page of subdomains, with their technologies
+	var subdomains []models.Subdomain
+	if err := db.Preload("Technologies").
+		Where("root_domain_id = ?", domain.ID).
+		Order("hostname asc").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&subdomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains", err.Error())
+		return
+	}
+	if len(subdomains) == 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Endpoint totals for the page in a single grouped query
+	subdomainIDs := make([]uint, len(subdomains))
+	for i, sub := range subdomains {
+		subdomainIDs[i] = sub.ID
+	}
+	var endpointCounts []struct {
+		SubdomainID uint
+		Count       int64
+	}
+	if err := db.Model(&models.Endpoint{}).
+		Select("subdomain_id, COUNT(*) AS count").
+		Where("subdomain_id IN ?", subdomainIDs).
+		Group("subdomain_id").
+		Scan(&endpointCounts).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count endpoints", err.Error())
+		return
+	}
+	endpointTotals := make(map[uint]int64, len(endpointCounts))
+	for _, ec := range endpointCounts {
+		endpointTotals[ec.SubdomainID] = ec.Count
+	}
+
+	for _, sub := range subdomains {
+		node := DomainTreeSubdomain{
+			ID:                 sub.ID,
+			Hostname:           sub.Hostname,
+			IPAddress:          sub.IPAddress,
+			IsActive:           sub.IsActive,
+			DiscoveredAt:       sub.DiscoveredAt,
+			LastSeenAt:         sub.LastSeenAt,
+			Technologies:       toTechnologyBasics(sub.Technologies),
+			TotalEndpoints:     endpointTotals[sub.ID],
+			EndpointsTruncated: endpointTotals[sub.ID] > int64(endpointLimit),
+		}
+
+		if depth >= 2 && node.TotalEndpoints > 0 {
+			var endpoints []models.Endpoint
+			if err := db.Preload("Technologies").
+				Where("subdomain_id = ?", sub.ID).
+				Order("path asc, method asc").
+				Limit(endpointLimit).
+				Find(&endpoints).Error; err != nil {
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve endpoints", err.Error())
+				return
+			}
+			node.Endpoints = make([]DomainTreeEndpoint, len(endpoints))
+			for i, ep := range endpoints {
+				node.Endpoints[i] = DomainTreeEndpoint{
+					ID:           ep.ID,
+					Path:         ep.Path,
+					Method:       ep.Method,
+					StatusCode:   ep.StatusCode,
+					ContentType:  ep.ContentType,
+					Technologies: toTechnologyBasics(ep.Technologies),
+				}
+			}
+		}
+		response.Subdomains = append(response.Subdomains, node)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ReassignDomainOrganization handles PATCH requests to move a root domain to a different organization.
+// Subdomains, endpoints and scans follow automatically since they link via the root domain.
+func ReassignDomainOrganization(c *gin.Context) {
+	idStr := c.Param("domain_id")
+	domainID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+
+	var input DomainReassign
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+
+	// Use a transaction so the duplicate check and the move happen atomically
+	txErr := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&domain, uint(domainID)).Error; err != nil {
+			return err
+		}
+
+		// Verify target organization exists
+		var organization models.Organization
+		if err := tx.First(&organization, input.OrganizationID).Error; err != nil {
+			return err
+		}
+
+		if domain.OrganizationID == input.OrganizationID {
+			return nil // Nothing to do
+		}
+
+		// Check the domain isn't already present in the target organization
+		var existingDomain models.RootDomain
+		errCheck := tx.Where("domain = ? AND organization_id = ?", domain.Domain, input.OrganizationID).First(&existingDomain).Error
+		if errCheck == nil {
+			return errDomainExists
+		} else if !errors.Is(errCheck, gorm.ErrRecordNotFound) {
+			return errCheck
+		}
+
+		if err := tx.Model(&domain).Update("organization_id", input.OrganizationID).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+
+	if txErr != nil {
+		switch {
+		case errors.Is(txErr, errDomainExists):
+			RespondError(c, http.StatusConflict, fmt.Sprintf("Domain '%s' already exists in organization ID %d", domain.Domain, input.OrganizationID))
+		case errors.Is(txErr, gorm.ErrRecordNotFound) && domain.ID == 0: // Domain lookup is the first query in the transaction
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Domain with ID %d not found", domainID))
+		case errors.Is(txErr, gorm.ErrRecordNotFound):
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Organization with ID %d not found", input.OrganizationID))
+		default:
+			RespondError(c, http.StatusInternalServerError, "Failed to reassign domain", txErr.Error())
+		}
+		return
+	}
+
+	response := DomainResponse{
+		ID:             domain.ID,
+		Domain:         domain.Domain,
+		OrganizationID: domain.OrganizationID,
+		CreatedAt:      domain.CreatedAt,
+		LastScannedAt:  domain.LastScannedAt,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // ScanDomain handles POST requests to initiate a scan for a domain.
 // DEPRECATED: Use POST /api/scans instead. This function remains for potential backward compatibility or reference.
 // It's recommended to remove or refactor this in the future.
@@ -174,7 +595,7 @@ func ScanDomain(c *gin.Context) {
 	idStr := c.Param("domain_id")
 	domainID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
 		return
 	}
 
@@ -187,7 +608,7 @@ func ScanDomain(c *gin.Context) {
 
 	// Bind JSON request body, allowing empty body if template ID is not provided
 	if err := c.ShouldBindJSON(&localInput); err != nil && !errors.Is(err, errors.New("EOF")) { // Ignore EOF which means empty body
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		RespondError(c, http.StatusBadRequest, "Invalid request body", err.Error())
 		return
 	}
 
@@ -197,9 +618,9 @@ func ScanDomain(c *gin.Context) {
 	var domain models.RootDomain
 	if err := db.First(&domain, uint(domainID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Domain with ID %d not found", domainID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Domain with ID %d not found", domainID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve domain", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve domain", err.Error())
 		}
 		return
 	}
@@ -219,9 +640,9 @@ func ScanDomain(c *gin.Context) {
 		var fetchedTemplate models.ScanTemplate
 		if err := db.First(&fetchedTemplate, *localInput.ScanTemplateID).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan template with ID %d not found", *localInput.ScanTemplateID)})
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", *localInput.ScanTemplateID))
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan template", "details": err.Error()})
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template", err.Error())
 			}
 			return
 		}
@@ -248,7 +669,7 @@ func ScanDomain(c *gin.Context) {
 
 	result := db.Create(&scan)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scan record", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to create scan record", result.Error.Error())
 		return
 	}
 
@@ -264,3 +685,133 @@ func ScanDomain(c *gin.Context) {
 
 	c.JSON(http.StatusAccepted, gin.H{"message": message, "scan_id": scan.ID})
 }
+
+// --- Helper Function ---
+
+// parseIntQuery reads an optional integer query parameter, returning defaultValue when absent.
+// Values below minValue are rejected with a 400 response; values above maxValue (if > 0) are capped.
+func parseIntQuery(c *gin.Context, name string, defaultValue, minValue, maxValue int) (int, bool) {
+	valueStr := c.Query(name)
+	if valueStr == "" {
+		return defaultValue, true
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil || value < minValue {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid %s, must be an integer >= %d", name, minValue))
+		return 0, false
+	}
+	if maxValue > 0 && value > maxValue {
+		value = maxValue
+	}
+	return value, true
+}
+
+// toTechnologyBasics converts technologies to their response form, dropping duplicates.
+func toTechnologyBasics(techs []models.Technology) []TechnologyBasic {
+	result := make([]TechnologyBasic, 0, len(techs))
+	seen := make(map[uint]struct{}, len(techs))
+	for _, tech := range techs {
+		if _, ok := seen[tech.ID]; ok {
+			continue
+		}
+		seen[tech.ID] = struct{}{}
+		result = append(result, TechnologyBasic{ID: tech.ID, Name: tech.Name, Category: tech.Category})
+	}
+	return result
+}
+
+// RepairRootSubdomains handles POST requests ensuring every root domain has exactly one canonical
+// root-level subdomain entry (see scanner.EnsureRootSubdomain). Missing entries are created and variants
+// of the same hostname are merged into the canonical one. Limited to one domain with domain_id.
+func RepairRootSubdomains(c *gin.Context) {
+	db := database.GetDB()
+	query := db.Order("id")
+	if idStr := c.Query("domain_id"); idStr != "" {
+		domainID, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+			return
+		}
+		query = query.Where("id = ?", uint(domainID))
+	}
+
+	var domains []models.RootDomain
+	if err := query.Find(&domains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve domains", err.Error())
+		return
+	}
+	if len(domains) == 0 && c.Query("domain_id") != "" {
+		RespondError(c, http.StatusNotFound, fmt.Sprintf("Domain with ID %s not found", c.Query("domain_id")))
+		return
+	}
+
+	// Tracked as a maintenance job; cancelling it stops before the next domain
+	jobCtx, jobCancel := context.WithCancel(c.Request.Context())
+	defer jobCancel()
+	job := jobs.Start(jobs.TypeMaintenance, "Repair root-level subdomain entries", jobCancel)
+
+	response := RootSubdomainRepairResponse{Repairs: []RootSubdomainRepair{}}
+	for i := range domains {
+		if jobCtx.Err() != nil {
+			job.Finish(nil) // Keeps the cancelled status
+			RespondError(c, http.StatusConflict, "Repair was cancelled", fmt.Sprintf("%d of %d domains were checked before cancellation", response.DomainsChecked, len(domains)))
+			return
+		}
+		job.SetProgress(i, len(domains))
+		domain := &domains[i]
+		repair := RootSubdomainRepair{RootDomainID: domain.ID, Domain: domain.Domain}
+
+		// One transaction per domain so a failure doesn't undo repairs of the others
+		err := db.Transaction(func(tx *gorm.DB) error {
+			rootSubdomain, created, err := scanner.EnsureRootSubdomain(tx, domain, nil)
+			if err != nil {
+				return err
+			}
+			repair.SubdomainID = rootSubdomain.ID
+			repair.Created = created
+
+			// Entries from older imports may lack a discovery time
+			if rootSubdomain.DiscoveredAt.IsZero() {
+				rootSubdomain.DiscoveredAt = domain.CreatedAt
+				if err := tx.Model(&rootSubdomain).Update("discovered_at", domain.CreatedAt).Error; err != nil {
+					return err
+				}
+			}
+
+			var duplicates []models.Subdomain
+			if err := tx.Where("root_domain_id = ? AND id <> ? AND LOWER(RTRIM(hostname, '.')) = ?", domain.ID, rootSubdomain.ID, rootSubdomain.Hostname).
+				Find(&duplicates).Error; err != nil {
+				return err
+			}
+			for j := range duplicates {
+				if _, err := mergeSubdomain(tx, &duplicates[j], &rootSubdomain); err != nil {
+					return fmt.Errorf("merging duplicate '%s': %w", duplicates[j].Hostname, err)
+				}
+				// Reload so the next merge compares against the updated timestamps
+				if err := tx.First(&rootSubdomain, rootSubdomain.ID).Error; err != nil {
+					return err
+				}
+				repair.DuplicatesMerged++
+			}
+			return nil
+		})
+		if err != nil {
+			job.Finish(err)
+			RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to repair root subdomain of '%s'", domain.Domain), err.Error())
+			return
+		}
+
+		response.DomainsChecked++
+		if repair.Created || repair.DuplicatesMerged > 0 {
+			if repair.Created {
+				response.EntriesCreated++
+			}
+			response.DuplicatesMerged += repair.DuplicatesMerged
+			response.Repairs = append(response.Repairs, repair)
+		}
+	}
+	job.SetProgress(len(domains), len(domains))
+	job.Finish(nil)
+
+	c.JSON(http.StatusOK, response)
+}
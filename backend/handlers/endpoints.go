@@ -18,13 +18,14 @@ import (
 
 // EndpointResponse represents the basic response structure for an endpoint.
 type EndpointResponse struct {
-	ID           uint      `json:"id"`
-	SubdomainID  uint      `json:"subdomain_id"`
-	Path         string    `json:"path"`
-	Method       string    `json:"method"`
-	StatusCode   int       `json:"status_code,omitempty"`
-	ContentType  string    `json:"content_type,omitempty"`
-	DiscoveredAt time.Time `json:"discovered_at"`
+	ID           uint       `json:"id"`
+	SubdomainID  uint       `json:"subdomain_id"`
+	Path         string     `json:"path"`
+	Method       string     `json:"method"`
+	StatusCode   int        `json:"status_code,omitempty"`
+	ContentType  string     `json:"content_type,omitempty"`
+	DiscoveredAt time.Time  `json:"discovered_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
 }
 
 // ParameterResponse represents the response structure for a parameter.
@@ -47,6 +48,23 @@ type RequestResponseResponse struct {
 	CapturedAt      time.Time `json:"captured_at"`
 }
 
+// EndpointStatusEntry is an endpoint's response in one scan.
+type EndpointStatusEntry struct {
+	ScanID      *uint     `json:"scan_id,omitempty"` // Unset once the scan was pruned
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type,omitempty"`
+	ObservedAt  time.Time `json:"observed_at"`
+	Changed     bool      `json:"changed"` // Status code or content type differs from the previous entry
+}
+
+// EndpointStatusHistoryResponse lists an endpoint's responses per scan, oldest first.
+type EndpointStatusHistoryResponse struct {
+	EndpointID uint                  `json:"endpoint_id"`
+	Total      int                   `json:"total"`   // Entries recorded, before changes_only and limit
+	Changes    int                   `json:"changes"` // Entries that differ from their previous one
+	Entries    []EndpointStatusEntry `json:"entries"`
+}
+
 // EndpointDetailResponse represents the detailed response for an endpoint.
 type EndpointDetailResponse struct {
 	ID                   uint                `json:"id"`
@@ -56,6 +74,7 @@ type EndpointDetailResponse struct {
 	StatusCode           int                 `json:"status_code,omitempty"`
 	ContentType          string              `json:"content_type,omitempty"`
 	DiscoveredAt         time.Time           `json:"discovered_at"`
+	LastSeenAt           *time.Time          `json:"last_seen_at,omitempty"`
 	Parameters           []ParameterResponse `json:"parameters"`                       // Use ParameterResponse
 	Technologies         []TechnologyBasic   `json:"technologies"`                     // Reuse TechnologyBasic from subdomains.go
 	LatestScreenshotPath *string             `json:"latest_screenshot_path,omitempty"` // Add field for screenshot path
@@ -75,15 +94,24 @@ func GetEndpoints(c *gin.Context) {
 	if subdomainIDStr != "" {
 		subdomainID, err := strconv.ParseUint(subdomainIDStr, 10, 32)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subdomain_id format"})
+			RespondError(c, http.StatusBadRequest, "Invalid subdomain_id format")
 			return
 		}
 		query = query.Where("subdomain_id = ?", uint(subdomainID))
 	}
 
+	// Optional filtering for endpoints not re-observed in the last N days
+	cutoff, ok := parseNotSeenDays(c)
+	if !ok {
+		return
+	}
+	if cutoff != nil {
+		query = query.Where("COALESCE(last_seen_at, discovered_at) < ?", *cutoff)
+	}
+
 	result := query.Find(&endpoints)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve endpoints", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve endpoints", result.Error.Error())
 		return
 	}
 
@@ -98,6 +126,7 @@ func GetEndpoints(c *gin.Context) {
 			StatusCode:   ep.StatusCode,
 			ContentType:  ep.ContentType,
 			DiscoveredAt: ep.DiscoveredAt,
+			LastSeenAt:   ep.LastSeenAt,
 		}
 	}
 	c.JSON(http.StatusOK, response)
@@ -108,7 +137,7 @@ func GetEndpoint(c *gin.Context) {
 	idStr := c.Param("endpoint_id")
 	endpointID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endpoint ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid endpoint ID format")
 		return
 	}
 
@@ -119,9 +148,9 @@ func GetEndpoint(c *gin.Context) {
 	result := db.Preload("Parameters").Preload("Technologies").First(&endpoint, uint(endpointID))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Endpoint with ID %d not found", endpointID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Endpoint with ID %d not found", endpointID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve endpoint", "details": result.Error.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve endpoint", result.Error.Error())
 		}
 		return
 	}
@@ -155,13 +184,14 @@ func GetEndpoint(c *gin.Context) {
 		StatusCode:   endpoint.StatusCode,
 		ContentType:  endpoint.ContentType,
 		DiscoveredAt: endpoint.DiscoveredAt,
+		LastSeenAt:   endpoint.LastSeenAt,
 		Parameters:   paramsResponse,
 		Technologies: techsResponse,
 	}
 
 	// --- Fetch Latest Screenshot ---
 	var latestScreenshot models.Screenshot
-	screenshotResult := db.Where("endpoint_id = ?", endpointID).Order("captured_at desc").First(&latestScreenshot)
+	screenshotResult := db.Where("endpoint_id = ? AND file_path <> ?", endpointID, "").Order("captured_at desc").First(&latestScreenshot) // Ignore skipped captures
 
 	if screenshotResult.Error == nil {
 		// Found a screenshot, add its path to the response
@@ -181,7 +211,7 @@ func GetEndpointParameters(c *gin.Context) {
 	idStr := c.Param("endpoint_id")
 	endpointID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endpoint ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid endpoint ID format")
 		return
 	}
 
@@ -191,9 +221,9 @@ func GetEndpointParameters(c *gin.Context) {
 	var endpoint models.Endpoint
 	if err := db.First(&endpoint, uint(endpointID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Endpoint with ID %d not found", endpointID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Endpoint with ID %d not found", endpointID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check endpoint existence", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to check endpoint existence", err.Error())
 		}
 		return
 	}
@@ -202,7 +232,7 @@ func GetEndpointParameters(c *gin.Context) {
 	var parameters []models.Parameter
 	result := db.Where("endpoint_id = ?", uint(endpointID)).Find(&parameters)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parameters", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve parameters", result.Error.Error())
 		return
 	}
 
@@ -225,7 +255,7 @@ func GetEndpointRequestResponses(c *gin.Context) {
 	idStr := c.Param("endpoint_id")
 	endpointID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endpoint ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid endpoint ID format")
 		return
 	}
 
@@ -235,9 +265,9 @@ func GetEndpointRequestResponses(c *gin.Context) {
 	var endpoint models.Endpoint
 	if err := db.First(&endpoint, uint(endpointID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Endpoint with ID %d not found", endpointID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Endpoint with ID %d not found", endpointID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check endpoint existence", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to check endpoint existence", err.Error())
 		}
 		return
 	}
@@ -246,7 +276,7 @@ func GetEndpointRequestResponses(c *gin.Context) {
 	var reqResps []models.RequestResponse
 	result := db.Where("endpoint_id = ?", uint(endpointID)).Find(&reqResps)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve request/responses", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve request/responses", result.Error.Error())
 		return
 	}
 
@@ -265,3 +295,62 @@ func GetEndpointRequestResponses(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, response)
 }
+
+// GetEndpointStatusHistory handles GET requests for the status codes an endpoint answered with per scan,
+// oldest first. changes_only=true keeps the entries where the response changed; limit (default 100,
+// max 1000) keeps the newest ones.
+func GetEndpointStatusHistory(c *gin.Context) {
+	endpointID, err := strconv.ParseUint(c.Param("endpoint_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid endpoint ID format")
+		return
+	}
+	limit, ok := parseIntQuery(c, "limit", 100, 1, 1000)
+	if !ok {
+		return
+	}
+	changesOnly := false
+	if changesStr := c.Query("changes_only"); changesStr != "" {
+		parsed, err := strconv.ParseBool(changesStr)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid changes_only, must be true or false")
+			return
+		}
+		changesOnly = parsed
+	}
+
+	db := database.GetDB()
+	var endpoint models.Endpoint
+	if err := db.Select("id").First(&endpoint, uint(endpointID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Endpoint with ID %d not found", endpointID), "Failed to check endpoint existence")
+		return
+	}
+
+	var history []models.EndpointStatusHistory
+	if err := db.Where("endpoint_id = ?", endpoint.ID).Order("observed_at, id").Find(&history).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve status history", err.Error())
+		return
+	}
+
+	response := EndpointStatusHistoryResponse{EndpointID: endpoint.ID, Total: len(history), Entries: []EndpointStatusEntry{}}
+	for i, entry := range history {
+		changed := i > 0 && (entry.StatusCode != history[i-1].StatusCode || entry.ContentType != history[i-1].ContentType)
+		if changed {
+			response.Changes++
+		}
+		if changesOnly && !changed {
+			continue
+		}
+		response.Entries = append(response.Entries, EndpointStatusEntry{
+			ScanID:      entry.ScanID,
+			StatusCode:  entry.StatusCode,
+			ContentType: entry.ContentType,
+			ObservedAt:  entry.ObservedAt,
+			Changed:     changed,
+		})
+	}
+	if len(response.Entries) > limit {
+		response.Entries = response.Entries[len(response.Entries)-limit:]
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorResponse is the JSON envelope returned by every failed API request.
+type ErrorResponse struct {
+	Code    string `json:"code"`              // Machine-readable status name, e.g. "not_found"
+	Message string `json:"message"`           // Human-readable summary
+	Details string `json:"details,omitempty"` // Optional underlying error
+}
+
+// newErrorResponse builds the envelope for a status code, deriving Code from the status text
+// (404 -> "not_found", 500 -> "internal_server_error").
+func newErrorResponse(status int, message string, details ...string) ErrorResponse {
+	resp := ErrorResponse{
+		Code:    strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		Message: message,
+	}
+	if len(details) > 0 {
+		resp.Details = details[0]
+	}
+	return resp
+}
+
+// RespondError writes an ErrorResponse with the given status to a gin context.
+func RespondError(c *gin.Context, status int, message string, details ...string) {
+	c.JSON(status, newErrorResponse(status, message, details...))
+}
+
+// writeError writes an ErrorResponse for plain net/http handlers (see settings.go).
+func writeError(w http.ResponseWriter, status int, message string, details ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(newErrorResponse(status, message, details...)); err != nil {
+		log.Printf("Error encoding error response: %v", err)
+	}
+}
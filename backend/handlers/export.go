@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetDomainSubdomainsText handles GET requests exporting a root domain's subdomains as a plain-text list,
+// one hostname per line in hostname order, for piping into other tools. active_only=true limits the list to
+// active subdomains.
+func GetDomainSubdomainsText(c *gin.Context) {
+	domain, activeOnly, ok := textExportParams(c)
+	if !ok {
+		return
+	}
+
+	query := database.GetDB().Model(&models.Subdomain{}).Select("hostname").Where("root_domain_id = ?", domain.ID)
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+	rows, err := query.Order("hostname").Rows()
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains", err.Error())
+		return
+	}
+	streamLines(c, rows, func(rows *sql.Rows) (string, error) {
+		var hostname string
+		err := rows.Scan(&hostname)
+		return hostname, err
+	})
+}
+
+// GetDomainEndpointsText handles GET requests exporting a root domain's endpoints as a plain-text list of
+// full URLs, one per line. Endpoints differing only in method are listed once. URLs use https unless
+// scheme=http is given, as the scheme an endpoint was crawled with is not stored. active_only=true limits the
+// list to endpoints of active subdomains.
+func GetDomainEndpointsText(c *gin.Context) {
+	domain, activeOnly, ok := textExportParams(c)
+	if !ok {
+		return
+	}
+	scheme := c.DefaultQuery("scheme", "https")
+	if scheme != "https" && scheme != "http" {
+		RespondError(c, http.StatusBadRequest, "Invalid scheme, must be http or https")
+		return
+	}
+
+	query := database.GetDB().Table("endpoints e").
+		Select("DISTINCT s.hostname, e.path").
+		Joins("JOIN subdomains s ON s.id = e.subdomain_id").
+		Where("s.root_domain_id = ?", domain.ID)
+	if activeOnly {
+		query = query.Where("s.is_active = ?", true)
+	}
+	rows, err := query.Order("s.hostname, e.path").Rows()
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve endpoints", err.Error())
+		return
+	}
+	streamLines(c, rows, func(rows *sql.Rows) (string, error) {
+		var hostname, path string
+		if err := rows.Scan(&hostname, &path); err != nil {
+			return "", err
+		}
+		// Stored paths are escaped; older ones were stored decoded and are escaped here
+		return scheme + "://" + hostname + scanner.NormalizeEndpointPath(path), nil
+	})
+}
+
+// textExportParams reads the root domain and the active_only flag of a text export request. Errors are
+// answered with the usual JSON error response, as nothing has been streamed yet.
+func textExportParams(c *gin.Context) (models.RootDomain, bool, bool) {
+	var domain models.RootDomain
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return domain, false, false
+	}
+	activeOnly := false
+	if activeOnlyStr := c.Query("active_only"); activeOnlyStr != "" {
+		activeOnly, err = strconv.ParseBool(activeOnlyStr)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid active_only value, must be true or false")
+			return domain, false, false
+		}
+	}
+	if err := database.GetDB().First(&domain, uint(domainID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Domain with ID %d not found", domainID))
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve domain", err.Error())
+		}
+		return domain, false, false
+	}
+	return domain, activeOnly, true
+}
+
+// streamLines writes one line per row as plain text while reading the rows, so exports of large domains
+// are never held in memory. Once streaming has started errors can only be logged.
+func streamLines(c *gin.Context, rows *sql.Rows, line func(rows *sql.Rows) (string, error)) {
+	defer rows.Close()
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := bufio.NewWriter(c.Writer)
+	for rows.Next() {
+		text, err := line(rows)
+		if err != nil {
+			log.Printf("Error reading row of text export %s: %v", c.Request.URL.Path, err)
+			break
+		}
+		if _, err := fmt.Fprintln(w, text); err != nil {
+			return // Client went away
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error streaming text export %s: %v", c.Request.URL.Path, err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("Error writing text export %s: %v", c.Request.URL.Path, err)
+	}
+}
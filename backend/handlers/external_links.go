@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Response Structs ---
+
+// ExternalLinkResponse is an endpoint of the domain that redirected to an out-of-scope URL.
+type ExternalLinkResponse struct {
+	ID           uint       `json:"id"`
+	EndpointID   uint       `json:"endpoint_id"`
+	SourceURL    string     `json:"source_url"` // https URL of the endpoint, the scheme it was found with is not stored
+	Method       string     `json:"method"`
+	StatusCode   int        `json:"status_code"`
+	TargetURL    string     `json:"target_url"`
+	TargetHost   string     `json:"target_host"`
+	ScanID       *uint      `json:"scan_id,omitempty"`
+	DiscoveredAt time.Time  `json:"discovered_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// ExternalHostCount is a third-party host with the number of external links pointing to it.
+type ExternalHostCount struct {
+	Host  string `json:"host"`
+	Links int64  `json:"links"`
+}
+
+// ExternalLinkListResponse is a page of a domain's external links, with the hosts they lead to.
+type ExternalLinkListResponse struct {
+	Page     int                    `json:"page"`
+	PageSize int                    `json:"page_size"`
+	Total    int64                  `json:"total"`
+	Hosts    []ExternalHostCount    `json:"hosts"` // Every target host of the domain, most linked first, regardless of filters
+	Links    []ExternalLinkResponse `json:"links"`
+}
+
+// --- Handler Functions ---
+
+// GetDomainExternalLinks handles GET requests listing the endpoints of a root domain that redirected outside
+// it, recorded by crawls with the katana option redirectPolicy "same-scope". Optional filter target_host;
+// paginated with page and page_size.
+func GetDomainExternalLinks(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.Select("id").First(&domain, uint(domainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+		return
+	}
+
+	response := ExternalLinkListResponse{
+		Page:     page,
+		PageSize: pageSize,
+		Hosts:    []ExternalHostCount{},
+		Links:    []ExternalLinkResponse{},
+	}
+	if err := db.Model(&models.ExternalLink{}).
+		Select("target_host AS host, COUNT(*) AS links").
+		Where("root_domain_id = ?", domain.ID).
+		Group("target_host").Order("links desc, host").
+		Scan(&response.Hosts).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count external hosts", err.Error())
+		return
+	}
+
+	query := db.Model(&models.ExternalLink{}).Where("root_domain_id = ?", domain.ID)
+	if host := strings.ToLower(strings.TrimSpace(c.Query("target_host"))); host != "" {
+		query = query.Where("target_host = ?", host)
+	}
+	if err := query.Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count external links", err.Error())
+		return
+	}
+
+	var links []models.ExternalLink
+	if err := query.Preload("Endpoint.Subdomain").
+		Order("target_host, id").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&links).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve external links", err.Error())
+		return
+	}
+	for _, link := range links {
+		item := ExternalLinkResponse{
+			ID:           link.ID,
+			EndpointID:   link.EndpointID,
+			StatusCode:   link.StatusCode,
+			TargetURL:    link.TargetURL,
+			TargetHost:   link.TargetHost,
+			ScanID:       link.ScanID,
+			DiscoveredAt: link.DiscoveredAt,
+			LastSeenAt:   link.LastSeenAt,
+		}
+		if link.Endpoint != nil {
+			item.Method = link.Endpoint.Method
+			if link.Endpoint.Subdomain != nil {
+				item.SourceURL = "https://" + link.Endpoint.Subdomain.Hostname + link.Endpoint.Path
+			}
+		}
+		response.Links = append(response.Links, item)
+	}
+	c.JSON(http.StatusOK, response)
+}
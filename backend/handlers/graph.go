@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/xml"
 	"fmt"
 	"net/http"
+	"rewrite-go/config"
 	"rewrite-go/database"
 	"rewrite-go/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // --- Response Structs ---
@@ -30,6 +38,19 @@ type LinkData struct {
 	To   string `json:"to"`
 }
 
+// GraphResponse is the JSON graph. With page_size set, it holds the root domains of one page, each with
+// everything below it.
+type GraphResponse struct {
+	Nodes        []NodeData `json:"nodes"`
+	Links        []LinkData `json:"links"`
+	GeneratedAt  time.Time  `json:"generated_at"` // When the graph was built; it is cached until the data changes
+	Cached       bool       `json:"cached"`
+	TotalDomains int        `json:"total_domains"`
+	Page         int        `json:"page,omitempty"`
+	PageSize     int        `json:"page_size,omitempty"`
+	HasMore      bool       `json:"has_more"`
+}
+
 // NodeProperties defines visual attributes for different node types.
 var NodeProperties = map[string]map[string]interface{}{
 	"domain":    {"size": 15, "color": "#ff6b6b"},
@@ -38,80 +59,275 @@ var NodeProperties = map[string]map[string]interface{}{
 	"parameter": {"size": 5, "color": "#f368e0"},
 }
 
-// --- Handler Function ---
+// --- Export Helpers ---
 
-// GetGraphData handles GET requests to retrieve graph data.
-func GetGraphData(c *gin.Context) {
-	db := database.GetDB()
-	var domains []models.RootDomain
+// xmlEscape escapes a string for use in XML text or attribute values.
+func xmlEscape(value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
 
-	// Fetch all domains, eagerly loading all nested relationships needed for the graph
-	result := db.Preload("Subdomains.Endpoints.Parameters").Find(&domains)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve graph data", "details": result.Error.Error()})
-		return
+// dotEscaper escapes the only characters with a meaning inside a DOT quoted string.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// dotQuote quotes a string as a DOT ID. Unlike strconv.Quote it keeps non-ASCII characters, which
+// Graphviz reads as UTF-8, instead of writing Go escapes Graphviz would show literally.
+func dotQuote(value string) string {
+	return `"` + dotEscaper.Replace(value) + `"`
+}
+
+// renderGraphML serializes nodes and links as GraphML (readable by Gephi, Cytoscape, yEd).
+func renderGraphML(nodes []NodeData, links []LinkData) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	buf.WriteString(`  <key id="label" for="node" attr.name="label" attr.type="string"/>` + "\n")
+	buf.WriteString(`  <key id="type" for="node" attr.name="type" attr.type="string"/>` + "\n")
+	buf.WriteString(`  <key id="size" for="node" attr.name="size" attr.type="int"/>` + "\n")
+	buf.WriteString(`  <key id="color" for="node" attr.name="color" attr.type="string"/>` + "\n")
+	buf.WriteString(`  <graph id="attack_surface" edgedefault="directed">` + "\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&buf, "    <node id=\"%s\">\n", xmlEscape(node.ID))
+		fmt.Fprintf(&buf, "      <data key=\"label\">%s</data>\n", xmlEscape(node.Label))
+		fmt.Fprintf(&buf, "      <data key=\"type\">%s</data>\n", xmlEscape(node.Type))
+		fmt.Fprintf(&buf, "      <data key=\"size\">%d</data>\n", node.Size)
+		fmt.Fprintf(&buf, "      <data key=\"color\">%s</data>\n", xmlEscape(node.Color))
+		buf.WriteString("    </node>\n")
+	}
+	for i, link := range links {
+		fmt.Fprintf(&buf, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"/>\n", i, xmlEscape(link.From), xmlEscape(link.To))
+	}
+	buf.WriteString("  </graph>\n</graphml>\n")
+	return buf.Bytes()
+}
+
+// renderDOT serializes nodes and links as a Graphviz DOT digraph.
+func renderDOT(nodes []NodeData, links []LinkData) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("digraph attack_surface {\n")
+	buf.WriteString("  node [style=filled];\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&buf, "  %s [label=%s, type=%s, fillcolor=%s, width=%.2f];\n",
+			dotQuote(node.ID), dotQuote(node.Label), dotQuote(node.Type), dotQuote(node.Color), float64(node.Size)/10)
+	}
+	for _, link := range links {
+		fmt.Fprintf(&buf, "  %s -> %s;\n", dotQuote(link.From), dotQuote(link.To))
 	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
 
-	nodesMap := make(map[string]NodeData) // Use map to easily check for existing nodes
-	var links []LinkData
+// --- Graph Building ---
 
-	// Helper to add node if it doesn't exist
-	addNodeIfNotExists := func(nodeID, nodeType, label string) {
-		if _, exists := nodesMap[nodeID]; !exists {
-			props, ok := NodeProperties[nodeType]
-			if !ok {
-				props = map[string]interface{}{"size": 5, "color": "#cccccc"} // Default props
-			}
-			nodesMap[nodeID] = NodeData{
-				ID:    nodeID,
-				Label: label,
-				Type:  nodeType,
-				Size:  props["size"].(int), // Type assertion
-				Color: props["color"].(string),
-			}
+const defaultGraphBatchSize = 1000 // Rows per query when building the graph, overridable via GRAPH_BATCH_SIZE
+
+// domainGraph is the part of the graph below one root domain: its node first, then the nodes of its
+// subdomains, endpoints and parameters, with the links between them.
+type domainGraph struct {
+	nodes []NodeData
+	links []LinkData
+}
+
+// graphFingerprint summarizes the rows the graph is built from. Scans, imports, merges and deletions all
+// change it, which is what invalidates the cached graph.
+type graphFingerprint struct {
+	Domains, MaxDomainID       int64
+	Subdomains, MaxSubdomainID int64
+	Endpoints, MaxEndpointID   int64
+	Parameters, MaxParameterID int64
+}
+
+// graphCache holds the last built graph. mu is held while checking and rebuilding, so concurrent requests
+// for a stale graph wait for a single rebuild instead of each starting one.
+var graphCache struct {
+	mu          sync.Mutex
+	fingerprint graphFingerprint
+	generatedAt time.Time // Zero until the graph is first built
+	domains     []domainGraph
+}
+
+// loadGraphFingerprint counts the graph's rows and their highest IDs.
+func loadGraphFingerprint(db *gorm.DB) (graphFingerprint, error) {
+	var fp graphFingerprint
+	err := db.Raw(`SELECT
+		(SELECT COUNT(*) FROM root_domains) AS domains, (SELECT COALESCE(MAX(id), 0) FROM root_domains) AS max_domain_id,
+		(SELECT COUNT(*) FROM subdomains) AS subdomains, (SELECT COALESCE(MAX(id), 0) FROM subdomains) AS max_subdomain_id,
+		(SELECT COUNT(*) FROM endpoints) AS endpoints, (SELECT COALESCE(MAX(id), 0) FROM endpoints) AS max_endpoint_id,
+		(SELECT COUNT(*) FROM parameters) AS parameters, (SELECT COALESCE(MAX(id), 0) FROM parameters) AS max_parameter_id`).
+		Scan(&fp).Error
+	return fp, err
+}
+
+// cachedGraph returns the graph per root domain (ordered by ID) and when it was built, rebuilding it if
+// the data changed since or refresh is set. cached reports whether the graph was reused.
+func cachedGraph(db *gorm.DB, refresh bool) (domains []domainGraph, generatedAt time.Time, cached bool, err error) {
+	graphCache.mu.Lock()
+	defer graphCache.mu.Unlock()
+
+	fp, err := loadGraphFingerprint(db)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	if !refresh && !graphCache.generatedAt.IsZero() && fp == graphCache.fingerprint {
+		return graphCache.domains, graphCache.generatedAt, true, nil
+	}
+	domains, err = buildGraph(db, config.GetInt("GRAPH_BATCH_SIZE", defaultGraphBatchSize))
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	graphCache.fingerprint, graphCache.generatedAt, graphCache.domains = fp, time.Now(), domains
+	return domains, graphCache.generatedAt, false, nil
+}
+
+// buildGraph loads the graph's rows batchSize at a time, selecting only the columns the nodes need,
+// and groups them per root domain.
+func buildGraph(db *gorm.DB, batchSize int) ([]domainGraph, error) {
+	var domains []models.RootDomain
+	if err := db.Select("id", "domain").Order("id").Find(&domains).Error; err != nil {
+		return nil, err
+	}
+
+	subdomainsByDomain := make(map[uint][]models.Subdomain)
+	var subdomainBatch []models.Subdomain
+	if err := db.Select("id", "root_domain_id", "hostname").Order("id").FindInBatches(&subdomainBatch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, sub := range subdomainBatch {
+			subdomainsByDomain[sub.RootDomainID] = append(subdomainsByDomain[sub.RootDomainID], sub)
 		}
+		return nil
+	}).Error; err != nil {
+		return nil, err
 	}
 
-	// Helper to add link
-	addLink := func(sourceID, targetID string) {
-		// Ensure both nodes exist before adding link (should always be true with this logic)
-		if _, existsSrc := nodesMap[sourceID]; existsSrc {
-			if _, existsTgt := nodesMap[targetID]; existsTgt {
-				links = append(links, LinkData{From: sourceID, To: targetID})
-			}
+	endpointsBySubdomain := make(map[uint][]models.Endpoint)
+	var endpointBatch []models.Endpoint
+	if err := db.Select("id", "subdomain_id", "method", "path").Order("id").FindInBatches(&endpointBatch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, ep := range endpointBatch {
+			endpointsBySubdomain[ep.SubdomainID] = append(endpointsBySubdomain[ep.SubdomainID], ep)
+		}
+		return nil
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	parametersByEndpoint := make(map[uint][]models.Parameter)
+	var parameterBatch []models.Parameter
+	if err := db.Select("id", "endpoint_id", "name").Order("id").FindInBatches(&parameterBatch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, param := range parameterBatch {
+			parametersByEndpoint[param.EndpointID] = append(parametersByEndpoint[param.EndpointID], param)
 		}
+		return nil
+	}).Error; err != nil {
+		return nil, err
 	}
 
-	// Process data and build node/link structures
+	graphs := make([]domainGraph, 0, len(domains))
 	for _, domain := range domains {
+		var graph domainGraph
 		domainID := fmt.Sprintf("domain_%d", domain.ID)
-		addNodeIfNotExists(domainID, "domain", domain.Domain)
+		graph.addNode(domainID, "domain", domain.Domain)
 
-		for _, subdomain := range domain.Subdomains {
+		for _, subdomain := range subdomainsByDomain[domain.ID] {
 			subdomainID := fmt.Sprintf("subdomain_%d", subdomain.ID)
-			addNodeIfNotExists(subdomainID, "subdomain", subdomain.Hostname)
-			addLink(domainID, subdomainID)
+			graph.addNode(subdomainID, "subdomain", subdomain.Hostname)
+			graph.links = append(graph.links, LinkData{From: domainID, To: subdomainID})
 
-			for _, endpoint := range subdomain.Endpoints {
-				endpointLabel := fmt.Sprintf("%s %s", endpoint.Method, endpoint.Path)
+			for _, endpoint := range endpointsBySubdomain[subdomain.ID] {
 				endpointID := fmt.Sprintf("endpoint_%d", endpoint.ID)
-				addNodeIfNotExists(endpointID, "endpoint", endpointLabel)
-				addLink(subdomainID, endpointID)
+				graph.addNode(endpointID, "endpoint", fmt.Sprintf("%s %s", endpoint.Method, endpoint.Path))
+				graph.links = append(graph.links, LinkData{From: subdomainID, To: endpointID})
 
-				for _, parameter := range endpoint.Parameters {
+				for _, parameter := range parametersByEndpoint[endpoint.ID] {
 					paramID := fmt.Sprintf("param_%d", parameter.ID)
-					addNodeIfNotExists(paramID, "parameter", parameter.Name)
-					addLink(endpointID, paramID)
+					graph.addNode(paramID, "parameter", parameter.Name)
+					graph.links = append(graph.links, LinkData{From: endpointID, To: paramID})
 				}
 			}
 		}
+		graphs = append(graphs, graph)
+	}
+	return graphs, nil
+}
+
+// addNode adds a node styled by NodeProperties for its type.
+func (g *domainGraph) addNode(nodeID, nodeType, label string) {
+	props, ok := NodeProperties[nodeType]
+	if !ok {
+		props = map[string]interface{}{"size": 5, "color": "#cccccc"} // Default props
+	}
+	g.nodes = append(g.nodes, NodeData{
+		ID:    nodeID,
+		Label: label,
+		Type:  nodeType,
+		Size:  props["size"].(int), // Type assertion
+		Color: props["color"].(string),
+	})
+}
+
+// --- Handler Function ---
+
+// GetGraphData handles GET requests to retrieve graph data.
+// Supports ?format=graphml and ?format=dot in addition to the default JSON. The graph is built once and
+// reused until root domains, subdomains, endpoints or parameters change; refresh=true rebuilds it anyway.
+// page_size paginates by root domain (page starts at 1); it is 0 by default, returning every domain.
+func GetGraphData(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "graphml" && format != "dot" {
+		RespondError(c, http.StatusBadRequest, "Invalid format, must be one of: json, graphml, dot")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 0, 0, 1000)
+	if !ok {
+		return
+	}
+	refresh := false
+	if refreshStr := c.Query("refresh"); refreshStr != "" {
+		parsed, err := strconv.ParseBool(refreshStr)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid refresh, must be true or false")
+			return
+		}
+		refresh = parsed
+	}
+
+	domains, generatedAt, cached, err := cachedGraph(database.GetDB(), refresh)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve graph data", err.Error())
+		return
 	}
 
-	// Convert map values to slice for response
-	nodes := make([]NodeData, 0, len(nodesMap))
-	for _, node := range nodesMap {
-		nodes = append(nodes, node)
+	response := GraphResponse{
+		Nodes:        []NodeData{},
+		Links:        []LinkData{},
+		GeneratedAt:  generatedAt,
+		Cached:       cached,
+		TotalDomains: len(domains),
+	}
+	selected := domains
+	if pageSize > 0 {
+		start := min((page-1)*pageSize, len(domains))
+		end := min(start+pageSize, len(domains))
+		selected = domains[start:end]
+		response.Page, response.PageSize, response.HasMore = page, pageSize, end < len(domains)
+	}
+	for _, graph := range selected {
+		response.Nodes = append(response.Nodes, graph.nodes...)
+		response.Links = append(response.Links, graph.links...)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"nodes": nodes, "links": links})
+	c.Header("X-Graph-Generated-At", generatedAt.UTC().Format(time.RFC3339))
+	switch format {
+	case "graphml":
+		c.Header("Content-Disposition", `attachment; filename="graph.graphml"`)
+		c.Data(http.StatusOK, "application/graphml+xml; charset=utf-8", renderGraphML(response.Nodes, response.Links))
+	case "dot":
+		c.Header("Content-Disposition", `attachment; filename="graph.dot"`)
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", renderDOT(response.Nodes, response.Links))
+	default:
+		c.JSON(http.StatusOK, response)
+	}
 }
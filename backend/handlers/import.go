@@ -2,21 +2,94 @@ package handlers
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	goerrors "errors" // Aliased, HandleImportURLs uses "errors" for its error list
 	"fmt"
+	"io"
 	"log"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
+	"rewrite-go/config"
 	"rewrite-go/database" // Correct module path
-	"rewrite-go/models"   // Correct module path
+	"rewrite-go/jobs"
+	"rewrite-go/models" // Correct module path
+	"rewrite-go/scanner"
 	"strings"
 
 	"strconv" // Need this to convert org_id string to uint
 
 	"github.com/gin-gonic/gin"
+	"github.com/weppos/publicsuffix-go/publicsuffix"
 	"gorm.io/gorm"
 )
 
+const (
+	defaultImportMaxUploadBytes = 10 << 20 // Maximum import file size, overridable via IMPORT_MAX_UPLOAD_BYTES
+	defaultImportMaxLineLength  = 8192     // Maximum characters per line, overridable via IMPORT_MAX_LINE_LENGTH
+	importMultipartOverhead     = 64 << 10 // Allowance for multipart boundaries and part headers on top of the file size
+)
+
+// importAllowedContentTypes lists the accepted media types of the uploaded file part.
+var importAllowedContentTypes = map[string]bool{
+	"text/plain":               true,
+	"text/csv":                 true,
+	"application/octet-stream": true,
+}
+
+// errUploadTooLarge is returned by uploadLimitReader once the file exceeds its limit.
+var errUploadTooLarge = goerrors.New("upload exceeds the maximum size")
+
+// uploadLimitReader reads at most remaining bytes and fails with errUploadTooLarge if more data follows,
+// so an oversized file is rejected instead of silently truncated.
+type uploadLimitReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64 // Bytes read so far
+}
+
+func (l *uploadLimitReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, errUploadTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	l.read += int64(n)
+	return n, err
+}
+
+// nextFilePart advances the multipart reader to the form field with the given name.
+func nextFilePart(reader *multipart.Reader, field string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no '%s' field in request", field)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
 // HandleImportURLs processes the uploaded text file containing URLs/subdomains for a specific organization.
+// The file is streamed line by line, so an upload over IMPORT_MAX_UPLOAD_BYTES or a line over
+// IMPORT_MAX_LINE_LENGTH stops the import there. If nothing was imported yet the upload is rejected with
+// 413 or 400; otherwise the lines before it stay imported and 207 reports the line the import stopped at.
 func HandleImportURLs(c *gin.Context) {
 	db := database.GetDB() // Get DB instance
 
@@ -24,7 +97,7 @@ func HandleImportURLs(c *gin.Context) {
 	orgIDStr := c.Param("org_id")
 	orgID64, err := strconv.ParseUint(orgIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Organization ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid Organization ID format")
 		return
 	}
 	orgID := uint(orgID64) // Convert to uint
@@ -33,38 +106,95 @@ func HandleImportURLs(c *gin.Context) {
 	var org models.Organization
 	if err := db.First(&org, orgID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Organization with ID %d not found", orgID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Organization with ID %d not found", orgID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking organization"})
+			RespondError(c, http.StatusInternalServerError, "Database error checking organization")
 		}
 		return
 	}
 
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from request: " + err.Error()})
+	// Track the import as a background job; cancelling it stops processing before the next line
+	jobCtx, jobCancel := context.WithCancel(c.Request.Context())
+	defer jobCancel()
+	job := jobs.Start(jobs.TypeImport, fmt.Sprintf("URL import into organization '%s'", org.Name), jobCancel)
+	defer func() {
+		if status := c.Writer.Status(); status >= http.StatusBadRequest {
+			job.FinishWithStatus(jobs.StatusFailed, fmt.Sprintf("Import failed with HTTP %d", status))
+		} else {
+			job.Finish(nil)
+		}
+	}()
+
+	maxUploadBytes := int64(config.GetInt("IMPORT_MAX_UPLOAD_BYTES", defaultImportMaxUploadBytes))
+	maxLineLength := config.GetInt("IMPORT_MAX_LINE_LENGTH", defaultImportMaxLineLength)
+
+	// Reject oversized requests up front when the client declares a length
+	if c.Request.ContentLength > maxUploadBytes+importMultipartOverhead {
+		RespondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Uploaded file exceeds the maximum size of %d bytes", maxUploadBytes))
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err != nil || mediaType != "multipart/form-data" {
+		RespondError(c, http.StatusUnsupportedMediaType, "Request must be multipart/form-data with a 'file' field")
 		return
 	}
-	defer file.Close()
-
-	log.Printf("Received file: %s, Size: %d", header.Filename, header.Size)
 
-	// Basic validation (consider adding more robust checks)
-	if header.Size == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Uploaded file is empty"})
+	// Stream the multipart body instead of FormFile, which buffers the whole upload before we see it
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes+importMultipartOverhead)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Failed to read multipart request", err.Error())
 		return
 	}
-	// Could also check Content-Type if needed, though frontend validates .txt
+	part, err := nextFilePart(reader, "file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if goerrors.As(err, &maxBytesErr) {
+			RespondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Uploaded file exceeds the maximum size of %d bytes", maxUploadBytes))
+		} else {
+			RespondError(c, http.StatusBadRequest, "Failed to get file from request: "+err.Error())
+		}
+		return
+	}
+	defer part.Close()
+
+	// Only plain text lists are accepted; browsers send application/octet-stream for unknown extensions
+	if partType := part.Header.Get("Content-Type"); partType != "" {
+		mediaType, _, err := mime.ParseMediaType(partType)
+		if err != nil || !importAllowedContentTypes[mediaType] {
+			RespondError(c, http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported file type '%s', expected a plain text file", partType))
+			return
+		}
+	}
+
+	log.Printf("Receiving file: %s (limit %d bytes)", part.FileName(), maxUploadBytes)
 
+	file := &uploadLimitReader{r: part, remaining: maxUploadBytes}
 	scanner := bufio.NewScanner(file)
-	var linesProcessed, domainsAdded, subdomainsAdded, endpointsAdded, paramsAdded int
+	// Room for the longest allowed line plus its line ending
+	scanner.Buffer(make([]byte, 0, min(maxLineLength+2, 64*1024)), maxLineLength+2)
+	var lineNumber, linesProcessed, domainsAdded, subdomainsAdded, endpointsAdded, paramsAdded int
 	var errors []string
+	stopLine, stopReason := 0, "" // Where and why an upload that was partly imported stopped
 
 	for scanner.Scan() {
+		if jobCtx.Err() != nil {
+			RespondError(c, http.StatusConflict, "Import was cancelled", fmt.Sprintf("%d lines were imported before cancellation", linesProcessed))
+			return
+		}
+		lineNumber++
+		job.SetProgress(linesProcessed, 0)
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue // Skip empty lines
 		}
+		if len(line) > maxLineLength {
+			if linesProcessed == 0 {
+				RespondError(c, http.StatusBadRequest, fmt.Sprintf("Line %d exceeds the maximum length of %d characters", lineNumber, maxLineLength))
+				return
+			}
+			stopLine, stopReason = lineNumber, fmt.Sprintf("line exceeds the maximum length of %d characters", maxLineLength)
+			break
+		}
 		linesProcessed++
 
 		// Attempt to parse the line as a URL
@@ -113,9 +243,27 @@ func HandleImportURLs(c *gin.Context) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading uploaded file: %v", err)
-		// Decide if this is a fatal error or just add to the list
-		errors = append(errors, "Error reading file stream: "+err.Error())
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case (err == errUploadTooLarge || goerrors.As(err, &maxBytesErr)) && linesProcessed == 0:
+			RespondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Uploaded file exceeds the maximum size of %d bytes", maxUploadBytes))
+			return
+		case err == errUploadTooLarge || goerrors.As(err, &maxBytesErr):
+			stopLine, stopReason = lineNumber+1, fmt.Sprintf("uploaded file exceeds the maximum size of %d bytes", maxUploadBytes)
+		case err == bufio.ErrTooLong && linesProcessed == 0:
+			RespondError(c, http.StatusBadRequest, fmt.Sprintf("Line %d exceeds the maximum length of %d characters", lineNumber+1, maxLineLength))
+			return
+		case err == bufio.ErrTooLong:
+			stopLine, stopReason = lineNumber+1, fmt.Sprintf("line exceeds the maximum length of %d characters", maxLineLength)
+		default:
+			log.Printf("Error reading uploaded file: %v", err)
+			// Decide if this is a fatal error or just add to the list
+			errors = append(errors, "Error reading file stream: "+err.Error())
+		}
+	}
+	if file.read == 0 {
+		RespondError(c, http.StatusBadRequest, "Uploaded file is empty")
+		return
 	}
 
 	// Construct response message
@@ -146,6 +294,14 @@ func HandleImportURLs(c *gin.Context) {
 		responseMsg.WriteString("No processable content found in the file.")
 	}
 
+	if stopReason != "" {
+		c.JSON(http.StatusMultiStatus, gin.H{
+			"message":         fmt.Sprintf("%s Stopped at line %d: %s; the lines before it were imported.", strings.TrimSpace(responseMsg.String()), stopLine, stopReason),
+			"stopped_at_line": stopLine,
+			"stop_reason":     stopReason,
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": strings.TrimSpace(responseMsg.String())})
 }
 
@@ -207,7 +363,10 @@ func processDomainOrSubdomainString(db *gorm.DB, input string, orgID uint) error
 		//     // Increment subdomain counter if needed (can't easily return counts from here)
 		// }
 	} else {
-		// Input was just the root domain itself, which already exists. Do nothing.
+		// Input was just the root domain itself; make sure its root-level entry exists
+		if _, _, err := scanner.EnsureRootSubdomain(db, &rootDomain, nil); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -218,7 +377,6 @@ func processDomainOrSubdomainString(db *gorm.DB, input string, orgID uint) error
 // Returns counts of added items and any error.
 func processParsedURL(db *gorm.DB, u *url.URL, orgID uint) (domainsAdded, subdomainsAdded, endpointsAdded, paramsAdded int, err error) {
 	host := u.Hostname()
-	path := u.Path
 	queryParams := u.Query()
 
 	// --- 1. Find Root Domain (MUST exist for this Org) ---
@@ -265,26 +423,14 @@ func processParsedURL(db *gorm.DB, u *url.URL, orgID uint) (domainsAdded, subdom
 		}
 	} else {
 		// If host is the root domain, we might still have endpoints/params for it.
-		// We need a Subdomain record to link endpoints to.
-		// Let's find the "subdomain" record that represents the root domain itself.
-		// This assumes a convention where a Subdomain record exists even for the root.
-		// If not, the schema/logic needs adjustment.
-		err = db.Where("hostname = ? AND root_domain_id = ?", host, rootDomain.ID).First(&subdomain).Error // Use Hostname here too
+		// They link to the canonical "subdomain" record that represents the root domain itself.
+		var created bool
+		subdomain, created, err = scanner.EnsureRootSubdomain(db, &rootDomain, nil)
 		if err != nil {
-			if err == gorm.ErrRecordNotFound {
-				// Create the "root" subdomain entry if it doesn't exist
-				subdomain = models.Subdomain{Hostname: host, RootDomainID: rootDomain.ID} // Correct field name
-				if res := db.Create(&subdomain); res.Error != nil {
-					err = fmt.Errorf("failed to create root-level subdomain entry '%s': %w", host, res.Error)
-					return
-				}
-				log.Printf("Created root-level subdomain entry: %s", host)
-				// Don't count this as a "new subdomain" in the user message? Or maybe do? Let's count it.
-				subdomainsAdded = 1
-			} else {
-				err = fmt.Errorf("failed to find root-level subdomain entry '%s': %w", host, err)
-				return
-			}
+			return
+		}
+		if created {
+			subdomainsAdded = 1
 		}
 	}
 
@@ -295,14 +441,9 @@ func processParsedURL(db *gorm.DB, u *url.URL, orgID uint) (domainsAdded, subdom
 	}
 
 	// --- 3. Find or Create Endpoint ---
-	// Only create endpoint if path is not empty or "/"
-	if path != "" && path != "/" {
+	// Only create endpoint if path is not "/", normalized like crawled paths so both find the same endpoint
+	if normalizedPath := scanner.NormalizeEndpointPath(u.EscapedPath()); normalizedPath != "/" {
 		var endpoint models.Endpoint
-		// Normalize path? e.g., remove trailing slash? Depends on desired behavior.
-		normalizedPath := strings.TrimSuffix(path, "/")
-		if normalizedPath == "" {
-			normalizedPath = "/"
-		} // Handle root path explicitly if needed
 
 		// TODO: Endpoint model needs Method. How to determine from URL? Default to GET?
 		// For now, let's assume GET or leave it blank if the model allows.
@@ -343,3 +484,153 @@ func processParsedURL(db *gorm.DB, u *url.URL, orgID uint) (domainsAdded, subdom
 
 	return // Return collected counts and nil error if successful so far
 }
+
+// Statuses of a line of a domain import (DomainImportResult.Status)
+const (
+	domainImportCreated   = "created"
+	domainImportExisting  = "existing"  // Already in the organization
+	domainImportDuplicate = "duplicate" // Same root domain as an earlier line of the import
+	domainImportInvalid   = "invalid"
+)
+
+// DomainImportResult is the outcome of one entry of a domain import.
+type DomainImportResult struct {
+	Input  string `json:"input"`
+	Domain string `json:"domain,omitempty"` // Root domain the entry was normalized to
+	Status string `json:"status"`
+	ID     uint   `json:"id,omitempty"` // Root domain ID, for created and existing domains
+	Error  string `json:"error,omitempty"`
+}
+
+// DomainImportResponse summarizes a domain import, with a result per entry in input order.
+type DomainImportResponse struct {
+	Created    int                  `json:"created"`
+	Existing   int                  `json:"existing"`
+	Duplicates int                  `json:"duplicates"`
+	Invalid    int                  `json:"invalid"`
+	Results    []DomainImportResult `json:"results"`
+}
+
+// HandleImportDomains creates root domains of an organization in bulk. The body is either a JSON array
+// of domains (Content-Type application/json) or one domain per line, where blank lines and lines starting
+// with # are skipped. Entries may be subdomains or URLs; each is reduced to its registrable domain using the
+// public suffix list. Domains the organization already has are reported, not recreated. The body is
+// limited to IMPORT_MAX_UPLOAD_BYTES.
+func HandleImportDomains(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("org_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid Organization ID format")
+		return
+	}
+	db := database.GetDB()
+	var org models.Organization
+	if err := db.Select("id").First(&org, uint(orgID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Organization with ID %d not found", orgID), "Database error checking organization")
+		return
+	}
+
+	maxUploadBytes := int64(config.GetInt("IMPORT_MAX_UPLOAD_BYTES", defaultImportMaxUploadBytes))
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if goerrors.As(err, &maxBytesErr) {
+			RespondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds the maximum size of %d bytes", maxUploadBytes))
+		} else {
+			RespondError(c, http.StatusBadRequest, "Failed to read request body", err.Error())
+		}
+		return
+	}
+
+	var entries []string
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType == "application/json" {
+		if err := json.Unmarshal(body, &entries); err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid request body, must be a JSON array of domains", err.Error())
+			return
+		}
+	} else {
+		for _, line := range strings.Split(string(body), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		RespondError(c, http.StatusBadRequest, "No domains to import")
+		return
+	}
+
+	var existingDomains []models.RootDomain
+	if err := db.Select("id", "domain").Where("organization_id = ?", org.ID).Find(&existingDomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve existing domains", err.Error())
+		return
+	}
+	existing := make(map[string]uint, len(existingDomains))
+	for _, domain := range existingDomains {
+		existing[domain.Domain] = domain.ID
+	}
+
+	response := DomainImportResponse{Results: make([]DomainImportResult, 0, len(entries))}
+	imported := make(map[string]bool)
+	for _, entry := range entries {
+		result := DomainImportResult{Input: entry}
+		domainName, err := importedRootDomain(entry)
+		switch {
+		case err != nil:
+			result.Status, result.Error = domainImportInvalid, err.Error()
+		case imported[domainName]:
+			result.Domain, result.Status, result.ID = domainName, domainImportDuplicate, existing[domainName]
+		case existing[domainName] != 0:
+			result.Domain, result.Status, result.ID = domainName, domainImportExisting, existing[domainName]
+		default:
+			domain := models.RootDomain{Domain: domainName, OrganizationID: org.ID}
+			if err := db.Create(&domain).Error; err != nil {
+				RespondError(c, http.StatusInternalServerError, "Failed to create domain", fmt.Sprintf("'%s' failed after %d domains were created: %v", domainName, response.Created, err))
+				return
+			}
+			existing[domainName] = domain.ID
+			result.Domain, result.Status, result.ID = domainName, domainImportCreated, domain.ID
+		}
+		if result.Domain != "" {
+			imported[domainName] = true
+		}
+
+		switch result.Status {
+		case domainImportCreated:
+			response.Created++
+		case domainImportExisting:
+			response.Existing++
+		case domainImportDuplicate:
+			response.Duplicates++
+		case domainImportInvalid:
+			response.Invalid++
+		}
+		response.Results = append(response.Results, result)
+	}
+	log.Printf("Domain import into organization %d: %d created, %d existing, %d duplicates, %d invalid", org.ID, response.Created, response.Existing, response.Duplicates, response.Invalid)
+	c.JSON(http.StatusOK, response)
+}
+
+// importedRootDomain reduces an imported entry (domain, subdomain, wildcard or URL) to its registrable
+// domain, e.g. "https://www.Example.co.uk/login" to "example.co.uk".
+func importedRootDomain(entry string) (string, error) {
+	host := strings.ToLower(strings.TrimSpace(entry))
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil || u.Hostname() == "" {
+			return "", fmt.Errorf("invalid URL")
+		}
+		host = u.Hostname()
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "*."), ".")
+	if net.ParseIP(host) != nil {
+		return "", fmt.Errorf("IP addresses are not domains")
+	}
+	if host == "" || strings.Contains(host, "..") || strings.Trim(host, "abcdefghijklmnopqrstuvwxyz0123456789.-") != "" {
+		return "", fmt.Errorf("invalid domain name")
+	}
+	parsed, err := publicsuffix.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	return parsed.SLD + "." + parsed.TLD, nil
+}
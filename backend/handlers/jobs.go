@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Response Structs ---
+
+// JobListResponse lists background jobs.
+type JobListResponse struct {
+	Jobs []jobs.Job `json:"jobs"`
+}
+
+// --- Handler Functions ---
+
+// GetJobs handles GET requests listing background work: scans, imports and maintenance tasks.
+// In-memory jobs are reconciled with the scans table, so pending scans and scans left "running" by a
+// previous server process (reported as "stale") are included. Optional filters: type and status.
+func GetJobs(c *gin.Context) {
+	db := database.GetDB()
+
+	byID := make(map[string]jobs.Job)
+	for _, job := range jobs.List() {
+		byID[job.ID] = job
+	}
+
+	// Scans are durable; the database is authoritative for their status
+	var activeScans []models.Scan
+	if err := db.Preload("RootDomain").Preload("Subdomain").
+		Where("status IN ?", []string{"pending", "running"}).Find(&activeScans).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve active scans", err.Error())
+		return
+	}
+	for _, scan := range activeScans {
+		id := jobs.ScanJobID(scan.ID)
+		if job, ok := byID[id]; ok && job.Status == jobs.StatusRunning {
+			continue // Running in this process
+		}
+		byID[id] = scanJob(scan)
+	}
+
+	typeFilter, statusFilter := c.Query("type"), c.Query("status")
+	response := JobListResponse{Jobs: []jobs.Job{}}
+	for _, job := range byID {
+		if (typeFilter != "" && job.Type != typeFilter) || (statusFilter != "" && job.Status != statusFilter) {
+			continue
+		}
+		response.Jobs = append(response.Jobs, job)
+	}
+	sort.Slice(response.Jobs, func(i, k int) bool { return response.Jobs[i].StartedAt.After(response.Jobs[k].StartedAt) })
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelJob handles POST requests cancelling a background job.
+// Scans (job ID "scan-<id>") are marked cancelled in the database whether or not they run in this process.
+func CancelJob(c *gin.Context) {
+	id := c.Param("job_id")
+
+	if scanIDStr, ok := strings.CutPrefix(id, jobs.TypeScan+"-"); ok {
+		scanID, err := strconv.ParseUint(scanIDStr, 10, 32)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid scan job ID format")
+			return
+		}
+		db := database.GetDB()
+		var scan models.Scan
+		if err := db.Select("id").First(&scan, uint(scanID)).Error; err != nil {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Job %s not found", id))
+			return
+		}
+		if !scanner.CancelScan(uint(scanID)) {
+			RespondError(c, http.StatusConflict, fmt.Sprintf("Job %s is not pending or running", id))
+			return
+		}
+		if job, ok := jobs.Get(id); ok {
+			c.JSON(http.StatusOK, job)
+			return
+		}
+		// Not running in this process, report the updated database record
+		if err := db.Preload("RootDomain").Preload("Subdomain").First(&scan, uint(scanID)).Error; err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve cancelled scan", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, scanJob(scan))
+		return
+	}
+
+	job, err := jobs.Cancel(id)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		RespondError(c, http.StatusNotFound, fmt.Sprintf("Job %s not found", id))
+	case errors.Is(err, jobs.ErrNotRunning), errors.Is(err, jobs.ErrNotCancellable):
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Job %s cannot be cancelled", id), err.Error())
+	case err != nil:
+		RespondError(c, http.StatusInternalServerError, "Failed to cancel job", err.Error())
+	default:
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// scanJob describes a scan that has no in-memory job as a job, based on its database record.
+func scanJob(scan models.Scan) jobs.Job {
+	scanID := scan.ID
+	job := jobs.Job{
+		ID:          jobs.ScanJobID(scan.ID),
+		Type:        jobs.TypeScan,
+		Description: fmt.Sprintf("%s scan of %s", scan.ScanType, scanTargetHost(&scan)),
+		Status:      scan.Status,
+		StartedAt:   scan.StartedAt,
+		FinishedAt:  scan.CompletedAt,
+		ScanID:      &scanID,
+	}
+	switch scan.Status {
+	case "pending":
+		job.Cancellable = true
+	case "running":
+		job.Status = "stale" // Marked running, but no scan goroutine in this process
+		job.Cancellable = true
+	}
+	return job
+}
+
+// scanTargetHost returns the host a scan targets: its subdomain for subdomain scans, else the root domain.
+func scanTargetHost(scan *models.Scan) string {
+	if scan.Subdomain != nil {
+		return scan.Subdomain.Hostname
+	}
+	if scan.RootDomain != nil {
+		return scan.RootDomain.Domain
+	}
+	return fmt.Sprintf("root domain %d", scan.RootDomainID)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/metrics"
+	"rewrite-go/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanStatuses are the statuses reported by the kasm_scans gauge, so absent ones show as 0.
+var scanStatuses = []string{"pending", "running", "completed", "failed", "cancelled"}
+
+// GetMetrics handles GET /metrics in the Prometheus text format: the counters and histograms recorded
+// by this process (scans, job phases, screenshots, API latency) plus gauges read from the database.
+func GetMetrics(c *gin.Context) {
+	db := database.GetDB()
+
+	var statusRows []struct {
+		Status string
+		Count  int64
+	}
+	if err := db.Model(&models.Scan{}).Select("status, COUNT(*) AS count").Group("status").Scan(&statusRows).Error; err != nil {
+		log.Printf("Error counting scans for metrics: %v", err)
+	}
+	byStatus := make(map[string]int64, len(scanStatuses))
+	for _, row := range statusRows {
+		byStatus[row.Status] = row.Count
+	}
+	scans := metrics.Gauge{Name: "kasm_scans", Help: "Scans in the database, by status.", Labels: []string{"status"}}
+	for _, status := range scanStatuses {
+		scans.Samples = append(scans.Samples, metrics.Sample{LabelValues: []string{status}, Value: float64(byStatus[status])})
+	}
+
+	var subdomains, endpoints, screenshots int64
+	if err := db.Model(&models.Subdomain{}).Count(&subdomains).Error; err != nil {
+		log.Printf("Error counting subdomains for metrics: %v", err)
+	}
+	if err := db.Model(&models.Endpoint{}).Count(&endpoints).Error; err != nil {
+		log.Printf("Error counting endpoints for metrics: %v", err)
+	}
+	if err := db.Model(&models.Screenshot{}).Where("file_path <> ''").Count(&screenshots).Error; err != nil {
+		log.Printf("Error counting screenshots for metrics: %v", err)
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.WriteText(c.Writer,
+		scans,
+		metrics.Gauge{Name: "kasm_scans_active", Help: "Scans pending or running.",
+			Samples: []metrics.Sample{{Value: float64(byStatus["pending"] + byStatus["running"])}}},
+		metrics.Gauge{Name: "kasm_subdomains", Help: "Subdomains in the database.", Samples: []metrics.Sample{{Value: float64(subdomains)}}},
+		metrics.Gauge{Name: "kasm_endpoints", Help: "Endpoints in the database.", Samples: []metrics.Sample{{Value: float64(endpoints)}}},
+		metrics.Gauge{Name: "kasm_screenshots", Help: "Saved screenshots in the database.", Samples: []metrics.Sample{{Value: float64(screenshots)}}},
+	)
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"rewrite-go/database"
+	"rewrite-go/jobs"
 	"rewrite-go/models"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -33,6 +36,39 @@ type RootDomainBasic struct {
 	Domain string `json:"domain"`
 }
 
+// OrganizationMerge represents the request body for merging one organization into another.
+type OrganizationMerge struct {
+	TargetOrganizationID uint `json:"target_organization_id" binding:"required"`
+}
+
+// OrganizationMergeResponse reports the outcome of an organization merge.
+type OrganizationMergeResponse struct {
+	SourceOrganizationID uint `json:"source_organization_id"` // Deleted after the merge
+	TargetOrganizationID uint `json:"target_organization_id"`
+	DomainsMoved         int  `json:"domains_moved"`     // Root domains reassigned as-is
+	DomainsMerged        int  `json:"domains_merged"`    // Root domains that already existed in the target and were merged into it
+	SubdomainsMoved      int  `json:"subdomains_moved"`  // Subdomains of merged domains reassigned as-is
+	SubdomainsMerged     int  `json:"subdomains_merged"` // Subdomains of merged domains combined with an existing hostname
+	EndpointsMerged      int  `json:"endpoints_merged"`  // Endpoints combined with an existing path/method
+}
+
+// SharedIPAddress is an IP address resolved by subdomains of both compared organizations.
+type SharedIPAddress struct {
+	IPAddress  string   `json:"ip_address"`
+	HostnamesA []string `json:"hostnames_a"`
+	HostnamesB []string `json:"hostnames_b"`
+}
+
+// OrganizationOverlapResponse lists the assets two organizations have in common.
+type OrganizationOverlapResponse struct {
+	OrganizationA OrganizationResponse `json:"organization_a"`
+	OrganizationB OrganizationResponse `json:"organization_b"`
+	RootDomains   []string             `json:"root_domains"`
+	Subdomains    []string             `json:"subdomains"`
+	IPAddresses   []SharedIPAddress    `json:"ip_addresses"`
+	Technologies  []TechnologyBasic    `json:"technologies"` // Detected on a subdomain or endpoint of each organization
+}
+
 // --- Handler Functions ---
 
 // CreateOrganization handles POST requests to create a new organization.
@@ -40,13 +76,13 @@ func CreateOrganization(c *gin.Context) {
 	var input OrganizationCreate
 	// Bind JSON request body to the input struct, handling validation errors
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	trimmedName := strings.TrimSpace(input.Name)
 	if trimmedName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization name cannot be empty"})
+		RespondError(c, http.StatusBadRequest, "Organization name cannot be empty")
 		return
 	}
 
@@ -60,9 +96,9 @@ func CreateOrganization(c *gin.Context) {
 		// A simple check for existing name before creating might be more reliable across DBs
 		var existingOrg models.Organization
 		if errors.Is(result.Error, gorm.ErrDuplicatedKey) || db.Where("name = ?", trimmedName).First(&existingOrg).Error == nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "Organization with name '" + trimmedName + "' already exists"})
+			RespondError(c, http.StatusConflict, "Organization with name '"+trimmedName+"' already exists")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization", "details": result.Error.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to create organization", result.Error.Error())
 		}
 		return
 	}
@@ -84,7 +120,7 @@ func GetOrganizations(c *gin.Context) {
 	// Retrieve all organizations, ordered by name
 	result := db.Order("name asc").Find(&organizations)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organizations", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve organizations", result.Error.Error())
 		return
 	}
 
@@ -106,7 +142,7 @@ func GetOrganization(c *gin.Context) {
 	idStr := c.Param("org_id")                     // Gin uses :param_name syntax in route definition
 	orgID, err := strconv.ParseUint(idStr, 10, 32) // Parse ID from URL param
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
 		return
 	}
 
@@ -117,9 +153,9 @@ func GetOrganization(c *gin.Context) {
 	result := db.Preload("RootDomains").First(&organization, uint(orgID)) // Preload RootDomains here
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			RespondError(c, http.StatusNotFound, "Organization not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organization", "details": result.Error.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve organization", result.Error.Error())
 		}
 		return
 	}
@@ -144,3 +180,440 @@ func GetOrganization(c *gin.Context) {
 	// Return the organization object which now includes the counts AND the preloaded RootDomains
 	c.JSON(http.StatusOK, organization)
 }
+
+// MergeOrganization handles POST requests merging an organization into a target organization.
+// All root domains move to the target; a domain already present there is merged into the existing
+// one along with its subdomains, endpoints, technologies, scans and screenshots. The emptied source
+// organization is deleted. Everything happens in one transaction.
+func MergeOrganization(c *gin.Context) {
+	idStr := c.Param("org_id")
+	orgID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
+		return
+	}
+
+	var input OrganizationMerge
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.TargetOrganizationID == uint(orgID) {
+		RespondError(c, http.StatusBadRequest, "Cannot merge an organization into itself")
+		return
+	}
+
+	db := database.GetDB()
+	response := OrganizationMergeResponse{SourceOrganizationID: uint(orgID), TargetOrganizationID: input.TargetOrganizationID}
+	var source, target models.Organization
+
+	// Tracked as a maintenance job; the merge runs in one transaction and cannot be cancelled
+	job := jobs.Start(jobs.TypeMaintenance, fmt.Sprintf("Merge organization %d into %d", orgID, input.TargetOrganizationID), nil)
+	txErr := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&source, uint(orgID)).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&target, input.TargetOrganizationID).Error; err != nil {
+			return err
+		}
+
+		var sourceDomains []models.RootDomain
+		if err := tx.Where("organization_id = ?", source.ID).Find(&sourceDomains).Error; err != nil {
+			return err
+		}
+		for i := range sourceDomains {
+			domain := &sourceDomains[i]
+			var existing models.RootDomain
+			errCheck := tx.Where("domain = ? AND organization_id = ?", domain.Domain, target.ID).First(&existing).Error
+			if errors.Is(errCheck, gorm.ErrRecordNotFound) {
+				if err := tx.Model(domain).Update("organization_id", target.ID).Error; err != nil {
+					return err
+				}
+				response.DomainsMoved++
+				continue
+			} else if errCheck != nil {
+				return errCheck
+			}
+
+			if err := mergeRootDomain(tx, domain, &existing, &response); err != nil {
+				return fmt.Errorf("merging domain '%s': %w", domain.Domain, err)
+			}
+			response.DomainsMerged++
+		}
+
+		// Sessions hold logins to the organization's applications, they move along with its domains
+		if err := tx.Model(&models.Session{}).Where("organization_id = ?", source.ID).Update("organization_id", target.ID).Error; err != nil {
+			return err
+		}
+		// So do scope rules, except for patterns the target has a rule of its own for
+		if err := tx.Where("organization_id = ? AND pattern IN (?)", source.ID,
+			tx.Model(&models.ScopeRule{}).Select("pattern").Where("organization_id = ?", target.ID)).
+			Delete(&models.ScopeRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ScopeRule{}).Where("organization_id = ?", source.ID).Update("organization_id", target.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&source).Error
+	})
+
+	job.Finish(txErr)
+	if txErr != nil {
+		switch {
+		case errors.Is(txErr, gorm.ErrRecordNotFound) && source.ID == 0: // Source lookup is the first query in the transaction
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Organization with ID %d not found", orgID))
+		case errors.Is(txErr, gorm.ErrRecordNotFound) && target.ID == 0:
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Target organization with ID %d not found", input.TargetOrganizationID))
+		default:
+			RespondError(c, http.StatusInternalServerError, "Failed to merge organizations", txErr.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// mergeRootDomain moves the subtree of source into target (same domain name) and deletes source.
+// Subdomains with a hostname already present under target are merged via mergeSubdomain.
+func mergeRootDomain(tx *gorm.DB, source, target *models.RootDomain, response *OrganizationMergeResponse) error {
+	var sourceSubs []models.Subdomain
+	if err := tx.Where("root_domain_id = ?", source.ID).Find(&sourceSubs).Error; err != nil {
+		return err
+	}
+	for i := range sourceSubs {
+		sub := &sourceSubs[i]
+		var existing models.Subdomain
+		errCheck := tx.Where("root_domain_id = ? AND hostname = ?", target.ID, sub.Hostname).First(&existing).Error
+		if errors.Is(errCheck, gorm.ErrRecordNotFound) {
+			if err := tx.Model(sub).Update("root_domain_id", target.ID).Error; err != nil {
+				return err
+			}
+			response.SubdomainsMoved++
+			continue
+		} else if errCheck != nil {
+			return errCheck
+		}
+
+		merged, err := mergeSubdomain(tx, sub, &existing)
+		if err != nil {
+			return fmt.Errorf("merging subdomain '%s': %w", sub.Hostname, err)
+		}
+		response.SubdomainsMerged++
+		response.EndpointsMerged += merged
+	}
+
+	// Scans of the source domain now belong to the target
+	if err := tx.Model(&models.Scan{}).Where("root_domain_id = ?", source.ID).Update("root_domain_id", target.ID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.ExternalLink{}).Where("root_domain_id = ?", source.ID).Update("root_domain_id", target.ID).Error; err != nil {
+		return err
+	}
+	if source.LastScannedAt != nil && (target.LastScannedAt == nil || source.LastScannedAt.After(*target.LastScannedAt)) {
+		if err := tx.Model(target).Update("last_scanned_at", source.LastScannedAt).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(source).Error
+}
+
+// mergeSubdomain moves everything linked to source into target (same hostname) and deletes source.
+// Returns the number of endpoints that were combined with an existing path/method on target.
+func mergeSubdomain(tx *gorm.DB, source, target *models.Subdomain) (int, error) {
+	var sourceEndpoints []models.Endpoint
+	if err := tx.Where("subdomain_id = ?", source.ID).Find(&sourceEndpoints).Error; err != nil {
+		return 0, err
+	}
+	merged := 0
+	for i := range sourceEndpoints {
+		ep := &sourceEndpoints[i]
+		var existing models.Endpoint
+		errCheck := tx.Where("subdomain_id = ? AND path = ? AND method = ?", target.ID, ep.Path, ep.Method).First(&existing).Error
+		if errors.Is(errCheck, gorm.ErrRecordNotFound) {
+			if err := tx.Model(ep).Update("subdomain_id", target.ID).Error; err != nil {
+				return merged, err
+			}
+			continue
+		} else if errCheck != nil {
+			return merged, errCheck
+		}
+		if err := mergeEndpoint(tx, ep, &existing); err != nil {
+			return merged, err
+		}
+		merged++
+	}
+
+	if err := moveJoinRows(tx, "subdomain_technologies", "subdomain_id", source.ID, target.ID); err != nil {
+		return merged, err
+	}
+	if err := tx.Where("subdomain_id = ? AND tag IN (?)", source.ID, tx.Model(&models.SubdomainTag{}).Select("tag").Where("subdomain_id = ?", target.ID)).Delete(&models.SubdomainTag{}).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Model(&models.SubdomainTag{}).Where("subdomain_id = ?", source.ID).Update("subdomain_id", target.ID).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Model(&models.Screenshot{}).Where("subdomain_id = ?", source.ID).Update("subdomain_id", target.ID).Error; err != nil {
+		return merged, err
+	}
+	// Target keeps its own TLS check if it has one
+	if err := tx.Where("subdomain_id = ? AND EXISTS (?)", source.ID, tx.Model(&models.TLSCheck{}).Select("1").Where("subdomain_id = ?", target.ID)).Delete(&models.TLSCheck{}).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Model(&models.TLSCheck{}).Where("subdomain_id = ?", source.ID).Update("subdomain_id", target.ID).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Where("subdomain_id = ? AND url IN (?)", source.ID, tx.Model(&models.SensitiveFile{}).Select("url").Where("subdomain_id = ?", target.ID)).Delete(&models.SensitiveFile{}).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Model(&models.SensitiveFile{}).Where("subdomain_id = ?", source.ID).Update("subdomain_id", target.ID).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Where("subdomain_id = ? AND url IN (?)", source.ID, tx.Model(&models.TechFingerprint{}).Select("url").Where("subdomain_id = ?", target.ID)).Delete(&models.TechFingerprint{}).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Model(&models.TechFingerprint{}).Where("subdomain_id = ?", source.ID).Update("subdomain_id", target.ID).Error; err != nil {
+		return merged, err
+	}
+	if err := tx.Model(&models.Scan{}).Where("subdomain_id = ?", source.ID).Update("subdomain_id", target.ID).Error; err != nil {
+		return merged, err
+	}
+
+	// Keep the widest first/last seen window and any known IP
+	updates := map[string]interface{}{"is_active": target.IsActive || source.IsActive}
+	if source.DiscoveredAt.Before(target.DiscoveredAt) {
+		updates["discovered_at"] = source.DiscoveredAt
+	}
+	if source.LastSeenAt != nil && (target.LastSeenAt == nil || source.LastSeenAt.After(*target.LastSeenAt)) {
+		updates["last_seen_at"] = source.LastSeenAt
+	}
+	if target.IPAddress == "" && source.IPAddress != "" {
+		updates["ip_address"] = source.IPAddress
+	}
+	if err := tx.Model(target).Updates(updates).Error; err != nil {
+		return merged, err
+	}
+	return merged, tx.Delete(source).Error
+}
+
+// mergeEndpoint moves everything linked to source into target (same path/method) and deletes source.
+func mergeEndpoint(tx *gorm.DB, source, target *models.Endpoint) error {
+	// Parameters are unique per endpoint by name and type
+	var targetParams []models.Parameter
+	if err := tx.Where("endpoint_id = ?", target.ID).Find(&targetParams).Error; err != nil {
+		return err
+	}
+	known := make(map[string]struct{}, len(targetParams))
+	for _, param := range targetParams {
+		known[param.ParamType+"\x00"+param.Name] = struct{}{}
+	}
+	var sourceParams []models.Parameter
+	if err := tx.Where("endpoint_id = ?", source.ID).Find(&sourceParams).Error; err != nil {
+		return err
+	}
+	for i := range sourceParams {
+		param := &sourceParams[i]
+		if _, ok := known[param.ParamType+"\x00"+param.Name]; ok {
+			if err := tx.Delete(param).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Model(param).Update("endpoint_id", target.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := moveJoinRows(tx, "endpoint_technologies", "endpoint_id", source.ID, target.ID); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.RequestResponse{}).Where("endpoint_id = ?", source.ID).Update("endpoint_id", target.ID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Screenshot{}).Where("endpoint_id = ?", source.ID).Update("endpoint_id", target.ID).Error; err != nil {
+		return err
+	}
+	// External links the target already has are dropped, like technology join rows
+	if err := tx.Where("endpoint_id = ? AND target_url IN (?)", source.ID, tx.Model(&models.ExternalLink{}).Select("target_url").Where("endpoint_id = ?", target.ID)).Delete(&models.ExternalLink{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.ExternalLink{}).Where("endpoint_id = ?", source.ID).Update("endpoint_id", target.ID).Error; err != nil {
+		return err
+	}
+	// Both endpoints may have been observed by the same scan, the target's record of it is kept
+	if err := tx.Where("endpoint_id = ? AND scan_id IN (?)", source.ID, tx.Model(&models.EndpointStatusHistory{}).Select("scan_id").Where("endpoint_id = ? AND scan_id IS NOT NULL", target.ID)).Delete(&models.EndpointStatusHistory{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.EndpointStatusHistory{}).Where("endpoint_id = ?", source.ID).Update("endpoint_id", target.ID).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	if source.DiscoveredAt.Before(target.DiscoveredAt) {
+		updates["discovered_at"] = source.DiscoveredAt
+	}
+	if source.LastSeenAt != nil && (target.LastSeenAt == nil || source.LastSeenAt.After(*target.LastSeenAt)) {
+		updates["last_seen_at"] = source.LastSeenAt
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(target).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(source).Error
+}
+
+// moveJoinRows relinks technology join rows from one owner to another, dropping rows
+// for technologies the new owner is already linked to.
+func moveJoinRows(tx *gorm.DB, table, ownerColumn string, fromID, toID uint) error {
+	if err := tx.Exec("DELETE FROM "+table+" WHERE "+ownerColumn+" = ? AND technology_id IN (SELECT technology_id FROM "+table+" WHERE "+ownerColumn+" = ?)", fromID, toID).Error; err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE "+table+" SET "+ownerColumn+" = ? WHERE "+ownerColumn+" = ?", toID, fromID).Error
+}
+
+// CompareOrganizations handles GET requests reporting the overlap between two organizations
+// (query parameters a and b): shared root domains, subdomain hostnames, resolved IPs and technologies.
+func CompareOrganizations(c *gin.Context) {
+	var orgs [2]models.Organization
+	db := database.GetDB()
+	for i, param := range []string{"a", "b"} {
+		idStr := c.Query(param)
+		if idStr == "" {
+			RespondError(c, http.StatusBadRequest, "Query parameters a and b (organization IDs) are required")
+			return
+		}
+		orgID, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid organization ID format for %s", param))
+			return
+		}
+		if err := db.First(&orgs[i], uint(orgID)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Organization with ID %d not found", orgID))
+			} else {
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve organization", err.Error())
+			}
+			return
+		}
+	}
+	if orgs[0].ID == orgs[1].ID {
+		RespondError(c, http.StatusBadRequest, "Cannot compare an organization with itself")
+		return
+	}
+
+	response := OrganizationOverlapResponse{
+		OrganizationA: OrganizationResponse{ID: orgs[0].ID, Name: orgs[0].Name, CreatedAt: orgs[0].CreatedAt},
+		OrganizationB: OrganizationResponse{ID: orgs[1].ID, Name: orgs[1].Name, CreatedAt: orgs[1].CreatedAt},
+		IPAddresses:   []SharedIPAddress{},
+		Technologies:  []TechnologyBasic{},
+	}
+
+	// Root domains
+	var domains [2][]string
+	for i := range orgs {
+		if err := db.Model(&models.RootDomain{}).Where("organization_id = ?", orgs[i].ID).Pluck("LOWER(domain)", &domains[i]).Error; err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve root domains", err.Error())
+			return
+		}
+	}
+	response.RootDomains = intersectStrings(domains[0], domains[1])
+
+	// Subdomains and their resolved IPs
+	type hostRow struct {
+		Hostname  string
+		IPAddress string
+	}
+	var hosts [2][]hostRow
+	var hostnames [2][]string
+	ipHosts := [2]map[string][]string{{}, {}}
+	for i := range orgs {
+		if err := db.Model(&models.Subdomain{}).
+			Select("LOWER(subdomains.hostname) AS hostname, subdomains.ip_address").
+			Joins("JOIN root_domains ON root_domains.id = subdomains.root_domain_id").
+			Where("root_domains.organization_id = ?", orgs[i].ID).
+			Scan(&hosts[i]).Error; err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains", err.Error())
+			return
+		}
+		for _, host := range hosts[i] {
+			hostnames[i] = append(hostnames[i], host.Hostname)
+			if host.IPAddress != "" {
+				ipHosts[i][host.IPAddress] = append(ipHosts[i][host.IPAddress], host.Hostname)
+			}
+		}
+	}
+	response.Subdomains = intersectStrings(hostnames[0], hostnames[1])
+
+	var ips [2][]string
+	for i := range ipHosts {
+		for ip := range ipHosts[i] {
+			ips[i] = append(ips[i], ip)
+		}
+	}
+	for _, ip := range intersectStrings(ips[0], ips[1]) {
+		sort.Strings(ipHosts[0][ip])
+		sort.Strings(ipHosts[1][ip])
+		response.IPAddresses = append(response.IPAddresses, SharedIPAddress{IPAddress: ip, HostnamesA: ipHosts[0][ip], HostnamesB: ipHosts[1][ip]})
+	}
+
+	// Technologies linked to any subdomain or endpoint of each organization
+	var techIDs [2][]uint
+	for i := range orgs {
+		err := db.Raw(`SELECT st.technology_id FROM subdomain_technologies st
+			JOIN subdomains s ON s.id = st.subdomain_id
+			JOIN root_domains rd ON rd.id = s.root_domain_id
+			WHERE rd.organization_id = ?
+			UNION
+			SELECT et.technology_id FROM endpoint_technologies et
+			JOIN endpoints e ON e.id = et.endpoint_id
+			JOIN subdomains s ON s.id = e.subdomain_id
+			JOIN root_domains rd ON rd.id = s.root_domain_id
+			WHERE rd.organization_id = ?`, orgs[i].ID, orgs[i].ID).Scan(&techIDs[i]).Error
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve technologies", err.Error())
+			return
+		}
+	}
+	inA := make(map[uint]struct{}, len(techIDs[0]))
+	for _, id := range techIDs[0] {
+		inA[id] = struct{}{}
+	}
+	var sharedTechIDs []uint
+	for _, id := range techIDs[1] {
+		if _, ok := inA[id]; ok {
+			sharedTechIDs = append(sharedTechIDs, id)
+		}
+	}
+	if len(sharedTechIDs) > 0 {
+		var techs []models.Technology
+		if err := db.Where("id IN ?", sharedTechIDs).Order("name").Find(&techs).Error; err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve technologies", err.Error())
+			return
+		}
+		response.Technologies = toTechnologyBasics(techs)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// intersectStrings returns the distinct values present in both slices, sorted.
+func intersectStrings(a, b []string) []string {
+	inA := make(map[string]struct{}, len(a))
+	for _, value := range a {
+		inA[value] = struct{}{}
+	}
+	shared := []string{}
+	seen := make(map[string]struct{})
+	for _, value := range b {
+		if _, ok := inA[value]; !ok {
+			continue
+		}
+		if _, dup := seen[value]; dup {
+			continue
+		}
+		seen[value] = struct{}{}
+		shared = append(shared, value)
+	}
+	sort.Strings(shared)
+	return shared
+}
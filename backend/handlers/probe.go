@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"rewrite-go/scanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Request Structs ---
+
+// ProbeRequest represents the input for an ad-hoc probe.
+type ProbeRequest struct {
+	URL string `json:"url" binding:"required"` // URL or bare hostname
+}
+
+// --- Handler Functions ---
+
+// ProbeURL handles POST requests checking a single URL or host synchronously: liveness, status, title
+// and technologies. Nothing is saved. Unreachable targets are reported with alive false, not as an error.
+func ProbeURL(c *gin.Context) {
+	var input ProbeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := scanner.Probe(c.Request.Context(), input.URL)
+	if err != nil {
+		if errors.Is(err, scanner.ErrInvalidProbeTarget) {
+			RespondError(c, http.StatusBadRequest, "Invalid url", err.Error())
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to probe target", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// reportSummaryLength is the number of characters of a scan's results summary shown in the report.
+const reportSummaryLength = 120
+
+// domainReport is the data rendered into a domain's Markdown report. Lists are capped at Top entries.
+type domainReport struct {
+	Domain           string
+	Organization     string
+	GeneratedAt      time.Time
+	LastScannedAt    *time.Time
+	Subdomains       int64
+	ActiveSubdomains int64
+	Endpoints        int64
+	Top              int
+	Hosts            []reportHost
+	NotableEndpoints []reportEndpoint
+	Technologies     []reportTechnology
+	Scans            []models.Scan
+}
+
+// reportHost is a subdomain listed by SubdomainScore.
+type reportHost struct {
+	Hostname string
+	IsActive bool
+	Score    int64
+	Signals  SubdomainSignals
+}
+
+// reportEndpoint is an endpoint answering with a status outside defaultStatusCodes.
+type reportEndpoint struct {
+	Hostname   string
+	Path       string
+	Method     string
+	StatusCode int
+}
+
+// reportTechnology is a technology with the number of subdomains running it.
+type reportTechnology struct {
+	Name  string
+	Hosts int64
+}
+
+// domainReportTemplate renders a domainReport. Values from scans are passed through cell or code, so
+// hostnames and paths can't break the Markdown tables.
+var domainReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"cell": markdownCell,
+	"code": markdownCode,
+	"shorten": func(text string) string {
+		if runes := []rune(text); len(runes) > reportSummaryLength {
+			return string(runes[:reportSummaryLength]) + "…"
+		}
+		return text
+	},
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+}).Parse(`# Attack surface report: {{ .Domain }}
+
+{{ if .Organization }}- **Organization:** {{ cell .Organization }}
+{{ end }}- **Generated:** {{ date .GeneratedAt }}
+- **Last scanned:** {{ if .LastScannedAt }}{{ date .LastScannedAt }}{{ else }}never{{ end }}
+- **Subdomains:** {{ .Subdomains }} ({{ .ActiveSubdomains }} active)
+- **Endpoints:** {{ .Endpoints }}
+
+## Top subdomains
+{{ if .Hosts }}
+Highest review scores (endpoints, parameters, technologies and unusual status codes), up to {{ .Top }}.
+
+| Subdomain | Active | Score | Endpoints | Parameters | Technologies |
+|---|---|---|---|---|---|
+{{ range .Hosts }}| {{ code .Hostname }} | {{ if .IsActive }}yes{{ else }}no{{ end }} | {{ .Score }} | {{ .Signals.Endpoints }} | {{ .Signals.Parameters }} | {{ .Signals.Technologies }} |
+{{ end }}{{ else }}
+No subdomain has endpoints or technologies yet.
+{{ end }}
+## Notable endpoints
+{{ if .NotableEndpoints }}
+Endpoints answering with a status other than 200, 301, 302 or 404, often auth walls, admin areas or errors (up to {{ .Top }}).
+
+| Status | Method | URL |
+|---|---|---|
+{{ range .NotableEndpoints }}| {{ .StatusCode }} | {{ cell .Method }} | {{ code (printf "https://%s%s" .Hostname .Path) }} |
+{{ end }}{{ else }}
+None.
+{{ end }}
+## Technologies
+{{ if .Technologies }}
+| Technology | Subdomains |
+|---|---|
+{{ range .Technologies }}| {{ cell .Name }} | {{ .Hosts }} |
+{{ end }}{{ else }}
+None detected.
+{{ end }}
+## Recent scans
+{{ if .Scans }}
+| ID | Type | Status | Started | Summary |
+|---|---|---|---|---|
+{{ range .Scans }}| {{ .ID }} | {{ cell .ScanType }} | {{ cell .Status }} | {{ date .StartedAt }} | {{ cell (shorten .ResultsSummary) }} |
+{{ end }}{{ else }}
+No scans yet.
+{{ end }}`))
+
+// markdownCell makes text safe for a Markdown table cell: pipes are escaped and line breaks flattened.
+func markdownCell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// markdownCode renders text as an inline code span in a table cell.
+func markdownCode(text string) string {
+	text = strings.ReplaceAll(markdownCell(text), "`", "'")
+	return "`" + text + "`"
+}
+
+// GetDomainReport handles GET requests rendering a root domain's attack surface as a Markdown report for
+// tickets and wikis: totals, the top subdomains by SubdomainScore, notable endpoints, technologies and recent
+// scans. Each list holds at most top entries (default 10, max 50).
+func GetDomainReport(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+	top, ok := parseIntQuery(c, "top", 10, 1, 50)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.Preload("Organization").First(&domain, uint(domainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+		return
+	}
+	report, err := buildDomainReport(db, &domain, top)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to build domain report", err.Error())
+		return
+	}
+	var body bytes.Buffer
+	if err := domainReportTemplate.Execute(&body, report); err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to render domain report", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", body.Bytes())
+}
+
+// buildDomainReport collects the report of a root domain with top entries per list.
+func buildDomainReport(db *gorm.DB, domain *models.RootDomain, top int) (*domainReport, error) {
+	report := &domainReport{
+		Domain:        domain.Domain,
+		GeneratedAt:   time.Now(),
+		LastScannedAt: domain.LastScannedAt,
+		Top:           top,
+	}
+	if domain.Organization != nil {
+		report.Organization = domain.Organization.Name
+	}
+
+	var subdomains []models.Subdomain
+	if err := db.Select("id", "hostname", "is_active").Where("root_domain_id = ?", domain.ID).Find(&subdomains).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve subdomains: %w", err)
+	}
+	signals, err := collectSubdomainSignals(db, domain.ID)
+	if err != nil {
+		return nil, err
+	}
+	report.Subdomains = int64(len(subdomains))
+	for _, sub := range subdomains {
+		if sub.IsActive {
+			report.ActiveSubdomains++
+		}
+		report.Endpoints += signals[sub.ID].Endpoints
+		if score := SubdomainScore(signals[sub.ID]); score > 0 {
+			report.Hosts = append(report.Hosts, reportHost{Hostname: sub.Hostname, IsActive: sub.IsActive, Score: score, Signals: signals[sub.ID]})
+		}
+	}
+	slices.SortFunc(report.Hosts, func(a, b reportHost) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Hostname, b.Hostname))
+	})
+	report.Hosts = report.Hosts[:min(top, len(report.Hosts))]
+
+	defaultCodes := make([]int, 0, len(defaultStatusCodes))
+	for code := range defaultStatusCodes {
+		defaultCodes = append(defaultCodes, code)
+	}
+	if err := db.Table("endpoints e").
+		Select("s.hostname, e.path, e.method, e.status_code").
+		Joins("JOIN subdomains s ON s.id = e.subdomain_id").
+		Where("s.root_domain_id = ? AND e.status_code NOT IN ?", domain.ID, defaultCodes).
+		Order("e.status_code, s.hostname, e.path").Limit(top).
+		Scan(&report.NotableEndpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve notable endpoints: %w", err)
+	}
+
+	if err := db.Raw(`SELECT t.name AS name, COUNT(DISTINCT h.subdomain_id) AS hosts FROM (
+			SELECT st.subdomain_id, st.technology_id FROM subdomain_technologies st
+			JOIN subdomains s ON s.id = st.subdomain_id WHERE s.root_domain_id = @domain
+			UNION
+			SELECT e.subdomain_id, et.technology_id FROM endpoint_technologies et
+			JOIN endpoints e ON e.id = et.endpoint_id
+			JOIN subdomains s ON s.id = e.subdomain_id WHERE s.root_domain_id = @domain
+		) h JOIN technologies t ON t.id = h.technology_id
+		GROUP BY t.id ORDER BY hosts DESC, t.name LIMIT @top`, map[string]interface{}{"domain": domain.ID, "top": top}).
+		Scan(&report.Technologies).Error; err != nil {
+		return nil, fmt.Errorf("failed to count technologies: %w", err)
+	}
+
+	if err := db.Where("root_domain_id = ?", domain.ID).Order("started_at desc").Limit(top).Find(&report.Scans).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve scans: %w", err)
+	}
+	return report, nil
+}
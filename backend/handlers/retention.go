@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"rewrite-go/config"
+	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultScanRetentionKeep = 5   // Latest finished scans kept per target regardless of age
+	scanPruneBatchSize       = 100 // Scans deleted per transaction
+)
+
+// finishedScanStatuses are the scan statuses retention may prune; pending and running scans are never touched.
+var finishedScanStatuses = []string{"completed", "failed", "cancelled"}
+
+// PrunedScan describes a scan removed (or, in a dry run, to be removed) by PruneScans.
+type PrunedScan struct {
+	ID           uint       `json:"id"`
+	RootDomainID uint       `json:"root_domain_id"`
+	SubdomainID  *uint      `json:"subdomain_id,omitempty"`
+	ScanType     string     `json:"scan_type"`
+	Status       string     `json:"status"`
+	StartedAt    time.Time  `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Screenshots  int        `json:"screenshots"`
+}
+
+// ScanPruneResponse reports what a retention run pruned.
+type ScanPruneResponse struct {
+	DryRun            bool         `json:"dry_run"`
+	RetentionDays     int          `json:"retention_days"`
+	KeepPerTarget     int          `json:"keep_per_target"`
+	Cutoff            time.Time    `json:"cutoff"`
+	ScansChecked      int          `json:"scans_checked"`
+	ScansPruned       int          `json:"scans_pruned"`
+	ScreenshotsPruned int          `json:"screenshots_pruned"`
+	FilesDeleted      int          `json:"files_deleted"`
+	BytesFreed        int64        `json:"bytes_freed"` // Size of the screenshot files, also reported in dry runs
+	FileErrors        []string     `json:"file_errors,omitempty"`
+	Scans             []PrunedScan `json:"scans"`
+}
+
+// PruneScans handles POST requests deleting finished scans older than the retention period together with
+// their screenshots (records and files) and scan directory. The latest keep scans of each target (root domain, or subdomain
+// for subdomain scans) are kept regardless of age. days and keep default to the SCAN_RETENTION_DAYS and
+// SCAN_RETENTION_KEEP settings. This is a dry run unless dry_run=false, reporting what would be pruned.
+func PruneScans(c *gin.Context) {
+	days, ok := parseIntQuery(c, "days", config.GetInt("SCAN_RETENTION_DAYS", 0), 0, 0)
+	if !ok {
+		return
+	}
+	if days < 1 {
+		RespondError(c, http.StatusBadRequest, "No retention period configured", "Pass days or set SCAN_RETENTION_DAYS to a positive number of days")
+		return
+	}
+	keep, ok := parseIntQuery(c, "keep", config.GetInt("SCAN_RETENTION_KEEP", defaultScanRetentionKeep), 0, 0)
+	if !ok {
+		return
+	}
+	dryRun := true
+	if dryRunStr := c.Query("dry_run"); dryRunStr != "" {
+		parsed, err := strconv.ParseBool(dryRunStr)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid dry_run, must be true or false")
+			return
+		}
+		dryRun = parsed
+	}
+
+	db := database.GetDB()
+	response := ScanPruneResponse{
+		DryRun:        dryRun,
+		RetentionDays: days,
+		KeepPerTarget: keep,
+		Cutoff:        time.Now().AddDate(0, 0, -days),
+		Scans:         []PrunedScan{},
+	}
+
+	// Newest first, so the first keep scans seen per target are the ones to keep
+	var scans []models.Scan
+	if err := db.Where("status IN ?", finishedScanStatuses).
+		Order("started_at desc, id desc").Find(&scans).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve scans", err.Error())
+		return
+	}
+	response.ScansChecked = len(scans)
+
+	type scanTarget struct {
+		rootDomainID uint
+		subdomainID  uint
+	}
+	keptPerTarget := make(map[scanTarget]int)
+	var pruneIDs []uint
+	for _, scan := range scans {
+		target := scanTarget{rootDomainID: scan.RootDomainID}
+		if scan.SubdomainID != nil {
+			target.subdomainID = *scan.SubdomainID
+		}
+		finishedAt := scan.StartedAt
+		if scan.CompletedAt != nil {
+			finishedAt = *scan.CompletedAt
+		}
+		if keptPerTarget[target] < keep || !finishedAt.Before(response.Cutoff) {
+			keptPerTarget[target]++
+			continue
+		}
+		pruneIDs = append(pruneIDs, scan.ID)
+		response.Scans = append(response.Scans, PrunedScan{
+			ID:           scan.ID,
+			RootDomainID: scan.RootDomainID,
+			SubdomainID:  scan.SubdomainID,
+			ScanType:     scan.ScanType,
+			Status:       scan.Status,
+			StartedAt:    scan.StartedAt,
+			CompletedAt:  scan.CompletedAt,
+		})
+	}
+
+	if len(pruneIDs) == 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	var screenshots []models.Screenshot
+	if err := db.Select("id, scan_id, file_path").Where("scan_id IN ?", pruneIDs).Find(&screenshots).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve screenshots", err.Error())
+		return
+	}
+	screenshotCounts := make(map[uint]int)
+	screenshotFiles := make(map[uint][]string) // Scan ID -> screenshot files
+	for _, shot := range screenshots {
+		screenshotCounts[shot.ScanID]++
+		if shot.FilePath == "" {
+			continue // Skipped capture, no file
+		}
+		screenshotFiles[shot.ScanID] = append(screenshotFiles[shot.ScanID], shot.FilePath)
+		if info, err := os.Stat(shot.FilePath); err == nil {
+			response.BytesFreed += info.Size()
+		}
+	}
+	for i := range response.Scans {
+		response.Scans[i].Screenshots = screenshotCounts[response.Scans[i].ID]
+	}
+	response.ScreenshotsPruned = len(screenshots)
+
+	if dryRun {
+		response.ScansPruned = len(pruneIDs)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Tracked as a maintenance job; cancelling it stops before the next batch
+	jobCtx, jobCancel := context.WithCancel(c.Request.Context())
+	defer jobCancel()
+	job := jobs.Start(jobs.TypeMaintenance, fmt.Sprintf("Prune scans older than %d days", days), jobCancel)
+
+	for start := 0; start < len(pruneIDs); start += scanPruneBatchSize {
+		if jobCtx.Err() != nil {
+			job.Finish(nil) // Keeps the cancelled status
+			RespondError(c, http.StatusConflict, "Pruning was cancelled", fmt.Sprintf("%d of %d scans were pruned before cancellation", response.ScansPruned, len(pruneIDs)))
+			return
+		}
+		job.SetProgress(start, len(pruneIDs))
+		end := min(start+scanPruneBatchSize, len(pruneIDs))
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return deleteScans(tx, pruneIDs[start:end])
+		}); err != nil {
+			job.Finish(err)
+			RespondError(c, http.StatusInternalServerError, "Failed to prune scans", err.Error())
+			return
+		}
+		response.ScansPruned += end - start
+
+		// Files go once their records are gone, so a failed transaction never leaves records without files
+		for _, scanID := range pruneIDs[start:end] {
+			for _, filePath := range screenshotFiles[scanID] {
+				if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+					response.FileErrors = append(response.FileErrors, err.Error())
+					continue
+				}
+				response.FilesDeleted++
+			}
+			// The scan directory holds nothing but the scan's artifacts; the legacy screenshot
+			// directory is only removed if nothing else is left in it
+			if err := os.RemoveAll(config.ScanDir(scanID)); err != nil {
+				response.FileErrors = append(response.FileErrors, err.Error())
+			}
+			_ = os.Remove(filepath.Join(config.DataDir(), "screenshots", fmt.Sprintf("scan_%d", scanID)))
+		}
+	}
+
+	job.SetProgress(len(pruneIDs), len(pruneIDs))
+	job.Finish(nil)
+	log.Printf("Scan retention pruned %d scans and %d screenshots (%d files, %d bytes) older than %d days.",
+		response.ScansPruned, response.ScreenshotsPruned, response.FilesDeleted, response.BytesFreed, days)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// deleteScans deletes scans and their screenshot records. Assets discovered by the scans are kept;
+// their scan references, and those of follow-up scans, are cleared.
+func deleteScans(tx *gorm.DB, scanIDs []uint) error {
+	if err := tx.Where("scan_id IN ?", scanIDs).Delete(&models.Screenshot{}).Error; err != nil {
+		return fmt.Errorf("failed to delete screenshots: %w", err)
+	}
+	if err := tx.Model(&models.Subdomain{}).Where("scan_id IN ?", scanIDs).Update("scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear subdomain scan references: %w", err)
+	}
+	if err := tx.Model(&models.Endpoint{}).Where("scan_id IN ?", scanIDs).Update("scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear endpoint scan references: %w", err)
+	}
+	if err := tx.Model(&models.ExternalLink{}).Where("scan_id IN ?", scanIDs).Update("scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear external link scan references: %w", err)
+	}
+	if err := tx.Model(&models.EndpointStatusHistory{}).Where("scan_id IN ?", scanIDs).Update("scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear endpoint status history scan references: %w", err)
+	}
+	if err := tx.Model(&models.TLSCheck{}).Where("scan_id IN ?", scanIDs).Update("scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear TLS check scan references: %w", err)
+	}
+	if err := tx.Model(&models.SensitiveFile{}).Where("scan_id IN ?", scanIDs).Update("scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear sensitive file scan references: %w", err)
+	}
+	if err := tx.Model(&models.TechFingerprint{}).Where("scan_id IN ?", scanIDs).Update("scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear tech fingerprint scan references: %w", err)
+	}
+	if err := tx.Model(&models.Scan{}).Where("parent_scan_id IN ?", scanIDs).Update("parent_scan_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear follow-up scan references: %w", err)
+	}
+	if err := tx.Where("id IN ?", scanIDs).Delete(&models.Scan{}).Error; err != nil {
+		return fmt.Errorf("failed to delete scans: %w", err)
+	}
+	return nil
+}
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"rewrite-go/database"
 	"rewrite-go/models"
+	"rewrite-go/scanner"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -32,39 +35,88 @@ type ScanSectionConfig struct {
 
 // ScanTemplateCreate represents the request body for creating a scan template.
 type ScanTemplateCreate struct {
-	Name                string             `json:"name" binding:"required"`
-	Description         *string            `json:"description"` // Use pointer for optional
-	SubdomainScanConfig *ScanSectionConfig `json:"subdomain_scan_config"`
-	URLScanConfig       *ScanSectionConfig `json:"url_scan_config"`
-	ParameterScanConfig *ScanSectionConfig `json:"parameter_scan_config"`
-	TechDetectEnabled   bool               `json:"tech_detect_enabled"` // Default handled by Go's bool default (false), adjust if needed
-	ScreenshotEnabled   bool               `json:"screenshot_enabled"`  // Add screenshot enabled field
+	Name                 string             `json:"name" binding:"required"`
+	Description          *string            `json:"description"` // Use pointer for optional
+	SubdomainScanConfig  *ScanSectionConfig `json:"subdomain_scan_config"`
+	URLScanConfig        *ScanSectionConfig `json:"url_scan_config"`
+	ParameterScanConfig  *ScanSectionConfig `json:"parameter_scan_config"`
+	TechDetectEnabled    bool               `json:"tech_detect_enabled"`    // Default handled by Go's bool default (false), adjust if needed
+	ScreenshotEnabled    bool               `json:"screenshot_enabled"`     // Add screenshot enabled field
+	ScreenshotTargetOnly bool               `json:"screenshot_target_only"` // Only screenshot existing assets within the scan target
+	ScreenshotCriteria   []string           `json:"screenshot_criteria"`    // Endpoint screenshot criteria (ok_html, captured, parameters), empty = all
+	ScreenshotRetry      bool               `json:"screenshot_retry"`       // Retry failed screenshots once at the end of the scan
+	ScreenshotPaths      []string           `json:"screenshot_paths"`       // Paths such as /login or /admin screenshotted on every live host
+	ScreenshotMobile     bool               `json:"screenshot_mobile"`      // Also screenshot every live host on an emulated mobile device
+	TechDetectNewOnly    bool               `json:"tech_detect_new_only"`   // Only detect technologies on assets discovered or changed by the scan
+	HostRequestDelayMs   int                `json:"host_request_delay_ms"`  // Delay between requests to the same host, 0 = HOST_REQUEST_DELAY_MS setting
 }
 
 // ScanTemplateUpdate represents the request body for updating a scan template.
 // Pointers are used to detect which fields are explicitly provided for update.
 type ScanTemplateUpdate struct {
-	Name                *string            `json:"name"`
-	Description         *string            `json:"description"`
-	SubdomainScanConfig *ScanSectionConfig `json:"subdomain_scan_config"`
-	URLScanConfig       *ScanSectionConfig `json:"url_scan_config"`
-	ParameterScanConfig *ScanSectionConfig `json:"parameter_scan_config"`
-	TechDetectEnabled   *bool              `json:"tech_detect_enabled"`
-	ScreenshotEnabled   *bool              `json:"screenshot_enabled"` // Add screenshot enabled field (pointer for update)
+	Name                 *string            `json:"name"`
+	Description          *string            `json:"description"`
+	SubdomainScanConfig  *ScanSectionConfig `json:"subdomain_scan_config"`
+	URLScanConfig        *ScanSectionConfig `json:"url_scan_config"`
+	ParameterScanConfig  *ScanSectionConfig `json:"parameter_scan_config"`
+	TechDetectEnabled    *bool              `json:"tech_detect_enabled"`
+	ScreenshotEnabled    *bool              `json:"screenshot_enabled"` // Add screenshot enabled field (pointer for update)
+	ScreenshotTargetOnly *bool              `json:"screenshot_target_only"`
+	ScreenshotCriteria   *[]string          `json:"screenshot_criteria"`
+	ScreenshotRetry      *bool              `json:"screenshot_retry"`
+	ScreenshotPaths      *[]string          `json:"screenshot_paths"`
+	ScreenshotMobile     *bool              `json:"screenshot_mobile"`
+	TechDetectNewOnly    *bool              `json:"tech_detect_new_only"`
+	HostRequestDelayMs   *int               `json:"host_request_delay_ms"`
 }
 
 // ScanTemplateResponse represents the response structure for a scan template.
 type ScanTemplateResponse struct {
-	ID                  uint               `json:"id"`
-	Name                string             `json:"name"`
-	Description         *string            `json:"description,omitempty"`
-	SubdomainScanConfig *ScanSectionConfig `json:"subdomain_scan_config,omitempty"`
-	URLScanConfig       *ScanSectionConfig `json:"url_scan_config,omitempty"`
-	ParameterScanConfig *ScanSectionConfig `json:"parameter_scan_config,omitempty"`
-	TechDetectEnabled   bool               `json:"tech_detect_enabled"`
-	ScreenshotEnabled   bool               `json:"screenshot_enabled"` // Add screenshot enabled field
-	CreatedAt           *time.Time         `json:"created_at,omitempty"`
-	UpdatedAt           *time.Time         `json:"updated_at,omitempty"`
+	ID                   uint               `json:"id"`
+	Name                 string             `json:"name"`
+	Description          *string            `json:"description,omitempty"`
+	SubdomainScanConfig  *ScanSectionConfig `json:"subdomain_scan_config,omitempty"`
+	URLScanConfig        *ScanSectionConfig `json:"url_scan_config,omitempty"`
+	ParameterScanConfig  *ScanSectionConfig `json:"parameter_scan_config,omitempty"`
+	TechDetectEnabled    bool               `json:"tech_detect_enabled"`
+	ScreenshotEnabled    bool               `json:"screenshot_enabled"` // Add screenshot enabled field
+	ScreenshotTargetOnly bool               `json:"screenshot_target_only"`
+	ScreenshotCriteria   []string           `json:"screenshot_criteria"`
+	ScreenshotRetry      bool               `json:"screenshot_retry"`
+	ScreenshotPaths      []string           `json:"screenshot_paths"`
+	ScreenshotMobile     bool               `json:"screenshot_mobile"`
+	TechDetectNewOnly    bool               `json:"tech_detect_new_only"`
+	HostRequestDelayMs   int                `json:"host_request_delay_ms"`
+	CreatedAt            *time.Time         `json:"created_at,omitempty"`
+	UpdatedAt            *time.Time         `json:"updated_at,omitempty"`
+}
+
+// ScanTemplateValidationResponse reports which API-key subfinder sources a template's
+// subdomain scan will be able to use.
+type ScanTemplateValidationResponse struct {
+	TemplateID       uint                            `json:"template_id"`
+	SubfinderEnabled bool                            `json:"subfinder_enabled"`
+	ReadySources     []string                        `json:"ready_sources"`   // Sources with usable-looking keys
+	SkippedSources   []string                        `json:"skipped_sources"` // Sources subfinder will skip for lack of keys
+	Sources          []scanner.SubfinderSourceStatus `json:"sources"`
+	WordlistError    string                          `json:"wordlist_error,omitempty"` // Why scans of the template would fail to start, see CheckTemplateWordlists
+}
+
+// ScanTemplateEffectiveConfigResponse is the configuration a scan using a template runs with, after
+// the scanner's defaults and fallbacks are applied.
+type ScanTemplateEffectiveConfigResponse struct {
+	TemplateID uint   `json:"template_id"`
+	ScanType   string `json:"scan_type"`
+	scanner.TemplateConfig
+	TechDetectEnabled    bool     `json:"tech_detect_enabled"`
+	TechDetectNewOnly    bool     `json:"tech_detect_new_only"`
+	ScreenshotEnabled    bool     `json:"screenshot_enabled"`
+	ScreenshotTargetOnly bool     `json:"screenshot_target_only"`
+	ScreenshotCriteria   []string `json:"screenshot_criteria"` // Empty = all endpoints
+	ScreenshotRetry      bool     `json:"screenshot_retry"`
+	ScreenshotPaths      []string `json:"screenshot_paths"`
+	ScreenshotMobile     bool     `json:"screenshot_mobile"`
+	HostRequestDelayMs   int64    `json:"host_request_delay_ms"` // The template's delay, or HOST_REQUEST_DELAY_MS if it sets none
 }
 
 // --- Helper Function ---
@@ -72,13 +124,20 @@ type ScanTemplateResponse struct {
 // mapScanTemplateToResponse converts a DB model to a response struct, handling JSON unmarshaling.
 func mapScanTemplateToResponse(template *models.ScanTemplate) ScanTemplateResponse {
 	resp := ScanTemplateResponse{
-		ID:                template.ID,
-		Name:              template.Name,
-		Description:       &template.Description, // Assign directly if Description is string, handle if pointer
-		TechDetectEnabled: template.TechDetectEnabled,
-		ScreenshotEnabled: template.ScreenshotEnabled, // Add screenshot enabled
-		CreatedAt:         &template.CreatedAt,        // Assign directly if CreatedAt is time.Time
-		UpdatedAt:         template.UpdatedAt,         // UpdatedAt is already *time.Time
+		ID:                   template.ID,
+		Name:                 template.Name,
+		Description:          &template.Description, // Assign directly if Description is string, handle if pointer
+		TechDetectEnabled:    template.TechDetectEnabled,
+		ScreenshotEnabled:    template.ScreenshotEnabled, // Add screenshot enabled
+		ScreenshotTargetOnly: template.ScreenshotTargetOnly,
+		ScreenshotCriteria:   []string{},
+		ScreenshotRetry:      template.ScreenshotRetry,
+		ScreenshotPaths:      []string{},
+		ScreenshotMobile:     template.ScreenshotMobile,
+		TechDetectNewOnly:    template.TechDetectNewOnly,
+		HostRequestDelayMs:   template.HostRequestDelayMs,
+		CreatedAt:            &template.CreatedAt, // Assign directly if CreatedAt is time.Time
+		UpdatedAt:            template.UpdatedAt,  // UpdatedAt is already *time.Time
 	}
 	// Handle potential empty description
 	if template.Description == "" {
@@ -89,10 +148,25 @@ func mapScanTemplateToResponse(template *models.ScanTemplate) ScanTemplateRespon
 	_ = json.Unmarshal([]byte(template.SubdomainScanConfig), &resp.SubdomainScanConfig)
 	_ = json.Unmarshal([]byte(template.URLScanConfig), &resp.URLScanConfig)
 	_ = json.Unmarshal([]byte(template.ParameterScanConfig), &resp.ParameterScanConfig)
+	if criteria, err := scanner.ParseScreenshotCriteria(template.ScreenshotCriteria); err == nil && criteria != nil {
+		resp.ScreenshotCriteria = criteria
+	}
+	if paths, err := scanner.ParseScreenshotPaths(template.ScreenshotPaths); err == nil && paths != nil {
+		resp.ScreenshotPaths = paths
+	}
 
 	return resp
 }
 
+// validHostRequestDelay checks a template's host_request_delay_ms, answering 400 if it is out of range.
+func validHostRequestDelay(c *gin.Context, delayMs int) bool {
+	if delayMs < 0 || delayMs > scanner.MaxHostRequestDelayMs {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid host_request_delay_ms, must be between 0 and %d", scanner.MaxHostRequestDelayMs))
+		return false
+	}
+	return true
+}
+
 // --- Handler Functions ---
 
 // GetScanTemplates handles GET requests to retrieve all scan templates.
@@ -102,7 +176,7 @@ func GetScanTemplates(c *gin.Context) {
 
 	result := db.Order("name asc").Find(&templates)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan templates", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan templates", result.Error.Error())
 		return
 	}
 
@@ -118,7 +192,7 @@ func GetScanTemplate(c *gin.Context) {
 	idStr := c.Param("template_id")
 	templateID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
 
@@ -128,9 +202,9 @@ func GetScanTemplate(c *gin.Context) {
 	result := db.First(&template, uint(templateID))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan template with ID %d not found", templateID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", templateID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan template", "details": result.Error.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template", result.Error.Error())
 		}
 		return
 	}
@@ -143,7 +217,7 @@ func GetScanTemplate(c *gin.Context) {
 func CreateScanTemplate(c *gin.Context) {
 	var input ScanTemplateCreate
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -152,10 +226,24 @@ func CreateScanTemplate(c *gin.Context) {
 	// Check if name already exists
 	var existing models.ScanTemplate
 	if err := db.Where("name = ?", input.Name).First(&existing).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Scan template with name '%s' already exists", input.Name)})
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Scan template with name '%s' already exists", input.Name))
 		return
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for existing template name", "details": err.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to check for existing template name", err.Error())
+		return
+	}
+
+	screenshotCriteria, err := scanner.ParseScreenshotCriteria(strings.Join(input.ScreenshotCriteria, ","))
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	screenshotPaths, err := scanner.ParseScreenshotPaths(strings.Join(input.ScreenshotPaths, ","))
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !validHostRequestDelay(c, input.HostRequestDelayMs) {
 		return
 	}
 
@@ -165,22 +253,37 @@ func CreateScanTemplate(c *gin.Context) {
 	paramCfgJSON, _ := json.Marshal(input.ParameterScanConfig)
 
 	newTemplate := models.ScanTemplate{
-		Name:                input.Name,
-		Description:         *input.Description, // Dereference pointer
-		SubdomainScanConfig: string(subdomainCfgJSON),
-		URLScanConfig:       string(urlCfgJSON),
-		ParameterScanConfig: string(paramCfgJSON),
-		TechDetectEnabled:   input.TechDetectEnabled,
-		ScreenshotEnabled:   input.ScreenshotEnabled, // Set screenshot enabled
+		Name:                 input.Name,
+		Description:          *input.Description, // Dereference pointer
+		SubdomainScanConfig:  string(subdomainCfgJSON),
+		URLScanConfig:        string(urlCfgJSON),
+		ParameterScanConfig:  string(paramCfgJSON),
+		TechDetectEnabled:    input.TechDetectEnabled,
+		ScreenshotEnabled:    input.ScreenshotEnabled, // Set screenshot enabled
+		ScreenshotTargetOnly: input.ScreenshotTargetOnly,
+		ScreenshotCriteria:   strings.Join(screenshotCriteria, ","),
+		ScreenshotRetry:      input.ScreenshotRetry,
+		ScreenshotPaths:      strings.Join(screenshotPaths, ","),
+		ScreenshotMobile:     input.ScreenshotMobile,
+		TechDetectNewOnly:    input.TechDetectNewOnly,
+		HostRequestDelayMs:   input.HostRequestDelayMs,
 	}
 	// Handle nil description
 	if input.Description == nil {
 		newTemplate.Description = ""
 	}
+	if err := scanner.CheckTemplateWordlistNames(&newTemplate); err != nil {
+		RespondError(c, http.StatusBadRequest, "Scan template has an invalid wordlist", err.Error())
+		return
+	}
+	if err := scanner.CheckTemplateChoiceOptions(&newTemplate); err != nil {
+		RespondError(c, http.StatusBadRequest, "Scan template has an invalid option", err.Error())
+		return
+	}
 
 	result := db.Create(&newTemplate)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scan template", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to create scan template", result.Error.Error())
 		return
 	}
 
@@ -193,13 +296,13 @@ func UpdateScanTemplate(c *gin.Context) {
 	idStr := c.Param("template_id")
 	templateID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
 
 	var input ScanTemplateUpdate
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -209,9 +312,9 @@ func UpdateScanTemplate(c *gin.Context) {
 	// Find existing template
 	if err := db.First(&template, uint(templateID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan template with ID %d not found", templateID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", templateID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan template for update", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template for update", err.Error())
 		}
 		return
 	}
@@ -220,10 +323,10 @@ func UpdateScanTemplate(c *gin.Context) {
 	if input.Name != nil && *input.Name != template.Name {
 		var existing models.ScanTemplate
 		if err := db.Where("name = ? AND id != ?", *input.Name, templateID).First(&existing).Error; err == nil {
-			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Scan template with name '%s' already exists", *input.Name)})
+			RespondError(c, http.StatusConflict, fmt.Sprintf("Scan template with name '%s' already exists", *input.Name))
 			return
 		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for name conflict during update", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to check for name conflict during update", err.Error())
 			return
 		}
 		template.Name = *input.Name // Update name
@@ -251,13 +354,55 @@ func UpdateScanTemplate(c *gin.Context) {
 	if input.ScreenshotEnabled != nil {
 		template.ScreenshotEnabled = *input.ScreenshotEnabled // Update screenshot enabled
 	}
+	if input.ScreenshotTargetOnly != nil {
+		template.ScreenshotTargetOnly = *input.ScreenshotTargetOnly
+	}
+	if input.ScreenshotRetry != nil {
+		template.ScreenshotRetry = *input.ScreenshotRetry
+	}
+	if input.ScreenshotMobile != nil {
+		template.ScreenshotMobile = *input.ScreenshotMobile
+	}
+	if input.TechDetectNewOnly != nil {
+		template.TechDetectNewOnly = *input.TechDetectNewOnly
+	}
+	if input.HostRequestDelayMs != nil {
+		if !validHostRequestDelay(c, *input.HostRequestDelayMs) {
+			return
+		}
+		template.HostRequestDelayMs = *input.HostRequestDelayMs
+	}
+	if input.ScreenshotCriteria != nil {
+		screenshotCriteria, err := scanner.ParseScreenshotCriteria(strings.Join(*input.ScreenshotCriteria, ","))
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		template.ScreenshotCriteria = strings.Join(screenshotCriteria, ",")
+	}
+	if input.ScreenshotPaths != nil {
+		screenshotPaths, err := scanner.ParseScreenshotPaths(strings.Join(*input.ScreenshotPaths, ","))
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		template.ScreenshotPaths = strings.Join(screenshotPaths, ",")
+	}
+	if err := scanner.CheckTemplateWordlistNames(&template); err != nil {
+		RespondError(c, http.StatusBadRequest, "Scan template has an invalid wordlist", err.Error())
+		return
+	}
+	if err := scanner.CheckTemplateChoiceOptions(&template); err != nil {
+		RespondError(c, http.StatusBadRequest, "Scan template has an invalid option", err.Error())
+		return
+	}
 
 	// Save updates
 	// GORM's Save updates all fields, including associations.
 	// Use Updates for partial updates if only changing specific columns.
 	result := db.Save(&template)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scan template", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to update scan template", result.Error.Error())
 		return
 	}
 
@@ -265,14 +410,30 @@ func UpdateScanTemplate(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Conflicts refusing the deletion of a scan template, see DeleteScanTemplate
+var (
+	errTemplateInUse      = errors.New("scan template is used by pending or running scans")
+	errTemplateReferenced = errors.New("scan template is referenced by scans")
+)
+
 // DeleteScanTemplate handles DELETE requests to remove a scan template.
+// Templates referenced by scans (as their template or follow-up template) are only deleted with force=true,
+// which clears those references in the same transaction and reports how many scans were affected (200 instead
+// of 204). Templates of pending or running scans are never deleted.
 func DeleteScanTemplate(c *gin.Context) {
 	idStr := c.Param("template_id")
 	templateID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
+	force := false
+	if forceStr := c.Query("force"); forceStr != "" {
+		if force, err = strconv.ParseBool(forceStr); err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid force, must be true or false")
+			return
+		}
+	}
 
 	db := database.GetDB()
 
@@ -280,23 +441,171 @@ func DeleteScanTemplate(c *gin.Context) {
 	var template models.ScanTemplate
 	if err := db.First(&template, uint(templateID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan template with ID %d not found", templateID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", templateID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan template for deletion", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template for deletion", err.Error())
 		}
 		return
 	}
 
-	// Delete the template
-	// Consider foreign key constraints: If scans reference this template,
-	// deletion might fail unless the foreign key allows SET NULL or CASCADE.
-	result := db.Delete(&template)
-	if result.Error != nil {
-		// Check for foreign key constraint error (specific error varies by DB)
-		// if strings.Contains(result.Error.Error(), "FOREIGN KEY constraint failed") { ... }
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete scan template", "details": result.Error.Error()})
+	// Count the dependent scans, clear their references and delete the template together, so no scan can
+	// start with the template or point at it once it is gone
+	var activeCount, scanCount int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		dependentScans := tx.Model(&models.Scan{}).Where("scan_template_id = ? OR follow_up_template_id = ?", template.ID, template.ID)
+		if err := dependentScans.Session(&gorm.Session{}).Where("status IN ?", []string{"pending", "running"}).Count(&activeCount).Error; err != nil {
+			return fmt.Errorf("failed to check scans using the template: %w", err)
+		}
+		if activeCount > 0 {
+			return errTemplateInUse
+		}
+		if err := dependentScans.Session(&gorm.Session{}).Count(&scanCount).Error; err != nil {
+			return fmt.Errorf("failed to check scans using the template: %w", err)
+		}
+		if scanCount > 0 && !force {
+			return errTemplateReferenced
+		}
+
+		if err := tx.Model(&models.Scan{}).Where("scan_template_id = ?", template.ID).Update("scan_template_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to clear scan template references: %w", err)
+		}
+		if err := tx.Model(&models.Scan{}).Where("follow_up_template_id = ?", template.ID).Update("follow_up_template_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to clear follow-up template references: %w", err)
+		}
+		return tx.Delete(&template).Error
+	})
+	switch {
+	case errors.Is(err, errTemplateInUse):
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Scan template is used by %d pending or running scans", activeCount),
+			"Wait for the scans to finish or cancel them before deleting the template")
+		return
+	case errors.Is(err, errTemplateReferenced):
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Scan template is referenced by %d scans", scanCount),
+			"Pass force=true to delete it anyway; the scans are kept without a template reference")
+		return
+	case err != nil:
+		RespondError(c, http.StatusInternalServerError, "Failed to delete scan template", err.Error())
+		return
+	}
+	if scanCount > 0 {
+		log.Printf("Deleted scan template %d ('%s'), cleared its reference from %d scans", template.ID, template.Name, scanCount)
+		c.JSON(http.StatusOK, gin.H{
+			"message":       fmt.Sprintf("Scan template deleted, %d scans referencing it are kept without a template", scanCount),
+			"cleared_scans": scanCount,
+		})
 		return
 	}
 
 	c.Status(http.StatusNoContent) // Return 204 No Content on successful deletion
 }
+
+// ValidateScanTemplate handles GET requests that dry-check a template's subdomain scan
+// configuration against the configured API keys, and its tools' wordlists, without running anything.
+func ValidateScanTemplate(c *gin.Context) {
+	idStr := c.Param("template_id")
+	templateID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+
+	db := database.GetDB()
+	var template models.ScanTemplate
+
+	result := db.First(&template, uint(templateID))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", templateID))
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template", result.Error.Error())
+		}
+		return
+	}
+
+	// Mirror the scanner: subfinder runs only if the section and the tool are enabled
+	subfinderEnabled := false
+	if template.SubdomainScanConfig != "" {
+		var section ScanSectionConfig
+		if err := json.Unmarshal([]byte(template.SubdomainScanConfig), &section); err != nil {
+			RespondError(c, http.StatusUnprocessableEntity, "Template has invalid subdomain scan config", err.Error())
+			return
+		}
+		if toolCfg, ok := section.Tools["subfinder"]; ok && section.Enabled {
+			subfinderEnabled = toolCfg.Enabled
+		}
+	}
+
+	response := ScanTemplateValidationResponse{
+		TemplateID:       template.ID,
+		SubfinderEnabled: subfinderEnabled,
+		ReadySources:     []string{},
+		SkippedSources:   []string{},
+		Sources:          scanner.CheckSubfinderSources(scanner.ResolveTemplateConfig(&template, "root_domain").Subfinder.SelectedSources),
+	}
+	if err := scanner.CheckTemplateWordlists(&template); err != nil {
+		response.WordlistError = err.Error()
+	}
+	if subfinderEnabled {
+		for _, source := range response.Sources {
+			if source.Status == "ready" {
+				response.ReadySources = append(response.ReadySources, source.Source)
+			} else {
+				response.SkippedSources = append(response.SkippedSources, source.Source)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetScanTemplateEffectiveConfig handles GET requests for the configuration scans using a template
+// actually run with. The optional scan_type query parameter (root_domain, the default, or subdomain)
+// selects the scan type, as subdomain scans skip discovery.
+func GetScanTemplateEffectiveConfig(c *gin.Context) {
+	idStr := c.Param("template_id")
+	templateID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+	scanType := c.DefaultQuery("scan_type", "root_domain")
+	if scanType != "root_domain" && scanType != "subdomain" {
+		RespondError(c, http.StatusBadRequest, "Invalid scan_type, must be root_domain or subdomain")
+		return
+	}
+
+	db := database.GetDB()
+	var template models.ScanTemplate
+
+	result := db.First(&template, uint(templateID))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", templateID))
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template", result.Error.Error())
+		}
+		return
+	}
+
+	templateResponse := mapScanTemplateToResponse(&template)
+	c.JSON(http.StatusOK, ScanTemplateEffectiveConfigResponse{
+		TemplateID:           template.ID,
+		ScanType:             scanType,
+		TemplateConfig:       scanner.ResolveTemplateConfig(&template, scanType),
+		TechDetectEnabled:    template.TechDetectEnabled,
+		TechDetectNewOnly:    template.TechDetectNewOnly,
+		ScreenshotEnabled:    template.ScreenshotEnabled,
+		ScreenshotTargetOnly: template.ScreenshotTargetOnly,
+		ScreenshotCriteria:   templateResponse.ScreenshotCriteria,
+		ScreenshotRetry:      template.ScreenshotRetry,
+		ScreenshotPaths:      templateResponse.ScreenshotPaths,
+		ScreenshotMobile:     template.ScreenshotMobile,
+		HostRequestDelayMs:   scanner.TemplateHostDelay(&template).Milliseconds(),
+	})
+}
+
+// GetSubfinderSources handles GET requests listing the subfinder enumeration sources that templates
+// can select with the "sources" and "excludeSources" subfinder options.
+func GetSubfinderSources(c *gin.Context) {
+	c.JSON(http.StatusOK, scanner.SubfinderSources())
+}
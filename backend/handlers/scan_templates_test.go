@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rewrite-go/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createTemplateWithScan creates a template and, unless status is empty, a scan of that status using it.
+func createTemplateWithScan(t *testing.T, db *gorm.DB, status string) (models.ScanTemplate, *models.Scan) {
+	t.Helper()
+	template := models.ScanTemplate{Name: "delete-test-" + t.Name()}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	if status == "" {
+		return template, nil
+	}
+	scan := models.Scan{RootDomainID: 1, ScanType: "root_domain", Status: status, StartedAt: time.Now(), ScanTemplateID: &template.ID}
+	if err := db.Create(&scan).Error; err != nil {
+		t.Fatalf("create scan: %v", err)
+	}
+	return template, &scan
+}
+
+func deleteTemplate(templateID uint, query string) (int, map[string]interface{}) {
+	rec := serve(http.MethodDelete, "/scan-templates/:template_id", DeleteScanTemplate, fmt.Sprintf("/scan-templates/%d%s", templateID, query), "")
+	var body map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body
+}
+
+func templateExists(t *testing.T, db *gorm.DB, templateID uint) bool {
+	t.Helper()
+	var count int64
+	if err := db.Model(&models.ScanTemplate{}).Where("id = ?", templateID).Count(&count).Error; err != nil {
+		t.Fatalf("count templates: %v", err)
+	}
+	return count > 0
+}
+
+func TestDeleteScanTemplateUnreferenced(t *testing.T) {
+	db := setupTestDB(t)
+	template, _ := createTemplateWithScan(t, db, "")
+
+	if code, _ := deleteTemplate(template.ID, ""); code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", code, http.StatusNoContent)
+	}
+	if templateExists(t, db, template.ID) {
+		t.Error("template still exists")
+	}
+}
+
+func TestDeleteScanTemplateReferencedWithoutForce(t *testing.T) {
+	db := setupTestDB(t)
+	template, scan := createTemplateWithScan(t, db, "completed")
+
+	code, body := deleteTemplate(template.ID, "")
+	if code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", code, http.StatusConflict)
+	}
+	if body["message"] != "Scan template is referenced by 1 scans" {
+		t.Errorf("message = %v", body["message"])
+	}
+	if !templateExists(t, db, template.ID) {
+		t.Error("template was deleted")
+	}
+	var kept models.Scan
+	db.First(&kept, scan.ID)
+	if kept.ScanTemplateID == nil || *kept.ScanTemplateID != template.ID {
+		t.Errorf("scan template reference = %v, want %d", kept.ScanTemplateID, template.ID)
+	}
+}
+
+func TestDeleteScanTemplateReferencedWithForce(t *testing.T) {
+	db := setupTestDB(t)
+	template, scan := createTemplateWithScan(t, db, "completed")
+	followUp := models.Scan{RootDomainID: 1, ScanType: "root_domain", Status: "failed", StartedAt: time.Now(), FollowUpTemplateID: &template.ID}
+	if err := db.Create(&followUp).Error; err != nil {
+		t.Fatalf("create scan: %v", err)
+	}
+
+	code, body := deleteTemplate(template.ID, "?force=true")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if body["cleared_scans"] != float64(2) {
+		t.Errorf("cleared_scans = %v, want 2", body["cleared_scans"])
+	}
+	if templateExists(t, db, template.ID) {
+		t.Error("template still exists")
+	}
+	var scans []models.Scan
+	db.Find(&scans, []uint{scan.ID, followUp.ID})
+	if len(scans) != 2 {
+		t.Fatalf("found %d scans, want both kept", len(scans))
+	}
+	for _, kept := range scans {
+		if kept.ScanTemplateID != nil || kept.FollowUpTemplateID != nil {
+			t.Errorf("scan %d still references the template: %v, %v", kept.ID, kept.ScanTemplateID, kept.FollowUpTemplateID)
+		}
+	}
+}
+
+func TestDeleteScanTemplateUsedByRunningScan(t *testing.T) {
+	db := setupTestDB(t)
+	template, _ := createTemplateWithScan(t, db, "running")
+
+	code, body := deleteTemplate(template.ID, "?force=true")
+	if code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", code, http.StatusConflict)
+	}
+	if body["message"] != "Scan template is used by 1 pending or running scans" {
+		t.Errorf("message = %v", body["message"])
+	}
+	if !templateExists(t, db, template.ID) {
+		t.Error("template was deleted")
+	}
+}
@@ -4,11 +4,17 @@ import (
 	"encoding/json" // Added for parsing template config
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"rewrite-go/config"
 	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/logtail"
 	"rewrite-go/models"
 	"rewrite-go/scanner" // Added scanner import
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -27,26 +33,150 @@ type ScanBasicResponse struct {
 	CompletedAt    *time.Time `json:"completed_at,omitempty"`
 	Status         string     `json:"status,omitempty"`
 	ResultsSummary string     `json:"results_summary,omitempty"`
+	ParentScanID   *uint      `json:"parent_scan_id,omitempty"` // Set on follow-up scans
+	Labels         []string   `json:"labels,omitempty"`
+	ScanTemplateID *uint      `json:"scan_template_id,omitempty"`
 }
 
-// ScanDetailResponse represents detailed scan info including discovered items.
-// Reusing SubdomainBasicResponse and EndpointBasic from other handlers.
+// ScanDetailResponse represents detailed scan info with the number of discovered items.
+// The items themselves are listed by GetScanSubdomains and GetScanEndpoints.
 type ScanDetailResponse struct {
-	ID                   uint                     `json:"id"`
-	RootDomainID         uint                     `json:"root_domain_id"`
-	SubdomainID          *uint                    `json:"subdomain_id,omitempty"` // Added
-	ScanType             string                   `json:"scan_type"`
-	StartedAt            time.Time                `json:"started_at"`
-	CompletedAt          *time.Time               `json:"completed_at,omitempty"`
-	Status               string                   `json:"status,omitempty"`
-	ResultsSummary       string                   `json:"results_summary,omitempty"`
-	DiscoveredSubdomains []SubdomainBasicResponse `json:"discovered_subdomains"`
-	DiscoveredEndpoints  []EndpointBasic          `json:"discovered_endpoints"` // Using EndpointBasic for now
+	ID                   uint                       `json:"id"`
+	RootDomainID         uint                       `json:"root_domain_id"`
+	SubdomainID          *uint                      `json:"subdomain_id,omitempty"` // Added
+	ScanType             string                     `json:"scan_type"`
+	StartedAt            time.Time                  `json:"started_at"`
+	CompletedAt          *time.Time                 `json:"completed_at,omitempty"`
+	Status               string                     `json:"status,omitempty"`
+	ResultsSummary       string                     `json:"results_summary,omitempty"`
+	DiscoveredSubdomains int64                      `json:"discovered_subdomain_count"`
+	DiscoveredEndpoints  int64                      `json:"discovered_endpoint_count"`
+	TargetSnapshot       *models.ScanTargetSnapshot `json:"target_snapshot,omitempty"` // Resolved targets at scan time
+	TechDetectMetrics    *models.TechDetectMetrics  `json:"tech_detect_metrics,omitempty"`
+	ToolVersions         map[string]string          `json:"tool_versions,omitempty"` // Scanner library versions used for this scan
+	FollowUpTemplateID   *uint                      `json:"follow_up_template_id,omitempty"`
+	ParentScanID         *uint                      `json:"parent_scan_id,omitempty"`
+	FollowUpScanIDs      []uint                     `json:"follow_up_scan_ids,omitempty"` // Scans enqueued for newly discovered subdomains
+	DNSResolver          string                     `json:"dns_resolver,omitempty"`       // Resolver used to look up subdomain IPs
+	SubfinderSources     map[string]int             `json:"subfinder_sources,omitempty"`  // Subdomains reported per subfinder source
+	Labels               []string                   `json:"labels,omitempty"`
+	TemplateOverrides    scanner.TemplateOverrides  `json:"template_overrides,omitempty"` // Tool options overridden for this run
+	EffectiveConfig      *scanner.TemplateConfig    `json:"effective_config,omitempty"`   // Tool configuration the scan ran with
+	SessionID            *uint                      `json:"session_id,omitempty"`         // Recorded session the scan ran authenticated with
+}
+
+// ScanSubdomainListResponse is a page of the subdomains a scan discovered.
+type ScanSubdomainListResponse struct {
+	ScanID     uint                     `json:"scan_id"`
+	Page       int                      `json:"page"`
+	PageSize   int                      `json:"page_size"`
+	Total      int64                    `json:"total"`
+	Subdomains []SubdomainBasicResponse `json:"subdomains"`
+}
+
+// ScanEndpoint is an endpoint a scan discovered, with the hostname of its subdomain.
+type ScanEndpoint struct {
+	EndpointBasic
+	Hostname string `json:"hostname"`
+}
+
+// ScanEndpointListResponse is a page of the endpoints a scan discovered.
+type ScanEndpointListResponse struct {
+	ScanID    uint           `json:"scan_id"`
+	Page      int            `json:"page"`
+	PageSize  int            `json:"page_size"`
+	Total     int64          `json:"total"`
+	Endpoints []ScanEndpoint `json:"endpoints"`
+}
+
+// ScanScreenshotPreviewResponse lists the existing assets a scan would screenshot before discovery.
+type ScanScreenshotPreviewResponse struct {
+	RootDomainID         uint                               `json:"root_domain_id"`
+	SubdomainID          *uint                              `json:"subdomain_id,omitempty"`
+	ScanType             string                             `json:"scan_type"`
+	ScanTemplateID       *uint                              `json:"scan_template_id,omitempty"`
+	ScreenshotEnabled    bool                               `json:"screenshot_enabled"`
+	ScreenshotTargetOnly bool                               `json:"screenshot_target_only"`
+	ScreenshotCriteria   []string                           `json:"screenshot_criteria,omitempty"` // Endpoints must match one of these
+	Total                int                                `json:"total"`
+	Targets              []scanner.ExistingScreenshotTarget `json:"targets"`
+}
+
+// ScanPhaseTimingResponse is a timed phase of a scan with its share of the timed total.
+type ScanPhaseTimingResponse struct {
+	models.ScanPhaseTiming
+	Percent float64 `json:"percent"` // Share of timed_ms, rounded to one decimal
+}
+
+// ScanTimingResponse breaks down where a scan's time went, by phase in the order they ran. Phases the
+// template disables are absent; a running scan lists the phases finished so far.
+type ScanTimingResponse struct {
+	ScanID      uint                      `json:"scan_id"`
+	Status      string                    `json:"status"`
+	StartedAt   time.Time                 `json:"started_at"`
+	CompletedAt *time.Time                `json:"completed_at,omitempty"`
+	TimedMs     int64                     `json:"timed_ms"` // Sum of the phase durations
+	Phases      []ScanPhaseTimingResponse `json:"phases"`
+}
+
+// ScanConfigResponse is the tool configuration a scan ran with and the commands reproducing it with the
+// standalone tools.
+type ScanConfigResponse struct {
+	ScanID            uint                      `json:"scan_id"`
+	ScanType          string                    `json:"scan_type"`
+	ScanTemplateID    *uint                     `json:"scan_template_id,omitempty"`
+	TemplateOverrides scanner.TemplateOverrides `json:"template_overrides,omitempty"`
+	EffectiveConfig   scanner.TemplateConfig    `json:"effective_config"`
+	ToolVersions      map[string]string         `json:"tool_versions,omitempty"`
+	SeedURLs          []string                  `json:"seed_urls,omitempty"` // Contents of seeds.txt for the katana command
+	Commands          []scanner.ToolCommand     `json:"commands"`
 }
 
 // --- Handler Functions ---
 
+// Scan label limits
+const (
+	maxScanLabels      = 10
+	maxScanLabelLength = 64
+)
+
+// normalizeScanLabels trims labels and drops empty and duplicate ones. Labels are stored comma-separated,
+// so they cannot contain commas.
+func normalizeScanLabels(labels []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" || seen[strings.ToLower(label)] {
+			continue
+		}
+		if strings.Contains(label, ",") {
+			return nil, fmt.Errorf("label '%s' must not contain commas", label)
+		}
+		if len(label) > maxScanLabelLength {
+			return nil, fmt.Errorf("label '%s' is longer than %d characters", label, maxScanLabelLength)
+		}
+		seen[strings.ToLower(label)] = true
+		normalized = append(normalized, label)
+	}
+	if len(normalized) > maxScanLabels {
+		return nil, fmt.Errorf("at most %d labels are allowed per scan", maxScanLabels)
+	}
+	return normalized, nil
+}
+
+// splitScanLabels returns the labels stored in Scan.Labels.
+func splitScanLabels(labels string) []string {
+	if labels == "" {
+		return nil
+	}
+	return strings.Split(labels, ",")
+}
+
 // GetScans handles GET requests to retrieve scans for a specific domain OR subdomain.
+// The optional label filter returns scans carrying that label (case-insensitive); on its own it
+// searches the scans of all domains. So does the scan_template_id filter, returning the scans run
+// with that template.
 func GetScans(c *gin.Context) {
 	db := database.GetDB()
 	var scans []models.Scan
@@ -54,46 +184,60 @@ func GetScans(c *gin.Context) {
 	// Allow filtering by root_domain_id OR subdomain_id
 	rootDomainIDStr := c.Query("root_domain_id")
 	subdomainIDStr := c.Query("subdomain_id")
+	label := strings.TrimSpace(c.Query("label"))
 
 	query := db.Order("started_at desc") // Start with ordering
+	if label != "" {
+		// Match whole labels only: ",a,b," contains ",b,"
+		query = query.Where("LOWER(',' || labels || ',') LIKE ? ESCAPE '\\'", "%,"+escapeLike(strings.ToLower(label))+",%")
+	}
+	templateIDStr := c.Query("scan_template_id")
+	if templateIDStr != "" {
+		templateID, err := strconv.ParseUint(templateIDStr, 10, 32)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid scan_template_id format")
+			return
+		}
+		query = query.Where("scan_template_id = ?", uint(templateID))
+	}
 
 	if rootDomainIDStr != "" {
 		rootDomainID, err := strconv.ParseUint(rootDomainIDStr, 10, 32)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid root_domain_id format"})
+			RespondError(c, http.StatusBadRequest, "Invalid root_domain_id format")
 			return
 		}
 		query = query.Where("root_domain_id = ?", uint(rootDomainID))
 	} else if subdomainIDStr != "" {
 		subdomainID, err := strconv.ParseUint(subdomainIDStr, 10, 32)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subdomain_id format"})
+			RespondError(c, http.StatusBadRequest, "Invalid subdomain_id format")
 			return
 		}
 		// Find the root domain ID for the given subdomain ID first
 		var sub models.Subdomain
 		if res := db.Select("root_domain_id").First(&sub, uint(subdomainID)); res.Error != nil {
 			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Subdomain with ID %d not found", subdomainID)})
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Subdomain with ID %d not found", subdomainID))
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find subdomain", "details": res.Error.Error()})
+				RespondError(c, http.StatusInternalServerError, "Failed to find subdomain", res.Error.Error())
 			}
 			return
 		}
 		// Now filter scans by root domain AND specific subdomain
 		query = query.Where("root_domain_id = ? AND subdomain_id = ?", sub.RootDomainID, uint(subdomainID))
-	} else {
+	} else if label == "" && templateIDStr == "" {
 		// If neither is provided, maybe return all scans? Or require at least one?
 		// For now, let's require at least root_domain_id for the general list.
 		// If you want scans for a specific subdomain, use the subdomain_id query param.
 		// If you want *all* scans, a different endpoint might be better.
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required query parameter: root_domain_id"})
+		RespondError(c, http.StatusBadRequest, "Missing required query parameter: root_domain_id (or label or scan_template_id)")
 		return
 	}
 
 	result := query.Find(&scans)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve scans", result.Error.Error())
 		return
 	}
 
@@ -109,6 +253,9 @@ func GetScans(c *gin.Context) {
 			CompletedAt:    s.CompletedAt,
 			Status:         s.Status,
 			ResultsSummary: s.ResultsSummary,
+			ParentScanID:   s.ParentScanID,
+			Labels:         splitScanLabels(s.Labels),
+			ScanTemplateID: s.ScanTemplateID,
 		}
 	}
 	c.JSON(http.StatusOK, response)
@@ -119,52 +266,33 @@ func GetScan(c *gin.Context) {
 	idStr := c.Param("id") // Get scan ID from path
 	scanID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scan ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid scan ID format")
 		return
 	}
 
 	db := database.GetDB()
 	var scan models.Scan
 
-	// Query scan by ID, preloading discovered subdomains and endpoints
-	result := db.Preload("DiscoveredSubdomains").
-		Preload("DiscoveredEndpoints").
-		First(&scan, uint(scanID))
+	// Discovered subdomains and endpoints are only counted, they are paginated by GetScanSubdomains and GetScanEndpoints
+	result := db.First(&scan, uint(scanID))
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan with ID %d not found", scanID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan with ID %d not found", scanID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan details", "details": result.Error.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan details", result.Error.Error())
 		}
 		return
 	}
 
-	// Build response for discovered subdomains
-	subdomainsData := make([]SubdomainBasicResponse, len(scan.DiscoveredSubdomains))
-	for i, sub := range scan.DiscoveredSubdomains {
-		subdomainsData[i] = SubdomainBasicResponse{
-			ID:           sub.ID,
-			RootDomainID: sub.RootDomainID,
-			Hostname:     sub.Hostname,
-			IPAddress:    sub.IPAddress,
-			IsActive:     sub.IsActive,
-			DiscoveredAt: sub.DiscoveredAt,
-		}
+	var subdomainCount, endpointCount int64
+	if err := db.Model(&models.Subdomain{}).Where("scan_id = ?", scan.ID).Count(&subdomainCount).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count discovered subdomains", err.Error())
+		return
 	}
-
-	// Build response for discovered endpoints
-	endpointsData := make([]EndpointBasic, len(scan.DiscoveredEndpoints))
-	for i, ep := range scan.DiscoveredEndpoints {
-		endpointsData[i] = EndpointBasic{
-			ID:           ep.ID,
-			SubdomainID:  ep.SubdomainID,
-			Path:         ep.Path,
-			Method:       ep.Method,
-			StatusCode:   ep.StatusCode,
-			ContentType:  ep.ContentType,
-			DiscoveredAt: ep.DiscoveredAt,
-		}
+	if err := db.Model(&models.Endpoint{}).Where("scan_id = ?", scan.ID).Count(&endpointCount).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count discovered endpoints", err.Error())
+		return
 	}
 
 	// Construct the final detailed response
@@ -177,10 +305,121 @@ func GetScan(c *gin.Context) {
 		CompletedAt:          scan.CompletedAt,
 		Status:               scan.Status,
 		ResultsSummary:       scan.ResultsSummary,
-		DiscoveredSubdomains: subdomainsData,
-		DiscoveredEndpoints:  endpointsData,
+		DiscoveredSubdomains: subdomainCount,
+		DiscoveredEndpoints:  endpointCount,
+		FollowUpTemplateID:   scan.FollowUpTemplateID,
+		ParentScanID:         scan.ParentScanID,
+		DNSResolver:          scan.DNSResolver,
+		Labels:               splitScanLabels(scan.Labels),
+		SessionID:            scan.SessionID,
+	}
+
+	if scan.FollowUpTemplateID != nil {
+		if err := db.Model(&models.Scan{}).Where("parent_scan_id = ?", scan.ID).Order("id").Pluck("id", &response.FollowUpScanIDs).Error; err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve follow-up scans", err.Error())
+			return
+		}
+	}
+
+	// Parse the target snapshot (absent for scans that predate it or are still running)
+	if scan.TargetSnapshot != "" {
+		_ = json.Unmarshal([]byte(scan.TargetSnapshot), &response.TargetSnapshot)
+	}
+	if scan.TechDetectMetrics != "" {
+		_ = json.Unmarshal([]byte(scan.TechDetectMetrics), &response.TechDetectMetrics)
+	}
+	if scan.ToolVersions != "" {
+		_ = json.Unmarshal([]byte(scan.ToolVersions), &response.ToolVersions)
+	}
+	if scan.SubfinderSources != "" {
+		_ = json.Unmarshal([]byte(scan.SubfinderSources), &response.SubfinderSources)
+	}
+	if scan.TemplateOverrides != "" {
+		_ = json.Unmarshal([]byte(scan.TemplateOverrides), &response.TemplateOverrides)
+	}
+	if scan.EffectiveConfig != "" {
+		_ = json.Unmarshal([]byte(scan.EffectiveConfig), &response.EffectiveConfig)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetScanSubdomains handles GET requests listing the subdomains a scan discovered (those whose scan_id is the
+// scan's), ordered by hostname. Paginated with page and page_size.
+func GetScanSubdomains(c *gin.Context) {
+	scanID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scan ID format")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 100, 1, 1000)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var scan models.Scan
+	if err := db.Select("id").First(&scan, uint(scanID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scan with ID %d not found", scanID), "Failed to retrieve scan")
+		return
+	}
+
+	response := ScanSubdomainListResponse{ScanID: scan.ID, Page: page, PageSize: pageSize, Subdomains: []SubdomainBasicResponse{}}
+	query := db.Model(&models.Subdomain{}).Where("scan_id = ?", scan.ID)
+	if err := query.Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count discovered subdomains", err.Error())
+		return
+	}
+	if err := query.Order("hostname").Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&response.Subdomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve discovered subdomains", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetScanEndpoints handles GET requests listing the endpoints a scan discovered (those whose scan_id is the
+// scan's) with their hostnames, ordered by hostname and path. Paginated with page and page_size.
+func GetScanEndpoints(c *gin.Context) {
+	scanID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scan ID format")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 100, 1, 1000)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var scan models.Scan
+	if err := db.Select("id").First(&scan, uint(scanID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scan with ID %d not found", scanID), "Failed to retrieve scan")
+		return
 	}
 
+	response := ScanEndpointListResponse{ScanID: scan.ID, Page: page, PageSize: pageSize, Endpoints: []ScanEndpoint{}}
+	query := db.Model(&models.Endpoint{}).Where("endpoints.scan_id = ?", scan.ID)
+	if err := query.Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count discovered endpoints", err.Error())
+		return
+	}
+	if err := query.Select("endpoints.*, subdomains.hostname").
+		Joins("JOIN subdomains ON subdomains.id = endpoints.subdomain_id").
+		Order("subdomains.hostname, endpoints.path, endpoints.method").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&response.Endpoints).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve discovered endpoints", err.Error())
+		return
+	}
 	c.JSON(http.StatusOK, response)
 }
 
@@ -188,7 +427,7 @@ func GetScan(c *gin.Context) {
 func StartScan(c *gin.Context) {
 	var input models.ScanStartRequest // Use model struct
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		RespondError(c, http.StatusBadRequest, "Invalid request body", err.Error())
 		return
 	}
 
@@ -198,9 +437,9 @@ func StartScan(c *gin.Context) {
 	var rootDomain models.RootDomain
 	if err := db.First(&rootDomain, input.RootDomainID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Root domain with ID %d not found", input.RootDomainID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Root domain with ID %d not found", input.RootDomainID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve root domain", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve root domain", err.Error())
 		}
 		return
 	}
@@ -215,9 +454,9 @@ func StartScan(c *gin.Context) {
 		// Ensure the subdomain belongs to the specified root domain
 		if err := db.Where("id = ? AND root_domain_id = ?", *input.SubdomainID, input.RootDomainID).First(&fetchedSubdomain).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Subdomain with ID %d not found or does not belong to root domain ID %d", *input.SubdomainID, input.RootDomainID)})
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Subdomain with ID %d not found or does not belong to root domain ID %d", *input.SubdomainID, input.RootDomainID))
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subdomain", "details": err.Error()})
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomain", err.Error())
 			}
 			return
 		}
@@ -241,13 +480,17 @@ func StartScan(c *gin.Context) {
 		var fetchedTemplate models.ScanTemplate
 		if err := db.First(&fetchedTemplate, *input.ScanTemplateID).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan template with ID %d not found", *input.ScanTemplateID)})
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", *input.ScanTemplateID))
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan template", "details": err.Error()})
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template", err.Error())
 			}
 			return
 		}
 		scanTemplate = &fetchedTemplate
+		if err := scanner.CheckTemplateWordlists(scanTemplate); err != nil {
+			RespondError(c, http.StatusBadRequest, "Scan template has an invalid wordlist", err.Error())
+			return
+		}
 
 		// Parse JSON config strings (handle potential errors gracefully)
 		_ = json.Unmarshal([]byte(scanTemplate.SubdomainScanConfig), &scanConfig.SubdomainScanConfig)
@@ -257,19 +500,87 @@ func StartScan(c *gin.Context) {
 		scanConfig.ScreenshotEnabled = scanTemplate.ScreenshotEnabled // Use template setting
 	}
 
+	// --- Follow-up Template Handling ---
+	// Follow-ups only make sense for root domain scans, which are the only ones that discover new subdomains
+	if input.FollowUpTemplateID != nil {
+		if scanType != "root_domain" {
+			RespondError(c, http.StatusBadRequest, "follow_up_template_id is only supported for root domain scans")
+			return
+		}
+		var followUpTemplate models.ScanTemplate
+		if err := db.Select("id").First(&followUpTemplate, *input.FollowUpTemplateID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Follow-up scan template with ID %d not found", *input.FollowUpTemplateID))
+			} else {
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve follow-up scan template", err.Error())
+			}
+			return
+		}
+	}
+
+	labels, err := normalizeScanLabels(input.Labels)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid labels", err.Error())
+		return
+	}
+
+	if input.SessionID != nil && !validateScanSession(c, db, *input.SessionID, &rootDomain) {
+		return
+	}
+
+	// Overrides are checked now, so a mistyped option fails the request instead of being ignored by the scan
+	overridesJSON := ""
+	if len(input.Overrides) > 0 {
+		overrides, err := scanner.NormalizeTemplateOverrides(input.Overrides)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid overrides", err.Error())
+			return
+		}
+		data, err := json.Marshal(overrides)
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to encode overrides", err.Error())
+			return
+		}
+		overridesJSON = string(data)
+	}
+
+	// --- Duplicate Check ---
+	// Held until the scan record exists, so simultaneous requests (double clicks, retries) start one scan
+	scanStartMu.Lock()
+	defer scanStartMu.Unlock()
+	if !input.Force {
+		duplicate, err := findDuplicateScan(db, input.RootDomainID, input.SubdomainID)
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to check for duplicate scans", err.Error())
+			return
+		}
+		if duplicate != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message":  fmt.Sprintf("A scan of %s is already %s (scan %d), not starting another; set force to start one anyway", targetHost, duplicate.Status, duplicate.ID),
+				"scan_id":  duplicate.ID,
+				"existing": true,
+			})
+			return
+		}
+	}
+
 	// --- Create Scan Record ---
 	scan := models.Scan{
-		RootDomainID:   input.RootDomainID,
-		SubdomainID:    input.SubdomainID, // Assign subdomain ID (can be nil)
-		ScanTemplateID: scanTemplateID,    // Assign template ID (can be nil)
-		ScanType:       scanType,          // Set based on whether SubdomainID is present
-		Status:         "pending",
-		StartedAt:      time.Now(), // Set start time explicitly
+		RootDomainID:       input.RootDomainID,
+		SubdomainID:        input.SubdomainID,        // Assign subdomain ID (can be nil)
+		ScanTemplateID:     scanTemplateID,           // Assign template ID (can be nil)
+		FollowUpTemplateID: input.FollowUpTemplateID, // Template for follow-up scans of new subdomains (can be nil)
+		ScanType:           scanType,                 // Set based on whether SubdomainID is present
+		Status:             "pending",
+		StartedAt:          time.Now(), // Set start time explicitly
+		Labels:             strings.Join(labels, ","),
+		TemplateOverrides:  overridesJSON,
+		SessionID:          input.SessionID,
 	}
 
 	result := db.Create(&scan)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scan record", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to create scan record", result.Error.Error())
 		return
 	}
 
@@ -282,6 +593,505 @@ func StartScan(c *gin.Context) {
 	if scanTemplateID != nil {
 		message += fmt.Sprintf(" using template ID %d", *scanTemplateID)
 	}
+	if input.FollowUpTemplateID != nil {
+		message += fmt.Sprintf(", new subdomains will be followed up with template ID %d", *input.FollowUpTemplateID)
+	}
+	if overridesJSON != "" {
+		message += " with option overrides"
+	}
+	if input.SessionID != nil {
+		message += fmt.Sprintf(", authenticated with session ID %d", *input.SessionID)
+	}
 
 	c.JSON(http.StatusAccepted, gin.H{"message": message, "scan_id": scan.ID})
 }
+
+// ResumeScan handles POST requests running a failed or cancelled scan again from its first stage that did
+// not complete (Scan.ResumePhase), reusing the subdomains and endpoints saved by the earlier stages. Scans
+// left running by a crash, with no job in this process, can be resumed too. The scan runs with the current
+// version of its template.
+func ResumeScan(c *gin.Context) {
+	scanID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scan ID format")
+		return
+	}
+
+	db := database.GetDB()
+	var scan models.Scan
+	if err := db.First(&scan, uint(scanID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scan with ID %d not found", scanID), "Failed to retrieve scan")
+		return
+	}
+
+	// --- Validate Resumable State ---
+	resumableStatuses := []string{"failed", "cancelled"}
+	switch scan.Status {
+	case "failed", "cancelled":
+	case "running":
+		if job, ok := jobs.Get(jobs.ScanJobID(scan.ID)); ok && job.Status == jobs.StatusRunning {
+			RespondError(c, http.StatusConflict, fmt.Sprintf("Scan %d is still running", scan.ID))
+			return
+		}
+		resumableStatuses = []string{"running"} // Interrupted by a restart
+	default:
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Scan %d is %s, only failed, cancelled or interrupted scans can be resumed", scan.ID, scan.Status))
+		return
+	}
+	if scan.ScanType != "root_domain" && scan.ScanType != "subdomain" {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Scans of type '%s' cannot be resumed", scan.ScanType))
+		return
+	}
+	if !scanner.IsResumeStage(scan.ResumePhase) {
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Scan %d has no recorded stage to resume from, start a new scan instead", scan.ID))
+		return
+	}
+	if scan.ScanTemplateID == nil {
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Scan %d has no scan template to resume with", scan.ID))
+		return
+	}
+	var scanTemplate models.ScanTemplate
+	if err := db.First(&scanTemplate, *scan.ScanTemplateID).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scan template with ID %d not found", *scan.ScanTemplateID), "Failed to retrieve scan template")
+		return
+	}
+	var rootDomain models.RootDomain
+	if err := db.Select("domain").First(&rootDomain, scan.RootDomainID).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Root domain of scan %d no longer exists", scan.ID), "Failed to retrieve root domain")
+		return
+	}
+	targetHost := rootDomain.Domain
+	if scan.ScanType == "subdomain" {
+		var subdomain models.Subdomain
+		if scan.SubdomainID == nil || db.Select("hostname").First(&subdomain, *scan.SubdomainID).Error != nil {
+			RespondError(c, http.StatusConflict, fmt.Sprintf("Target subdomain of scan %d no longer exists", scan.ID))
+			return
+		}
+		targetHost = subdomain.Hostname
+	}
+
+	// Compare-and-set, so simultaneous requests resume the scan once
+	result := db.Model(&models.Scan{}).Where("id = ? AND status IN ?", scan.ID, resumableStatuses).
+		Updates(map[string]interface{}{"status": "pending", "completed_at": nil})
+	if result.Error != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to update scan status", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Scan %d changed status, not resuming it", scan.ID))
+		return
+	}
+
+	go scanner.ResumeSubdomainScan(targetHost, scan.ScanType, scan.RootDomainID, scan.ID, &scanTemplate, scan.ResumePhase)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     fmt.Sprintf("Scan %d of %s resumed from its %s stage", scan.ID, targetHost, scan.ResumePhase),
+		"scan_id":     scan.ID,
+		"resume_from": scan.ResumePhase,
+	})
+}
+
+// maxMultiDomainScanDomains caps the root domains of a single multi-domain scan.
+const maxMultiDomainScanDomains = 100
+
+// StartMultiDomainScan handles POST requests starting a scan of several root domains with one template. A
+// multi_domain scan records the run, with a root_domain scan per domain as its children saving what they
+// find to their own domain; up to MULTI_DOMAIN_SCAN_CONCURRENCY of them run at once. Root domains are
+// registrable domains, so their hosts never overlap; a domain name listed twice (in different organizations)
+// is refused. Root domains with a duplicate scan (see findDuplicateScan) are skipped unless force is set. The
+// multi_domain scan's summary counts what each root domain scan found.
+func StartMultiDomainScan(c *gin.Context) {
+	var input models.MultiDomainScanRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if len(input.RootDomainIDs) > maxMultiDomainScanDomains {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("A multi-domain scan covers at most %d root domains", maxMultiDomainScanDomains))
+		return
+	}
+
+	db := database.GetDB()
+	var domains []models.RootDomain
+	if err := db.Where("id IN ?", input.RootDomainIDs).Order("domain").Find(&domains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve root domains", err.Error())
+		return
+	}
+	found := make(map[uint]bool, len(domains))
+	names := make(map[string]uint, len(domains))
+	for _, domain := range domains {
+		if other, ok := names[domain.Domain]; ok {
+			RespondError(c, http.StatusBadRequest, fmt.Sprintf("Root domains %d and %d are both %s, scan them separately", other, domain.ID, domain.Domain))
+			return
+		}
+		names[domain.Domain] = domain.ID
+		found[domain.ID] = true
+	}
+	for _, id := range input.RootDomainIDs {
+		if !found[id] {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Root domain with ID %d not found", id))
+			return
+		}
+	}
+
+	var scanTemplate models.ScanTemplate
+	if err := db.First(&scanTemplate, input.ScanTemplateID).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scan template with ID %d not found", input.ScanTemplateID), "Failed to retrieve scan template")
+		return
+	}
+	if err := scanner.CheckTemplateWordlists(&scanTemplate); err != nil {
+		RespondError(c, http.StatusBadRequest, "Scan template has an invalid wordlist", err.Error())
+		return
+	}
+	labels, err := normalizeScanLabels(input.Labels)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid labels", err.Error())
+		return
+	}
+
+	// --- Duplicate Check ---
+	// Held until the scan records exist, like for single scans, so simultaneous requests start each scan once
+	scanStartMu.Lock()
+	defer scanStartMu.Unlock()
+	skipped := []gin.H{}
+	if !input.Force {
+		kept := make([]models.RootDomain, 0, len(domains))
+		for _, domain := range domains {
+			duplicate, err := findDuplicateScan(db, domain.ID, nil)
+			if err != nil {
+				RespondError(c, http.StatusInternalServerError, "Failed to check for duplicate scans", err.Error())
+				return
+			}
+			if duplicate != nil {
+				skipped = append(skipped, gin.H{"root_domain_id": domain.ID, "domain": domain.Domain, "scan_id": duplicate.ID, "status": duplicate.Status})
+				continue
+			}
+			kept = append(kept, domain)
+		}
+		if len(kept) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"message":  "Every root domain already has a scan pending, running or just completed, not starting another; set force to start one anyway",
+				"skipped":  skipped,
+				"existing": true,
+			})
+			return
+		}
+		domains = kept
+	}
+
+	// Records of the run and its root domain scans are created together, so the queued scans are visible as pending
+	var scan models.Scan
+	var targets []scanner.MultiDomainTarget
+	err = db.Transaction(func(tx *gorm.DB) error {
+		scan = models.Scan{
+			RootDomainID:   domains[0].ID, // Always set; the root domain scans cover the others
+			ScanTemplateID: &scanTemplate.ID,
+			ScanType:       "multi_domain",
+			Status:         "pending",
+			StartedAt:      time.Now(),
+			Labels:         strings.Join(labels, ","),
+		}
+		if err := tx.Create(&scan).Error; err != nil {
+			return err
+		}
+		targets = make([]scanner.MultiDomainTarget, 0, len(domains))
+		for _, domain := range domains {
+			child := models.Scan{
+				RootDomainID:   domain.ID,
+				ScanTemplateID: &scanTemplate.ID,
+				ParentScanID:   &scan.ID,
+				ScanType:       "root_domain",
+				Status:         "pending",
+				StartedAt:      time.Now(),
+				Labels:         scan.Labels,
+			}
+			if err := tx.Create(&child).Error; err != nil {
+				return err
+			}
+			targets = append(targets, scanner.MultiDomainTarget{RootDomainID: domain.ID, Domain: domain.Domain, ScanID: child.ID})
+		}
+		return nil
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to create scan records", err.Error())
+		return
+	}
+
+	go scanner.ExecuteMultiDomainScan(scan.ID, targets, &scanTemplate)
+
+	message := fmt.Sprintf("Multi-domain scan started for %d domains using template ID %d", len(targets), scanTemplate.ID)
+	if len(skipped) > 0 {
+		message += fmt.Sprintf(", skipping %d with a duplicate scan", len(skipped))
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": message,
+		"scan_id": scan.ID,
+		"scans":   targets,
+		"skipped": skipped,
+	})
+}
+
+// scanStartMu serializes the duplicate check and creation of scans started through the API.
+var scanStartMu sync.Mutex
+
+// findDuplicateScan returns a root domain or subdomain scan of the same target that makes a new one
+// redundant, or nil: a pending or running scan, or one completed within SCAN_DEDUP_WINDOW_MINUTES.
+// Scans marked running that have no job in this process are only counted if they started within the
+// window, so scans left behind by a crash don't block their target. Returns nil if the window is 0.
+func findDuplicateScan(db *gorm.DB, rootDomainID uint, subdomainID *uint) (*models.Scan, error) {
+	window := config.GetInt("SCAN_DEDUP_WINDOW_MINUTES", 0)
+	if window <= 0 {
+		return nil, nil
+	}
+	cutoff := time.Now().Add(-time.Duration(window) * time.Minute)
+
+	query := db.Where("root_domain_id = ? AND scan_type IN ?", rootDomainID, []string{"root_domain", "subdomain"})
+	if subdomainID != nil {
+		query = query.Where("subdomain_id = ?", *subdomainID)
+	} else {
+		query = query.Where("subdomain_id IS NULL")
+	}
+	var candidates []models.Scan
+	if err := query.Where("status IN ? OR (status = ? AND completed_at >= ?)", []string{"pending", "running"}, "completed", cutoff).
+		Order("id desc").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	for i, scan := range candidates {
+		if scan.Status == "completed" || !scan.StartedAt.Before(cutoff) {
+			return &candidates[i], nil
+		}
+		if job, ok := jobs.Get(jobs.ScanJobID(scan.ID)); ok && job.Status == jobs.StatusRunning {
+			return &candidates[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// PreviewScanScreenshots handles POST requests listing the existing assets a scan with the given
+// body (same as StartScan) would screenshot before discovery, without starting anything.
+func PreviewScanScreenshots(c *gin.Context) {
+	var input models.ScanStartRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	db := database.GetDB()
+
+	var rootDomain models.RootDomain
+	if err := db.First(&rootDomain, input.RootDomainID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Root domain with ID %d not found", input.RootDomainID))
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve root domain", err.Error())
+		}
+		return
+	}
+
+	response := ScanScreenshotPreviewResponse{
+		RootDomainID:   input.RootDomainID,
+		SubdomainID:    input.SubdomainID,
+		ScanType:       "root_domain",
+		ScanTemplateID: input.ScanTemplateID,
+		Targets:        []scanner.ExistingScreenshotTarget{},
+	}
+	targetHost := rootDomain.Domain
+
+	if input.SubdomainID != nil {
+		var subdomain models.Subdomain
+		if err := db.Where("id = ? AND root_domain_id = ?", *input.SubdomainID, input.RootDomainID).First(&subdomain).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Subdomain with ID %d not found or does not belong to root domain ID %d", *input.SubdomainID, input.RootDomainID))
+			} else {
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomain", err.Error())
+			}
+			return
+		}
+		targetHost = subdomain.Hostname
+		response.ScanType = "subdomain"
+	}
+
+	if input.ScanTemplateID != nil {
+		var scanTemplate models.ScanTemplate
+		if err := db.First(&scanTemplate, *input.ScanTemplateID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan template with ID %d not found", *input.ScanTemplateID))
+			} else {
+				RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan template", err.Error())
+			}
+			return
+		}
+		response.ScreenshotEnabled = scanTemplate.ScreenshotEnabled
+		response.ScreenshotTargetOnly = scanTemplate.ScreenshotTargetOnly
+		response.ScreenshotCriteria, _ = scanner.ParseScreenshotCriteria(scanTemplate.ScreenshotCriteria)
+	}
+
+	// Without screenshots enabled nothing existing is captured
+	if response.ScreenshotEnabled {
+		targets, err := scanner.ExistingScreenshotTargets(db, rootDomain.ID, response.ScanType, targetHost, response.ScreenshotTargetOnly, response.ScreenshotCriteria)
+		if err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to gather existing assets", err.Error())
+			return
+		}
+		if targets != nil {
+			response.Targets = targets
+		}
+	}
+	response.Total = len(response.Targets)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetScanTiming handles GET requests for the per-phase durations of a scan (see scanner.PhaseDiscovery and
+// the other phases), to show e.g. that screenshots dominate a scan. Scans that are not subdomain or root
+// domain scans, or that ran before phases were timed, have no phases.
+func GetScanTiming(c *gin.Context) {
+	scanID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scan ID format")
+		return
+	}
+	var scan models.Scan
+	if err := database.GetDB().Select("id", "status", "started_at", "completed_at", "phase_timings").First(&scan, uint(scanID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scan with ID %d not found", scanID), "Failed to retrieve scan")
+		return
+	}
+
+	var timings []models.ScanPhaseTiming
+	if scan.PhaseTimings != "" {
+		if err := json.Unmarshal([]byte(scan.PhaseTimings), &timings); err != nil {
+			RespondError(c, http.StatusInternalServerError, "Failed to decode phase timings", err.Error())
+			return
+		}
+	}
+	response := ScanTimingResponse{
+		ScanID:      scan.ID,
+		Status:      scan.Status,
+		StartedAt:   scan.StartedAt,
+		CompletedAt: scan.CompletedAt,
+		Phases:      make([]ScanPhaseTimingResponse, len(timings)),
+	}
+	for _, timing := range timings {
+		response.TimedMs += timing.DurationMs
+	}
+	for i, timing := range timings {
+		response.Phases[i].ScanPhaseTiming = timing
+		if response.TimedMs > 0 {
+			response.Phases[i].Percent = math.Round(float64(timing.DurationMs)*1000/float64(response.TimedMs)) / 10
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetScanConfig handles GET requests for the resolved tool options (subfinder, httpx, katana) a scan ran
+// with, along with the CLI commands reproducing its runs elsewhere (see scanner.ToolCommands). Scans that
+// predate the recorded configuration, or don't run these tools, have none.
+func GetScanConfig(c *gin.Context) {
+	scanID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scan ID format")
+		return
+	}
+	db := database.GetDB()
+	var scan models.Scan
+	if err := db.Select("id", "root_domain_id", "scan_type", "scan_template_id", "template_overrides", "effective_config", "tool_versions", "target_snapshot").First(&scan, uint(scanID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scan with ID %d not found", scanID), "Failed to retrieve scan")
+		return
+	}
+	if scan.EffectiveConfig == "" {
+		RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan %d has no recorded tool configuration", scan.ID))
+		return
+	}
+	response := ScanConfigResponse{ScanID: scan.ID, ScanType: scan.ScanType, ScanTemplateID: scan.ScanTemplateID}
+	if err := json.Unmarshal([]byte(scan.EffectiveConfig), &response.EffectiveConfig); err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to decode the scan's tool configuration", err.Error())
+		return
+	}
+	if scan.TemplateOverrides != "" {
+		_ = json.Unmarshal([]byte(scan.TemplateOverrides), &response.TemplateOverrides)
+	}
+	if scan.ToolVersions != "" {
+		_ = json.Unmarshal([]byte(scan.ToolVersions), &response.ToolVersions)
+	}
+	if scan.TargetSnapshot != "" {
+		var snapshot models.ScanTargetSnapshot
+		if json.Unmarshal([]byte(scan.TargetSnapshot), &snapshot) == nil {
+			response.SeedURLs = snapshot.SeedURLs
+		}
+	}
+
+	var rootDomain models.RootDomain
+	if err := db.Select("id", "domain").First(&rootDomain, scan.RootDomainID).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Root domain of scan %d not found", scan.ID), "Failed to retrieve the scan's root domain")
+		return
+	}
+	response.Commands = scanner.ToolCommands(response.EffectiveConfig, rootDomain.Domain)
+	if response.Commands == nil {
+		response.Commands = []scanner.ToolCommand{}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// logTailHeartbeat is how often a log tail stream sends a keep-alive and checks whether the scan ended.
+const logTailHeartbeat = 10 * time.Second
+
+// StreamScanLogTail handles GET requests streaming the server log lines of a scan as server-sent events:
+// the recent lines first, then new ones as they are logged, each as a "log" event. An "end" event with
+// the final status closes the stream once the scan is no longer pending or running. Lines are attributed
+// to a scan by the scan ID they mention (see logtail), and only lines logged since the server started
+// are available.
+func StreamScanLogTail(c *gin.Context) {
+	scanID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scan ID format")
+		return
+	}
+	db := database.GetDB()
+	var scan models.Scan
+	if err := db.Select("id", "status").First(&scan, uint(scanID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Scan with ID %d not found", scanID))
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve scan", err.Error())
+		}
+		return
+	}
+
+	recent, lines, unsubscribe := logtail.Subscribe(scan.ID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Don't let proxies buffer the stream
+	c.Status(http.StatusOK)
+	for _, line := range recent {
+		c.SSEvent("log", line)
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(logTailHeartbeat)
+	defer ticker.Stop()
+	status := scan.Status
+	for {
+		if status != "pending" && status != "running" {
+			c.SSEvent("end", gin.H{"status": status})
+			c.Writer.Flush()
+			return
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case line := <-lines:
+			c.SSEvent("log", line)
+			c.Writer.Flush()
+		case <-ticker.C:
+			if err := db.Model(&models.Scan{}).Where("id = ?", scan.ID).Pluck("status", &status).Error; err != nil {
+				return
+			}
+			// Comment line, keeps idle connections from being closed by proxies
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
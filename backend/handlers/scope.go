@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/csv"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"rewrite-go/config"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weppos/publicsuffix-go/publicsuffix"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- Response Structs ---
+
+// ScopeImportResult is the outcome of one entry of a scope import.
+type ScopeImportResult struct {
+	Input   string `json:"input"`
+	Pattern string `json:"pattern,omitempty"` // Normalized hostname or *.domain pattern
+	InScope bool   `json:"in_scope"`
+	Domain  string `json:"domain,omitempty"` // Root domain of the pattern
+	Error   string `json:"error,omitempty"`
+}
+
+// ScopeImportResponse summarizes a scope import, with a result per entry in input order.
+type ScopeImportResponse struct {
+	DryRun         bool                `json:"dry_run"`
+	InScope        int                 `json:"in_scope"`
+	OutOfScope     int                 `json:"out_of_scope"`
+	Invalid        int                 `json:"invalid"`
+	DomainsCreated []string            `json:"domains_created"` // Root domains of in-scope patterns the organization lacked
+	Results        []ScopeImportResult `json:"results"`
+}
+
+// scopeEntry is a pattern of a pasted scope with the section it was listed in.
+type scopeEntry struct {
+	Input   string
+	InScope bool
+}
+
+// --- Handler Functions ---
+
+// GetOrganizationScope handles GET requests listing the scope rules of an organization, in-scope first.
+func GetOrganizationScope(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("org_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
+		return
+	}
+	rules := []models.ScopeRule{}
+	if err := database.GetDB().Where("organization_id = ?", uint(orgID)).Order("in_scope desc, pattern").Find(&rules).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve scope rules", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// ImportOrganizationScope handles POST requests turning a pasted program scope into scope rules of an
+// organization. The body is either one pattern per line or the scope CSV HackerOne exports (header
+// starting with identifier,asset_type). In a list, lines after an "Out of scope" heading or starting with
+// "!" are out of scope, lines after an "In scope" heading in scope again; blank lines, lines starting
+// with # and list bullets are skipped. Patterns are hostnames, *.domain wildcards or URLs, whose host is
+// used. In-scope patterns also create the root domains the organization lacks. A pattern listed again
+// replaces its rule. With dry_run=true nothing is saved. The body is limited to IMPORT_MAX_UPLOAD_BYTES.
+func ImportOrganizationScope(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("org_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	db := database.GetDB()
+	var org models.Organization
+	if err := db.Select("id").First(&org, uint(orgID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Organization with ID %d not found", orgID), "Database error checking organization")
+		return
+	}
+
+	maxUploadBytes := int64(config.GetInt("IMPORT_MAX_UPLOAD_BYTES", defaultImportMaxUploadBytes))
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if goerrors.As(err, &maxBytesErr) {
+			RespondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds the maximum size of %d bytes", maxUploadBytes))
+		} else {
+			RespondError(c, http.StatusBadRequest, "Failed to read request body", err.Error())
+		}
+		return
+	}
+	entries, err := parseScopeText(string(body))
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scope CSV", err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		RespondError(c, http.StatusBadRequest, "No scope patterns to import")
+		return
+	}
+
+	response := ScopeImportResponse{DryRun: dryRun, DomainsCreated: []string{}, Results: make([]ScopeImportResult, 0, len(entries))}
+	var rules []models.ScopeRule
+	ruleIndex := make(map[string]int) // Pattern -> index in rules, the last listing wins
+	ruleDomains := make(map[string]string)
+	for _, entry := range entries {
+		result := ScopeImportResult{Input: entry.Input, InScope: entry.InScope}
+		pattern, domain, err := scopePattern(entry.Input)
+		if err != nil {
+			result.Error = err.Error()
+			response.Invalid++
+			response.Results = append(response.Results, result)
+			continue
+		}
+		result.Pattern, result.Domain = pattern, domain
+		ruleDomains[pattern] = domain
+		if entry.InScope {
+			response.InScope++
+		} else {
+			response.OutOfScope++
+		}
+		rule := models.ScopeRule{OrganizationID: org.ID, Pattern: pattern, InScope: entry.InScope}
+		if i, ok := ruleIndex[pattern]; ok {
+			rules[i] = rule
+		} else {
+			ruleIndex[pattern] = len(rules)
+			rules = append(rules, rule)
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	var existingDomains []string
+	if err := db.Model(&models.RootDomain{}).Where("organization_id = ?", org.ID).Pluck("domain", &existingDomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve existing domains", err.Error())
+		return
+	}
+	known := make(map[string]bool, len(existingDomains))
+	for _, domain := range existingDomains {
+		known[domain] = true
+	}
+	for _, rule := range rules {
+		if domain := ruleDomains[rule.Pattern]; rule.InScope && !known[domain] {
+			known[domain] = true
+			response.DomainsCreated = append(response.DomainsCreated, domain)
+		}
+	}
+	if dryRun || len(rules) == 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "organization_id"}, {Name: "pattern"}},
+			DoUpdates: clause.AssignmentColumns([]string{"in_scope"}),
+		}).CreateInBatches(rules, 500).Error; err != nil {
+			return err
+		}
+		for _, domain := range response.DomainsCreated {
+			if err := tx.Create(&models.RootDomain{Domain: domain, OrganizationID: org.ID}).Error; err != nil {
+				return fmt.Errorf("creating domain '%s': %w", domain, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to save scope", err.Error())
+		return
+	}
+	log.Printf("Scope import into organization %d: %d in scope, %d out of scope, %d invalid, %d domains created", org.ID, response.InScope, response.OutOfScope, response.Invalid, len(response.DomainsCreated))
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteScopeRule handles DELETE requests deleting a scope rule of an organization. Root domains created
+// by the rule are kept.
+func DeleteScopeRule(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("org_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
+		return
+	}
+	ruleID, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid scope rule ID format")
+		return
+	}
+	db := database.GetDB()
+	var rule models.ScopeRule
+	if err := db.Where("organization_id = ?", uint(orgID)).First(&rule, uint(ruleID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Scope rule with ID %d not found", ruleID), "Failed to retrieve scope rule")
+		return
+	}
+	if err := db.Delete(&rule).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to delete scope rule", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Scope rule %d deleted", rule.ID)})
+}
+
+// --- Helper Functions ---
+
+// parseScopeText splits a pasted scope into its entries, see ImportOrganizationScope.
+func parseScopeText(text string) ([]scopeEntry, error) {
+	text = strings.TrimPrefix(text, "\ufeff")
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(text)), "identifier,asset_type") {
+		return parseHackerOneScopeCSV(text)
+	}
+	var entries []scopeEntry
+	inScope := true
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch strings.Trim(strings.ToLower(strings.ReplaceAll(line, "-", " ")), " :#") {
+		case "in scope":
+			inScope = true
+			continue
+		case "out of scope":
+			inScope = false
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, bullet := range []string{"- ", "* ", "• "} {
+			line = strings.TrimSpace(strings.TrimPrefix(line, bullet))
+		}
+		entry := scopeEntry{Input: line, InScope: inScope}
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			entry = scopeEntry{Input: strings.TrimSpace(rest), InScope: false}
+		}
+		if entry.Input != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// parseHackerOneScopeCSV reads the scope CSV of a HackerOne program. Assets other than URLs, wildcards and
+// domains (e.g. mobile apps or CIDRs) are skipped; assets not eligible for submission are out of scope.
+func parseHackerOneScopeCSV(text string) ([]scopeEntry, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	eligibleColumn, hasEligible := columns["eligible_for_submission"]
+	var entries []scopeEntry
+	for _, record := range records[1:] {
+		if len(record) < 2 {
+			continue
+		}
+		switch strings.ToUpper(strings.TrimSpace(record[1])) {
+		case "URL", "WILDCARD", "DOMAIN":
+		default:
+			continue
+		}
+		entry := scopeEntry{Input: strings.TrimSpace(record[0]), InScope: true}
+		if hasEligible && eligibleColumn < len(record) {
+			entry.InScope = strings.EqualFold(strings.TrimSpace(record[eligibleColumn]), "true")
+		}
+		// An identifier may list several hosts, e.g. "example.com, www.example.com"
+		for _, identifier := range strings.Split(entry.Input, ",") {
+			if identifier = strings.TrimSpace(identifier); identifier != "" {
+				entries = append(entries, scopeEntry{Input: identifier, InScope: entry.InScope})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// scopePattern normalizes a scope entry to a lowercase hostname or *.domain pattern and returns it with
+// its registrable domain, e.g. "https://*.Example.co.uk/" to "*.example.co.uk" and "example.co.uk".
+func scopePattern(entry string) (string, string, error) {
+	host := strings.ToLower(strings.TrimSpace(entry))
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:] // url.Parse rejects the '*' of wildcard URLs
+	}
+	if end := strings.IndexAny(host, "/:?#"); end >= 0 {
+		host = host[:end] // Paths, ports and CIDR prefix lengths
+	}
+	host = strings.TrimSuffix(host, ".")
+	name, wildcard := strings.CutPrefix(host, "*.")
+	if net.ParseIP(name) != nil {
+		return "", "", fmt.Errorf("IP addresses and ranges are not supported")
+	}
+	if name == "" || strings.Contains(name, "..") || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789.-") != "" {
+		return "", "", fmt.Errorf("invalid hostname or unsupported wildcard")
+	}
+	parsed, err := publicsuffix.Parse(name)
+	if err != nil {
+		return "", "", err
+	}
+	domain := parsed.SLD + "." + parsed.TLD
+	if wildcard {
+		return "*." + name, domain, nil
+	}
+	return name, domain, nil
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- Request Structs ---
+
+// ScreenshotBatchRequest selects the URLs of a screenshot batch: explicit URLs, or the subdomain and
+// endpoint URLs of one subdomain or root domain. Exactly one of them must be given.
+type ScreenshotBatchRequest struct {
+	URLs        []string `json:"urls"`         // Hosts must be known subdomains of a single root domain
+	SubdomainID *uint    `json:"subdomain_id"` // The subdomain and its endpoints
+	DomainID    *uint    `json:"domain_id"`    // Every subdomain and endpoint of the root domain
+	Concurrency int      `json:"concurrency"`  // Parallel captures, default SCREENSHOT_BATCH_CONCURRENCY
+}
+
+// DomainScreenshotsRequest is the optional body of a domain screenshot re-run.
+type DomainScreenshotsRequest struct {
+	ScanTemplateID *uint `json:"scan_template_id"` // Endpoint screenshot criteria are taken from the template, default all endpoints
+	Concurrency    int   `json:"concurrency"`      // Parallel captures, default SCREENSHOT_BATCH_CONCURRENCY
+}
+
+// --- Response Structs ---
+
+// ScreenshotResponse represents a single screenshot record.
+type ScreenshotResponse struct {
+	ID          uint      `json:"id"`
+	ScanID      uint      `json:"scan_id"`
+	SubdomainID *uint     `json:"subdomain_id,omitempty"`
+	EndpointID  *uint     `json:"endpoint_id,omitempty"`
+	URL         string    `json:"url"`
+	FilePath    string    `json:"file_path"`
+	SkipReason  string    `json:"skip_reason,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	FailureKind string    `json:"failure_kind,omitempty"`
+	Attempts    int       `json:"attempts"`
+	CapturedAt  time.Time `json:"captured_at"`
+}
+
+// ScreenshotListResponse represents a page of screenshot records.
+type ScreenshotListResponse struct {
+	Page        int                  `json:"page"`
+	PageSize    int                  `json:"page_size"`
+	Total       int64                `json:"total"`
+	Screenshots []ScreenshotResponse `json:"screenshots"`
+}
+
+// ScreenshotBatchResponse acknowledges a screenshot batch started in the background. Progress is the
+// job of the scan, the captures are listed by GET /api/screenshots?scan_id=.
+type ScreenshotBatchResponse struct {
+	Message     string `json:"message"`
+	ScanID      uint   `json:"scan_id"` // Scan of type "screenshot" owning the captures
+	Concurrency int    `json:"concurrency"`
+	Total       int    `json:"total"`
+}
+
+// ScreenshotEligibilityResponse lists what decides whether a URL is screenshotted, see
+// scanner.ShouldScreenshotContent.
+type ScreenshotEligibilityResponse struct {
+	ContentTypes       []string `json:"content_types"`       // Media types screenshotted when the content type is known
+	ExcludedExtensions []string `json:"excluded_extensions"` // Path extensions skipped when it is not
+}
+
+// --- Handler Functions ---
+
+// GetScreenshotEligibility handles GET requests for the current screenshot content types and excluded
+// extensions, from the SCREENSHOT_CONTENT_TYPES and SCREENSHOT_EXCLUDED_EXTENSIONS settings or their defaults.
+func GetScreenshotEligibility(c *gin.Context) {
+	c.JSON(http.StatusOK, ScreenshotEligibilityResponse{
+		ContentTypes:       scanner.ScreenshotContentTypes(),
+		ExcludedExtensions: scanner.ScreenshotExcludedExtensions(),
+	})
+}
+
+// GetScreenshots handles GET requests listing screenshot metadata, newest first.
+// Optional filters: scan_id, subdomain_id, endpoint_id, captured_after and captured_before
+// (RFC 3339 or YYYY-MM-DD), status (captured, skipped or failed), viewport (desktop or mobile) and
+// include_skipped (default true, also covers failed captures). Paginated with page and page_size.
+func GetScreenshots(c *gin.Context) {
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	query := db.Model(&models.Screenshot{})
+
+	// Optional ID filters
+	for _, column := range []string{"scan_id", "subdomain_id", "endpoint_id"} {
+		valueStr := c.Query(column)
+		if valueStr == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(valueStr, 10, 32)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid %s format", column))
+			return
+		}
+		query = query.Where(column+" = ?", uint(value))
+	}
+
+	// Optional capture date range
+	capturedAfter, ok := parseTimeQuery(c, "captured_after")
+	if !ok {
+		return
+	}
+	if capturedAfter != nil {
+		query = query.Where("captured_at >= ?", *capturedAfter)
+	}
+	capturedBefore, ok := parseTimeQuery(c, "captured_before")
+	if !ok {
+		return
+	}
+	if capturedBefore != nil {
+		query = query.Where("captured_at < ?", *capturedBefore)
+	}
+
+	if status := c.Query("status"); status != "" {
+		switch status {
+		case scanner.ScreenshotStatusCaptured, scanner.ScreenshotStatusSkipped, scanner.ScreenshotStatusFailed:
+			query = query.Where("status = ?", status)
+		default:
+			RespondError(c, http.StatusBadRequest, "Invalid status, must be captured, skipped or failed")
+			return
+		}
+	}
+
+	switch viewport := c.Query("viewport"); viewport {
+	case "":
+	case scanner.ScreenshotViewportDesktop:
+		query = query.Where("viewport = ? OR viewport = '' OR viewport IS NULL", viewport) // Older records are desktop captures
+	case scanner.ScreenshotViewportMobile:
+		query = query.Where("viewport = ?", viewport)
+	default:
+		RespondError(c, http.StatusBadRequest, "Invalid viewport, must be desktop or mobile")
+		return
+	}
+
+	// Skipped and failed captures have no file on disk
+	if includeSkipped := c.Query("include_skipped"); includeSkipped != "" {
+		include, err := strconv.ParseBool(includeSkipped)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid include_skipped value, must be true or false")
+			return
+		}
+		if !include {
+			query = query.Where("file_path <> ?", "")
+		}
+	}
+
+	response := ScreenshotListResponse{
+		Page:        page,
+		PageSize:    pageSize,
+		Screenshots: []ScreenshotResponse{},
+	}
+	if err := query.Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count screenshots", err.Error())
+		return
+	}
+
+	var screenshots []models.Screenshot
+	if err := query.Order("captured_at desc, id desc").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&screenshots).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve screenshots", err.Error())
+		return
+	}
+
+	for _, shot := range screenshots {
+		response.Screenshots = append(response.Screenshots, ScreenshotResponse{
+			ID:          shot.ID,
+			ScanID:      shot.ScanID,
+			SubdomainID: shot.SubdomainID,
+			EndpointID:  shot.EndpointID,
+			URL:         shot.URL,
+			FilePath:    shot.FilePath,
+			SkipReason:  shot.SkipReason,
+			Status:      shot.Status,
+			Error:       shot.Error,
+			FailureKind: shot.FailureKind,
+			Attempts:    shot.Attempts,
+			CapturedAt:  shot.CapturedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// parseTimeQuery reads an optional timestamp query parameter in RFC 3339 or YYYY-MM-DD format.
+// Invalid values are rejected with a 400 response.
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, bool) {
+	valueStr := c.Query(name)
+	if valueStr == "" {
+		return nil, true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, valueStr); err == nil {
+			return &t, true
+		}
+	}
+	RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid %s, must be RFC 3339 or YYYY-MM-DD", name))
+	return nil, false
+}
+
+// CreateScreenshotBatch handles POST requests screenshotting a set of URLs now, without a full scan. The
+// captures run in the background in a bounded worker pool and are recorded under a new scan of type
+// "screenshot", whose ID is returned. Explicit URLs must belong to known subdomains, and every URL and
+// every request the browser makes for it is checked against private and internal addresses; the existing
+// URLs of a domain or subdomain are captured like in a scan. The batch is cancelled like any other scan
+// (see CancelScan).
+func CreateScreenshotBatch(c *gin.Context) {
+	var input ScreenshotBatchRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	selectors := 0
+	for _, set := range []bool{len(input.URLs) > 0, input.SubdomainID != nil, input.DomainID != nil} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		RespondError(c, http.StatusBadRequest, "Exactly one of urls, subdomain_id and domain_id is required")
+		return
+	}
+	if input.Concurrency < 0 || input.Concurrency > scanner.MaxScreenshotBatchConcurrency {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid concurrency, must be between 1 and %d", scanner.MaxScreenshotBatchConcurrency))
+		return
+	}
+
+	db := database.GetDB()
+	var rootDomainID uint
+	var subdomainID *uint
+	var targets []scanner.ExistingScreenshotTarget
+	var err error
+	switch {
+	case input.DomainID != nil:
+		var domain models.RootDomain
+		if err := db.First(&domain, *input.DomainID).Error; err != nil {
+			respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", *input.DomainID), "Failed to retrieve domain")
+			return
+		}
+		rootDomainID = domain.ID
+		targets, err = scanner.ExistingScreenshotTargets(db, domain.ID, "root_domain", domain.Domain, false, nil)
+	case input.SubdomainID != nil:
+		var subdomain models.Subdomain
+		if err := db.First(&subdomain, *input.SubdomainID).Error; err != nil {
+			respondLookupError(c, err, fmt.Sprintf("Subdomain with ID %d not found", *input.SubdomainID), "Failed to retrieve subdomain")
+			return
+		}
+		rootDomainID, subdomainID = subdomain.RootDomainID, &subdomain.ID
+		targets, err = scanner.ExistingScreenshotTargets(db, subdomain.RootDomainID, "subdomain", subdomain.Hostname, true, nil)
+	default:
+		var status int
+		var message string
+		targets, rootDomainID, status, message = screenshotBatchURLTargets(input.URLs)
+		if status != 0 {
+			RespondError(c, status, message)
+			return
+		}
+	}
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to list screenshot targets", err.Error())
+		return
+	}
+	if len(targets) == 0 {
+		RespondError(c, http.StatusBadRequest, "Nothing to screenshot")
+		return
+	}
+	if len(targets) > scanner.MaxScreenshotBatchURLs {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Batch has %d URLs, at most %d are allowed", len(targets), scanner.MaxScreenshotBatchURLs))
+		return
+	}
+
+	scan := models.Scan{
+		RootDomainID: rootDomainID,
+		SubdomainID:  subdomainID,
+		ScanType:     scanner.ScanTypeScreenshot,
+		Status:       "pending",
+		StartedAt:    time.Now(),
+	}
+	if err := db.Create(&scan).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to create screenshot scan", err.Error())
+		return
+	}
+
+	concurrency := scanner.ScreenshotBatchConcurrency(input.Concurrency)
+	go scanner.RunScreenshotBatch(context.Background(), db, scan.ID, targets, concurrency, len(input.URLs) > 0)
+
+	c.JSON(http.StatusAccepted, ScreenshotBatchResponse{
+		Message:     fmt.Sprintf("Screenshotting %d URLs", len(targets)),
+		ScanID:      scan.ID,
+		Concurrency: concurrency,
+		Total:       len(targets),
+	})
+}
+
+// RescreenshotDomain handles POST requests re-running only the screenshot phase of a scan for a root
+// domain: every existing subdomain and endpoint URL is captured again with the current capture settings,
+// under a new scan of type "screenshot". Endpoints are filtered by the screenshot criteria of the given
+// template, if any. The URLs were found by the domain's scans, so they are captured like in a scan's
+// screenshot phase, without the address checks of explicit batch URLs. The captures run in the background
+// like a scan; the scan ID is returned right away.
+func RescreenshotDomain(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+	var input DomainScreenshotsRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			RespondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if input.Concurrency < 0 || input.Concurrency > scanner.MaxScreenshotBatchConcurrency {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid concurrency, must be between 1 and %d", scanner.MaxScreenshotBatchConcurrency))
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.First(&domain, uint(domainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+		return
+	}
+	var criteria []string
+	if input.ScanTemplateID != nil {
+		var template models.ScanTemplate
+		if err := db.First(&template, *input.ScanTemplateID).Error; err != nil {
+			respondLookupError(c, err, fmt.Sprintf("Scan template with ID %d not found", *input.ScanTemplateID), "Failed to retrieve scan template")
+			return
+		}
+		if criteria, err = scanner.ParseScreenshotCriteria(template.ScreenshotCriteria); err != nil {
+			RespondError(c, http.StatusUnprocessableEntity, "Template has invalid screenshot criteria", err.Error())
+			return
+		}
+	}
+
+	// One re-run per domain at a time, captures of the same URLs would only race each other. Held until the
+	// scan record exists, so simultaneous requests can't both pass the check
+	scanStartMu.Lock()
+	defer scanStartMu.Unlock()
+	var running int64
+	if err := db.Model(&models.Scan{}).
+		Where("root_domain_id = ? AND scan_type = ? AND status IN ?", domain.ID, scanner.ScanTypeScreenshot, []string{"pending", "running"}).
+		Count(&running).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to check running screenshot scans", err.Error())
+		return
+	}
+	if running > 0 {
+		RespondError(c, http.StatusConflict, fmt.Sprintf("Screenshots of domain %s are already being taken", domain.Domain))
+		return
+	}
+
+	targets, err := scanner.ExistingScreenshotTargets(db, domain.ID, "root_domain", domain.Domain, false, criteria)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to list screenshot targets", err.Error())
+		return
+	}
+	if len(targets) == 0 {
+		RespondError(c, http.StatusBadRequest, "Nothing to screenshot")
+		return
+	}
+
+	scan := models.Scan{
+		RootDomainID:   domain.ID,
+		ScanTemplateID: input.ScanTemplateID,
+		ScanType:       scanner.ScanTypeScreenshot,
+		Status:         "pending",
+		StartedAt:      time.Now(),
+	}
+	if err := db.Create(&scan).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to create screenshot scan", err.Error())
+		return
+	}
+
+	// The captures outlive the request; the scan is cancelled like any other (see CancelScan)
+	concurrency := scanner.ScreenshotBatchConcurrency(input.Concurrency)
+	go scanner.RunScreenshotBatch(context.Background(), db, scan.ID, targets, concurrency, false)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": fmt.Sprintf("Screenshotting %d URLs of domain %s", len(targets), domain.Domain),
+		"scan_id": scan.ID,
+		"targets": len(targets),
+	})
+}
+
+// screenshotBatchURLTargets validates explicit batch URLs: each must be an http(s) URL on a known
+// subdomain, all of the same root domain. Duplicates are dropped; URLs matching an endpoint path are linked
+// to the endpoint, the others to the subdomain. On invalid input a status and message are returned.
+func screenshotBatchURLTargets(rawURLs []string) ([]scanner.ExistingScreenshotTarget, uint, int, string) {
+	if len(rawURLs) > scanner.MaxScreenshotBatchURLs {
+		return nil, 0, http.StatusBadRequest, fmt.Sprintf("Batch has %d URLs, at most %d are allowed", len(rawURLs), scanner.MaxScreenshotBatchURLs)
+	}
+	db := database.GetDB()
+	subdomains := make(map[string]*models.Subdomain)
+	seen := make(map[string]bool)
+	var targets []scanner.ExistingScreenshotTarget
+	var rootDomainID uint
+	for _, rawURL := range rawURLs {
+		parsed, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+			return nil, 0, http.StatusBadRequest, fmt.Sprintf("Invalid URL '%s', must be an absolute http(s) URL", rawURL)
+		}
+		parsed.Fragment = ""
+		urlStr := parsed.String()
+		if seen[urlStr] {
+			continue
+		}
+		seen[urlStr] = true
+
+		hostname := strings.ToLower(parsed.Hostname())
+		subdomain, ok := subdomains[hostname]
+		if !ok {
+			var found models.Subdomain
+			if err := db.Where("hostname = ?", hostname).First(&found).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, 0, http.StatusBadRequest, fmt.Sprintf("Host of URL '%s' is not a known subdomain", rawURL)
+				}
+				return nil, 0, http.StatusInternalServerError, fmt.Sprintf("Failed to look up subdomain %s: %v", hostname, err)
+			}
+			subdomain = &found
+			subdomains[hostname] = subdomain
+		}
+		if rootDomainID == 0 {
+			rootDomainID = subdomain.RootDomainID
+		} else if subdomain.RootDomainID != rootDomainID {
+			return nil, 0, http.StatusBadRequest, "All URLs must belong to subdomains of the same root domain"
+		}
+
+		target := scanner.ExistingScreenshotTarget{URL: urlStr, SubdomainID: &subdomain.ID}
+		if path := scanner.NormalizeEndpointPath(parsed.EscapedPath()); path != "/" {
+			var endpoint models.Endpoint
+			if err := db.Where("subdomain_id = ? AND path = ?", subdomain.ID, path).First(&endpoint).Error; err == nil {
+				target.SubdomainID, target.EndpointID = nil, &endpoint.ID
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, rootDomainID, 0, ""
+}
+
+// respondLookupError answers a failed single-record lookup with 404 if the record does not exist, 500 otherwise.
+func respondLookupError(c *gin.Context, err error, notFound, failed string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		RespondError(c, http.StatusNotFound, notFound)
+	} else {
+		RespondError(c, http.StatusInternalServerError, failed, err.Error())
+	}
+}
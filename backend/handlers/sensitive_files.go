@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- Response Structs ---
+
+// SensitiveFileResponse is a sensitive file found on a subdomain.
+type SensitiveFileResponse struct {
+	ID            uint       `json:"id"`
+	SubdomainID   uint       `json:"subdomain_id"`
+	Hostname      string     `json:"hostname"`
+	URL           string     `json:"url"`
+	Path          string     `json:"path"`
+	StatusCode    int        `json:"status_code"`
+	ContentType   string     `json:"content_type,omitempty"`
+	ContentLength int        `json:"content_length"`
+	ScanID        *uint      `json:"scan_id,omitempty"`
+	DiscoveredAt  time.Time  `json:"discovered_at"`
+	LastSeenAt    *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// SensitivePathCount is a probed path with the number of subdomains serving it.
+type SensitivePathCount struct {
+	Path       string `json:"path"`
+	Subdomains int64  `json:"subdomains"`
+}
+
+// SensitiveFileListResponse is a page of a domain's sensitive files, with the paths found.
+type SensitiveFileListResponse struct {
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"page_size"`
+	Total    int64                   `json:"total"`
+	Paths    []SensitivePathCount    `json:"paths"` // Every path found on the domain, most widespread first, regardless of filters
+	Files    []SensitiveFileResponse `json:"files"`
+}
+
+// --- Handler Functions ---
+
+// GetDomainSensitiveFiles handles GET requests listing the sensitive files (e.g. /.env) found on a root
+// domain's subdomains by scans with the sensitive_files tool. Optional filter path; paginated with page and
+// page_size.
+func GetDomainSensitiveFiles(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.Select("id").First(&domain, uint(domainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+		return
+	}
+
+	response := SensitiveFileListResponse{
+		Page:     page,
+		PageSize: pageSize,
+		Paths:    []SensitivePathCount{},
+		Files:    []SensitiveFileResponse{},
+	}
+	domainFiles := func() *gorm.DB {
+		return db.Model(&models.SensitiveFile{}).
+			Joins("JOIN subdomains ON subdomains.id = sensitive_files.subdomain_id").
+			Where("subdomains.root_domain_id = ?", domain.ID)
+	}
+	if err := domainFiles().
+		Select("sensitive_files.path AS path, COUNT(DISTINCT sensitive_files.subdomain_id) AS subdomains").
+		Group("sensitive_files.path").Order("subdomains desc, path").
+		Scan(&response.Paths).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count sensitive file paths", err.Error())
+		return
+	}
+
+	query := domainFiles()
+	if path := strings.TrimSpace(c.Query("path")); path != "" {
+		query = query.Where("sensitive_files.path = ?", path)
+	}
+	if err := query.Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count sensitive files", err.Error())
+		return
+	}
+	if err := query.Select("sensitive_files.*, subdomains.hostname").
+		Order("subdomains.hostname, sensitive_files.url").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&response.Files).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve sensitive files", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- Request/Response Structs ---
+
+// SessionCreate represents the request body for creating a session of an organization.
+type SessionCreate struct {
+	Name       string                    `json:"name" binding:"required,min=1"`
+	LoginSteps []models.SessionLoginStep `json:"login_steps" binding:"required"` // Replayed in order by POST /api/sessions/:session_id/record
+}
+
+// SessionResponse represents a session. Recorded cookies and local storage are summarized, never
+// returned, and the values typed by fill steps are masked.
+type SessionResponse struct {
+	ID                  uint                      `json:"id"`
+	OrganizationID      uint                      `json:"organization_id"`
+	Name                string                    `json:"name"`
+	LoginSteps          []models.SessionLoginStep `json:"login_steps"`
+	RecordedAt          *time.Time                `json:"recorded_at,omitempty"`
+	RecordError         string                    `json:"record_error,omitempty"`
+	CookieCount         int                       `json:"cookie_count"`
+	CookieDomains       []string                  `json:"cookie_domains"`        // Domains the recorded cookies belong to
+	LocalStorageOrigins []string                  `json:"local_storage_origins"` // Origins with recorded local storage
+	CreatedAt           time.Time                 `json:"created_at"`
+	UpdatedAt           time.Time                 `json:"updated_at"`
+}
+
+// sessionValueMask replaces the values of fill steps in responses.
+const sessionValueMask = "********"
+
+// --- Helper Function ---
+
+// mapSessionToResponse converts a session to its response, summarizing the recorded state.
+func mapSessionToResponse(session *models.Session) SessionResponse {
+	resp := SessionResponse{
+		ID:                  session.ID,
+		OrganizationID:      session.OrganizationID,
+		Name:                session.Name,
+		LoginSteps:          []models.SessionLoginStep{},
+		RecordedAt:          session.RecordedAt,
+		RecordError:         session.RecordError,
+		CookieDomains:       []string{},
+		LocalStorageOrigins: []string{},
+		CreatedAt:           session.CreatedAt,
+		UpdatedAt:           session.UpdatedAt,
+	}
+	_ = json.Unmarshal([]byte(session.LoginSteps), &resp.LoginSteps)
+	for i := range resp.LoginSteps {
+		if resp.LoginSteps[i].Value != "" {
+			resp.LoginSteps[i].Value = sessionValueMask
+		}
+	}
+
+	var cookies []models.SessionCookie
+	_ = json.Unmarshal([]byte(session.Cookies), &cookies)
+	resp.CookieCount = len(cookies)
+	domains := make(map[string]struct{})
+	for _, cookie := range cookies {
+		domains[strings.TrimPrefix(cookie.Domain, ".")] = struct{}{}
+	}
+	for domain := range domains {
+		resp.CookieDomains = append(resp.CookieDomains, domain)
+	}
+	sort.Strings(resp.CookieDomains)
+
+	var localStorage map[string]map[string]string
+	_ = json.Unmarshal([]byte(session.LocalStorage), &localStorage)
+	for origin := range localStorage {
+		resp.LocalStorageOrigins = append(resp.LocalStorageOrigins, origin)
+	}
+	sort.Strings(resp.LocalStorageOrigins)
+	return resp
+}
+
+// findSession looks up the session of the session_id path parameter, responding with an error if it
+// can't be found.
+func findSession(c *gin.Context) (*models.Session, bool) {
+	sessionID, err := strconv.ParseUint(c.Param("session_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid session ID format")
+		return nil, false
+	}
+	var session models.Session
+	if err := database.GetDB().First(&session, uint(sessionID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Session with ID %d not found", sessionID), "Failed to retrieve session")
+		return nil, false
+	}
+	return &session, true
+}
+
+// --- Handler Functions ---
+
+// CreateSession handles POST requests creating a session for an organization from a login sequence.
+// The session is recorded separately, see RecordSession.
+func CreateSession(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("org_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
+		return
+	}
+	var input SessionCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := scanner.ValidateSessionSteps(input.LoginSteps); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid login steps", err.Error())
+		return
+	}
+
+	db := database.GetDB()
+	var organization models.Organization
+	if err := db.Select("id").First(&organization, uint(orgID)).Error; err != nil {
+		respondLookupError(c, err, "Organization not found", "Failed to retrieve organization")
+		return
+	}
+
+	steps, err := json.Marshal(input.LoginSteps)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to encode login steps", err.Error())
+		return
+	}
+	session := models.Session{
+		OrganizationID: organization.ID,
+		Name:           strings.TrimSpace(input.Name),
+		LoginSteps:     string(steps),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to create session", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, mapSessionToResponse(&session))
+}
+
+// GetSessions handles GET requests listing the sessions of an organization.
+func GetSessions(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("org_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid organization ID format")
+		return
+	}
+	var sessions []models.Session
+	if err := database.GetDB().Where("organization_id = ?", uint(orgID)).Order("name").Find(&sessions).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve sessions", err.Error())
+		return
+	}
+	response := make([]SessionResponse, len(sessions))
+	for i := range sessions {
+		response[i] = mapSessionToResponse(&sessions[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetSession handles GET requests for a single session.
+func GetSession(c *gin.Context) {
+	session, ok := findSession(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, mapSessionToResponse(session))
+}
+
+// RecordSession handles POST requests replaying a session's login sequence in headless Chrome and
+// storing the resulting cookies and local storage, replacing those of an earlier recording. A failed
+// recording keeps the earlier state and is reported in record_error.
+func RecordSession(c *gin.Context) {
+	session, ok := findSession(c)
+	if !ok {
+		return
+	}
+	var steps []models.SessionLoginStep
+	if err := json.Unmarshal([]byte(session.LoginSteps), &steps); err != nil {
+		RespondError(c, http.StatusUnprocessableEntity, "Session has invalid login steps", err.Error())
+		return
+	}
+
+	db := database.GetDB()
+	recorded, err := scanner.RecordSession(c.Request.Context(), steps)
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			return // Client went away, nothing to report
+		}
+		db.Model(session).Update("record_error", err.Error())
+		RespondError(c, http.StatusUnprocessableEntity, "Failed to record session", err.Error())
+		return
+	}
+	cookies, err := json.Marshal(recorded.Cookies)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to encode cookies", err.Error())
+		return
+	}
+	localStorage, err := json.Marshal(recorded.LocalStorage)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to encode local storage", err.Error())
+		return
+	}
+	now := time.Now()
+	if err := db.Model(session).Updates(map[string]interface{}{
+		"cookies":       string(cookies),
+		"local_storage": string(localStorage),
+		"recorded_at":   now,
+		"record_error":  "",
+	}).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to save session", err.Error())
+		return
+	}
+	session.Cookies, session.LocalStorage, session.RecordedAt, session.RecordError = string(cookies), string(localStorage), &now, ""
+	c.JSON(http.StatusOK, mapSessionToResponse(session))
+}
+
+// DeleteSession handles DELETE requests for a session. Scans that used it keep their results but no
+// longer reference it.
+func DeleteSession(c *gin.Context) {
+	session, ok := findSession(c)
+	if !ok {
+		return
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Scan{}).Where("session_id = ?", session.ID).Update("session_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(session).Error
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to delete session", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// validateScanSession checks that a session can be used by a scan of a root domain: it must belong to
+// the domain's organization and have been recorded. Responds with an error otherwise.
+func validateScanSession(c *gin.Context, db *gorm.DB, sessionID uint, rootDomain *models.RootDomain) bool {
+	var session models.Session
+	if err := db.Select("id", "organization_id", "recorded_at").First(&session, sessionID).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Session with ID %d not found", sessionID), "Failed to retrieve session")
+		return false
+	}
+	if session.OrganizationID != rootDomain.OrganizationID {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Session %d belongs to another organization than domain %s", sessionID, rootDomain.Domain))
+		return false
+	}
+	if session.RecordedAt == nil {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Session %d has not been recorded yet", sessionID))
+		return false
+	}
+	return true
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"rewrite-go/config" // Use the correct module path from go.mod
+	"strconv"
+	"strings"
 )
 
 // GetSettingsHandler handles GET requests to /api/settings
@@ -25,30 +28,130 @@ func GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(settings); err != nil {
 		log.Printf("Error encoding settings response: %v", err)
-		http.Error(w, "Failed to encode settings", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to encode settings", err.Error())
 	}
 }
 
-// SaveSettingsHandler handles POST requests to /api/settings
+// SettingsTemplateResponse lists every known setting without its value, for setting up a new instance.
+type SettingsTemplateResponse struct {
+	Template map[string]string     `json:"template"` // Every known key with an empty value, ready to fill in as config.json
+	Settings []SettingTemplateItem `json:"settings"`
+}
+
+// SettingTemplateItem documents a setting and whether this instance has it configured.
+type SettingTemplateItem struct {
+	config.Setting
+	Configured bool `json:"configured"`
+}
+
+// GetSettingsTemplateHandler handles GET requests to /api/settings/template, listing all known settings
+// (config.Settings) with descriptions and defaults. Values are never included.
+func GetSettingsTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	current := config.GetAll()
+	response := SettingsTemplateResponse{
+		Template: make(map[string]string, len(config.Settings)),
+		Settings: make([]SettingTemplateItem, 0, len(config.Settings)),
+	}
+	for _, setting := range config.Settings {
+		response.Template[setting.Key] = ""
+		response.Settings = append(response.Settings, SettingTemplateItem{
+			Setting:    setting,
+			Configured: strings.TrimSpace(current[setting.Key]) != "",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding settings template response: %v", err)
+	}
+}
+
+// SettingsValidationErrorResponse is returned when settings fail validation, with a message per key.
+type SettingsValidationErrorResponse struct {
+	ErrorResponse
+	Errors map[string]string `json:"errors"`
+}
+
+// SaveSettingsHandler handles POST requests to /api/settings. The body is a JSON object of string values.
+// By default only the keys it contains are updated; with replace=true it replaces all stored settings,
+// dropping the keys it doesn't contain. Values are validated against the settings catalog
+// (config.Settings); empty values are always accepted.
 func SaveSettingsHandler(w http.ResponseWriter, r *http.Request) {
-	var newSettings map[string]string
-	if err := json.NewDecoder(r.Body).Decode(&newSettings); err != nil {
+	defer r.Body.Close()
+	var payload map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Printf("Error decoding settings request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid request body, must be a JSON object of settings", err.Error())
+		return
+	}
+	if payload == nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body, must be a JSON object of settings")
 		return
 	}
-	defer r.Body.Close()
 
-	// Basic validation (optional): Check if keys are expected, etc.
-	// ...
+	// Unknown keys are rejected unless allow_unknown=true, so typos don't silently do nothing
+	allowUnknown, ok := parseBoolParam(w, r, "allow_unknown")
+	if !ok {
+		return
+	}
+	replace, ok := parseBoolParam(w, r, "replace")
+	if !ok {
+		return
+	}
 
-	if err := config.Save(newSettings); err != nil {
+	newSettings := make(map[string]string, len(payload))
+	errs := make(map[string]string)
+	for key, raw := range payload {
+		if strings.TrimSpace(key) == "" {
+			errs[key] = "key must not be empty"
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil || string(raw) == "null" {
+			errs[key] = "must be a string"
+			continue
+		}
+		newSettings[key] = value
+	}
+	for key, msg := range config.ValidateSettings(newSettings, allowUnknown) {
+		errs[key] = msg
+	}
+	if len(errs) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SettingsValidationErrorResponse{
+			ErrorResponse: newErrorResponse(http.StatusBadRequest, fmt.Sprintf("%d invalid settings, nothing was saved", len(errs))),
+			Errors:        errs,
+		})
+		return
+	}
+
+	save, message := config.Merge, fmt.Sprintf("%d settings updated", len(newSettings))
+	if replace {
+		save, message = config.Save, fmt.Sprintf("Settings replaced, %d settings stored", len(newSettings))
+	}
+	if err := save(newSettings); err != nil {
 		log.Printf("Error saving settings: %v", err)
-		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to save settings", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // Or http.StatusNoContent if no body is returned
-	json.NewEncoder(w).Encode(map[string]string{"message": "Settings saved successfully"})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// parseBoolParam reads an optional boolean query parameter, false if absent. Responds with an error
+// if it isn't a boolean.
+func parseBoolParam(w http.ResponseWriter, r *http.Request, name string) (bool, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, true
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s, must be true or false", name))
+		return false, false
+	}
+	return parsed, true
 }
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"rewrite-go/config"
+	"strings"
+	"testing"
+)
+
+// resetSettings stores exactly the given settings for the test.
+func resetSettings(t *testing.T, settings map[string]string) {
+	t.Helper()
+	if err := config.Save(settings); err != nil {
+		t.Fatalf("reset settings: %v", err)
+	}
+	t.Cleanup(func() { _ = config.Save(map[string]string{}) })
+}
+
+func postSettings(query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/settings"+query, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	SaveSettingsHandler(rec, req)
+	return rec
+}
+
+// storedSettings returns the settings as written to config.json.
+func storedSettings(t *testing.T) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile("config.json")
+	if err != nil {
+		t.Fatalf("read config.json: %v", err)
+	}
+	var stored map[string]string
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("decode config.json: %v", err)
+	}
+	return stored
+}
+
+func TestSaveSettingsMergesByDefault(t *testing.T) {
+	resetSettings(t, map[string]string{"SCREENSHOT_RETRIES": "2", "SCREENSHOT_FULL_PAGE": "true"})
+
+	rec := postSettings("", `{"SCREENSHOT_RETRIES": "5"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	want := map[string]string{"SCREENSHOT_RETRIES": "5", "SCREENSHOT_FULL_PAGE": "true"}
+	if got := config.GetAll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+	if got := storedSettings(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("config.json = %v, want %v", got, want)
+	}
+}
+
+func TestSaveSettingsMergeClearsWithEmptyValue(t *testing.T) {
+	resetSettings(t, map[string]string{"SCREENSHOT_RETRIES": "2", "SCREENSHOT_FULL_PAGE": "true"})
+
+	if rec := postSettings("", `{"SCREENSHOT_FULL_PAGE": ""}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	want := map[string]string{"SCREENSHOT_RETRIES": "2", "SCREENSHOT_FULL_PAGE": ""}
+	if got := config.GetAll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+}
+
+func TestSaveSettingsReplace(t *testing.T) {
+	resetSettings(t, map[string]string{"SCREENSHOT_RETRIES": "2", "SCREENSHOT_FULL_PAGE": "true"})
+
+	rec := postSettings("?replace=true", `{"SCREENSHOT_RETRIES": "5"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	want := map[string]string{"SCREENSHOT_RETRIES": "5"}
+	if got := config.GetAll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+	if got := storedSettings(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("config.json = %v, want %v", got, want)
+	}
+}
+
+func TestSaveSettingsRejectsInvalidPayloads(t *testing.T) {
+	initial := map[string]string{"SCREENSHOT_RETRIES": "2", "SCREENSHOT_FULL_PAGE": "true"}
+	tests := []struct {
+		name, query, body string
+		wantKey           string // Key reported in errors, if any
+	}{
+		{"not an object", "", `["SCREENSHOT_RETRIES"]`, ""},
+		{"null", "", `null`, ""},
+		{"malformed", "", `{"SCREENSHOT_RETRIES": `, ""},
+		{"number value", "", `{"SCREENSHOT_RETRIES": 5}`, "SCREENSHOT_RETRIES"},
+		{"null value", "", `{"SCREENSHOT_RETRIES": null}`, "SCREENSHOT_RETRIES"},
+		{"out of range", "", `{"SCREENSHOT_RETRIES": "50"}`, "SCREENSHOT_RETRIES"},
+		{"unknown key", "", `{"SCREENSHOT_RETRIE": "5"}`, "SCREENSHOT_RETRIE"},
+		{"invalid replace", "?replace=maybe", `{"SCREENSHOT_RETRIES": "5"}`, ""},
+		{"one invalid key with replace", "?replace=true", `{"SCREENSHOT_RETRIES": "5", "SCREENSHOT_FULL_PAGE": "yes please"}`, "SCREENSHOT_FULL_PAGE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetSettings(t, initial)
+			rec := postSettings(tt.query, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			if tt.wantKey != "" {
+				var response SettingsValidationErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if _, ok := response.Errors[tt.wantKey]; !ok {
+					t.Errorf("errors = %v, want one for %s", response.Errors, tt.wantKey)
+				}
+			}
+			if got := config.GetAll(); !reflect.DeepEqual(got, initial) {
+				t.Errorf("settings = %v, want them unchanged", got)
+			}
+		})
+	}
+}
+
+func TestSaveSettingsAllowUnknown(t *testing.T) {
+	resetSettings(t, map[string]string{"SCREENSHOT_RETRIES": "2"})
+
+	if rec := postSettings("?allow_unknown=true", `{"CUSTOM_KEY": "x"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	want := map[string]string{"SCREENSHOT_RETRIES": "2", "CUSTOM_KEY": "x"}
+	if got := config.GetAll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Weights of the signals in SubdomainScore. Parameters and technologies say more about an application
+// than raw endpoint volume, and unusual status codes often mark auth walls, admin areas or errors.
+const (
+	scoreWeightEndpoint         = 1
+	scoreWeightParameter        = 2
+	scoreWeightTechnology       = 3
+	scoreWeightNonDefaultStatus = 2
+)
+
+// defaultStatusCodes are endpoint status codes that say little about a host: success, plain redirects
+// and not found. 0 means the endpoint was never probed.
+var defaultStatusCodes = map[int]bool{0: true, 200: true, 301: true, 302: true, 404: true}
+
+// SubdomainSignals are the collected facts a subdomain's score is computed from.
+type SubdomainSignals struct {
+	Endpoints        int64 `json:"endpoints"`
+	Parameters       int64 `json:"parameters"`
+	Technologies     int64 `json:"technologies"`       // Distinct, on the host itself or any of its endpoints
+	NonDefaultStatus int64 `json:"non_default_status"` // Endpoints with a status outside defaultStatusCodes
+}
+
+// SubdomainScore rates how much application surface a subdomain exposes, to order hosts for manual review.
+// It is the weighted sum of its signals:
+//
+//	endpoints*1 + parameters*2 + technologies*3 + non-default status endpoints*2
+//
+// A host without any collected signals scores 0.
+func SubdomainScore(signals SubdomainSignals) int64 {
+	return signals.Endpoints*scoreWeightEndpoint +
+		signals.Parameters*scoreWeightParameter +
+		signals.Technologies*scoreWeightTechnology +
+		signals.NonDefaultStatus*scoreWeightNonDefaultStatus
+}
+
+// isDefaultStatusCode reports whether an endpoint status code is uninteresting for scoring.
+func isDefaultStatusCode(statusCode int) bool {
+	return defaultStatusCodes[statusCode]
+}
+
+// ScoredSubdomain is a subdomain with its score signals.
+type ScoredSubdomain struct {
+	SubdomainResponse
+	Signals SubdomainSignals `json:"signals"`
+	Score   int64            `json:"score"`
+}
+
+// DomainSubdomainsResponse lists a root domain's subdomains with their scores.
+type DomainSubdomainsResponse struct {
+	DomainID              uint              `json:"domain_id"`
+	TotalSubdomains       int               `json:"total_subdomains"`
+	TotalEndpoints        int64             `json:"total_endpoints"`
+	EndpointsPerSubdomain float64           `json:"endpoints_per_subdomain"` // 0 without subdomains
+	Sort                  string            `json:"sort"`
+	Page                  int               `json:"page"`
+	PageSize              int               `json:"page_size"`
+	Subdomains            []ScoredSubdomain `json:"subdomains"`
+}
+
+// subdomainSortKeys are the fields GetDomainSubdomains can sort by; prefix with "-" for descending.
+var subdomainSortKeys = []string{"score", "hostname", "endpoints", "discovered_at"}
+
+// GetDomainSubdomains handles GET requests listing a root domain's subdomains with their endpoint,
+// parameter and technology counts and the resulting SubdomainScore. Sorted with sort (default "hostname",
+// e.g. "-score" for the most app-rich hosts first) and paginated with page and page_size.
+func GetDomainSubdomains(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+
+	sortParam := c.DefaultQuery("sort", "hostname")
+	sortKey, descending := strings.TrimPrefix(sortParam, "-"), strings.HasPrefix(sortParam, "-")
+	validSort := false
+	for _, key := range subdomainSortKeys {
+		if sortKey == key {
+			validSort = true
+			break
+		}
+	}
+	if !validSort {
+		RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid sort '%s' (allowed: %s, prefix with - for descending)", sortParam, strings.Join(subdomainSortKeys, ", ")))
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.First(&domain, uint(domainID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Domain with ID %d not found", domainID))
+		} else {
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve domain", err.Error())
+		}
+		return
+	}
+
+	// Scores need every subdomain of the domain, so sorting and paging happen in memory
+	var subdomains []models.Subdomain
+	if err := db.Preload("Technologies").Where("root_domain_id = ?", domain.ID).Find(&subdomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains", err.Error())
+		return
+	}
+
+	signals, err := collectSubdomainSignals(db, domain.ID)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to collect subdomain signals", err.Error())
+		return
+	}
+
+	response := DomainSubdomainsResponse{
+		DomainID:        domain.ID,
+		TotalSubdomains: len(subdomains),
+		Sort:            sortParam,
+		Page:            page,
+		PageSize:        pageSize,
+		Subdomains:      []ScoredSubdomain{},
+	}
+	scored := make([]ScoredSubdomain, len(subdomains))
+	for i, sub := range subdomains {
+		subSignals := signals[sub.ID]
+		response.TotalEndpoints += subSignals.Endpoints
+		scored[i] = ScoredSubdomain{
+			SubdomainResponse: SubdomainResponse{
+				ID:           sub.ID,
+				RootDomainID: sub.RootDomainID,
+				Hostname:     sub.Hostname,
+				IPAddress:    sub.IPAddress,
+				IsActive:     sub.IsActive,
+				DiscoveredAt: sub.DiscoveredAt,
+				LastSeenAt:   sub.LastSeenAt,
+				Technologies: toTechnologyBasics(sub.Technologies),
+			},
+			Signals: subSignals,
+			Score:   SubdomainScore(subSignals),
+		}
+	}
+	if len(subdomains) > 0 {
+		response.EndpointsPerSubdomain = float64(response.TotalEndpoints) / float64(len(subdomains))
+	}
+
+	sort.SliceStable(scored, func(i, k int) bool {
+		a, b := scored[i], scored[k]
+		order := 0
+		switch sortKey {
+		case "score":
+			order = cmp.Compare(a.Score, b.Score)
+		case "endpoints":
+			order = cmp.Compare(a.Signals.Endpoints, b.Signals.Endpoints)
+		case "discovered_at":
+			order = a.DiscoveredAt.Compare(b.DiscoveredAt)
+		case "hostname":
+			order = strings.Compare(a.Hostname, b.Hostname)
+		}
+		if descending {
+			order = -order
+		}
+		if order != 0 {
+			return order < 0
+		}
+		return a.Hostname < b.Hostname // Ties by hostname
+	})
+
+	if start := (page - 1) * pageSize; start < len(scored) {
+		end := start + pageSize
+		if end > len(scored) {
+			end = len(scored)
+		}
+		response.Subdomains = scored[start:end]
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// collectSubdomainSignals gathers the SubdomainScore signals of all subdomains of a root domain with grouped queries.
+func collectSubdomainSignals(db *gorm.DB, rootDomainID uint) (map[uint]SubdomainSignals, error) {
+	signals := make(map[uint]SubdomainSignals)
+	domainSubdomains := db.Model(&models.Subdomain{}).Select("id").Where("root_domain_id = ?", rootDomainID)
+
+	var endpointRows []struct {
+		SubdomainID uint
+		StatusCode  int
+		Count       int64
+	}
+	if err := db.Model(&models.Endpoint{}).
+		Select("subdomain_id, status_code, COUNT(*) AS count").
+		Where("subdomain_id IN (?)", domainSubdomains).
+		Group("subdomain_id, status_code").
+		Scan(&endpointRows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count endpoints: %w", err)
+	}
+	for _, row := range endpointRows {
+		s := signals[row.SubdomainID]
+		s.Endpoints += row.Count
+		if !isDefaultStatusCode(row.StatusCode) {
+			s.NonDefaultStatus += row.Count
+		}
+		signals[row.SubdomainID] = s
+	}
+
+	var parameterRows []struct {
+		SubdomainID uint
+		Count       int64
+	}
+	if err := db.Model(&models.Parameter{}).
+		Select("endpoints.subdomain_id, COUNT(*) AS count").
+		Joins("JOIN endpoints ON endpoints.id = parameters.endpoint_id").
+		Where("endpoints.subdomain_id IN (?)", domainSubdomains).
+		Group("endpoints.subdomain_id").
+		Scan(&parameterRows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count parameters: %w", err)
+	}
+	for _, row := range parameterRows {
+		s := signals[row.SubdomainID]
+		s.Parameters = row.Count
+		signals[row.SubdomainID] = s
+	}
+
+	var technologyRows []struct {
+		SubdomainID uint
+		Count       int64
+	}
+	if err := db.Raw(`SELECT subdomain_id, COUNT(DISTINCT technology_id) AS count FROM (
+			SELECT st.subdomain_id, st.technology_id FROM subdomain_technologies st
+			JOIN subdomains s ON s.id = st.subdomain_id WHERE s.root_domain_id = @domain
+			UNION
+			SELECT e.subdomain_id, et.technology_id FROM endpoint_technologies et
+			JOIN endpoints e ON e.id = et.endpoint_id
+			JOIN subdomains s ON s.id = e.subdomain_id WHERE s.root_domain_id = @domain
+		) GROUP BY subdomain_id`, map[string]interface{}{"domain": rootDomainID}).
+		Scan(&technologyRows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count technologies: %w", err)
+	}
+	for _, row := range technologyRows {
+		s := signals[row.SubdomainID]
+		s.Technologies = row.Count
+		signals[row.SubdomainID] = s
+	}
+
+	return signals, nil
+}
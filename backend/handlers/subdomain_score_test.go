@@ -0,0 +1,46 @@
+package handlers
+
+import "testing"
+
+func TestSubdomainScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		signals SubdomainSignals
+		want    int64
+	}{
+		{"no signals", SubdomainSignals{}, 0},
+		{"endpoints", SubdomainSignals{Endpoints: 4}, 4},
+		{"parameters", SubdomainSignals{Parameters: 3}, 6},
+		{"technologies", SubdomainSignals{Technologies: 2}, 6},
+		{"non-default status", SubdomainSignals{NonDefaultStatus: 5}, 10},
+		{"all signals", SubdomainSignals{Endpoints: 10, Parameters: 4, Technologies: 3, NonDefaultStatus: 2}, 10 + 8 + 9 + 4},
+	}
+	for _, tt := range tests {
+		if got := SubdomainScore(tt.signals); got != tt.want {
+			t.Errorf("SubdomainScore(%s: %+v) = %d, want %d", tt.name, tt.signals, got, tt.want)
+		}
+	}
+}
+
+func TestIsDefaultStatusCode(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		want       bool
+	}{
+		{0, true}, // Never probed
+		{200, true},
+		{301, true},
+		{302, true},
+		{404, true},
+		{201, false},
+		{307, false},
+		{401, false},
+		{403, false},
+		{500, false},
+	}
+	for _, tt := range tests {
+		if got := isDefaultStatusCode(tt.statusCode); got != tt.want {
+			t.Errorf("isDefaultStatusCode(%d) = %v, want %v", tt.statusCode, got, tt.want)
+		}
+	}
+}
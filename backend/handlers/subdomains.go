@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"rewrite-go/database"
 	"rewrite-go/models"
+	"rewrite-go/scanner"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -25,30 +27,44 @@ type TechnologyBasic struct {
 
 // SubdomainResponse represents the response structure for a subdomain.
 type SubdomainResponse struct {
-	ID                   uint              `json:"id"`
-	RootDomainID         uint              `json:"root_domain_id"`
-	Hostname             string            `json:"hostname"`
-	IPAddress            string            `json:"ip_address,omitempty"`
-	IsActive             bool              `json:"is_active"`
-	DiscoveredAt         time.Time         `json:"discovered_at"`
-	Technologies         []TechnologyBasic `json:"technologies,omitempty"`           // Use slice of TechnologyBasic
-	LatestScreenshotPath *string           `json:"latest_screenshot_path,omitempty"` // Add field for screenshot path
+	ID                         uint              `json:"id"`
+	RootDomainID               uint              `json:"root_domain_id"`
+	Hostname                   string            `json:"hostname"`
+	IPAddress                  string            `json:"ip_address,omitempty"`
+	IsActive                   bool              `json:"is_active"`
+	DiscoveredAt               time.Time         `json:"discovered_at"`
+	LastSeenAt                 *time.Time        `json:"last_seen_at,omitempty"`
+	Technologies               []TechnologyBasic `json:"technologies,omitempty"`                  // Use slice of TechnologyBasic
+	LatestScreenshotPath       *string           `json:"latest_screenshot_path,omitempty"`        // Add field for screenshot path
+	LatestMobileScreenshotPath *string           `json:"latest_mobile_screenshot_path,omitempty"` // Mobile viewport capture; latest_screenshot_path is desktop
 }
 
 // EndpointBasic represents basic endpoint info for responses.
 type EndpointBasic struct {
-	ID           uint      `json:"id"`
-	SubdomainID  uint      `json:"subdomain_id"`
-	Path         string    `json:"path"`
-	Method       string    `json:"method"`
-	StatusCode   int       `json:"status_code,omitempty"`
-	ContentType  string    `json:"content_type,omitempty"`
-	DiscoveredAt time.Time `json:"discovered_at"`
+	ID           uint       `json:"id"`
+	SubdomainID  uint       `json:"subdomain_id"`
+	Path         string     `json:"path"`
+	Method       string     `json:"method"`
+	StatusCode   int        `json:"status_code,omitempty"`
+	ContentType  string     `json:"content_type,omitempty"`
+	DiscoveredAt time.Time  `json:"discovered_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// coverageGapConditions are the GetSubdomains missing filters: subdomains no scan has found endpoints on,
+// or that have no saved screenshot of the host itself or any of its endpoints.
+var coverageGapConditions = map[string]string{
+	"endpoints": "NOT EXISTS (SELECT 1 FROM endpoints e WHERE e.subdomain_id = subdomains.id)",
+	"screenshots": `NOT EXISTS (SELECT 1 FROM screenshots sc WHERE sc.subdomain_id = subdomains.id AND sc.file_path <> '')
+		AND NOT EXISTS (SELECT 1 FROM screenshots sc JOIN endpoints e ON e.id = sc.endpoint_id
+			WHERE e.subdomain_id = subdomains.id AND sc.file_path <> '')`,
 }
 
 // --- Handler Functions ---
 
 // GetSubdomains handles GET requests to retrieve subdomains.
+// Optional filters: domain_id, not_seen_days, and missing=endpoints and/or screenshots (comma-separated)
+// listing active subdomains with coverage gaps, i.e. hosts that need a deeper scan.
 func GetSubdomains(c *gin.Context) {
 	db := database.GetDB()
 	var subdomains []models.Subdomain
@@ -61,16 +77,38 @@ func GetSubdomains(c *gin.Context) {
 	if domainIDStr != "" {
 		domainID, err := strconv.ParseUint(domainIDStr, 10, 32)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain_id format"})
+			RespondError(c, http.StatusBadRequest, "Invalid domain_id format")
 			return
 		}
 		query = query.Where("root_domain_id = ?", uint(domainID))
 	}
 
+	// Optional filtering for assets not re-observed in the last N days
+	cutoff, ok := parseNotSeenDays(c)
+	if !ok {
+		return
+	}
+	if cutoff != nil {
+		query = query.Where("COALESCE(last_seen_at, discovered_at) < ?", *cutoff)
+	}
+
+	// Optional coverage gap filtering: active subdomains missing endpoints and/or screenshots
+	if missingStr := c.Query("missing"); missingStr != "" {
+		for _, gap := range strings.Split(missingStr, ",") {
+			condition, ok := coverageGapConditions[strings.TrimSpace(gap)]
+			if !ok {
+				RespondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid missing value '%s' (allowed: endpoints, screenshots)", strings.TrimSpace(gap)))
+				return
+			}
+			query = query.Where(condition)
+		}
+		query = query.Where("subdomains.is_active = ?", true)
+	}
+
 	// Execute query
 	result := query.Find(&subdomains)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subdomains", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains", result.Error.Error())
 		return
 	}
 
@@ -98,6 +136,7 @@ func GetSubdomains(c *gin.Context) {
 			IPAddress:    sub.IPAddress,
 			IsActive:     sub.IsActive,
 			DiscoveredAt: sub.DiscoveredAt,
+			LastSeenAt:   sub.LastSeenAt,
 			Technologies: uniqueTechs, // Use the deduplicated slice
 		}
 	}
@@ -110,7 +149,7 @@ func GetSubdomain(c *gin.Context) {
 	idStr := c.Param("subdomain_id")
 	subdomainID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subdomain ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid subdomain ID format")
 		return
 	}
 
@@ -121,9 +160,9 @@ func GetSubdomain(c *gin.Context) {
 	result := db.Preload("Technologies").First(&subdomain, uint(subdomainID))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Subdomain with ID %d not found", subdomainID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Subdomain with ID %d not found", subdomainID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subdomain", "details": result.Error.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomain", result.Error.Error())
 		}
 		return
 	}
@@ -150,22 +189,34 @@ func GetSubdomain(c *gin.Context) {
 		IPAddress:    subdomain.IPAddress,
 		IsActive:     subdomain.IsActive,
 		DiscoveredAt: subdomain.DiscoveredAt,
+		LastSeenAt:   subdomain.LastSeenAt,
 		Technologies: uniqueTechs, // Use the deduplicated slice
 	}
 
-	// --- Fetch Latest Screenshot ---
-	var latestScreenshot models.Screenshot
-	screenshotResult := db.Where("subdomain_id = ?", subdomainID).Order("captured_at desc").First(&latestScreenshot)
+	// --- Fetch Latest Screenshots ---
+	// Desktop and mobile captures are reported apart; records predating viewports have none and are desktop
+	viewports := []struct {
+		condition string
+		path      **string
+	}{
+		{"(viewport IS NULL OR viewport <> ?)", &response.LatestScreenshotPath},
+		{"viewport = ?", &response.LatestMobileScreenshotPath},
+	}
+	for _, viewport := range viewports {
+		var latestScreenshot models.Screenshot
+		screenshotResult := db.Where("subdomain_id = ? AND file_path <> ?", subdomainID, "").Where(viewport.condition, scanner.ScreenshotViewportMobile).
+			Order("captured_at desc").First(&latestScreenshot) // Ignore skipped captures
 
-	if screenshotResult.Error == nil {
-		// Found a screenshot, add its path to the response
-		response.LatestScreenshotPath = &latestScreenshot.FilePath
-	} else if !errors.Is(screenshotResult.Error, gorm.ErrRecordNotFound) {
-		// Log error if it's something other than not found
-		log.Printf("Error fetching latest screenshot for subdomain %d: %v", subdomainID, screenshotResult.Error)
+		if screenshotResult.Error == nil {
+			// Found a screenshot, add its path to the response
+			*viewport.path = &latestScreenshot.FilePath
+		} else if !errors.Is(screenshotResult.Error, gorm.ErrRecordNotFound) {
+			// Log error if it's something other than not found
+			log.Printf("Error fetching latest screenshot for subdomain %d: %v", subdomainID, screenshotResult.Error)
+		}
+		// If ErrRecordNotFound, the path remains nil, which is correct.
 	}
-	// If ErrRecordNotFound, LatestScreenshotPath remains nil, which is correct.
-	// --- End Fetch Latest Screenshot ---
+	// --- End Fetch Latest Screenshots ---
 
 	c.JSON(http.StatusOK, response)
 }
@@ -175,7 +226,7 @@ func GetSubdomainEndpoints(c *gin.Context) {
 	idStr := c.Param("subdomain_id")
 	subdomainID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subdomain ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid subdomain ID format")
 		return
 	}
 
@@ -185,9 +236,9 @@ func GetSubdomainEndpoints(c *gin.Context) {
 	var subdomain models.Subdomain
 	if err := db.First(&subdomain, uint(subdomainID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Subdomain with ID %d not found", subdomainID)})
+			RespondError(c, http.StatusNotFound, fmt.Sprintf("Subdomain with ID %d not found", subdomainID))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check subdomain existence", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to check subdomain existence", err.Error())
 		}
 		return
 	}
@@ -196,7 +247,7 @@ func GetSubdomainEndpoints(c *gin.Context) {
 	var endpoints []models.Endpoint
 	result := db.Where("subdomain_id = ?", uint(subdomainID)).Find(&endpoints)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve endpoints", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve endpoints", result.Error.Error())
 		return
 	}
 
@@ -211,8 +262,28 @@ func GetSubdomainEndpoints(c *gin.Context) {
 			StatusCode:   ep.StatusCode,
 			ContentType:  ep.ContentType,
 			DiscoveredAt: ep.DiscoveredAt,
+			LastSeenAt:   ep.LastSeenAt,
 		}
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// --- Helper Function ---
+
+// parseNotSeenDays reads the optional "not_seen_days" query parameter and returns the
+// cutoff time before which an asset was last observed. It writes a 400 response and
+// returns ok=false when the value is invalid.
+func parseNotSeenDays(c *gin.Context) (*time.Time, bool) {
+	daysStr := c.Query("not_seen_days")
+	if daysStr == "" {
+		return nil, true
+	}
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days < 1 {
+		RespondError(c, http.StatusBadRequest, "Invalid not_seen_days value, must be a positive integer")
+		return nil, false
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	return &cutoff, true
+}
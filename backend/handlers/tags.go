@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- Request/Response Structs ---
+
+// TagRuleCreate represents the request body for creating a tag rule. At least one of technology and
+// category is required.
+type TagRuleCreate struct {
+	Tag        string `json:"tag" binding:"required"`
+	Technology string `json:"technology"` // Technology name, e.g. "wordpress"
+	Category   string `json:"category"`   // Technology category, e.g. "admin panels"
+}
+
+// TagRuleApplyResponse reports the tags added by applying the tag rules.
+type TagRuleApplyResponse struct {
+	RootDomainID *uint                   `json:"root_domain_id,omitempty"` // Limited to this root domain
+	Tagged       int64                   `json:"tagged"`                   // Tags added over all rules
+	Rules        []scanner.TagRuleResult `json:"rules"`
+}
+
+// --- Handler Functions ---
+
+// GetTagRules handles GET requests listing the tag rules.
+func GetTagRules(c *gin.Context) {
+	rules := []models.TagRule{}
+	if err := database.GetDB().Order("tag, id").Find(&rules).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve tag rules", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateTagRule handles POST requests creating a tag rule. The rule is applied by the next scan's
+// technology detection, or right away with POST /api/maintenance/apply-tag-rules.
+func CreateTagRule(c *gin.Context) {
+	var input TagRuleCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	tag, err := scanner.NormalizeTag(input.Tag)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid tag", err.Error())
+		return
+	}
+	rule := models.TagRule{
+		Tag:        tag,
+		Technology: strings.TrimSpace(input.Technology),
+		Category:   strings.TrimSpace(input.Category),
+	}
+	if rule.Technology == "" && rule.Category == "" {
+		RespondError(c, http.StatusBadRequest, "A tag rule needs a technology, a category or both")
+		return
+	}
+
+	db := database.GetDB()
+	var existing int64
+	if err := db.Model(&models.TagRule{}).
+		Where("tag = ? AND LOWER(technology) = ? AND LOWER(category) = ?", rule.Tag, strings.ToLower(rule.Technology), strings.ToLower(rule.Category)).
+		Count(&existing).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to check for duplicate tag rules", err.Error())
+		return
+	}
+	if existing > 0 {
+		RespondError(c, http.StatusConflict, "An identical tag rule already exists")
+		return
+	}
+	if err := db.Create(&rule).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to create tag rule", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// DeleteTagRule handles DELETE requests deleting a tag rule along with the tags it applied.
+func DeleteTagRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid tag rule ID format")
+		return
+	}
+	db := database.GetDB()
+	var rule models.TagRule
+	if err := db.First(&rule, uint(ruleID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Tag rule with ID %d not found", ruleID), "Failed to retrieve tag rule")
+		return
+	}
+	var removed int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("tag_rule_id = ?", rule.ID).Delete(&models.SubdomainTag{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		return tx.Delete(&rule).Error
+	})
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to delete tag rule", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Tag rule %d deleted, %d subdomain tags removed", rule.ID, removed)})
+}
+
+// ApplyTagRules handles POST requests applying every tag rule to the subdomains detected so far, e.g.
+// after adding a rule. Limited to one root domain with domain_id. Tracked as a maintenance job.
+func ApplyTagRules(c *gin.Context) {
+	db := database.GetDB()
+	response := TagRuleApplyResponse{}
+	if idStr := c.Query("domain_id"); idStr != "" {
+		domainID, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+			return
+		}
+		var domain models.RootDomain
+		if err := db.Select("id").First(&domain, uint(domainID)).Error; err != nil {
+			respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+			return
+		}
+		response.RootDomainID = &domain.ID
+	}
+
+	job := jobs.Start(jobs.TypeMaintenance, "Apply tag rules", nil)
+	results, err := scanner.ApplyTagRules(db, response.RootDomainID)
+	job.Finish(err)
+	if err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to apply tag rules", err.Error())
+		return
+	}
+	response.Rules = results
+	for _, result := range results {
+		response.Tagged += result.Tagged
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetSubdomainTags handles GET requests listing the tags of a subdomain.
+func GetSubdomainTags(c *gin.Context) {
+	subdomainID, err := strconv.ParseUint(c.Param("subdomain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid subdomain ID format")
+		return
+	}
+	db := database.GetDB()
+	var subdomain models.Subdomain
+	if err := db.Select("id").First(&subdomain, uint(subdomainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Subdomain with ID %d not found", subdomainID), "Failed to retrieve subdomain")
+		return
+	}
+	tags := []models.SubdomainTag{}
+	if err := db.Where("subdomain_id = ?", subdomain.ID).Order("tag").Find(&tags).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomain tags", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
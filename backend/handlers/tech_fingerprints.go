@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Response Structs ---
+
+// TechFingerprintResponse is the fingerprint of a URL with its decoded technologies.
+type TechFingerprintResponse struct {
+	models.TechFingerprint
+	Technologies []scanner.FingerprintTechnology `json:"technologies"`
+}
+
+// TechFingerprintListResponse is a page of a subdomain's fingerprints.
+type TechFingerprintListResponse struct {
+	SubdomainID  uint                      `json:"subdomain_id"`
+	Hostname     string                    `json:"hostname"`
+	Page         int                       `json:"page"`
+	PageSize     int                       `json:"page_size"`
+	Total        int64                     `json:"total"`
+	Fingerprints []TechFingerprintResponse `json:"fingerprints"`
+}
+
+// --- Handler Functions ---
+
+// GetSubdomainFingerprint handles GET requests listing the full technology detection output for the URLs of
+// a subdomain, from the last scan that fingerprinted each: technologies with version and categories, the
+// response status and headers. URLs where nothing was detected are included. Optional filter url;
+// paginated with page and page_size.
+func GetSubdomainFingerprint(c *gin.Context) {
+	subdomainID, err := strconv.ParseUint(c.Param("subdomain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid subdomain ID format")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var subdomain models.Subdomain
+	if err := db.Select("id", "hostname").First(&subdomain, uint(subdomainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Subdomain with ID %d not found", subdomainID), "Failed to retrieve subdomain")
+		return
+	}
+
+	query := db.Model(&models.TechFingerprint{}).Where("subdomain_id = ?", subdomain.ID)
+	if urlFilter := strings.TrimSpace(c.Query("url")); urlFilter != "" {
+		query = query.Where("url = ?", urlFilter)
+	}
+	response := TechFingerprintListResponse{
+		SubdomainID:  subdomain.ID,
+		Hostname:     subdomain.Hostname,
+		Page:         page,
+		PageSize:     pageSize,
+		Fingerprints: []TechFingerprintResponse{},
+	}
+	if err := query.Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count fingerprints", err.Error())
+		return
+	}
+	var fingerprints []models.TechFingerprint
+	if err := query.Order("url").Offset((page - 1) * pageSize).Limit(pageSize).Find(&fingerprints).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve fingerprints", err.Error())
+		return
+	}
+	for _, fingerprint := range fingerprints {
+		item := TechFingerprintResponse{TechFingerprint: fingerprint, Technologies: []scanner.FingerprintTechnology{}}
+		if fingerprint.Technologies != "" {
+			if err := json.Unmarshal([]byte(fingerprint.Technologies), &item.Technologies); err != nil {
+				RespondError(c, http.StatusInternalServerError, "Failed to decode fingerprint", fmt.Sprintf("%s: %v", fingerprint.URL, err))
+				return
+			}
+		}
+		response.Fingerprints = append(response.Fingerprints, item)
+	}
+	c.JSON(http.StatusOK, response)
+}
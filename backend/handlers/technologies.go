@@ -6,7 +6,10 @@ import (
 	"net/http"
 	"rewrite-go/database"
 	"rewrite-go/models"
+	"rewrite-go/scanner"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -41,10 +44,111 @@ type SubdomainBasicResponse struct {
 	DiscoveredAt time.Time `json:"discovered_at"`
 }
 
+// TechnologySearchResult represents a technology match for autocomplete, with its usage count.
+type TechnologySearchResult struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	Category   string `json:"category,omitempty"`
+	UsageCount int64  `json:"usage_count"` // Number of subdomain + endpoint associations
+}
+
+// TechnologyDetailResponse describes where a technology is in use across all organizations.
+type TechnologyDetailResponse struct {
+	Technology             TechnologyBasic                `json:"technology"`
+	SubdomainCount         int64                          `json:"subdomain_count"`          // Subdomains the technology was detected on directly
+	EndpointCount          int64                          `json:"endpoint_count"`           // Endpoints the technology was detected on
+	AffectedSubdomainCount int64                          `json:"affected_subdomain_count"` // Distinct hosts, directly or through one of their endpoints
+	RootDomainCount        int64                          `json:"root_domain_count"`
+	Organizations          []TechnologyOrganizationImpact `json:"organizations"`
+	RecentDetections       []TechnologyDetection          `json:"recent_detections"`
+}
+
+// TechnologyOrganizationImpact counts an organization's assets using a technology.
+type TechnologyOrganizationImpact struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	SubdomainCount int64  `json:"subdomain_count"`
+	EndpointCount  int64  `json:"endpoint_count"`
+}
+
+// TechnologyDetection is a single subdomain or endpoint detection of a technology.
+type TechnologyDetection struct {
+	Type        string    `json:"type"` // "subdomain" or "endpoint"
+	SubdomainID uint      `json:"subdomain_id"`
+	Hostname    string    `json:"hostname"`
+	EndpointID  *uint     `json:"endpoint_id,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Method      string    `json:"method,omitempty"`
+	Confidence  *float64  `json:"confidence,omitempty"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// TechnologyAssetSearchResponse lists the assets of every organization running a technology.
+type TechnologyAssetSearchResponse struct {
+	Name          string            `json:"name"`
+	Version       string            `json:"version,omitempty"`
+	Technologies  []TechnologyBasic `json:"technologies"`  // Matching technologies, one per detected version
+	Organizations int               `json:"organizations"` // Organizations with at least one matching asset
+	Page          int               `json:"page"`
+	PageSize      int               `json:"page_size"`
+	Total         int64             `json:"total"`
+	Assets        []TechnologyAsset `json:"assets"`
+}
+
+// TechnologyAsset is a subdomain or endpoint running a searched technology, with its owning organization.
+type TechnologyAsset struct {
+	Type             string    `json:"type"` // "subdomain" or "endpoint"
+	OrganizationID   uint      `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	RootDomainID     uint      `json:"root_domain_id"`
+	Domain           string    `json:"domain"`
+	SubdomainID      uint      `json:"subdomain_id"`
+	Hostname         string    `json:"hostname"`
+	IsActive         bool      `json:"is_active"`
+	EndpointID       *uint     `json:"endpoint_id,omitempty"`
+	Path             string    `json:"path,omitempty"`
+	Method           string    `json:"method,omitempty"`
+	TechnologyID     uint      `json:"technology_id"`
+	Version          string    `json:"version,omitempty"` // Empty if technology detection found no version
+	DetectedAt       time.Time `json:"detected_at"`
+}
+
+// TechnologyEvidence is a URL whose response revealed a technology.
+type TechnologyEvidence struct {
+	URL            string    `json:"url"`
+	SubdomainID    uint      `json:"subdomain_id"`
+	Hostname       string    `json:"hostname"`
+	RootDomainID   uint      `json:"root_domain_id"`
+	Detections     int64     `json:"detections"` // Scans that detected the technology at the URL
+	LastDetectedAt time.Time `json:"last_detected_at"`
+}
+
+// TechnologyEvidenceResponse is a page of the URLs a technology was detected at.
+type TechnologyEvidenceResponse struct {
+	Technology TechnologyBasic      `json:"technology"`
+	Page       int                  `json:"page"`
+	PageSize   int                  `json:"page_size"`
+	Total      int64                `json:"total"`
+	Evidence   []TechnologyEvidence `json:"evidence"` // Most recent detections first
+}
+
 // Reusing EndpointBasic from subdomains.go
 
 // --- Helper Function ---
 
+// escapeLike escapes LIKE wildcards so user input is matched literally (use with ESCAPE '\\').
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	return replacer.Replace(value)
+}
+
+// versionMatches reports whether a detected version is the searched one or a release of it: "2.5" matches
+// "2.5" and "2.5.10", but not "2.50".
+func versionMatches(detected, searched string) bool {
+	detected, searched = strings.ToLower(detected), strings.ToLower(searched)
+	return detected == searched || strings.HasPrefix(detected, searched+".")
+}
+
 // checkTechnologyExists checks if a technology exists and returns it or an error.
 func checkTechnologyExists(db *gorm.DB, technologyID uint) (*models.Technology, error) {
 	var technology models.Technology
@@ -66,7 +170,7 @@ func GetTechnologies(c *gin.Context) {
 
 	result := db.Find(&technologies)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve technologies", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve technologies", result.Error.Error())
 		return
 	}
 
@@ -82,12 +186,51 @@ func GetTechnologies(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// SearchTechnologies handles GET requests to search technologies by name prefix (for autocomplete).
+// Results are ordered by how many subdomains/endpoints use the technology.
+func SearchTechnologies(c *gin.Context) {
+	prefix := strings.ToLower(strings.TrimSpace(c.Query("q"))) // Technology names are stored lowercased
+
+	limit := 10
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 {
+			RespondError(c, http.StatusBadRequest, "Invalid limit, must be a positive integer")
+			return
+		}
+		if parsedLimit > 100 {
+			parsedLimit = 100
+		}
+		limit = parsedLimit
+	}
+
+	db := database.GetDB()
+	var results []TechnologySearchResult
+	result := db.Model(&models.Technology{}).
+		Select("technologies.id, technologies.name, technologies.category, "+
+			"(SELECT COUNT(*) FROM subdomain_technologies WHERE subdomain_technologies.technology_id = technologies.id) + "+
+			"(SELECT COUNT(*) FROM endpoint_technologies WHERE endpoint_technologies.technology_id = technologies.id) AS usage_count").
+		Where("technologies.name LIKE ? ESCAPE '\\'", escapeLike(prefix)+"%").
+		Order("usage_count desc, technologies.name asc").
+		Limit(limit).
+		Scan(&results)
+	if result.Error != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to search technologies", result.Error.Error())
+		return
+	}
+
+	if results == nil {
+		results = []TechnologySearchResult{} // Return empty list rather than null
+	}
+	c.JSON(http.StatusOK, results)
+}
+
 // GetTechnology handles GET requests for a single technology by ID.
 func GetTechnology(c *gin.Context) {
 	idStr := c.Param("technology_id")
 	technologyID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid technology ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid technology ID format")
 		return
 	}
 
@@ -95,9 +238,9 @@ func GetTechnology(c *gin.Context) {
 	technology, err := checkTechnologyExists(db, uint(technologyID))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == fmt.Sprintf("technology with ID %d not found", technologyID) {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			RespondError(c, http.StatusNotFound, err.Error())
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve technology", "details": err.Error()})
+			RespondError(c, http.StatusInternalServerError, "Failed to retrieve technology", err.Error())
 		}
 		return
 	}
@@ -110,19 +253,156 @@ func GetTechnology(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GetTechnologyDetail handles GET requests for a technology's impact: how many subdomains, endpoints and
+// root domains use it, per-organization counts and the most recent detections (optional limit, default 20).
+func GetTechnologyDetail(c *gin.Context) {
+	technologyID, err := strconv.ParseUint(c.Param("technology_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid technology ID format")
+		return
+	}
+
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 {
+			RespondError(c, http.StatusBadRequest, "Invalid limit, must be a positive integer")
+			return
+		}
+		if parsedLimit > 100 {
+			parsedLimit = 100
+		}
+		limit = parsedLimit
+	}
+
+	db := database.GetDB()
+	technology, err := checkTechnologyExists(db, uint(technologyID))
+	if err != nil {
+		RespondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response := TechnologyDetailResponse{
+		Technology:       TechnologyBasic{ID: technology.ID, Name: technology.Name, Category: technology.Category},
+		Organizations:    []TechnologyOrganizationImpact{},
+		RecentDetections: []TechnologyDetection{},
+	}
+
+	if err := db.Model(&models.SubdomainTechnology{}).Where("technology_id = ?", technology.ID).
+		Count(&response.SubdomainCount).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count subdomains", err.Error())
+		return
+	}
+	if err := db.Model(&models.EndpointTechnology{}).Where("technology_id = ?", technology.ID).
+		Count(&response.EndpointCount).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count endpoints", err.Error())
+		return
+	}
+
+	// Hosts using the technology, directly or through an endpoint
+	affectedSubdomains := `SELECT st.subdomain_id FROM subdomain_technologies st WHERE st.technology_id = @tech
+		UNION SELECT e.subdomain_id FROM endpoint_technologies et JOIN endpoints e ON e.id = et.endpoint_id WHERE et.technology_id = @tech`
+	if err := db.Raw(`SELECT COUNT(*) FROM (`+affectedSubdomains+`)`, map[string]interface{}{"tech": technology.ID}).
+		Scan(&response.AffectedSubdomainCount).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count affected subdomains", err.Error())
+		return
+	}
+	if err := db.Raw(`SELECT COUNT(DISTINCT s.root_domain_id) FROM subdomains s WHERE s.id IN (`+affectedSubdomains+`)`,
+		map[string]interface{}{"tech": technology.ID}).Scan(&response.RootDomainCount).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count root domains", err.Error())
+		return
+	}
+
+	// Per-organization counts, grouped separately for subdomain and endpoint detections
+	var orgSubdomains, orgEndpoints []struct {
+		ID    uint
+		Name  string
+		Count int64
+	}
+	if err := db.Raw(`SELECT o.id, o.name, COUNT(*) AS count FROM subdomain_technologies st
+		JOIN subdomains s ON s.id = st.subdomain_id
+		JOIN root_domains rd ON rd.id = s.root_domain_id
+		JOIN organizations o ON o.id = rd.organization_id
+		WHERE st.technology_id = ? GROUP BY o.id, o.name`, technology.ID).Scan(&orgSubdomains).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count subdomains per organization", err.Error())
+		return
+	}
+	if err := db.Raw(`SELECT o.id, o.name, COUNT(*) AS count FROM endpoint_technologies et
+		JOIN endpoints e ON e.id = et.endpoint_id
+		JOIN subdomains s ON s.id = e.subdomain_id
+		JOIN root_domains rd ON rd.id = s.root_domain_id
+		JOIN organizations o ON o.id = rd.organization_id
+		WHERE et.technology_id = ? GROUP BY o.id, o.name`, technology.ID).Scan(&orgEndpoints).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count endpoints per organization", err.Error())
+		return
+	}
+	orgIndex := make(map[uint]int)
+	impactFor := func(id uint, name string) *TechnologyOrganizationImpact {
+		if i, ok := orgIndex[id]; ok {
+			return &response.Organizations[i]
+		}
+		orgIndex[id] = len(response.Organizations)
+		response.Organizations = append(response.Organizations, TechnologyOrganizationImpact{ID: id, Name: name})
+		return &response.Organizations[len(response.Organizations)-1]
+	}
+	for _, row := range orgSubdomains {
+		impactFor(row.ID, row.Name).SubdomainCount = row.Count
+	}
+	for _, row := range orgEndpoints {
+		impactFor(row.ID, row.Name).EndpointCount = row.Count
+	}
+	sort.Slice(response.Organizations, func(i, k int) bool {
+		a, b := response.Organizations[i], response.Organizations[k]
+		if a.SubdomainCount+a.EndpointCount != b.SubdomainCount+b.EndpointCount {
+			return a.SubdomainCount+a.EndpointCount > b.SubdomainCount+b.EndpointCount
+		}
+		return a.Name < b.Name
+	})
+
+	var detections []struct {
+		Type        string
+		SubdomainID uint
+		Hostname    string
+		EndpointID  *uint
+		Path        string
+		Method      string
+		Confidence  *float64
+		DetectedAt  time.Time
+	}
+	if err := db.Raw(`SELECT * FROM (
+			SELECT 'subdomain' AS type, s.id AS subdomain_id, s.hostname, NULL AS endpoint_id, '' AS path, '' AS method,
+				st.confidence, st.detected_at
+			FROM subdomain_technologies st JOIN subdomains s ON s.id = st.subdomain_id
+			WHERE st.technology_id = @tech
+			UNION ALL
+			SELECT 'endpoint', s.id, s.hostname, e.id, e.path, e.method, et.confidence, et.detected_at
+			FROM endpoint_technologies et JOIN endpoints e ON e.id = et.endpoint_id JOIN subdomains s ON s.id = e.subdomain_id
+			WHERE et.technology_id = @tech
+		) ORDER BY detected_at DESC LIMIT @limit`,
+		map[string]interface{}{"tech": technology.ID, "limit": limit}).Scan(&detections).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve recent detections", err.Error())
+		return
+	}
+	for _, d := range detections {
+		response.RecentDetections = append(response.RecentDetections, TechnologyDetection(d))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // GetDomainsWithTechnology handles GET requests for domains associated with a technology.
 func GetDomainsWithTechnology(c *gin.Context) {
 	idStr := c.Param("technology_id")
 	technologyID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid technology ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid technology ID format")
 		return
 	}
 
 	db := database.GetDB()
 	_, err = checkTechnologyExists(db, uint(technologyID)) // Just check existence
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -137,7 +417,7 @@ func GetDomainsWithTechnology(c *gin.Context) {
 		Find(&subdomains)
 
 	if resultSubdomains.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subdomains for technology", "details": resultSubdomains.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains for technology", resultSubdomains.Error.Error())
 		return
 	}
 
@@ -160,7 +440,7 @@ func GetDomainsWithTechnology(c *gin.Context) {
 	var rootDomains []models.RootDomain
 	resultDomains := db.Where("id IN ?", rootDomainIDs).Find(&rootDomains)
 	if resultDomains.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve root domains", "details": resultDomains.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve root domains", resultDomains.Error.Error())
 		return
 	}
 
@@ -182,14 +462,14 @@ func GetSubdomainsWithTechnology(c *gin.Context) {
 	idStr := c.Param("technology_id")
 	technologyID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid technology ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid technology ID format")
 		return
 	}
 
 	db := database.GetDB()
 	_, err = checkTechnologyExists(db, uint(technologyID)) // Just check existence
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -200,7 +480,7 @@ func GetSubdomainsWithTechnology(c *gin.Context) {
 		Find(&subdomains)
 
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subdomains", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve subdomains", result.Error.Error())
 		return
 	}
 
@@ -224,14 +504,14 @@ func GetEndpointsWithTechnology(c *gin.Context) {
 	idStr := c.Param("technology_id")
 	technologyID, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid technology ID format"})
+		RespondError(c, http.StatusBadRequest, "Invalid technology ID format")
 		return
 	}
 
 	db := database.GetDB()
 	_, err = checkTechnologyExists(db, uint(technologyID)) // Just check existence
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		RespondError(c, http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -242,7 +522,7 @@ func GetEndpointsWithTechnology(c *gin.Context) {
 		Find(&endpoints)
 
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve endpoints", "details": result.Error.Error()})
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve endpoints", result.Error.Error())
 		return
 	}
 
@@ -261,3 +541,176 @@ func GetEndpointsWithTechnology(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, response)
 }
+
+// GetTechnologyEvidence handles GET requests for the URLs a technology was detected at, e.g. to tell that
+// WordPress was found at /blog. Detections from before URLs were recorded are not listed. Paginated with page
+// and page_size.
+func GetTechnologyEvidence(c *gin.Context) {
+	technologyID, err := strconv.ParseUint(c.Param("technology_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid technology ID format")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var technology models.Technology
+	if err := db.First(&technology, uint(technologyID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Technology with ID %d not found", technologyID), "Failed to retrieve technology")
+		return
+	}
+
+	response := TechnologyEvidenceResponse{
+		Technology: TechnologyBasic{ID: technology.ID, Name: technology.Name, Category: technology.Category},
+		Page:       page,
+		PageSize:   pageSize,
+		Evidence:   []TechnologyEvidence{},
+	}
+	if err := db.Model(&models.SubdomainTechnology{}).
+		Where("technology_id = ? AND url <> ''", technology.ID).
+		Distinct("url").Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count technology evidence", err.Error())
+		return
+	}
+	// Each URL is detected again by every scan; list its latest detection with the number of them
+	if err := db.Raw(`SELECT st.url, s.id AS subdomain_id, s.hostname, s.root_domain_id, st.detected_at AS last_detected_at,
+			(SELECT COUNT(*) FROM subdomain_technologies d WHERE d.technology_id = st.technology_id AND d.url = st.url) AS detections
+		FROM subdomain_technologies st JOIN subdomains s ON s.id = st.subdomain_id
+		WHERE st.technology_id = @tech AND st.url <> ''
+			AND NOT EXISTS (SELECT 1 FROM subdomain_technologies later WHERE later.technology_id = st.technology_id
+				AND later.url = st.url AND later.detected_at > st.detected_at)
+		GROUP BY st.url ORDER BY st.detected_at DESC, st.url LIMIT @limit OFFSET @offset`,
+		map[string]interface{}{"tech": technology.ID, "limit": pageSize, "offset": (page - 1) * pageSize}).
+		Scan(&response.Evidence).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve technology evidence", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SearchTechnologyAssets handles GET requests for every subdomain and endpoint, across all organizations,
+// running a technology (name, required), e.g. to find exposed hosts during emergency response. The optional
+// version limits the results to that version or its releases (see versionMatches); assets whose version was
+// not detected are then left out. Paginated with page and page_size.
+func SearchTechnologyAssets(c *gin.Context) {
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		RespondError(c, http.StatusBadRequest, "Query parameter name is required")
+		return
+	}
+	version := strings.TrimSpace(c.Query("version"))
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 100, 1, 1000)
+	if !ok {
+		return
+	}
+
+	response := TechnologyAssetSearchResponse{
+		Name:         name,
+		Version:      version,
+		Technologies: []TechnologyBasic{},
+		Page:         page,
+		PageSize:     pageSize,
+		Assets:       []TechnologyAsset{},
+	}
+
+	db := database.GetDB()
+	var technologies []models.Technology
+	if err := scanner.WhereTechnologyName(db.Model(&models.Technology{}), name).Order("name").Find(&technologies).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve technologies", err.Error())
+		return
+	}
+	var techIDs []uint
+	for _, tech := range technologies {
+		_, detected := scanner.SplitTechnologyVersion(tech.Name)
+		if version != "" && !versionMatches(detected, version) {
+			continue
+		}
+		techIDs = append(techIDs, tech.ID)
+		response.Technologies = append(response.Technologies, TechnologyBasic{ID: tech.ID, Name: tech.Name, Category: tech.Category})
+	}
+	if len(techIDs) == 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	assets := `SELECT 'subdomain' AS type, s.id AS subdomain_id, NULL AS endpoint_id, '' AS path, '' AS method,
+			st.technology_id, st.detected_at
+		FROM subdomain_technologies st JOIN subdomains s ON s.id = st.subdomain_id
+		WHERE st.technology_id IN @techs
+		UNION ALL
+		SELECT 'endpoint', e.subdomain_id, e.id, e.path, e.method, et.technology_id, et.detected_at
+		FROM endpoint_technologies et JOIN endpoints e ON e.id = et.endpoint_id
+		WHERE et.technology_id IN @techs`
+	params := map[string]interface{}{"techs": techIDs, "limit": pageSize, "offset": (page - 1) * pageSize}
+	if err := db.Raw(`SELECT COUNT(*) FROM (`+assets+`)`, params).Scan(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count assets", err.Error())
+		return
+	}
+	if err := db.Raw(`SELECT COUNT(DISTINCT rd.organization_id) FROM (`+assets+`) a
+		JOIN subdomains s ON s.id = a.subdomain_id JOIN root_domains rd ON rd.id = s.root_domain_id`, params).
+		Scan(&response.Organizations).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count organizations", err.Error())
+		return
+	}
+
+	var rows []struct {
+		Type             string
+		OrganizationID   uint
+		OrganizationName string
+		RootDomainID     uint
+		Domain           string
+		SubdomainID      uint
+		Hostname         string
+		IsActive         bool
+		EndpointID       *uint
+		Path             string
+		Method           string
+		TechnologyID     uint
+		TechnologyName   string
+		DetectedAt       time.Time
+	}
+	if err := db.Raw(`SELECT a.type, rd.organization_id, COALESCE(o.name, '') AS organization_name,
+			rd.id AS root_domain_id, rd.domain, s.id AS subdomain_id, s.hostname, s.is_active,
+			a.endpoint_id, a.path, a.method, a.technology_id, t.name AS technology_name, a.detected_at
+		FROM (`+assets+`) a
+		JOIN subdomains s ON s.id = a.subdomain_id
+		JOIN root_domains rd ON rd.id = s.root_domain_id
+		LEFT JOIN organizations o ON o.id = rd.organization_id
+		JOIN technologies t ON t.id = a.technology_id
+		ORDER BY organization_name, rd.domain, s.hostname, a.path, a.method, t.name
+		LIMIT @limit OFFSET @offset`, params).Scan(&rows).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve assets", err.Error())
+		return
+	}
+	for _, row := range rows {
+		_, detected := scanner.SplitTechnologyVersion(row.TechnologyName)
+		response.Assets = append(response.Assets, TechnologyAsset{
+			Type:             row.Type,
+			OrganizationID:   row.OrganizationID,
+			OrganizationName: row.OrganizationName,
+			RootDomainID:     row.RootDomainID,
+			Domain:           row.Domain,
+			SubdomainID:      row.SubdomainID,
+			Hostname:         row.Hostname,
+			IsActive:         row.IsActive,
+			EndpointID:       row.EndpointID,
+			Path:             row.Path,
+			Method:           row.Method,
+			TechnologyID:     row.TechnologyID,
+			Version:          detected,
+			DetectedAt:       row.DetectedAt,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
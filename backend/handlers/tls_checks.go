@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- Response Structs ---
+
+// TLSCheckResponse is the last TLS certificate check of a subdomain.
+type TLSCheckResponse struct {
+	SubdomainID uint      `json:"subdomain_id"`
+	Hostname    string    `json:"hostname"`
+	Valid       bool      `json:"valid"`
+	Error       string    `json:"error,omitempty"`
+	ScanID      *uint     `json:"scan_id,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// TLSCheckListResponse is a page of a domain's TLS checks.
+type TLSCheckListResponse struct {
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+	Total    int64              `json:"total"`
+	Invalid  int64              `json:"invalid"` // Checks of the domain that failed, regardless of filters
+	Checks   []TLSCheckResponse `json:"checks"`
+}
+
+// --- Handler Functions ---
+
+// GetDomainTLSChecks handles GET requests listing whether the certificates of a root domain's subdomains
+// verified, recorded by scans while the TLS_VERIFY setting is on. Optional filter valid (true or false);
+// paginated with page and page_size.
+func GetDomainTLSChecks(c *gin.Context) {
+	domainID, err := strconv.ParseUint(c.Param("domain_id"), 10, 32)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid domain ID format")
+		return
+	}
+	page, ok := parseIntQuery(c, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := parseIntQuery(c, "page_size", 50, 1, 200)
+	if !ok {
+		return
+	}
+	var valid *bool
+	if validStr := c.Query("valid"); validStr != "" {
+		parsed, err := strconv.ParseBool(validStr)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid valid, must be true or false")
+			return
+		}
+		valid = &parsed
+	}
+
+	db := database.GetDB()
+	var domain models.RootDomain
+	if err := db.Select("id").First(&domain, uint(domainID)).Error; err != nil {
+		respondLookupError(c, err, fmt.Sprintf("Domain with ID %d not found", domainID), "Failed to retrieve domain")
+		return
+	}
+
+	response := TLSCheckListResponse{Page: page, PageSize: pageSize, Checks: []TLSCheckResponse{}}
+	domainChecks := func() *gorm.DB {
+		return db.Model(&models.TLSCheck{}).
+			Joins("JOIN subdomains ON subdomains.id = tls_checks.subdomain_id").
+			Where("subdomains.root_domain_id = ?", domain.ID)
+	}
+	if err := domainChecks().Where("tls_checks.valid = ?", false).Count(&response.Invalid).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count invalid TLS checks", err.Error())
+		return
+	}
+	query := domainChecks()
+	if valid != nil {
+		query = query.Where("tls_checks.valid = ?", *valid)
+	}
+	if err := query.Count(&response.Total).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to count TLS checks", err.Error())
+		return
+	}
+	if err := query.Select("tls_checks.subdomain_id, subdomains.hostname, tls_checks.valid, tls_checks.error, tls_checks.scan_id, tls_checks.checked_at").
+		Order("tls_checks.valid, subdomains.hostname").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&response.Checks).Error; err != nil {
+		RespondError(c, http.StatusInternalServerError, "Failed to retrieve TLS checks", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
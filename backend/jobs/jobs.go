@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rewrite-go/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job types
+const (
+	TypeScan        = "scan"
+	TypeImport      = "import"
+	TypeMaintenance = "maintenance"
+)
+
+// Job statuses. Scans additionally report the DB statuses "pending" and "stale" (see handlers.GetJobs).
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+const (
+	finishedJobRetention = time.Hour // Finished jobs stay listed this long
+	maxFinishedJobs      = 200       // Oldest finished jobs are dropped beyond this
+)
+
+var (
+	ErrNotFound       = errors.New("job not found")
+	ErrNotCancellable = errors.New("job cannot be cancelled")
+	ErrNotRunning     = errors.New("job is not running")
+)
+
+// Job is a unit of background work tracked in memory while the server runs.
+// Scans are durable in the database as well; their job ID is "scan-<scan ID>".
+type Job struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	Phase       string     `json:"phase,omitempty"` // Current step, e.g. "subdomain discovery"
+	Done        int        `json:"done"`
+	Total       int        `json:"total"` // 0 if the amount of work is unknown
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	ScanID      *uint      `json:"scan_id,omitempty"`
+	Cancellable bool       `json:"cancellable"`
+
+	cancel         context.CancelFunc
+	phaseStartedAt time.Time
+}
+
+var (
+	mu       sync.Mutex
+	registry = make(map[string]*Job)
+	sequence int
+)
+
+// Start registers a running job. If cancel is non-nil the job can be cancelled through Cancel.
+func Start(jobType, description string, cancel context.CancelFunc) *Job {
+	mu.Lock()
+	sequence++
+	id := fmt.Sprintf("%s-%d", jobType, sequence)
+	mu.Unlock()
+	return register(&Job{ID: id, Type: jobType, Description: description}, cancel)
+}
+
+// StartScan registers a running scan job with the ID "scan-<scanID>", replacing any earlier entry.
+func StartScan(scanID uint, description string, cancel context.CancelFunc) *Job {
+	return register(&Job{ID: ScanJobID(scanID), Type: TypeScan, Description: description, ScanID: &scanID}, cancel)
+}
+
+// ScanJobID returns the job ID used for a scan.
+func ScanJobID(scanID uint) string {
+	return fmt.Sprintf("%s-%d", TypeScan, scanID)
+}
+
+func register(job *Job, cancel context.CancelFunc) *Job {
+	job.Status = StatusRunning
+	job.StartedAt = time.Now()
+	job.Cancellable = cancel != nil
+	job.cancel = cancel
+
+	mu.Lock()
+	defer mu.Unlock()
+	prune()
+	registry[job.ID] = job
+	return job
+}
+
+// SetPhase records the step a running job is in. The duration of the previous step is recorded in
+// metrics.JobPhaseDuration.
+func (j *Job) SetPhase(phase string) {
+	mu.Lock()
+	defer mu.Unlock()
+	j.observePhase()
+	j.Phase = phase
+	j.phaseStartedAt = time.Now()
+}
+
+// observePhase records how long the current phase took, if there is one. Callers must hold mu.
+func (j *Job) observePhase() {
+	if j.Phase == "" || j.phaseStartedAt.IsZero() {
+		return
+	}
+	metrics.JobPhaseDuration.Observe(time.Since(j.phaseStartedAt).Seconds(), j.Type, j.Phase)
+	j.phaseStartedAt = time.Time{}
+}
+
+// SetProgress records how much of the job's work is done.
+func (j *Job) SetProgress(done, total int) {
+	mu.Lock()
+	defer mu.Unlock()
+	j.Done, j.Total = done, total
+}
+
+// Finish marks the job completed, or failed if err is non-nil. A cancelled job stays cancelled.
+func (j *Job) Finish(err error) {
+	status, message := StatusCompleted, ""
+	if err != nil {
+		status, message = StatusFailed, err.Error()
+	}
+	j.FinishWithStatus(status, message)
+}
+
+// FinishWithStatus marks the job finished with the given status and message. A cancelled job stays cancelled.
+func (j *Job) FinishWithStatus(status, message string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if j.FinishedAt != nil {
+		return
+	}
+	j.observePhase()
+	now := time.Now()
+	j.FinishedAt = &now
+	if j.Status != StatusCancelled {
+		j.Status = status
+		j.Error = message
+	}
+	if j.Status == StatusCompleted {
+		j.Phase = "" // Keep the phase of failed/cancelled jobs to show where they stopped
+	}
+	j.Cancellable = false
+	j.cancel = nil
+}
+
+// Cancel cancels a running job's context and marks it cancelled. The job's goroutine stops at its
+// next cancellation check and then calls Finish, which keeps the cancelled status.
+func Cancel(id string) (Job, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	job, ok := registry[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if job.Status != StatusRunning {
+		return *job, ErrNotRunning
+	}
+	if job.cancel == nil {
+		return *job, ErrNotCancellable
+	}
+	job.cancel()
+	job.Status = StatusCancelled
+	job.Cancellable = false
+	return *job, nil
+}
+
+// Get returns a snapshot of a job.
+func Get(id string) (Job, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	job, ok := registry[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns snapshots of all tracked jobs, newest first.
+func List() []Job {
+	mu.Lock()
+	defer mu.Unlock()
+	prune()
+	list := make([]Job, 0, len(registry))
+	for _, job := range registry {
+		list = append(list, *job)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].StartedAt.After(list[k].StartedAt) })
+	return list
+}
+
+// prune drops finished jobs past the retention window or limit. Callers must hold mu.
+func prune() {
+	var finished []*Job
+	for id, job := range registry {
+		if job.FinishedAt == nil {
+			continue
+		}
+		if time.Since(*job.FinishedAt) > finishedJobRetention {
+			delete(registry, id)
+			continue
+		}
+		finished = append(finished, job)
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool { return finished[i].FinishedAt.After(*finished[k].FinishedAt) })
+	for _, job := range finished[maxFinishedJobs:] {
+		delete(registry, job.ID)
+	}
+}
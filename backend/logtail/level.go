@@ -0,0 +1,59 @@
+package logtail
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync/atomic"
+)
+
+// Levels of application log lines, lowest first
+const (
+	levelInfo = iota
+	levelWarn
+	levelError
+	levelSilent // Above every line, nothing is printed
+)
+
+var levels = map[string]int32{"info": levelInfo, "warn": levelWarn, "error": levelError, "silent": levelSilent}
+
+// minLevel is the lowest level printed to stderr, see SetLevel. Every line is printed until it is set.
+var minLevel atomic.Int32
+
+// timestampPattern matches the date and time the standard logger prefixes each line with.
+var timestampPattern = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+
+// SetLevel sets the lowest level of the lines printed to stderr: "silent", "error", "warn" or "info" (see
+// config.LogLevel). The scan log tails still receive every line.
+func SetLevel(level string) {
+	if l, ok := levels[level]; ok {
+		minLevel.Store(l)
+	}
+}
+
+// lineLevel classifies a log entry by the prefixes the code base uses: entries starting with "Error" or
+// "Failed" are errors, "Warning" warnings and the others info.
+func lineLevel(entry []byte) int32 {
+	message := entry[len(timestampPattern.Find(entry)):]
+	switch {
+	case bytes.HasPrefix(message, []byte("Error")), bytes.HasPrefix(message, []byte("Failed")):
+		return levelError
+	case bytes.HasPrefix(message, []byte("Warning")):
+		return levelWarn
+	default:
+		return levelInfo
+	}
+}
+
+// levelWriter passes the log entries at or above minLevel to w. The standard logger writes each entry,
+// including multi-line ones, in a single call.
+type levelWriter struct {
+	w io.Writer
+}
+
+func (lw levelWriter) Write(p []byte) (int, error) {
+	if lineLevel(p) < minLevel.Load() {
+		return len(p), nil
+	}
+	return lw.w.Write(p)
+}
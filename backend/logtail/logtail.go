@@ -0,0 +1,121 @@
+package logtail
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	recentLines    = 200 // Lines kept per scan for clients connecting mid-scan
+	maxScans       = 100 // Scans with buffered lines; the least recently logged are dropped beyond this
+	subscriberSize = 256 // Lines buffered per subscriber; slow subscribers miss lines rather than block logging
+)
+
+// Line is a log line attributed to a scan.
+type Line struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// scanIDPattern finds the scan a log line is about. Lines are not tagged with a scan ID yet, so this
+// matches the phrasings the scanner uses: "scan 12", "Scan ID: 12", "(Scan 12)" or "scan_id=12".
+var scanIDPattern = regexp.MustCompile(`(?i)\bscan(?:_id=| id: ?| )(\d+)\b`)
+
+// scanLog holds the recent lines of a scan and the channels of clients following it.
+type scanLog struct {
+	lines       []Line
+	subscribers map[chan Line]struct{}
+	lastLogged  time.Time
+}
+
+var (
+	mu    sync.Mutex
+	scans = make(map[uint]*scanLog)
+)
+
+// Install makes the standard logger also feed the scan log tails, see Subscribe. Output still goes to
+// stderr, filtered by SetLevel.
+func Install() {
+	log.SetOutput(io.MultiWriter(levelWriter{os.Stderr}, writer{}))
+}
+
+// writer attributes each line written by the standard logger to the scan it mentions, if any.
+type writer struct{}
+
+func (writer) Write(p []byte) (int, error) {
+	for _, raw := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		match := scanIDPattern.FindSubmatch(raw)
+		if match == nil {
+			continue
+		}
+		scanID, err := strconv.ParseUint(string(match[1]), 10, 32)
+		if err != nil {
+			continue
+		}
+		record(uint(scanID), Line{Time: time.Now(), Text: string(raw)})
+	}
+	return len(p), nil
+}
+
+// record appends a line to the scan's recent lines and hands it to the scan's subscribers.
+func record(scanID uint, line Line) {
+	mu.Lock()
+	defer mu.Unlock()
+	sl := scanLogLocked(scanID)
+	sl.lines = append(sl.lines, line)
+	if len(sl.lines) > recentLines {
+		sl.lines = sl.lines[len(sl.lines)-recentLines:]
+	}
+	sl.lastLogged = line.Time
+	for ch := range sl.subscribers {
+		select {
+		case ch <- line:
+		default: // Subscriber is behind, drop the line for it
+		}
+	}
+}
+
+// scanLogLocked returns the log of a scan, creating it and evicting the stalest scan without
+// subscribers if needed. mu must be held.
+func scanLogLocked(scanID uint) *scanLog {
+	if sl, ok := scans[scanID]; ok {
+		return sl
+	}
+	if len(scans) >= maxScans {
+		var stalest uint
+		var stalestAt time.Time
+		for id, sl := range scans {
+			if len(sl.subscribers) == 0 && (stalestAt.IsZero() || sl.lastLogged.Before(stalestAt)) {
+				stalest, stalestAt = id, sl.lastLogged
+			}
+		}
+		if !stalestAt.IsZero() {
+			delete(scans, stalest)
+		}
+	}
+	sl := &scanLog{subscribers: make(map[chan Line]struct{}), lastLogged: time.Now()}
+	scans[scanID] = sl
+	return sl
+}
+
+// Subscribe returns the recent lines of a scan and a channel receiving its lines from now on. The
+// returned func unsubscribes and must be called once the caller stops reading.
+func Subscribe(scanID uint) ([]Line, <-chan Line, func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	sl := scanLogLocked(scanID)
+	recent := append([]Line(nil), sl.lines...)
+	ch := make(chan Line, subscriberSize)
+	sl.subscribers[ch] = struct{}{}
+	return recent, ch, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(sl.subscribers, ch)
+	}
+}
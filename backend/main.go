@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"                  // Import os package
 	"path/filepath"       // Import filepath package
 	"rewrite-go/config"   // Import the config package
 	"rewrite-go/database" // Import the database package
+	"rewrite-go/digest"
 	"rewrite-go/handlers" // Import the handlers package
-	"strings"             // Import strings package
+	"rewrite-go/logtail"
+	"rewrite-go/metrics"
+	"strings" // Import strings package
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -20,7 +24,7 @@ func ServeScreenshot(c *gin.Context) {
 	// The *filepath captures everything after /api/screenshots/
 	requestedPath := c.Param("filepath")
 	if requestedPath == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Filepath parameter is missing"})
+		handlers.RespondError(c, http.StatusBadRequest, "Filepath parameter is missing")
 		return
 	}
 
@@ -65,11 +69,10 @@ func ServeScreenshot(c *gin.Context) {
 	// The `requestedPath` parameter contains `data/screenshots/scan_X/file.png`.
 	// We need `filepath.Join(".", requestedPath)` but need to ensure security.
 
-	// Revised Logic based on feedback:
-	// The requestedPath from the URL seems to be relative *within* the screenshots dir,
-	// e.g., "scan_1/image.png".
-	// Define the base directory on the server where screenshots are stored.
-	serverSideBaseDir := filepath.Join(".", "data", "screenshots")
+	// The requested path is either relative to the legacy screenshots directory (scan_1/image.png,
+	// what the frontend sends for data/screenshots/... paths), relative to DATA_DIR, or the stored
+	// file path itself (e.g. data/scans/scan_1/screenshots/image.png).
+	dataDir := config.DataDir()
 
 	// Clean the user-provided path segment to prevent traversal like "../.." within it.
 	// Prepending "/" ensures Clean treats it like an absolute path segment for cleaning purposes,
@@ -78,33 +81,48 @@ func ServeScreenshot(c *gin.Context) {
 	if strings.HasPrefix(cleanedRelativePath, "/..") || cleanedRelativePath == "/.." {
 		// If cleaning results in trying to go above the root of the relative path, deny.
 		log.Printf("Attempted directory traversal within relative path: %s", requestedPath)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid path"})
+		handlers.RespondError(c, http.StatusForbidden, "Invalid path")
 		return
 	}
 	// Remove the leading "/" added for cleaning, as Join expects relative paths.
 	cleanedRelativePath = strings.TrimPrefix(cleanedRelativePath, "/")
 
-	// Construct the full path by joining the server's base screenshot directory
-	// with the cleaned relative path provided in the request.
-	fullPath := filepath.Join(serverSideBaseDir, cleanedRelativePath)
-
-	// Security Check: Ensure the final resolved path is still prefixed by the server's base directory.
-	// This is a crucial check against more complex traversal attacks.
-	if !strings.HasPrefix(fullPath, serverSideBaseDir+string(filepath.Separator)) && fullPath != serverSideBaseDir {
-		// Check prefix + separator to avoid matching "/base/dir" with "/base/directory"
-		// Also allow exact match if requesting the base directory itself (though unlikely here).
-		log.Printf("Security check failed: Path %s resolved outside base directory %s", fullPath, serverSideBaseDir)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	candidates := []string{
+		filepath.Join(dataDir, "screenshots", cleanedRelativePath),
+		filepath.Join(dataDir, cleanedRelativePath),
+		filepath.Clean(cleanedRelativePath),
+	}
+	if filepath.IsAbs(dataDir) {
+		candidates = append(candidates, filepath.Clean("/"+cleanedRelativePath)) // Stored absolute path
+	}
+	fullPath := ""
+	for _, candidate := range candidates {
+		// Security Check: Only files inside the data directory are served.
+		// This is a crucial check against more complex traversal attacks.
+		if rel, err := filepath.Rel(dataDir, candidate); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if fullPath == "" {
+			fullPath = candidate // Reported as not found if no candidate exists
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			fullPath = candidate
+			break
+		}
+	}
+	if fullPath == "" {
+		log.Printf("Security check failed: Path %s resolves outside data directory %s", requestedPath, dataDir)
+		handlers.RespondError(c, http.StatusForbidden, "Access denied")
 		return
 	}
 
 	// Check if the file exists
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Screenshot not found"})
+		handlers.RespondError(c, http.StatusNotFound, "Screenshot not found")
 		return
 	} else if err != nil {
 		log.Printf("Error checking screenshot file %s: %v", fullPath, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error accessing screenshot file"})
+		handlers.RespondError(c, http.StatusInternalServerError, "Error accessing screenshot file")
 		return
 	}
 
@@ -115,15 +133,37 @@ func ServeScreenshot(c *gin.Context) {
 }
 
 func main() {
+	// Feed log lines mentioning a scan to GET /api/scans/:id/logtail
+	logtail.Install()
+
+	// Load Config first so LOG_LEVEL applies to the database logger
+	config.LoadConfig()
+	logLevel := config.LogLevel()
+	log.Printf("Log level: %s", logLevel)
+	logtail.SetLevel(logLevel) // Application log lines below the level are dropped from here on
+
+	// Resolve the bind address early so a bad HOST/PORT setting fails fast (defaults to 127.0.0.1:8080)
+	addr, err := config.ListenAddress()
+	if err != nil {
+		log.Fatal("Error: Invalid server address configuration: ", err)
+	}
+
 	// Initialize Database
 	database.ConnectDatabase()
 	database.MigrateDatabase()
 
-	// Load Config (Load it early, e.g., after DB init)
-	config.LoadConfig()
-
-	// Create Gin router
-	router := gin.Default()
+	// Email digests on the DIGEST_INTERVAL_HOURS schedule (checked periodically, disabled by default)
+	digest.StartScheduler(context.Background())
+
+	// Create Gin router (request logging and debug output only at info level, so the default "warn" logs no requests)
+	var router *gin.Engine
+	if logLevel == "info" {
+		router = gin.Default()
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+		router = gin.New()
+		router.Use(gin.Recovery())
+	}
 
 	// Configure CORS
 	// Mimics the FastAPI CORS settings
@@ -134,31 +174,57 @@ func main() {
 	config.AllowHeaders = []string{"*"} // Allow all headers for local dev testing
 	config.AllowCredentials = true
 	router.Use(cors.New(config))
+	router.Use(metrics.Middleware()) // API latency for /metrics
 
 	// Define root route
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "Attack Surface Management API (Go Version)"})
 	})
 
+	// Prometheus metrics, outside /api so scrapers don't need the API prefix
+	router.GET("/metrics", handlers.GetMetrics)
+
 	// API Route Group
 	api := router.Group("/api")
 	{
 		// Organization routes
 		orgRoutes := api.Group("/organizations")
 		{
-			orgRoutes.POST("", handlers.CreateOrganization) // Also handle POST without trailing slash
-			orgRoutes.GET("", handlers.GetOrganizations)    // Handle GET without trailing slash
+			orgRoutes.POST("", handlers.CreateOrganization)          // Also handle POST without trailing slash
+			orgRoutes.GET("", handlers.GetOrganizations)             // Handle GET without trailing slash
+			orgRoutes.GET("/compare", handlers.CompareOrganizations) // Overlap report, ?a=<id>&b=<id>
 			orgRoutes.GET("/:org_id", handlers.GetOrganization)
+			orgRoutes.POST("/:org_id/merge", handlers.MergeOrganization) // Merge into another organization, then delete this one
+			orgRoutes.POST("/:org_id/sessions", handlers.CreateSession)  // Recorded browser sessions for authenticated scans
+			orgRoutes.GET("/:org_id/sessions", handlers.GetSessions)
+			orgRoutes.GET("/:org_id/delta", handlers.GetOrganizationDelta) // Assets discovered since a timestamp, ?since=&limit=
+			orgRoutes.GET("/:org_id/scope", handlers.GetOrganizationScope)
+			orgRoutes.POST("/:org_id/scope", handlers.ImportOrganizationScope) // Pasted scope list or HackerOne scope CSV, ?dry_run=true
+			orgRoutes.DELETE("/:org_id/scope/:rule_id", handlers.DeleteScopeRule)
 			// Add the organization-specific import route here
 			orgRoutes.POST("/:org_id/import/urls", handlers.HandleImportURLs)
+			orgRoutes.POST("/:org_id/import/domains", handlers.HandleImportDomains)
 		}
 
 		// Domain routes
 		domainRoutes := api.Group("/domains")
 		{
-			domainRoutes.POST("", handlers.CreateDomain) // Handle POST without trailing slash
-			domainRoutes.GET("", handlers.GetDomains)    // Handle GET without trailing slash
+			domainRoutes.POST("", handlers.CreateDomain)                                // Handle POST without trailing slash
+			domainRoutes.GET("", handlers.GetDomains)                                   // Handle GET without trailing slash
+			domainRoutes.POST("/repair-root-subdomains", handlers.RepairRootSubdomains) // Maintenance: one canonical root-level subdomain per domain
 			domainRoutes.GET("/:domain_id", handlers.GetDomain)
+			domainRoutes.GET("/:domain_id/tree", handlers.GetDomainTree)                     // Nested subdomains/endpoints/tech for detail pages
+			domainRoutes.GET("/:domain_id/subdomains", handlers.GetDomainSubdomains)         // Subdomains with review scores, e.g. ?sort=-score
+			domainRoutes.GET("/:domain_id/subdomains.txt", handlers.GetDomainSubdomainsText) // One hostname per line, ?active_only=true
+			domainRoutes.GET("/:domain_id/endpoints.txt", handlers.GetDomainEndpointsText)   // One URL per line, ?active_only=true&scheme=http
+			domainRoutes.PATCH("/:domain_id/organization", handlers.ReassignDomainOrganization)
+			domainRoutes.GET("/:domain_id/external-links", handlers.GetDomainExternalLinks)
+			domainRoutes.GET("/:domain_id/tls-checks", handlers.GetDomainTLSChecks)
+			domainRoutes.GET("/:domain_id/sensitive-files", handlers.GetDomainSensitiveFiles)
+			domainRoutes.GET("/:domain_id/report.md", handlers.GetDomainReport)
+			domainRoutes.GET("/:domain_id/status-distribution", handlers.GetDomainStatusDistribution)
+			domainRoutes.GET("/:domain_id/content-types", handlers.GetDomainContentTypes)
+			domainRoutes.POST("/:domain_id/screenshots", handlers.RescreenshotDomain) // Re-run only the screenshot phase
 			// Removed deprecated domain-specific scan route: POST /:domain_id/scan
 		}
 
@@ -168,6 +234,8 @@ func main() {
 			subdomainRoutes.GET("", handlers.GetSubdomains) // Handle GET without trailing slash
 			subdomainRoutes.GET("/:subdomain_id", handlers.GetSubdomain)
 			subdomainRoutes.GET("/:subdomain_id/endpoints", handlers.GetSubdomainEndpoints)
+			subdomainRoutes.GET("/:subdomain_id/tags", handlers.GetSubdomainTags)
+			subdomainRoutes.GET("/:subdomain_id/fingerprint", handlers.GetSubdomainFingerprint)
 		}
 
 		// Endpoint routes
@@ -177,24 +245,45 @@ func main() {
 			endpointRoutes.GET("/:endpoint_id", handlers.GetEndpoint)
 			endpointRoutes.GET("/:endpoint_id/parameters", handlers.GetEndpointParameters)
 			endpointRoutes.GET("/:endpoint_id/request-responses", handlers.GetEndpointRequestResponses)
+			endpointRoutes.GET("/:endpoint_id/status-history", handlers.GetEndpointStatusHistory)
 		}
 
 		// Technology routes
 		techRoutes := api.Group("/technologies")
 		{
-			techRoutes.GET("", handlers.GetTechnologies) // Handle GET without trailing slash
+			techRoutes.GET("", handlers.GetTechnologies)           // Handle GET without trailing slash
+			techRoutes.GET("/search", handlers.SearchTechnologies) // Prefix search for autocomplete
 			techRoutes.GET("/:technology_id", handlers.GetTechnology)
+			techRoutes.GET("/:technology_id/detail", handlers.GetTechnologyDetail) // Usage counts, affected organizations and recent detections
 			techRoutes.GET("/:technology_id/domains", handlers.GetDomainsWithTechnology)
 			techRoutes.GET("/:technology_id/subdomains", handlers.GetSubdomainsWithTechnology)
 			techRoutes.GET("/:technology_id/endpoints", handlers.GetEndpointsWithTechnology)
+			techRoutes.GET("/:technology_id/evidence", handlers.GetTechnologyEvidence) // URLs the technology was detected at
 		}
 
 		// Scan routes
 		scanRoutes := api.Group("/scans")
 		{
-			scanRoutes.POST("", handlers.StartScan) // Add route for starting scans (root or subdomain)
-			scanRoutes.GET("", handlers.GetScans)   // Handle GET without trailing slash
+			scanRoutes.POST("", handlers.StartScan)                                 // Add route for starting scans (root or subdomain)
+			scanRoutes.GET("", handlers.GetScans)                                   // Handle GET without trailing slash
+			scanRoutes.POST("/multi-domain", handlers.StartMultiDomainScan)         // Several root domains in one run, see MULTI_DOMAIN_SCAN_CONCURRENCY
+			scanRoutes.POST("/screenshot-preview", handlers.PreviewScanScreenshots) // Dry run of the initial existing-asset screenshots
+			scanRoutes.POST("/prune", handlers.PruneScans)                          // Retention: delete old scans and screenshots (dry run unless dry_run=false)
 			scanRoutes.GET("/:id", handlers.GetScan)
+			scanRoutes.GET("/:id/logtail", handlers.StreamScanLogTail) // Server-sent events with the scan's log lines
+			scanRoutes.GET("/:id/timing", handlers.GetScanTiming)      // Time spent per phase
+			scanRoutes.POST("/:id/resume", handlers.ResumeScan)
+			scanRoutes.GET("/:id/config", handlers.GetScanConfig)
+			scanRoutes.GET("/:id/subdomains", handlers.GetScanSubdomains)
+			scanRoutes.GET("/:id/endpoints", handlers.GetScanEndpoints)
+		}
+
+		// Session routes
+		sessionRoutes := api.Group("/sessions")
+		{
+			sessionRoutes.GET("/:session_id", handlers.GetSession)
+			sessionRoutes.POST("/:session_id/record", handlers.RecordSession) // Replay the login sequence and store the cookies
+			sessionRoutes.DELETE("/:session_id", handlers.DeleteSession)
 		}
 
 		// Scan Template routes
@@ -202,11 +291,34 @@ func main() {
 		{
 			scanTemplateRoutes.POST("", handlers.CreateScanTemplate)
 			scanTemplateRoutes.GET("", handlers.GetScanTemplates)
+			scanTemplateRoutes.GET("/subfinder-sources", handlers.GetSubfinderSources) // Source names for the subfinder sources/excludeSources options
 			scanTemplateRoutes.GET("/:template_id", handlers.GetScanTemplate)
+			scanTemplateRoutes.GET("/:template_id/validate", handlers.ValidateScanTemplate) // Dry-check API keys for subfinder sources
+			scanTemplateRoutes.GET("/:template_id/effective-config", handlers.GetScanTemplateEffectiveConfig)
 			scanTemplateRoutes.PUT("/:template_id", handlers.UpdateScanTemplate)
 			scanTemplateRoutes.DELETE("/:template_id", handlers.DeleteScanTemplate)
 		}
 
+		// Cross-organization search routes
+		searchRoutes := api.Group("/search")
+		{
+			searchRoutes.GET("/technology", handlers.SearchTechnologyAssets) // ?name=<tech>&version=<ver>
+		}
+
+		// Tag rule routes, applied after technology detection
+		tagRuleRoutes := api.Group("/tag-rules")
+		{
+			tagRuleRoutes.GET("", handlers.GetTagRules)
+			tagRuleRoutes.POST("", handlers.CreateTagRule)
+			tagRuleRoutes.DELETE("/:rule_id", handlers.DeleteTagRule)
+		}
+
+		// Maintenance routes
+		maintenanceRoutes := api.Group("/maintenance")
+		{
+			maintenanceRoutes.POST("/apply-tag-rules", handlers.ApplyTagRules) // Tag subdomains detected so far, ?domain_id= limits to one domain
+		}
+
 		// Graph routes
 		graphRoutes := api.Group("/graph")
 		{
@@ -219,10 +331,35 @@ func main() {
 			// Wrap standard http handlers for Gin
 			settingsRoutes.GET("", gin.WrapF(handlers.GetSettingsHandler))
 			settingsRoutes.POST("", gin.WrapF(handlers.SaveSettingsHandler))
+			settingsRoutes.GET("/template", gin.WrapF(handlers.GetSettingsTemplateHandler)) // Known keys with descriptions, no values
 		}
 
-		// Screenshot serving route (outside specific resource groups)
+		// Background job routes (scans, imports, maintenance)
+		jobRoutes := api.Group("/jobs")
+		{
+			jobRoutes.GET("", handlers.GetJobs)
+			jobRoutes.POST("/:job_id/cancel", handlers.CancelJob)
+		}
+
+		// "What changed" email digests
+		digestRoutes := api.Group("/digest")
+		{
+			digestRoutes.GET("/preview", handlers.PreviewDigest) // Digest that would be sent now, ?since=&format=text
+			digestRoutes.POST("/send", handlers.SendDigest)      // Send now, regardless of DIGEST_INTERVAL_HOURS
+			digestRoutes.GET("/runs", handlers.GetDigestRuns)
+		}
+
+		// Recent scans, discoveries and imports across the instance, for the dashboard
+		api.GET("/activity", handlers.GetActivity)
+
+		// Ad-hoc liveness and technology check of a single URL, nothing is saved
+		api.POST("/probe", handlers.ProbeURL)
+
+		// Screenshot metadata listing and file serving (outside specific resource groups)
+		api.GET("/screenshots", handlers.GetScreenshots)
+		api.POST("/screenshots/batch", handlers.CreateScreenshotBatch) // Capture selected URLs now, outside a scan
 		api.GET("/screenshots/*filepath", ServeScreenshot)
+		api.GET("/screenshot-eligibility", handlers.GetScreenshotEligibility) // Content types and extensions deciding what is screenshotted
 
 		// Import routes are now nested under organizations
 		// Remove the old top-level import route group
@@ -231,9 +368,8 @@ func main() {
 	// Remove the duplicated orgRoutes group below
 
 	// Start server
-	port := "8080" // Use a different port than the Python version (8000)
-	log.Printf("Starting Go server on port %s", port)
-	if err := router.Run(":" + port); err != nil {
+	log.Printf("Starting Go server on %s", addr)
+	if err := router.Run(addr); err != nil {
 		log.Fatal("Failed to run server:", err)
 	}
 }
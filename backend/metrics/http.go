@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware records the latency of every request in HTTPRequestDuration, labelled with the route
+// pattern (e.g. /api/scans/:scan_id) so IDs don't create a series per request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequestDuration.Observe(time.Since(started).Seconds(), c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
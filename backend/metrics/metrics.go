@@ -0,0 +1,251 @@
+// Package metrics keeps in-process counters and histograms and writes them in the Prometheus text
+// exposition format. It covers the few metric types kasm needs without pulling in a client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics recorded by the scanner, jobs and HTTP server. Database-derived gauges are collected at scrape time
+// (see handlers.GetMetrics).
+var (
+	ScansFinished = NewCounterVec("kasm_scans_finished_total",
+		"Scans finished by this process, by final status.", "status")
+	ScanDuration = NewHistogramVec("kasm_scan_duration_seconds",
+		"Duration of scans finished by this process.", []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800}, "scan_type", "status")
+	JobPhaseDuration = NewHistogramVec("kasm_job_phase_duration_seconds",
+		"Duration of background job phases, e.g. the URL crawl of a scan.", []float64{1, 10, 30, 60, 300, 900, 1800, 3600, 7200}, "type", "phase")
+	SubdomainsDiscovered = NewCounterVec("kasm_subdomains_discovered_total",
+		"Subdomains first discovered by scans of this process.")
+	EndpointsDiscovered = NewCounterVec("kasm_endpoints_discovered_total",
+		"Endpoints first discovered by scans of this process.")
+	Screenshots = NewCounterVec("kasm_screenshots_total",
+		"Screenshot capture attempts, by outcome (captured, skipped or failed).", "status")
+	HTTPRequestDuration = NewHistogramVec("kasm_http_request_duration_seconds",
+		"Latency of API requests, by route pattern.", []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}, "method", "route", "status")
+)
+
+var (
+	registryMu sync.Mutex
+	registry   []family
+)
+
+// family is a registered metric that can write itself in the text format.
+type family interface {
+	name() string
+	write(w io.Writer)
+}
+
+func register(f family) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, f)
+}
+
+// CounterVec is a monotonically increasing counter partitioned by label values.
+type CounterVec struct {
+	metricName, help string
+	labels           []string
+	mu               sync.Mutex
+	values           map[string]float64 // Encoded label values -> count
+}
+
+// NewCounterVec creates and registers a counter with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metricName: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc adds 1 to the counter for the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v (which must not be negative) to the counter for the given label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := encodeLabels(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.metricName, c.help, "counter")
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.metricName) // Unlabelled counters are reported from the start
+		return
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, key, formatValue(c.values[key]))
+	}
+}
+
+// HistogramVec counts observations into cumulative buckets, partitioned by label values.
+type HistogramVec struct {
+	metricName, help string
+	labels           []string
+	bucketLabels     []string  // labels plus "le"
+	buckets          []float64 // Upper bounds, ascending; +Inf is implicit
+	mu               sync.Mutex
+	series           map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // Per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec creates and registers a histogram with the given bucket upper bounds and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{
+		metricName:   name,
+		help:         help,
+		labels:       labels,
+		bucketLabels: append(append([]string(nil), labels...), "le"),
+		buckets:      sorted,
+		series:       make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+// Observe records a value for the given label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := encodeLabels(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.metricName, h.help, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		bucketValues := append(append([]string(nil), s.labelValues...), "")
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			bucketValues[len(bucketValues)-1] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, encodeLabels(h.bucketLabels, bucketValues), cumulative)
+		}
+		bucketValues[len(bucketValues)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, encodeLabels(h.bucketLabels, bucketValues), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, key, formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, key, s.count)
+	}
+}
+
+// Sample is one value of a Gauge.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// Gauge is a point-in-time value computed by the caller, e.g. from the database at scrape time.
+type Gauge struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Samples []Sample
+}
+
+// WriteText writes all registered metrics, followed by the given gauges, in the Prometheus text format.
+func WriteText(w io.Writer, gauges ...Gauge) {
+	registryMu.Lock()
+	families := append([]family(nil), registry...)
+	registryMu.Unlock()
+	sort.Slice(families, func(i, k int) bool { return families[i].name() < families[k].name() })
+
+	for _, f := range families {
+		f.write(w)
+	}
+	for _, g := range gauges {
+		writeHeader(w, g.Name, g.Help, "gauge")
+		for _, s := range g.Samples {
+			fmt.Fprintf(w, "%s%s %s\n", g.Name, encodeLabels(g.Labels, s.LabelValues), formatValue(s.Value))
+		}
+	}
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help), name, metricType)
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// encodeLabels renders {name="value",...}, or "" without labels. Missing values are empty.
+func encodeLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, labelEscaper.Replace(value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -37,6 +37,7 @@ type Subdomain struct {
 	IPAddress    string       `json:"ip_address,omitempty"`
 	IsActive     bool         `json:"is_active"`
 	DiscoveredAt time.Time    `json:"discovered_at"`
+	LastSeenAt   *time.Time   `json:"last_seen_at,omitempty"`                                          // Nullable DateTime, updated each time a scan re-observes the subdomain
 	RootDomain   *RootDomain  `json:"root_domain,omitempty"`                                           // Relationship
 	ScanID       *uint        `json:"scan_id,omitempty"`                                               // Nullable Foreign Key
 	Scan         *Scan        `json:"scan,omitempty"`                                                  // Relationship
@@ -53,6 +54,8 @@ type Endpoint struct {
 	StatusCode       int               `json:"status_code,omitempty"`
 	ContentType      string            `json:"content_type,omitempty"`
 	DiscoveredAt     time.Time         `json:"discovered_at"`
+	LastSeenAt       *time.Time        `json:"last_seen_at,omitempty"`                                         // Nullable DateTime, updated each time a scan re-observes the endpoint
+	ChangedAt        *time.Time        `json:"changed_at,omitempty"`                                           // Last time a scan observed a different status code or content type
 	ScanID           *uint             `json:"scan_id,omitempty"`                                              // Nullable Foreign Key
 	Scan             *Scan             `json:"scan,omitempty"`                                                 // Relationship
 	Subdomain        *Subdomain        `json:"subdomain,omitempty"`                                            // Relationship
@@ -71,6 +74,17 @@ type Parameter struct {
 	Endpoint     *Endpoint `json:"endpoint,omitempty"` // Relationship
 }
 
+// EndpointStatusHistory records the response of an endpoint in one scan, so that changes in its behavior
+// (e.g. a 200 becoming a 403) can be traced. Endpoints that were not requested, like form actions, have none.
+type EndpointStatusHistory struct {
+	ID          uint      `json:"id"`
+	EndpointID  uint      `json:"endpoint_id" gorm:"uniqueIndex:idx_endpoint_status_scan"`
+	ScanID      *uint     `json:"scan_id,omitempty" gorm:"uniqueIndex:idx_endpoint_status_scan"` // Cleared when the scan is pruned
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type,omitempty"`
+	ObservedAt  time.Time `json:"observed_at"`
+}
+
 // Technology represents a web technology identified.
 type Technology struct {
 	ID       uint   `json:"id"`
@@ -85,13 +99,14 @@ type SubdomainTechnology struct {
 	TechnologyID uint      `json:"technology_id"`        // Foreign Key & Primary Key
 	Confidence   *float64  `json:"confidence,omitempty"` // Nullable Float
 	DetectedAt   time.Time `json:"detected_at"`
+	URL          string    `json:"url,omitempty"` // URL whose response revealed the technology, empty for older detections
 }
 
 // EndpointTechnology represents the join table between Endpoints and Technologies.
 type EndpointTechnology struct {
-	EndpointID   uint      `json:"endpoint_id"`          // Foreign Key & Primary Key
-	TechnologyID uint      `json:"technology_id"`        // Foreign Key & Primary Key
-	Confidence   *float64  `json:"confidence,omitempty"` // Nullable Float
+	EndpointID   uint      `json:"endpoint_id" gorm:"uniqueIndex:idx_endpoint_technology"`   // Foreign Key & Primary Key
+	TechnologyID uint      `json:"technology_id" gorm:"uniqueIndex:idx_endpoint_technology"` // Foreign Key & Primary Key
+	Confidence   *float64  `json:"confidence,omitempty"`                                     // Nullable Float
 	DetectedAt   time.Time `json:"detected_at"`
 }
 
@@ -123,21 +138,90 @@ type Scan struct {
 	DiscoveredEndpoints  []Endpoint    `json:"discovered_endpoints,omitempty"`  // Relationship
 	ScanTemplateID       *uint         `json:"scan_template_id,omitempty"`      // Nullable Foreign Key
 	ScanTemplate         *ScanTemplate `json:"scan_template,omitempty"`         // Relationship
+	TargetSnapshot       string        `json:"target_snapshot,omitempty"`       // Text (JSON string) -> string, see ScanTargetSnapshot
+	TechDetectMetrics    string        `json:"tech_detect_metrics,omitempty"`   // Text (JSON string) -> string, see TechDetectMetrics
+	ToolVersions         string        `json:"tool_versions,omitempty"`         // Text (JSON string) -> string, tool name -> module version
+	FollowUpTemplateID   *uint         `json:"follow_up_template_id,omitempty"` // Nullable: template used to deep-scan newly discovered subdomains on completion
+	ParentScanID         *uint         `json:"parent_scan_id,omitempty"`        // Nullable: set on follow-up scans enqueued by another scan
+	DNSResolver          string        `json:"dns_resolver,omitempty"`          // Resolver used by DNS enrichment, e.g. "doh:https://..." (empty if not run)
+	SubfinderSources     string        `json:"subfinder_sources,omitempty"`     // Text (JSON string) -> string, subfinder source name -> subdomains it reported
+	Labels               string        `json:"labels,omitempty"`                // Comma-separated free-form labels annotating this run, e.g. "weekly monitoring"
+	TemplateOverrides    string        `json:"template_overrides,omitempty"`    // Text (JSON string) -> string, tool name -> option overrides given at start
+	EffectiveConfig      string        `json:"effective_config,omitempty"`      // Text (JSON string) -> string, tool configuration the scan ran with
+	SessionID            *uint         `json:"session_id,omitempty"`            // Nullable: recorded browser session the scan crawls and screenshots with
+	PhaseTimings         string        `json:"phase_timings,omitempty"`         // Text (JSON string) -> string, see ScanPhaseTiming
+	ResumePhase          string        `json:"resume_phase,omitempty"`          // First phase that has not completed without errors, where POST /api/scans/:id/resume starts (empty once all have)
+}
+
+// ScanPhaseTiming records how long a phase of a scan run took, in the order the phases ran.
+// A list of them is marshalled into Scan.PhaseTimings.
+type ScanPhaseTiming struct {
+	Phase      string    `json:"phase"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// ScanTargetSnapshot records the resolved target set of a scan run.
+// It is marshalled into Scan.TargetSnapshot so users can see exactly what was targeted.
+type ScanTargetSnapshot struct {
+	SeedURLs           []string `json:"seed_urls,omitempty"`           // Seed URLs handed to the URL crawler
+	TruncatedSeedURLs  []string `json:"truncated_seed_urls,omitempty"` // Seeds whose crawl hit the per-seed crawl duration limit
+	RefreshedEndpoints int      `json:"refreshed_endpoints,omitempty"` // Known endpoints re-requested instead of crawling (URL phase mode "known")
+	ExistingAssetURLs  []string `json:"existing_asset_urls,omitempty"` // Existing subdomain/endpoint URLs screenshotted before discovery
+	PathURLs           []string `json:"path_urls,omitempty"`           // URLs of the template's screenshot paths on the live hosts
+	TechDetectURLs     []string `json:"tech_detect_urls,omitempty"`    // URLs targeted by technology detection
+}
+
+// TechDetectMetrics holds throughput statistics for a scan's technology detection phase.
+// It is marshalled into Scan.TechDetectMetrics.
+type TechDetectMetrics struct {
+	TotalURLs       int     `json:"total_urls"`
+	Succeeded       int     `json:"succeeded"`
+	Failed          int     `json:"failed"`
+	Workers         int     `json:"workers"`
+	PerHostLimit    int     `json:"per_host_limit"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	URLsPerSecond   float64 `json:"urls_per_second"`
+	SuccessRate     float64 `json:"success_rate"` // 0.0 - 1.0
+	AvgFetchMs      int64   `json:"avg_fetch_ms"`
+	MaxFetchMs      int64   `json:"max_fetch_ms"`
 }
 
 // ScanTemplate defines the configuration for a scan.
 type ScanTemplate struct {
-	ID                  uint       `json:"id"`
-	Name                string     `json:"name"`
-	Description         string     `json:"description,omitempty"`           // Text -> string
-	SubdomainScanConfig string     `json:"subdomain_scan_config,omitempty"` // Text (JSON string) -> string
-	URLScanConfig       string     `json:"url_scan_config,omitempty"`       // Text (JSON string) -> string
-	ParameterScanConfig string     `json:"parameter_scan_config,omitempty"` // Text (JSON string) -> string
-	TechDetectEnabled   bool       `json:"tech_detect_enabled"`
-	ScreenshotEnabled   bool       `json:"screenshot_enabled"` // New field for enabling screenshots
-	CreatedAt           time.Time  `json:"created_at"`
-	UpdatedAt           *time.Time `json:"updated_at,omitempty"` // Nullable DateTime (onupdate)
-	Scans               []Scan     `json:"scans,omitempty"`      // Relationship
+	ID                   uint       `json:"id"`
+	Name                 string     `json:"name"`
+	Description          string     `json:"description,omitempty"`           // Text -> string
+	SubdomainScanConfig  string     `json:"subdomain_scan_config,omitempty"` // Text (JSON string) -> string
+	URLScanConfig        string     `json:"url_scan_config,omitempty"`       // Text (JSON string) -> string
+	ParameterScanConfig  string     `json:"parameter_scan_config,omitempty"` // Text (JSON string) -> string
+	TechDetectEnabled    bool       `json:"tech_detect_enabled"`
+	ScreenshotEnabled    bool       `json:"screenshot_enabled"`     // New field for enabling screenshots
+	ScreenshotTargetOnly bool       `json:"screenshot_target_only"` // Limit initial screenshots of existing assets to the scan's target subdomain
+	ScreenshotCriteria   string     `json:"screenshot_criteria"`    // Comma-separated endpoint screenshot criteria, empty = every eligible endpoint
+	ScreenshotRetry      bool       `json:"screenshot_retry"`       // Retry failed screenshots once at the end of the scan
+	ScreenshotPaths      string     `json:"screenshot_paths"`       // Comma-separated paths (e.g. /login,/admin) screenshotted on every live host
+	ScreenshotMobile     bool       `json:"screenshot_mobile"`      // Also screenshot every live host on an emulated mobile device
+	TechDetectNewOnly    bool       `json:"tech_detect_new_only"`   // Limit tech detection to assets discovered or changed by the scan
+	HostRequestDelayMs   int        `json:"host_request_delay_ms"`  // Minimum delay between requests to the same host, 0 = HOST_REQUEST_DELAY_MS setting
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            *time.Time `json:"updated_at,omitempty"` // Nullable DateTime (onupdate)
+	Scans                []Scan     `json:"scans,omitempty"`      // Relationship
+}
+
+// ExternalLink records an endpoint that redirected to a host outside its root domain. With the katana
+// option redirectPolicy "same-scope", such targets are recorded here instead of as endpoints.
+type ExternalLink struct {
+	ID           uint       `json:"id"`
+	RootDomainID uint       `json:"root_domain_id" gorm:"index"`                      // Root domain of the endpoint
+	EndpointID   uint       `json:"endpoint_id" gorm:"uniqueIndex:idx_external_link"` // Endpoint that redirected
+	TargetURL    string     `json:"target_url" gorm:"uniqueIndex:idx_external_link"`  // Out-of-scope URL the redirects ended at
+	TargetHost   string     `json:"target_host" gorm:"index"`
+	StatusCode   int        `json:"status_code"`       // Redirect status of the endpoint, e.g. 302
+	ScanID       *uint      `json:"scan_id,omitempty"` // Last scan that observed the redirect
+	DiscoveredAt time.Time  `json:"discovered_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+	Endpoint     *Endpoint  `json:"endpoint,omitempty"` // Relationship
 }
 
 // Screenshot stores information about captured screenshots.
@@ -146,7 +230,13 @@ type Screenshot struct {
 	SubdomainID *uint      `json:"subdomain_id,omitempty"` // Optional Foreign Key to Subdomain
 	EndpointID  *uint      `json:"endpoint_id,omitempty"`  // Optional Foreign Key to Endpoint
 	URL         string     `json:"url"`                    // The URL that was screenshotted
-	FilePath    string     `json:"file_path"`              // Path to the saved screenshot image file
+	FilePath    string     `json:"file_path"`              // Path to the saved screenshot image file (empty if skipped)
+	SkipReason  string     `json:"skip_reason,omitempty"`  // Why the capture was not saved (e.g., exceeded size limit)
+	Status      string     `json:"status,omitempty"`       // "captured", "skipped" or "failed" (empty for records predating statuses)
+	Error       string     `json:"error,omitempty"`        // Why the capture failed
+	FailureKind string     `json:"failure_kind,omitempty"` // Failed captures: "unreachable" (host dead, not retried), "transient" or "error"
+	Viewport    string     `json:"viewport,omitempty"`     // "desktop" or "mobile" (empty for records predating viewports, i.e. desktop)
+	Attempts    int        `json:"attempts"`               // Capture attempts, more than 1 if retried
 	ScanID      uint       `json:"scan_id"`                // Foreign Key to Scan
 	CapturedAt  time.Time  `json:"captured_at"`
 	Subdomain   *Subdomain `json:"subdomain,omitempty"` // Relationship
@@ -154,14 +244,149 @@ type Screenshot struct {
 	Scan        *Scan      `json:"scan,omitempty"`      // Relationship
 }
 
+// DigestRun records a change digest run. The next digest covers the changes since the PeriodEnd of the
+// last run that did not fail.
+type DigestRun struct {
+	ID          uint      `json:"id"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Status      string    `json:"status"`               // "sent", "empty" (nothing changed, not sent) or "failed"
+	Recipients  string    `json:"recipients,omitempty"` // Comma-separated
+	Changes     int       `json:"changes"`              // New subdomains, new or changed endpoints and new technologies
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Session is a browser session of an organization's application, recorded by replaying a login sequence
+// in headless Chrome (see scanner.RecordSession). Scans started with a session send its cookies when
+// crawling and screenshotting. Cookies and local storage are credentials and never returned by the API.
+type Session struct {
+	ID             uint       `json:"id"`
+	OrganizationID uint       `json:"organization_id" gorm:"index"`
+	Name           string     `json:"name"`
+	LoginSteps     string     `json:"-"` // Text (JSON string) -> string, see SessionLoginStep
+	Cookies        string     `json:"-"` // Text (JSON string) -> string, see SessionCookie
+	LocalStorage   string     `json:"-"` // Text (JSON string) -> string, origin -> key -> value
+	RecordedAt     *time.Time `json:"recorded_at,omitempty"`
+	RecordError    string     `json:"record_error,omitempty"` // Why the last recording failed, empty if it succeeded
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// SessionLoginStep is one action of a session's login sequence.
+type SessionLoginStep struct {
+	Action   string `json:"action"`             // "navigate", "fill", "click", "wait_visible" or "sleep"
+	URL      string `json:"url,omitempty"`      // navigate
+	Selector string `json:"selector,omitempty"` // fill, click, wait_visible (CSS selector)
+	Value    string `json:"value,omitempty"`    // fill
+	Ms       int    `json:"ms,omitempty"`       // sleep
+}
+
+// SessionCookie is a cookie recorded for a session.
+type SessionCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain"`
+	Path     string  `json:"path"`
+	Expires  float64 `json:"expires,omitempty"` // Unix seconds, 0 for session cookies
+	HTTPOnly bool    `json:"http_only,omitempty"`
+	Secure   bool    `json:"secure,omitempty"`
+	SameSite string  `json:"same_site,omitempty"`
+}
+
+// TagRule tags the subdomains running a matching technology, see scanner.ApplyTagRules. A rule matches
+// technologies by name, by category, or by both when both are set.
+type TagRule struct {
+	ID         uint      `json:"id"`
+	Tag        string    `json:"tag"`                  // Tag applied to matching subdomains, lowercase
+	Technology string    `json:"technology,omitempty"` // Technology name, compared case-insensitively
+	Category   string    `json:"category,omitempty"`   // Technology category, compared case-insensitively
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ScopeRule is a pattern of an organization's program scope: a hostname, or "*.example.com" for the hosts
+// below example.com. Scans never save hosts matching an out-of-scope rule of the domain's organization.
+type ScopeRule struct {
+	ID             uint      `json:"id"`
+	OrganizationID uint      `json:"organization_id" gorm:"uniqueIndex:idx_scope_rule"`
+	Pattern        string    `json:"pattern" gorm:"uniqueIndex:idx_scope_rule"`
+	InScope        bool      `json:"in_scope"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SubdomainTag is a tag on a subdomain, for triage. A subdomain has each tag at most once.
+type SubdomainTag struct {
+	ID          uint      `json:"id"`
+	SubdomainID uint      `json:"subdomain_id" gorm:"uniqueIndex:idx_subdomain_tag"`
+	Tag         string    `json:"tag" gorm:"uniqueIndex:idx_subdomain_tag;index"`
+	TagRuleID   *uint     `json:"tag_rule_id,omitempty" gorm:"index"` // Rule that applied the tag
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TLSCheck records whether the certificate a subdomain presents on port 443 verified, checked by scans
+// after saving subdomains while the TLS_VERIFY setting is on. A subdomain has one, updated by each check.
+type TLSCheck struct {
+	ID          uint      `json:"id"`
+	SubdomainID uint      `json:"subdomain_id" gorm:"uniqueIndex"`
+	Valid       bool      `json:"valid"`
+	Error       string    `json:"error,omitempty"`   // Why verification failed, e.g. an expired or self-signed certificate
+	ScanID      *uint     `json:"scan_id,omitempty"` // Last scan that checked the host
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// SensitiveFile records a sensitive path (e.g. /.env or /.git/config) a subdomain served with status 200,
+// found by scans whose template enables the sensitive_files tool. Each URL is recorded once per subdomain.
+type SensitiveFile struct {
+	ID            uint       `json:"id"`
+	SubdomainID   uint       `json:"subdomain_id" gorm:"uniqueIndex:idx_sensitive_file"`
+	URL           string     `json:"url" gorm:"uniqueIndex:idx_sensitive_file"` // The scheme matters, a file may only be served over http
+	Path          string     `json:"path" gorm:"index"`
+	StatusCode    int        `json:"status_code"`
+	ContentType   string     `json:"content_type,omitempty"`
+	ContentLength int        `json:"content_length"`    // Bytes read, capped at the fingerprinting limit
+	ScanID        *uint      `json:"scan_id,omitempty"` // Last scan that found the file
+	DiscoveredAt  time.Time  `json:"discovered_at"`
+	LastSeenAt    *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// TechFingerprint is the full technology detection output for a URL from the last scan that fingerprinted
+// it, also when nothing was detected, to explain detections. Each URL is recorded once per subdomain.
+type TechFingerprint struct {
+	ID              uint      `json:"id"`
+	SubdomainID     uint      `json:"subdomain_id" gorm:"uniqueIndex:idx_tech_fingerprint"`
+	URL             string    `json:"url" gorm:"uniqueIndex:idx_tech_fingerprint"`
+	StatusCode      int       `json:"status_code"`
+	ContentType     string    `json:"content_type,omitempty"`
+	BodyBytes       int       `json:"body_bytes"`        // Bytes fingerprinted, capped at the fingerprinting limit
+	ResponseHeaders string    `json:"response_headers"`  // "Name: value" lines, matched by header and cookie fingerprints
+	Technologies    string    `json:"-"`                 // Text (JSON string) -> []scanner.FingerprintTechnology
+	ScanID          *uint     `json:"scan_id,omitempty"` // Last scan that fingerprinted the URL
+	FingerprintedAt time.Time `json:"fingerprinted_at"`
+}
+
 // --- Request/Response Structs for Handlers ---
 // (Moved from handlers package to avoid circular dependencies and redeclarations)
 
 // ScanStartRequest represents the request body for starting any scan.
 type ScanStartRequest struct {
-	RootDomainID   uint  `json:"root_domain_id" binding:"required"`
-	SubdomainID    *uint `json:"subdomain_id"`     // Optional: ID of the specific subdomain to scan
-	ScanTemplateID *uint `json:"scan_template_id"` // Optional: ID of the template to use
+	RootDomainID       uint     `json:"root_domain_id" binding:"required"`
+	SubdomainID        *uint    `json:"subdomain_id"`          // Optional: ID of the specific subdomain to scan
+	ScanTemplateID     *uint    `json:"scan_template_id"`      // Optional: ID of the template to use
+	FollowUpTemplateID *uint    `json:"follow_up_template_id"` // Optional: template for follow-up scans of newly discovered subdomains (root domain scans only)
+	Labels             []string `json:"labels"`                // Optional: free-form labels for this run, inherited by follow-up scans
+	Force              bool     `json:"force"`                 // Optional: start even if a scan of the same target is running or just finished (see SCAN_DEDUP_WINDOW_MINUTES)
+	SessionID          *uint    `json:"session_id"`            // Optional: recorded session of the domain's organization to scan authenticated
+
+	// Optional: tool options merged over the template's for this run only, e.g. {"katana": {"maxDepth": 5}}
+	Overrides map[string]map[string]interface{} `json:"overrides"`
+}
+
+// MultiDomainScanRequest is the body for starting a scan of several root domains at once.
+type MultiDomainScanRequest struct {
+	RootDomainIDs  []uint   `json:"root_domain_ids" binding:"required,min=1"`
+	ScanTemplateID uint     `json:"scan_template_id" binding:"required"`
+	Labels         []string `json:"labels"` // Optional: free-form labels for this run, inherited by the scans of each root domain
+	Force          bool     `json:"force"`  // Optional: also scan root domains that a scan is running on or just finished (see SCAN_DEDUP_WINDOW_MINUTES)
 }
 
 // ScanConfig holds parsed configuration from a ScanTemplate.
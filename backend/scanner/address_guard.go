@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"rewrite-go/config"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned when a connection to a non-public address is refused, see publicAddressControl.
+var ErrBlockedAddress = errors.New("connection to a non-public address refused")
+
+// cgnatRange is the shared address space of carrier-grade NAT (RFC 6598), internal to the provider
+// network but not covered by net.IP.IsPrivate.
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// blockedAddress reports whether requests made on behalf of API users must not connect to ip: anything but
+// a public unicast address, so loopback, private, CGNAT, link-local (cloud metadata) and unspecified
+// addresses. Nothing is blocked with ALLOW_INTERNAL_TARGETS, for deployments scanning internal networks.
+func blockedAddress(ip net.IP) bool {
+	if config.GetBool("ALLOW_INTERNAL_TARGETS", false) {
+		return false
+	}
+	return !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || cgnatRange.Contains(ip)
+}
+
+// publicAddressControl is a net.Dialer Control hook refusing connections to blocked addresses. It sees the
+// address actually dialed, after DNS resolution, so a host that resolves to an internal address only when
+// connected to (DNS rebinding) is refused too.
+func publicAddressControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if ip := net.ParseIP(host); ip == nil || blockedAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
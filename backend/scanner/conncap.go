@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"rewrite-go/config"
+	"sync"
+	"time"
+)
+
+// defaultMaxOutboundConnections caps the requests to scan targets in flight at once across all scans and
+// phases, overridable via the MAX_OUTBOUND_CONNECTIONS setting (0 disables the cap).
+const defaultMaxOutboundConnections = 50
+
+// outboundLimiter is the process-wide cap shared by tech detection, soft-404 calibration, probes and
+// screenshot navigation. Katana and httpx manage their own connections and are not covered.
+var outboundLimiter = &connLimiter{}
+
+// connLimiter is a counting semaphore sized by MAX_OUTBOUND_CONNECTIONS. The setting is read on every
+// acquire, so changes apply without a restart; slots held when the size changes are released into the
+// old semaphore, so the new cap is only exact once those requests finish.
+type connLimiter struct {
+	mu    sync.Mutex
+	limit int
+	slots chan struct{}
+}
+
+// acquire blocks until an outbound slot is free or ctx is done. The returned release func is safe to call more than once.
+func (l *connLimiter) acquire(ctx context.Context) (release func(), err error) {
+	limit := config.GetInt("MAX_OUTBOUND_CONNECTIONS", defaultMaxOutboundConnections)
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	if l.slots == nil || l.limit != limit {
+		l.slots = make(chan struct{}, limit)
+		l.limit = limit
+	}
+	slots := l.slots
+	l.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return sync.OnceFunc(func() { <-slots }), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limitedTransport is an http.RoundTripper holding an outboundLimiter slot from the start of each
+// request until its response body is closed. Requests first wait hostDelay after the previous request
+// to the same host (see hostLimiter).
+type limitedTransport struct {
+	base      http.RoundTripper
+	hostDelay time.Duration
+}
+
+// newLimitedTransport wraps base so its requests count against the shared outbound connection cap and
+// are spaced hostDelay apart per host (0 for no politeness delay). A nil base is scanTransport().
+func newLimitedTransport(base http.RoundTripper, hostDelay time.Duration) http.RoundTripper {
+	if base == nil {
+		base = scanTransport()
+	}
+	return &limitedTransport{base: base, hostDelay: hostDelay}
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Wait for the host before taking an outbound slot, so waiting requests don't block other hosts
+	if err := hostLimiter.wait(req.Context(), req.URL.Hostname(), t.hostDelay); err != nil {
+		return nil, err
+	}
+	release, err := outboundLimiter.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody releases an outbound slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
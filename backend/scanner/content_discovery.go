@@ -0,0 +1,218 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Content discovery defaults, overridable with the options of the "content_discovery" tool
+const (
+	defaultContentDiscoveryWordlist = "common-dirs"
+	defaultContentDiscoveryStatus   = "200,204,301,302,307,308,401" // 403 is left out: many hosts forbid every unknown path
+	maxContentDiscoveryPaths        = 20000                         // Paths requested on every host, extensions included
+)
+
+// contentDiscoverySettings are the paths the content discovery phase requests and the status codes it keeps.
+type contentDiscoverySettings struct {
+	Paths       []string
+	StatusCodes map[int]struct{}
+}
+
+// contentDiscoveryConfig reads the "content_discovery" tool from a template's URL scan config:
+//
+//	wordlist=common-dirs      bundled wordlist or file in WORDLIST_DIR with one path per line (see loadWordlist)
+//	extensions=php,bak,zip    every entry is also requested with each extension appended
+//	status=200,301,401,403    status codes or classes (e.g. 2xx) of the responses saved as endpoints
+//
+// A leading '/' is added to entries lacking one. Returns false if the tool is absent or disabled, or if its
+// wordlist cannot be read (CheckTemplateWordlists fails such scans at their start).
+func contentDiscoveryConfig(scanTemplate *models.ScanTemplate) (contentDiscoverySettings, bool) {
+	var section models.ScanSectionConfig
+	if scanTemplate.URLScanConfig == "" || json.Unmarshal([]byte(scanTemplate.URLScanConfig), &section) != nil {
+		return contentDiscoverySettings{}, false
+	}
+	toolCfg, ok := section.Tools["content_discovery"]
+	if !ok || !toolCfg.Enabled {
+		return contentDiscoverySettings{}, false
+	}
+	options := parseToolOptions(toolCfg.Options)
+	wordlistName := defaultContentDiscoveryWordlist
+	if raw, ok := options["wordlist"]; ok {
+		wordlistName = fmt.Sprint(raw)
+	}
+	entries, err := loadWordlist(wordlistName)
+	if err != nil {
+		log.Printf("Warning: Content discovery of template %d disabled: %v", scanTemplate.ID, err)
+		return contentDiscoverySettings{}, false
+	}
+	var extensions []string
+	if raw, ok := options["extensions"]; ok {
+		for _, ext := range strings.Split(fmt.Sprint(raw), ",") {
+			if ext = strings.TrimPrefix(strings.TrimSpace(ext), "."); ext != "" {
+				extensions = append(extensions, ext)
+			}
+		}
+	}
+	status := defaultContentDiscoveryStatus
+	if raw, ok := options["status"]; ok {
+		status = fmt.Sprint(raw)
+	}
+	settings := contentDiscoverySettings{StatusCodes: parseCaptureStatusCodes(status)}
+	if len(settings.StatusCodes) == 0 {
+		log.Printf("Warning: Template %d lists no valid content discovery status codes, keeping %s.", scanTemplate.ID, defaultContentDiscoveryStatus)
+		settings.StatusCodes = parseCaptureStatusCodes(defaultContentDiscoveryStatus)
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		p := strings.TrimSpace(entry)
+		if p != "" && !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		if p == "" || strings.HasPrefix(p, "//") || strings.ContainsAny(p, " \t#?") {
+			continue
+		}
+		candidates := []string{p}
+		if !strings.HasSuffix(p, "/") {
+			for _, ext := range extensions {
+				candidates = append(candidates, p+"."+ext)
+			}
+		}
+		for _, candidate := range candidates {
+			if !seen[candidate] {
+				seen[candidate] = true
+				settings.Paths = append(settings.Paths, candidate)
+			}
+		}
+	}
+	if len(settings.Paths) > maxContentDiscoveryPaths {
+		log.Printf("Warning: Template %d gives %d content discovery paths, requesting the first %d.", scanTemplate.ID, len(settings.Paths), maxContentDiscoveryPaths)
+		settings.Paths = settings.Paths[:maxContentDiscoveryPaths]
+	}
+	return settings, len(settings.Paths) > 0
+}
+
+// ExecuteContentDiscovery requests the paths of settings on every saved subdomain (hostname -> ID), over
+// https or, if the host doesn't answer it, http, and saves the responses with a kept status code as
+// endpoints like crawl results. Responses matching the host's soft-404 signature (see calibrateSoft404) and
+// empty success responses are dropped. Requests use the tech detection client and limits. Cancelling ctx
+// stops the requests; the paths found so far are saved. Returns the number of endpoints found.
+func ExecuteContentDiscovery(ctx context.Context, db *gorm.DB, rootDomain string, rootDomainID uint, scanID uint, subdomains map[string]uint, scanTemplate *models.ScanTemplate, settings contentDiscoverySettings) (int, error) {
+	workers := max(1, config.GetInt("TECH_DETECT_WORKERS", defaultTechDetectWorkers))
+	perHost := max(1, config.GetInt("TECH_DETECT_PER_HOST", defaultTechDetectPerHost))
+	rateLimitRetries := config.GetInt("RATE_LIMIT_RETRIES", defaultRateLimitRetries)
+	hostDelay := scanHostDelay(scanID)
+
+	hostnames := make([]string, 0, len(subdomains))
+	bases := make([]string, 0, len(subdomains)*2)
+	for hostname := range subdomains {
+		hostnames = append(hostnames, hostname)
+		bases = append(bases, "https://"+hostname, "http://"+hostname)
+	}
+	sort.Strings(hostnames)
+	signatures := calibrateSoft404(bases, techDetectTimeout, hostDelay)
+	log.Printf("Content discovery: requesting %d paths on %d subdomains (Scan ID: %d).", len(settings.Paths), len(hostnames), scanID)
+
+	httpClient := newTechDetectClient(workers*perHost, perHost, hostDelay)
+	defer httpClient.CloseIdleConnections()
+
+	existingSubdomains := &sync.Map{}
+	for hostname, id := range subdomains {
+		existingSubdomains.Store(hostname, id)
+	}
+	resultsChan := make(chan urlScanResult, 100)
+	var saveWg sync.WaitGroup
+	startURLSaveWorkers(db, rootDomain, rootDomainID, scanID, resultsChan, &saveWg, existingSubdomains, scanTemplate.ScreenshotEnabled, templateScreenshotCriteria(scanTemplate))
+
+	var mu sync.Mutex
+	found := 0
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(hostnames)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hostname := range work {
+				n := discoverHostContent(ctx, httpClient, hostname, scanID, settings, signatures, rateLimitRetries, resultsChan)
+				mu.Lock()
+				found += n
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, hostname := range hostnames {
+		select {
+		case work <- hostname:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	close(resultsChan)
+	saveWg.Wait()
+
+	log.Printf("Content discovery found %d endpoints on %d subdomains (Scan ID: %d).", found, len(hostnames), scanID)
+	if err := ctx.Err(); err != nil {
+		return found, fmt.Errorf("content discovery cancelled: %w", err)
+	}
+	return found, nil
+}
+
+// discoverHostContent requests the paths of settings on a host and sends the responses kept to results.
+// The scheme is https unless the first request over it fails; the host is given up on once neither
+// scheme answers. Returns the number of results sent.
+func discoverHostContent(ctx context.Context, client *http.Client, hostname string, scanID uint, settings contentDiscoverySettings, signatures map[string]soft404Signature, rateLimitRetries int, results chan<- urlScanResult) int {
+	schemes := []string{"https", "http"}
+	answered := false
+	found := 0
+	for i := 0; i < len(settings.Paths) && len(schemes) > 0 && ctx.Err() == nil; i++ {
+		p := settings.Paths[i]
+		base := schemes[0] + "://" + hostname
+		page, err := fetchTechPage(ctx, client, base+p, rateLimitRetries, nil)
+		if err != nil {
+			if !answered {
+				schemes = schemes[1:] // Try the other scheme, or give up on the host
+				i--
+			}
+			continue
+		}
+		answered = true
+		if _, keep := settings.StatusCodes[page.StatusCode]; !keep {
+			continue
+		}
+		if page.StatusCode >= 200 && page.StatusCode < 300 && len(page.Body) == 0 {
+			continue
+		}
+		if sig, calibrated := signatures[base]; calibrated && sig.matches(page.StatusCode, string(page.Body), p) {
+			continue
+		}
+		log.Printf("Content discovery: %s%s answered %d (Scan ID: %d)", base, p, page.StatusCode, scanID)
+		results <- urlScanResult{
+			Hostname: hostname,
+			FullURL:  base + p,
+			Endpoint: models.Endpoint{
+				Path:         p,
+				Method:       "GET",
+				StatusCode:   page.StatusCode,
+				ContentType:  page.Header.Get("Content-Type"),
+				DiscoveredAt: time.Now(),
+				ScanID:       &scanID,
+			},
+		}
+		found++
+	}
+	return found
+}
@@ -0,0 +1,337 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"rewrite-go/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	dnsLookupTimeout       = 5 * time.Second // Timeout for a single record lookup
+	defaultDNSWorkers      = 10              // Hostnames resolved in parallel
+	defaultDNSResolverPort = "53"
+)
+
+// dnsRecordNetworks maps the supported record types to the address family LookupIP expects.
+// Only address records are collected since Subdomain stores an IP address.
+var dnsRecordNetworks = map[string]string{
+	"A":    "ip4",
+	"AAAA": "ip6",
+}
+
+// dnsRecordTypeCodes are the numeric record types used in DoH JSON answers.
+var dnsRecordTypeCodes = map[string]int{
+	"A":    1,
+	"AAAA": 28,
+}
+
+// dnsResolverConfig describes how the DNS enrichment phase resolves hostnames.
+// It is parsed from the "dns" tool options of a template's subdomain scan config:
+//
+//	resolvers=10.0.0.2:53,1.1.1.1   plain DNS servers (port defaults to 53), tried in order
+//	doh=https://cloudflare-dns.com/dns-query   DNS-over-HTTPS endpoint (JSON API), takes precedence over resolvers
+//	recordTypes=A,AAAA              record types to collect (default A)
+//
+// Invalid entries are dropped with a warning; with nothing valid left the system resolver is used.
+type dnsResolverConfig struct {
+	Servers     []string
+	DoHURL      string
+	RecordTypes []string
+}
+
+// String describes the resolver for the scan metadata, e.g. "doh:https://..." or "dns:10.0.0.2:53".
+func (cfg dnsResolverConfig) String() string {
+	resolver := "system"
+	if cfg.DoHURL != "" {
+		resolver = "doh:" + cfg.DoHURL
+	} else if len(cfg.Servers) > 0 {
+		resolver = "dns:" + strings.Join(cfg.Servers, ",")
+	}
+	return resolver + " (" + strings.Join(cfg.RecordTypes, ",") + ")"
+}
+
+// dnsEnrichmentConfig reads the "dns" tool from a template's subdomain scan config.
+// Returns false if the tool is absent or disabled.
+func dnsEnrichmentConfig(scanTemplate *models.ScanTemplate) (dnsResolverConfig, bool) {
+	var section models.ScanSectionConfig
+	if scanTemplate.SubdomainScanConfig == "" || json.Unmarshal([]byte(scanTemplate.SubdomainScanConfig), &section) != nil {
+		return dnsResolverConfig{}, false
+	}
+	toolCfg, ok := section.Tools["dns"]
+	if !ok || !toolCfg.Enabled {
+		return dnsResolverConfig{}, false
+	}
+	return parseDNSResolverConfig(parseToolOptions(toolCfg.Options)), true
+}
+
+// parseDNSResolverConfig validates the dns tool options, dropping invalid entries.
+func parseDNSResolverConfig(options map[string]interface{}) dnsResolverConfig {
+	cfg := dnsResolverConfig{}
+
+	if raw, ok := options["resolvers"]; ok {
+		for _, entry := range strings.Split(fmt.Sprint(raw), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			addr, err := normalizeResolverAddr(entry)
+			if err != nil {
+				log.Printf("Warning: Ignoring DNS resolver '%s': %v", entry, err)
+				continue
+			}
+			cfg.Servers = append(cfg.Servers, addr)
+		}
+	}
+
+	if raw, ok := options["doh"]; ok {
+		dohURL := strings.TrimSpace(fmt.Sprint(raw))
+		parsed, err := url.Parse(dohURL)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			log.Printf("Warning: Ignoring DoH endpoint '%s': must be an https:// URL", dohURL)
+		} else {
+			cfg.DoHURL = dohURL
+		}
+	}
+
+	if raw, ok := options["recordTypes"]; ok {
+		for _, entry := range strings.Split(fmt.Sprint(raw), ",") {
+			recordType := strings.ToUpper(strings.TrimSpace(entry))
+			if _, supported := dnsRecordNetworks[recordType]; !supported {
+				log.Printf("Warning: Ignoring unsupported DNS record type '%s' (supported: A, AAAA)", entry)
+				continue
+			}
+			cfg.RecordTypes = append(cfg.RecordTypes, recordType)
+		}
+	}
+	if len(cfg.RecordTypes) == 0 {
+		cfg.RecordTypes = []string{"A"}
+	}
+
+	return cfg
+}
+
+// normalizeResolverAddr validates a resolver given as "ip" or "ip:port" and returns it as "ip:port".
+// Hostnames are rejected so that using a resolver never depends on another resolver.
+func normalizeResolverAddr(entry string) (string, error) {
+	host, port := entry, defaultDNSResolverPort
+	if h, p, err := net.SplitHostPort(entry); err == nil {
+		host, port = h, p
+	}
+	if net.ParseIP(host) == nil {
+		return "", errors.New("must be an IP address, optionally with a port")
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil || portNum < 1 || portNum > 65535 {
+		return "", fmt.Errorf("invalid port '%s'", port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// dnsTransportError marks a failure to reach the configured resolver, as opposed to a negative answer.
+// Only transport errors fall back to the system resolver, so split-horizon names never leak on NXDOMAIN.
+type dnsTransportError struct{ err error }
+
+func (e *dnsTransportError) Error() string { return e.err.Error() }
+
+// dnsEnricher resolves hostnames using a dnsResolverConfig.
+type dnsEnricher struct {
+	cfg        dnsResolverConfig
+	resolver   *net.Resolver // Custom servers, nil for the system resolver
+	httpClient *http.Client  // DoH only
+}
+
+func newDNSEnricher(cfg dnsResolverConfig) *dnsEnricher {
+	enricher := &dnsEnricher{cfg: cfg}
+	if cfg.DoHURL != "" {
+		enricher.httpClient = &http.Client{Timeout: dnsLookupTimeout}
+	} else if len(cfg.Servers) > 0 {
+		enricher.resolver = &net.Resolver{
+			PreferGo: true,
+			// Ignore the system-configured address and try each configured server in order
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				var lastErr error
+				for _, server := range cfg.Servers {
+					conn, err := dialer.DialContext(ctx, network, server)
+					if err == nil {
+						return conn, nil
+					}
+					lastErr = err
+				}
+				return nil, lastErr
+			},
+		}
+	}
+	return enricher
+}
+
+// resolve returns the addresses of hostname for the configured record types.
+func (e *dnsEnricher) resolve(hostname string) ([]string, error) {
+	var addresses []string
+	for _, recordType := range e.cfg.RecordTypes {
+		found, err := e.lookup(hostname, recordType)
+		var transportErr *dnsTransportError
+		if errors.As(err, &transportErr) && (e.httpClient != nil || e.resolver != nil) {
+			log.Printf("Warning: Resolver %s failed for %s (%v), falling back to system resolver", e.cfg, hostname, err)
+			found, err = lookupWith(net.DefaultResolver, hostname, recordType)
+		}
+		if err != nil {
+			continue // No records of this type
+		}
+		addresses = append(addresses, found...)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no %s records for %s", strings.Join(e.cfg.RecordTypes, "/"), hostname)
+	}
+	return addresses, nil
+}
+
+func (e *dnsEnricher) lookup(hostname, recordType string) ([]string, error) {
+	if e.httpClient != nil {
+		return e.lookupDoH(hostname, recordType)
+	}
+	if e.resolver != nil {
+		return lookupWith(e.resolver, hostname, recordType)
+	}
+	return lookupWith(net.DefaultResolver, hostname, recordType)
+}
+
+// lookupWith resolves one record type, reporting unreachable servers as dnsTransportError.
+func lookupWith(resolver *net.Resolver, hostname, recordType string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+	ips, err := resolver.LookupIP(ctx, dnsRecordNetworks[recordType], hostname)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && (dnsErr.IsNotFound || !(dnsErr.IsTimeout || dnsErr.IsTemporary)) {
+			return nil, err
+		}
+		return nil, &dnsTransportError{err: err}
+	}
+	addresses := make([]string, len(ips))
+	for i, ip := range ips {
+		addresses[i] = ip.String()
+	}
+	return addresses, nil
+}
+
+// lookupDoH resolves one record type using the DoH JSON API (application/dns-json).
+func (e *dnsEnricher) lookupDoH(hostname, recordType string) ([]string, error) {
+	query := url.Values{"name": {hostname}, "type": {recordType}}
+	req, err := http.NewRequest(http.MethodGet, e.cfg.DoHURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, &dnsTransportError{err: err}
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, &dnsTransportError{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &dnsTransportError{err: fmt.Errorf("DoH endpoint returned HTTP %d", resp.StatusCode)}
+	}
+
+	var answer struct {
+		Status int `json:"Status"`
+		Answer []struct {
+			Type int    `json:"type"`
+			Data string `json:"data"`
+		} `json:"Answer"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, &dnsTransportError{err: fmt.Errorf("invalid DoH response: %w", err)}
+	}
+	if answer.Status != 0 {
+		return nil, fmt.Errorf("DoH lookup of %s returned DNS status %d", hostname, answer.Status)
+	}
+
+	var addresses []string
+	for _, record := range answer.Answer {
+		// Answers may include the CNAME chain, keep only the requested address records
+		if record.Type == dnsRecordTypeCodes[recordType] && net.ParseIP(record.Data) != nil {
+			addresses = append(addresses, record.Data)
+		}
+	}
+	return addresses, nil
+}
+
+// enrichSubdomainIPs resolves the given subdomains (hostname -> ID) and stores their first address
+// in Subdomain.IPAddress. The resolver description is recorded on the scan. Returns the number resolved.
+func enrichSubdomainIPs(db *gorm.DB, scanID uint, subdomains map[string]uint, cfg dnsResolverConfig) int {
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Update("dns_resolver", cfg.String()).Error; err != nil {
+		log.Printf("Warning: Failed to record DNS resolver for scan %d: %v", scanID, err)
+	}
+
+	enricher := newDNSEnricher(cfg)
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	resolved := 0
+
+	for i := 0; i < defaultDNSWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hostname := range jobs {
+				addresses, err := enricher.resolve(hostname)
+				if err != nil {
+					continue
+				}
+				if err := db.Model(&models.Subdomain{}).Where("id = ?", subdomains[hostname]).Update("ip_address", addresses[0]).Error; err != nil {
+					log.Printf("Error saving IP address for %s (Scan ID: %d): %v", hostname, scanID, err)
+					continue
+				}
+				mu.Lock()
+				resolved++
+				mu.Unlock()
+			}
+		}()
+	}
+	for hostname := range subdomains {
+		jobs <- hostname
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Printf("DNS enrichment for scan %d resolved %d of %d subdomains using %s.", scanID, resolved, len(subdomains), cfg)
+	return resolved
+}
+
+// saveVerifiedAddresses stores the addresses httpx resolved while verifying the saved subdomains
+// (hostname -> ID) in Subdomain.IPAddress. DNS enrichment, if the template enables it, runs afterwards
+// and overwrites them with its own results.
+func saveVerifiedAddresses(db *gorm.DB, scanID uint, subdomains map[string]uint, addresses map[string]string) {
+	saved := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for hostname, address := range addresses {
+			id, ok := subdomains[hostname]
+			if !ok {
+				continue
+			}
+			if err := tx.Model(&models.Subdomain{}).Where("id = ?", id).Update("ip_address", address).Error; err != nil {
+				return err
+			}
+			saved++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving IP addresses resolved during verification (Scan ID: %d): %v", scanID, err)
+		return
+	}
+	log.Printf("Saved IP addresses of %d subdomains resolved during verification (Scan ID: %d).", saved, scanID)
+}
@@ -0,0 +1,61 @@
+package scanner
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// NormalizeEndpointPath returns the path stored for an endpoint, so that the same resource found by a crawl,
+// a refresh or an import is stored once. rawPath is an escaped path as in a URL, or a full URL whose path
+// is used. The result stays escaped, so it can be put back into a URL as is: it starts with a slash, has no
+// repeated slashes, has no trailing slash unless it is the root path, and its percent-encodings are upper
+// case. "/admin/" and "//admin" are both "/admin", and "/a%2fb" is "/a%2Fb". Escapes are never decoded, as
+// "/a%2Fb" and "/a/b" are different resources. Bytes a URL path can't hold, such as spaces, are escaped.
+func NormalizeEndpointPath(rawPath string) string {
+	if parsed, err := url.Parse(rawPath); err == nil && parsed.IsAbs() {
+		rawPath = parsed.EscapedPath()
+	}
+	var b strings.Builder
+	b.WriteByte('/')
+	afterSlash := true // Repeated slashes are dropped
+	for i := 0; i < len(rawPath); i++ {
+		c := rawPath[i]
+		switch {
+		case c == '/':
+			if afterSlash {
+				continue
+			}
+			b.WriteByte(c)
+		case c == '%' && i+2 < len(rawPath) && isHexDigit(rawPath[i+1]) && isHexDigit(rawPath[i+2]):
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(rawPath[i+1 : i+3]))
+			i += 2
+		case isPathByte(c):
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+		afterSlash = c == '/'
+	}
+	path := b.String()
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// isPathByte reports whether c may appear unescaped in a URL path: unreserved characters, sub-delimiters,
+// ':' and '@' (RFC 3986 pchar).
+func isPathByte(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~!$&'()*+,;=:@", c) >= 0
+}
+
+// isHexDigit reports whether c is a hexadecimal digit.
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,55 @@
+package scanner
+
+import "testing"
+
+func TestNormalizeEndpointPath(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"root", "/", "/"},
+		{"empty", "", "/"},
+		{"plain", "/admin", "/admin"},
+		{"missing leading slash", "admin", "/admin"},
+
+		{"trailing slash", "/admin/", "/admin"},
+		{"trailing slashes", "/admin///", "/admin"},
+		{"root with slashes", "///", "/"},
+
+		{"leading double slash", "//admin", "/admin"},
+		{"inner double slash", "/a//b///c", "/a/b/c"},
+
+		{"escaped space kept", "/a%20b", "/a%20b"},
+		{"raw space escaped", "/a b", "/a%20b"},
+		{"escape case", "/a%2fb%c3%a9", "/a%2Fb%C3%A9"},
+		{"escaped slash not decoded", "/a%2Fb", "/a%2Fb"},
+		{"escaped slash differs from slash", "/a/b", "/a/b"},
+		{"escaped letter not decoded", "/%61dmin", "/%61dmin"},
+		{"invalid escape", "/100%", "/100%25"},
+		{"invalid escape digits", "/a%zz", "/a%25zz"},
+		{"raw non-ascii escaped", "/café", "/caf%C3%A9"},
+		{"sub-delimiters kept", "/a;b=c,d:e@f", "/a;b=c,d:e@f"},
+		{"query character escaped", "/a?b", "/a%3Fb"},
+
+		{"full URL", "https://example.com/a%2fb/", "/a%2Fb"},
+		{"full URL without path", "https://example.com", "/"},
+		{"full URL with query", "https://example.com/a/?x=1", "/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeEndpointPath(tt.in); got != tt.want {
+				t.Errorf("NormalizeEndpointPath(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEndpointPathIdempotent(t *testing.T) {
+	for _, in := range []string{"/a b/", "//x%2f//y", "/100%", "/café/", "https://example.com//a%2Fb"} {
+		once := NormalizeEndpointPath(in)
+		if twice := NormalizeEndpointPath(once); twice != once {
+			t.Errorf("NormalizeEndpointPath is not idempotent for %q: %q, then %q", in, once, twice)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"log"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultFollowUpMaxScans = 50 // Maximum follow-up scans a single scan may enqueue, overridable via FOLLOW_UP_MAX_SCANS
+
+// enqueueFollowUpScans creates subdomain-scoped scans, using the scan's FollowUpTemplateID, for the active
+// subdomains first discovered by the scan, then runs them one after another in the background.
+// Only root domain scans that were not themselves enqueued as follow-ups chain, so a follow-up can never
+// trigger further follow-ups.
+func enqueueFollowUpScans(db *gorm.DB, scanID uint, rootDomainID uint, targetHost string) {
+	var scan models.Scan
+	if err := db.Select("id", "scan_type", "started_at", "follow_up_template_id", "parent_scan_id").First(&scan, scanID).Error; err != nil {
+		log.Printf("Error loading scan %d for follow-up scans: %v", scanID, err)
+		return
+	}
+	if scan.FollowUpTemplateID == nil {
+		return
+	}
+	if scan.ScanType != "root_domain" || scan.ParentScanID != nil {
+		log.Printf("Skipping follow-up scans for scan %d: only top-level root domain scans may chain", scanID)
+		return
+	}
+	var enqueued int64
+	if err := db.Model(&models.Scan{}).Where("parent_scan_id = ?", scanID).Count(&enqueued).Error; err != nil {
+		log.Printf("Error checking for follow-up scans of scan %d: %v", scanID, err)
+		return
+	}
+	if enqueued > 0 {
+		log.Printf("Skipping follow-up scans for scan %d: an earlier run already enqueued %d", scanID, enqueued) // Resumed scan
+		return
+	}
+
+	var followUpTemplate models.ScanTemplate
+	if err := db.First(&followUpTemplate, *scan.FollowUpTemplateID).Error; err != nil {
+		log.Printf("Error loading follow-up template %d for scan %d: %v", *scan.FollowUpTemplateID, scanID, err)
+		return
+	}
+
+	// discovered_at is kept as first seen and a resumed scan keeps its started_at, so this selects only
+	// subdomains new to this scan, whichever scan_id they ended up with
+	var newSubdomains []models.Subdomain
+	if err := db.Where("root_domain_id = ? AND discovered_at >= ? AND is_active = ? AND hostname <> ?", rootDomainID, scan.StartedAt, true, targetHost).
+		Order("hostname").Find(&newSubdomains).Error; err != nil {
+		log.Printf("Error fetching newly discovered subdomains for follow-up scans (Scan ID: %d): %v", scanID, err)
+		return
+	}
+	if len(newSubdomains) == 0 {
+		log.Printf("No newly discovered subdomains to follow up for scan %d.", scanID)
+		return
+	}
+
+	maxScans := config.GetInt("FOLLOW_UP_MAX_SCANS", defaultFollowUpMaxScans)
+	if maxScans > 0 && len(newSubdomains) > maxScans {
+		log.Printf("Limiting follow-up scans for scan %d to %d of %d new subdomains (FOLLOW_UP_MAX_SCANS)", scanID, maxScans, len(newSubdomains))
+		newSubdomains = newSubdomains[:maxScans]
+	}
+
+	// Create all records up front so the queued scans are visible as pending
+	followUps := make([]models.Scan, 0, len(newSubdomains))
+	hostnames := make(map[uint]string, len(newSubdomains))
+	for _, sub := range newSubdomains {
+		subID := sub.ID
+		followUp := models.Scan{
+			RootDomainID:   rootDomainID,
+			SubdomainID:    &subID,
+			ScanTemplateID: scan.FollowUpTemplateID,
+			ParentScanID:   &scanID,
+			Labels:         scan.Labels,
+			SessionID:      scan.SessionID, // Follow-ups of an authenticated scan stay authenticated
+			ScanType:       "subdomain",
+			Status:         "pending",
+			StartedAt:      time.Now(),
+		}
+		if err := db.Create(&followUp).Error; err != nil {
+			log.Printf("Error creating follow-up scan for %s (Scan ID: %d): %v", sub.Hostname, scanID, err)
+			continue
+		}
+		followUps = append(followUps, followUp)
+		hostnames[followUp.ID] = sub.Hostname
+	}
+	log.Printf("Enqueued %d follow-up scans for scan %d using template %d.", len(followUps), scanID, followUpTemplate.ID)
+
+	// Run sequentially so a large discovery does not start dozens of crawls at once
+	go func() {
+		for _, followUp := range followUps {
+			var current models.Scan
+			if err := db.Select("status").First(&current, followUp.ID).Error; err != nil || current.Status != "pending" {
+				log.Printf("Skipping follow-up scan %d (no longer pending)", followUp.ID)
+				continue
+			}
+			ExecuteSubdomainScan(hostnames[followUp.ID], "subdomain", rootDomainID, followUp.ID, &followUpTemplate)
+		}
+		log.Printf("Follow-up scans for scan %d finished.", scanID)
+	}()
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"log"
+	"net/url"
+	"regexp"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// deniedHostSuffixes returns the HOSTNAME_DENY_SUFFIXES setting: lowercase suffixes without leading dots or
+// wildcards, e.g. "local", "internal" or "staging.example.com".
+func deniedHostSuffixes() []string {
+	var suffixes []string
+	for _, entry := range strings.Split(config.Get("HOSTNAME_DENY_SUFFIXES"), ",") {
+		suffix := strings.Trim(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(entry)), "*"), ".")
+		if suffix != "" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	return suffixes
+}
+
+// isDeniedHostname reports whether hostname is one of the suffixes or below one of them. Matching is per
+// label, so the suffix "local" denies "printer.local" but not "glocal.com".
+func isDeniedHostname(hostname string, suffixes []string) bool {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	for _, suffix := range suffixes {
+		if hostname == suffix || strings.HasSuffix(hostname, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// outOfScopePatterns returns the out-of-scope rules of the organization owning a root domain, see
+// models.ScopeRule.
+func outOfScopePatterns(db *gorm.DB, rootDomainID uint) []string {
+	var patterns []string
+	if err := db.Model(&models.ScopeRule{}).
+		Where("in_scope = ? AND organization_id = (SELECT organization_id FROM root_domains WHERE id = ?)", false, rootDomainID).
+		Pluck("pattern", &patterns).Error; err != nil {
+		log.Printf("Warning: Could not load the out-of-scope rules of root domain %d: %v", rootDomainID, err)
+	}
+	return patterns
+}
+
+// isOutOfScope reports whether hostname matches one of the out-of-scope patterns: "*.example.com" matches
+// the hosts below example.com, other patterns the host itself.
+func isOutOfScope(hostname string, patterns []string) bool {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	for _, pattern := range patterns {
+		if parent, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(hostname, "."+parent) {
+				return true
+			}
+		} else if hostname == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// dropOutOfScopeURLs returns the URLs whose host does not match one of the out-of-scope patterns, logging
+// how many were dropped before what. Unparseable URLs are kept.
+func dropOutOfScopeURLs(urls []string, patterns []string, what string, scanID uint) []string {
+	if len(patterns) == 0 {
+		return urls
+	}
+	kept := make([]string, 0, len(urls))
+	for _, rawURL := range urls {
+		if parsed, err := url.Parse(rawURL); err == nil && isOutOfScope(parsed.Hostname(), patterns) {
+			continue
+		}
+		kept = append(kept, rawURL)
+	}
+	if dropped := len(urls) - len(kept); dropped > 0 {
+		log.Printf("Skipping %d %s of scan %d on hosts matching an out-of-scope rule of the organization.", dropped, what, scanID)
+	}
+	return kept
+}
+
+// dropOutOfScopeHosts removes the hostnames matching one of the out-of-scope patterns from a map keyed by
+// hostname, so that they are not requested.
+func dropOutOfScopeHosts[V any](subdomains map[string]V, patterns []string, scanID uint) {
+	for hostname := range subdomains {
+		if isOutOfScope(hostname, patterns) {
+			log.Printf("Skipping %s in scan %d: matches an out-of-scope rule of the organization", hostname, scanID)
+			delete(subdomains, hostname)
+		}
+	}
+}
+
+// katanaOutOfScopeRegexes translates out-of-scope patterns into katana OutOfScope regexes, which katana
+// matches against every URL before requesting it.
+func katanaOutOfScopeRegexes(patterns []string) []string {
+	regexes := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		host := regexp.QuoteMeta(pattern)
+		if parent, ok := strings.CutPrefix(pattern, "*."); ok {
+			host = `[^/?#@:]+\.` + regexp.QuoteMeta(parent)
+		}
+		regexes = append(regexes, `(?i)^[a-z][a-z0-9+.-]*://([^/?#@]*@)?`+host+`\.?(:[0-9]+)?([/?#]|$)`)
+	}
+	return regexes
+}
@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"context"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxHostRequestDelayMs bounds the politeness delay of the HOST_REQUEST_DELAY_MS setting and templates.
+const MaxHostRequestDelayMs = 60000
+
+// hostLimiter spaces requests to the same hostname across all scans and phases: tech detection, soft-404
+// calibration, probes and screenshot navigation wait on it, katana's requests are charged to it (see
+// ExecuteURLScan). Like outboundLimiter it is process-wide, so concurrent scans of a host share one budget.
+var hostLimiter = &hostRateLimiter{next: make(map[string]time.Time)}
+
+// hostRateLimiter is a token bucket per hostname holding a single token, refilled one delay after it was
+// taken. The delay is given per request, so scans with different politeness settings can share a host's
+// bucket; each request waits at least its own delay after the previous one.
+type hostRateLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time // When the token of a host is available again
+}
+
+// reserve takes the token of host and returns when it may be used.
+func (l *hostRateLimiter) reserve(host string, delay time.Duration) time.Time {
+	host = strings.ToLower(host)
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.next) > 10000 {
+		for h, at := range l.next {
+			if at.Before(now) {
+				delete(l.next, h)
+			}
+		}
+	}
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(delay)
+	return at
+}
+
+// wait blocks until a request to host may be sent, delay after the previous one, or ctx is done.
+// A delay of 0 disables the wait.
+func (l *hostRateLimiter) wait(ctx context.Context, host string, delay time.Duration) error {
+	if delay <= 0 || host == "" {
+		return nil
+	}
+	wait := time.Until(l.reserve(host, delay))
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// charge records a request to host that was sent without waiting, delaying the next ones.
+func (l *hostRateLimiter) charge(host string, delay time.Duration) {
+	if delay > 0 && host != "" {
+		l.reserve(host, delay)
+	}
+}
+
+// scanHostDelays holds the politeness delay of running scans by scan ID, see registerScanHostDelay.
+var scanHostDelays sync.Map
+
+// defaultHostDelay returns the HOST_REQUEST_DELAY_MS setting.
+func defaultHostDelay() time.Duration {
+	ms := config.GetInt("HOST_REQUEST_DELAY_MS", 0)
+	return time.Duration(max(0, min(ms, MaxHostRequestDelayMs))) * time.Millisecond
+}
+
+// registerScanHostDelay records the delay between requests to the same host for a scan, see
+// TemplateHostDelay. The returned func unregisters it.
+func registerScanHostDelay(scanID uint, scanTemplate *models.ScanTemplate) (time.Duration, func()) {
+	delay := TemplateHostDelay(scanTemplate)
+	scanHostDelays.Store(scanID, delay)
+	return delay, func() { scanHostDelays.Delete(scanID) }
+}
+
+// scanHostDelay returns the politeness delay of a scan, or HOST_REQUEST_DELAY_MS for scans not started
+// by ExecuteSubdomainScan (e.g. screenshot batches).
+func scanHostDelay(scanID uint) time.Duration {
+	if delay, ok := scanHostDelays.Load(scanID); ok {
+		return delay.(time.Duration)
+	}
+	return defaultHostDelay()
+}
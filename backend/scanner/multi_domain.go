@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rewrite-go/config"
+	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/models"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+const defaultMultiDomainConcurrency = 2 // Root domains a multi-domain scan discovers at once, overridable via MULTI_DOMAIN_SCAN_CONCURRENCY
+
+// MultiDomainTarget is a root domain of a multi-domain scan with the scan record that runs it.
+type MultiDomainTarget struct {
+	RootDomainID uint   `json:"root_domain_id"`
+	Domain       string `json:"domain"`
+	ScanID       uint   `json:"scan_id"` // root_domain scan with the multi-domain scan as its parent
+}
+
+// ExecuteMultiDomainScan runs the root domain scans of a multi-domain scan, up to
+// MULTI_DOMAIN_SCAN_CONCURRENCY at once, and summarizes what each found on the multi-domain scan's record.
+// Cancelling the multi-domain scan cancels the scans of its root domains.
+func ExecuteMultiDomainScan(scanID uint, targets []MultiDomainTarget, scanTemplate *models.ScanTemplate) {
+	db := database.GetDB()
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	defer jobCancel()
+	job := jobs.StartScan(scanID, fmt.Sprintf("multi_domain scan of %d domains", len(targets)), jobCancel)
+	defer finishScanJob(db, job, scanID)
+
+	if !updateScanStatus(db, scanID, "running") {
+		log.Printf("Scan %d is no longer pending (cancelled?), not starting it.", scanID)
+		for _, target := range targets {
+			CancelScan(target.ScanID)
+		}
+		return
+	}
+	concurrency := max(1, config.GetInt("MULTI_DOMAIN_SCAN_CONCURRENCY", defaultMultiDomainConcurrency))
+	log.Printf("Starting multi-domain scan %d of %d domains (%d at once).", scanID, len(targets), concurrency)
+
+	// A cancelled multi-domain scan takes the scans of its root domains with it
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-jobCtx.Done():
+			select {
+			case <-done:
+				return // Finished, the context is being released
+			default:
+			}
+			for _, target := range targets {
+				CancelScan(target.ScanID) // No-op for the ones already finished
+			}
+		case <-done:
+		}
+	}()
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-jobCtx.Done():
+		}
+		if jobCtx.Err() != nil {
+			break
+		}
+		job.SetProgress(i, len(targets))
+		wg.Add(1)
+		go func(target MultiDomainTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ExecuteSubdomainScan(target.Domain, "root_domain", target.RootDomainID, target.ScanID, scanTemplate)
+		}(target)
+	}
+	wg.Wait()
+	job.SetProgress(len(targets), len(targets))
+
+	summary, failed := summarizeMultiDomainScan(db, targets)
+	if jobCtx.Err() != nil {
+		log.Printf("Multi-domain scan %d was cancelled.", scanID)
+		return
+	}
+	finalStatus := "completed"
+	if failed == len(targets) {
+		finalStatus = "failed"
+	}
+	updateScanStatus(db, scanID, finalStatus, summary)
+	log.Printf("Multi-domain scan %d finished: %s", scanID, summary)
+}
+
+// summarizeMultiDomainScan describes the outcome of each root domain scan of a multi-domain scan and
+// returns the number of them that failed.
+func summarizeMultiDomainScan(db *gorm.DB, targets []MultiDomainTarget) (string, int) {
+	parts := make([]string, 0, len(targets))
+	failed := 0
+	for _, target := range targets {
+		var scan models.Scan
+		if err := db.Select("status", "started_at").First(&scan, target.ScanID).Error; err != nil {
+			parts = append(parts, fmt.Sprintf("%s: unknown (%v)", target.Domain, err))
+			failed++
+			continue
+		}
+		if scan.Status == "failed" {
+			failed++
+		}
+		// Assets first discovered by the scan, like recordScanMetrics counts them
+		var subdomains, endpoints int64
+		db.Model(&models.Subdomain{}).Where("scan_id = ? AND discovered_at >= ?", target.ScanID, scan.StartedAt).Count(&subdomains)
+		db.Model(&models.Endpoint{}).Where("scan_id = ? AND discovered_at >= ?", target.ScanID, scan.StartedAt).Count(&endpoints)
+		parts = append(parts, fmt.Sprintf("%s: %d new subdomains, %d new endpoints (scan %d %s)", target.Domain, subdomains, endpoints, target.ScanID, scan.Status))
+	}
+	return fmt.Sprintf("Scanned %d domains, %d failed. %s", len(targets), failed, strings.Join(parts, "; ")), failed
+}
@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"encoding/json"
+	"log"
+	"rewrite-go/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scan phases timed by ExecuteSubdomainScan, see GET /api/scans/:id/timing
+const (
+	PhaseExistingScreenshots = "existing_screenshots" // Screenshots of known assets before discovery
+	PhaseDiscovery           = "discovery"            // Subfinder enumeration
+	PhaseVerification        = "verification"         // httpx verification, including names from TLS certificates
+	PhaseSave                = "save"                 // Saving the active subdomains
+	PhaseDNS                 = "dns"                  // DNS enrichment
+	PhaseTLS                 = "tls"                  // Certificate checks of the saved subdomains, with TLS_VERIFY
+	PhaseSensitiveFiles      = "sensitive_files"      // Probing the saved subdomains for sensitive files
+	PhaseScreenshots         = "screenshots"          // Screenshots of the saved subdomains
+	PhaseURLScan             = "url_scan"             // Crawl or known endpoint refresh, including saving the results
+	PhaseContentDiscovery    = "content_discovery"    // Requesting wordlist paths on the saved subdomains
+	PhaseTech                = "tech"                 // Technology detection
+	PhaseScreenshotRetry     = "screenshot_retry"     // Retry of failed screenshots
+)
+
+// phaseTimer records the durations of a scan's phases. Each finished phase is saved right away, so a
+// running scan shows the phases it went through so far.
+type phaseTimer struct {
+	db      *gorm.DB
+	scanID  uint
+	timings []models.ScanPhaseTiming
+	current string
+	started time.Time
+}
+
+// newPhaseTimer returns a timer for a scan with no phase running. A resumed scan keeps the timings of its
+// earlier runs.
+func newPhaseTimer(db *gorm.DB, scanID uint) *phaseTimer {
+	t := &phaseTimer{db: db, scanID: scanID}
+	var scan models.Scan
+	if err := db.Select("phase_timings").First(&scan, scanID).Error; err == nil && scan.PhaseTimings != "" {
+		if err := json.Unmarshal([]byte(scan.PhaseTimings), &t.timings); err != nil {
+			log.Printf("Warning: Could not decode the phase timings of scan %d, starting over: %v", scanID, err)
+			t.timings = nil
+		}
+	}
+	return t
+}
+
+// start ends the running phase, if any, and starts the given one.
+func (t *phaseTimer) start(phase string) {
+	t.stop()
+	t.current, t.started = phase, time.Now()
+}
+
+// stop ends the running phase, if any, and saves the timings.
+func (t *phaseTimer) stop() {
+	if t.current == "" {
+		return
+	}
+	t.timings = append(t.timings, models.ScanPhaseTiming{
+		Phase:      t.current,
+		StartedAt:  t.started,
+		DurationMs: time.Since(t.started).Milliseconds(),
+	})
+	t.current = ""
+
+	data, err := json.Marshal(t.timings)
+	if err != nil {
+		log.Printf("Error marshalling phase timings for scan %d: %v", t.scanID, err)
+		return
+	}
+	if err := t.db.Model(&models.Scan{}).Where("id = ?", t.scanID).Update("phase_timings", string(data)).Error; err != nil {
+		log.Printf("Error saving phase timings for scan %d: %v", t.scanID, err)
+	}
+}
@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/url"
+	"regexp"
+	"rewrite-go/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	wappalyzergo "github.com/projectdiscovery/wappalyzergo"
+)
+
+// ProbeResult is the outcome of probing a single URL, see Probe.
+type ProbeResult struct {
+	Input            string   `json:"input"`
+	URL              string   `json:"url"` // URL that answered (with the scheme tried for bare hosts)
+	Alive            bool     `json:"alive"`
+	StatusCode       int      `json:"status_code,omitempty"`
+	Title            string   `json:"title,omitempty"`
+	ContentType      string   `json:"content_type,omitempty"`
+	ContentLength    int      `json:"content_length"` // Bytes read, capped at the fingerprinting limit
+	Server           string   `json:"server,omitempty"`
+	RedirectLocation string   `json:"redirect_location,omitempty"` // Redirects are reported, not followed
+	ResponseTimeMs   int64    `json:"response_time_ms"`
+	Technologies     []string `json:"technologies"`
+	Error            string   `json:"error,omitempty"` // Why the target is not alive
+}
+
+var (
+	// ErrInvalidProbeTarget is returned by Probe for input that is not an http(s) URL or hostname.
+	ErrInvalidProbeTarget = errors.New("target must be an http(s) URL or a hostname")
+
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+	// The fingerprint database is loaded once and shared by all probes
+	probeWappalyzerOnce sync.Once
+	probeWappalyzer     *wappalyzergo.Wappalyze
+	probeWappalyzerErr  error
+)
+
+// Probe checks whether a URL is alive and fingerprints it, using the same fetch as technology detection.
+// Nothing is stored. A bare host is tried over https first, then http. An unreachable target is not an
+// error: the result reports Alive false with the reason, also for hosts resolving to non-public addresses
+// (see publicAddressControl).
+func Probe(ctx context.Context, target string) (*ProbeResult, error) {
+	target = strings.TrimSpace(target)
+	candidates, err := probeCandidates(target)
+	if err != nil {
+		return nil, err
+	}
+
+	probeWappalyzerOnce.Do(func() {
+		probeWappalyzer, probeWappalyzerErr = wappalyzergo.New()
+	})
+	if probeWappalyzerErr != nil {
+		return nil, fmt.Errorf("failed to create wappalyzer client: %w", probeWappalyzerErr)
+	}
+
+	// Targets are chosen by API users, so only public addresses are dialed. The check runs on the resolved
+	// address of each connection; a proxy would be the address dialed instead of the target, so none is used.
+	transport := techDetectTransport(1, 1)
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: publicAddressControl}).DialContext
+	client := techDetectClient(transport, defaultHostDelay())
+	defer client.CloseIdleConnections()
+	retries := config.GetInt("RATE_LIMIT_RETRIES", defaultRateLimitRetries)
+
+	result := &ProbeResult{Input: target, Technologies: []string{}}
+	for _, candidate := range candidates {
+		result.URL = candidate
+		started := time.Now()
+		page, err := fetchTechPage(ctx, client, candidate, retries, nil)
+		result.ResponseTimeMs = time.Since(started).Milliseconds()
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		result.Alive = true
+		result.Error = ""
+		result.StatusCode = page.StatusCode
+		result.ContentType = page.Header.Get("Content-Type")
+		result.ContentLength = len(page.Body)
+		result.Server = page.Header.Get("Server")
+		result.RedirectLocation = page.Header.Get("Location")
+		if mediaType, _, err := mime.ParseMediaType(result.ContentType); err != nil || htmlMediaTypes[mediaType] {
+			result.Title = extractTitle(page.Body)
+		}
+		for tech := range probeWappalyzer.Fingerprint(page.Header, page.Body) {
+			result.Technologies = append(result.Technologies, tech)
+		}
+		sort.Strings(result.Technologies)
+		break
+	}
+	return result, nil
+}
+
+// probeCandidates returns the URLs to try for a probe target: the URL itself, or https and http for a bare host.
+func probeCandidates(target string) ([]string, error) {
+	if target == "" {
+		return nil, ErrInvalidProbeTarget
+	}
+	if strings.Contains(target, "://") {
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+			return nil, ErrInvalidProbeTarget
+		}
+		return []string{parsed.String()}, nil
+	}
+	parsed, err := url.Parse("https://" + target)
+	if err != nil || parsed.Hostname() == "" || strings.ContainsAny(parsed.Hostname(), " /") {
+		return nil, ErrInvalidProbeTarget
+	}
+	return []string{parsed.String(), "http://" + strings.TrimPrefix(parsed.String(), "https://")}, nil
+}
+
+// extractTitle returns the whitespace-normalized <title> of an HTML document, or "" if it has none.
+func extractTitle(body []byte) string {
+	match := titlePattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+}
@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff settings for HTTP 429 responses from the targets kasm requests itself (tech detection, content
+// discovery, sensitive files, probes). Passive sources such as crt.sh are queried by subfinder with its own
+// HTTP client, which kasm can't wrap; their errors are reported in the scan summary instead (see
+// subfinderSourceIssues). The retry count is overridable via the RATE_LIMIT_RETRIES setting.
+const (
+	defaultRateLimitRetries = 3
+	rateLimitBaseDelay      = 2 * time.Second
+	rateLimitMaxDelay       = 60 * time.Second
+)
+
+// doWithRateLimitBackoff sends a body-less request and retries it with exponential backoff
+// while the server answers 429 Too Many Requests. A Retry-After header (in seconds) is
+// honoured when present. The last response is returned if all retries are exhausted.
+func doWithRateLimitBackoff(client *http.Client, req *http.Request, maxRetries int) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req.Clone(req.Context()))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRetries {
+			return resp, nil
+		}
+
+		delay := rateLimitBaseDelay << attempt
+		if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		if delay > rateLimitMaxDelay {
+			delay = rateLimitMaxDelay
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // Drain so the connection can be reused
+		resp.Body.Close()
+
+		log.Printf("Rate limited (429) by %s, retrying in %s (attempt %d/%d)", req.URL.Host, delay, attempt+1, maxRetries)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	appconfig "rewrite-go/config"
+	"rewrite-go/database"
+	"rewrite-go/models"
+	"sync"
+	"time"
+)
+
+// URL phase modes, selected with the "mode" option of the katana tool config
+const (
+	URLScanModeCrawl = "crawl" // Crawl from the seed URLs with katana
+	URLScanModeKnown = "known" // Re-request the endpoints already known instead of crawling, see RefreshKnownEndpoints
+)
+
+// urlScanModes are the modes the URL phase accepts.
+var urlScanModes = []string{URLScanModeCrawl, URLScanModeKnown}
+
+// knownEndpoint is a stored endpoint to re-request.
+type knownEndpoint struct {
+	Hostname string
+	Path     string
+	Method   string
+}
+
+// RefreshKnownEndpoints re-requests the known GET and HEAD endpoints of a root domain, or of the target
+// subdomain if targetHost is not the root domain, and saves the fresh status codes and content types like
+// crawl results: changes are recorded in changed_at, and captures and screenshots follow the usual settings.
+// Other methods are not replayed, as their requests may change state. The scheme an endpoint was found
+// with is not stored, so https is tried first, then http. Unreachable endpoints keep their last response.
+// The katana options concurrency, timeout and bodyReadSize apply. Returns the number of endpoints refreshed.
+func RefreshKnownEndpoints(ctx context.Context, targetHost string, rootDomain string, rootDomainID uint, scanID uint, existingSubdomains *sync.Map, scanTemplate *models.ScanTemplate, config map[string]interface{}) (int, error) {
+	db := database.GetDB()
+	query := db.Table("endpoints e").
+		Select("DISTINCT s.hostname, e.path, e.method").
+		Joins("JOIN subdomains s ON s.id = e.subdomain_id").
+		Where("s.root_domain_id = ? AND e.method IN ?", rootDomainID, []string{"GET", "HEAD"})
+	if targetHost != rootDomain {
+		query = query.Where("s.hostname = ?", targetHost)
+	}
+	var endpoints []knownEndpoint
+	if err := query.Order("s.hostname, e.path").Scan(&endpoints).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch known endpoints: %w", err)
+	}
+	if outOfScope := outOfScopePatterns(db, rootDomainID); len(outOfScope) > 0 {
+		inScope := endpoints[:0]
+		for _, ep := range endpoints {
+			if !isOutOfScope(ep.Hostname, outOfScope) {
+				inScope = append(inScope, ep)
+			}
+		}
+		endpoints = inScope
+	}
+	if len(endpoints) == 0 {
+		log.Printf("No known endpoints to refresh for scan %d.", scanID)
+		return 0, nil
+	}
+
+	settings := resolveKatanaSettings(config)
+	concurrency := max(1, settings.Concurrency)
+	timeout, bodyReadSize := settings.Timeout, settings.BodyReadSize
+	captureStatusCodes := parseCaptureStatusCodes(appconfig.Get("CAPTURE_STATUS_CODES"))
+	log.Printf("Refreshing %d known endpoints for scan %d (Concurrency: %d, Timeout: %ds).", len(endpoints), scanID, concurrency, timeout)
+
+	// Redirects are not followed, so each endpoint gets its own status code as katana would record it
+	client := &http.Client{
+		Timeout:   time.Duration(timeout) * time.Second,
+		Transport: newLimitedTransport(nil, scanHostDelay(scanID)),
+		Jar:       scanSession(scanID).cookieJar(), // Session cookies of authenticated scans, if any
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resultsChan := make(chan urlScanResult, 100)
+	var saveWg sync.WaitGroup
+	startURLSaveWorkers(db, rootDomain, rootDomainID, scanID, resultsChan, &saveWg, existingSubdomains, scanTemplate.ScreenshotEnabled, templateScreenshotCriteria(scanTemplate))
+
+	work := make(chan knownEndpoint)
+	var workers sync.WaitGroup
+	var mu sync.Mutex
+	refreshed := 0
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for ep := range work {
+				res, ok := refreshEndpoint(ctx, client, ep, scanID, bodyReadSize, captureStatusCodes)
+				if !ok {
+					continue
+				}
+				resultsChan <- res
+				mu.Lock()
+				refreshed++
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, ep := range endpoints {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- ep
+	}
+	close(work)
+	workers.Wait()
+	close(resultsChan)
+	saveWg.Wait()
+
+	log.Printf("Refreshed %d of %d known endpoints for scan %d.", refreshed, len(endpoints), scanID)
+	return refreshed, ctx.Err()
+}
+
+// refreshEndpoint requests a known endpoint over https, falling back to http, and returns the response as
+// a URL scan result. Returns false if neither scheme answered.
+func refreshEndpoint(ctx context.Context, client *http.Client, ep knownEndpoint, scanID uint, bodyReadSize int, captureStatusCodes map[int]struct{}) (urlScanResult, bool) {
+	path := NormalizeEndpointPath(ep.Path) // Escapes what older, decoded paths hold unescaped
+	for _, scheme := range []string{"https", "http"} {
+		fullURL := scheme + "://" + ep.Hostname + path
+		req, err := http.NewRequestWithContext(ctx, ep.Method, fullURL, nil)
+		if err != nil {
+			return urlScanResult{}, false
+		}
+		req.Header.Set("User-Agent", userAgents[rand.Intn(len(userAgents))])
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		_, capture := captureStatusCodes[resp.StatusCode] // 2xx/3xx only, as in the crawl (see parseCaptureStatusCodes)
+		var body []byte
+		if capture {
+			body, _ = io.ReadAll(io.LimitReader(resp.Body, int64(bodyReadSize)))
+		}
+		resp.Body.Close()
+
+		res := urlScanResult{
+			Hostname: ep.Hostname,
+			FullURL:  fullURL,
+			Endpoint: models.Endpoint{
+				Path:         path,
+				Method:       ep.Method,
+				StatusCode:   resp.StatusCode,
+				ContentType:  resp.Header.Get("Content-Type"),
+				DiscoveredAt: time.Now(),
+				ScanID:       &scanID,
+			},
+		}
+		if capture {
+			requestHeaders := make(map[string]string, len(req.Header))
+			for name := range req.Header {
+				requestHeaders[name] = req.Header.Get(name)
+			}
+			responseHeaders := make(map[string]string, len(resp.Header))
+			for name := range resp.Header {
+				responseHeaders[name] = resp.Header.Get(name)
+			}
+			res.Capture = &models.RequestResponse{
+				RequestHeaders:  formatHeaders(requestHeaders),
+				ResponseHeaders: formatHeaders(responseHeaders),
+				ResponseBody:    string(body),
+				CapturedAt:      time.Now(),
+			}
+		}
+		return res, true
+	}
+	return urlScanResult{}, false
+}
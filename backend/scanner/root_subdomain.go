@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"rewrite-go/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RootSubdomainHostname returns the canonical hostname of the Subdomain entry that represents a root
+// domain itself: lower-case without a trailing dot.
+func RootSubdomainHostname(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+// EnsureRootSubdomain returns the canonical root-level Subdomain entry of a root domain, creating it if missing.
+// Endpoints and technologies found on the bare domain link to this entry. New entries are marked active
+// and attributed to scanID (nil for imports). Reports whether the entry was created.
+func EnsureRootSubdomain(db *gorm.DB, rootDomain *models.RootDomain, scanID *uint) (models.Subdomain, bool, error) {
+	hostname := RootSubdomainHostname(rootDomain.Domain)
+
+	var rootSubdomain models.Subdomain
+	err := db.Where("root_domain_id = ? AND hostname = ?", rootDomain.ID, hostname).First(&rootSubdomain).Error
+	if err == nil {
+		return rootSubdomain, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return rootSubdomain, false, fmt.Errorf("failed to query subdomain entry for root domain %s: %w", hostname, err)
+	}
+
+	log.Printf("Creating missing Subdomain entry for root domain host: %s", hostname)
+	rootSubdomain = models.Subdomain{
+		RootDomainID: rootDomain.ID,
+		Hostname:     hostname,
+		IsActive:     true, // The root domain is a known, in-scope asset
+		DiscoveredAt: time.Now(),
+		ScanID:       scanID,
+	}
+	if err := db.Create(&rootSubdomain).Error; err != nil {
+		return rootSubdomain, false, fmt.Errorf("failed to create subdomain entry for root domain %s: %w", hostname, err)
+	}
+	return rootSubdomain, true, nil
+}
@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"encoding/json"
+	"log"
+	"rewrite-go/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ResumeStages are the stages a scan can be resumed from (Scan.ResumePhase), in the order they run.
+// PhaseDiscovery stands for everything before the URL scan: screenshots of existing assets, discovery,
+// verification, saving, DNS enrichment, TLS checks, sensitive files and screenshots of the saved subdomains.
+// PhaseURLScan includes content discovery.
+var ResumeStages = []string{PhaseDiscovery, PhaseURLScan, PhaseTech, PhaseScreenshotRetry}
+
+// resumeStageIndex returns the position of stage in ResumeStages, or -1 if it isn't one.
+func resumeStageIndex(stage string) int {
+	for i, s := range ResumeStages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsResumeStage reports whether stage is one of ResumeStages.
+func IsResumeStage(stage string) bool {
+	return resumeStageIndex(stage) >= 0
+}
+
+// setResumePhase records the stage a resumed run of the scan starts from, empty once every stage completed.
+func setResumePhase(db *gorm.DB, scanID uint, stage string) {
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Update("resume_phase", stage).Error; err != nil {
+		log.Printf("Error saving resume phase %q of scan %d: %v", stage, scanID, err)
+	}
+}
+
+// resumedScanSubdomains returns the subdomains a completed discovery stage handed to the later stages,
+// hostname -> ID: the target of a subdomain scan, or the active subdomains of the root domain re-observed
+// since the scan started.
+func resumedScanSubdomains(db *gorm.DB, rootDomainID uint, scanType string, targetHost string, scanStartedAt time.Time) (map[string]uint, error) {
+	query := db.Model(&models.Subdomain{}).Where("root_domain_id = ?", rootDomainID)
+	if scanType == "subdomain" {
+		query = query.Where("hostname = ?", targetHost)
+	} else {
+		query = query.Where("is_active = ? AND last_seen_at >= ?", true, scanStartedAt)
+	}
+	var subdomains []models.Subdomain
+	if err := query.Select("id", "hostname").Find(&subdomains).Error; err != nil {
+		return nil, err
+	}
+	outOfScope := outOfScopePatterns(db, rootDomainID)
+	saved := make(map[string]uint, len(subdomains))
+	for _, sub := range subdomains {
+		if !isOutOfScope(sub.Hostname, outOfScope) {
+			saved[sub.Hostname] = sub.ID
+		}
+	}
+	return saved, nil
+}
+
+// resumedTargetSnapshot returns the target snapshot of the scan's earlier run without the targets of the
+// stages run again from resumeFrom on, so they aren't listed twice.
+func resumedTargetSnapshot(db *gorm.DB, scanID uint, resumeFrom string) *models.ScanTargetSnapshot {
+	snapshot := &models.ScanTargetSnapshot{}
+	var scan models.Scan
+	if err := db.Select("target_snapshot").First(&scan, scanID).Error; err != nil || scan.TargetSnapshot == "" {
+		return snapshot
+	}
+	if err := json.Unmarshal([]byte(scan.TargetSnapshot), snapshot); err != nil {
+		log.Printf("Warning: Could not decode the target snapshot of scan %d, starting a new one: %v", scanID, err)
+		return &models.ScanTargetSnapshot{}
+	}
+	from := resumeStageIndex(resumeFrom)
+	if from <= resumeStageIndex(PhaseDiscovery) {
+		snapshot.ExistingAssetURLs, snapshot.PathURLs = nil, nil
+	}
+	if from <= resumeStageIndex(PhaseURLScan) {
+		snapshot.SeedURLs, snapshot.TruncatedSeedURLs, snapshot.RefreshedEndpoints = nil, nil, 0
+	}
+	if from <= resumeStageIndex(PhaseTech) {
+		snapshot.TechDetectURLs = nil
+	}
+	return snapshot
+}
@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"rewrite-go/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateScanStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"pending", "running", true},
+		{"pending", "cancelled", true},
+		{"running", "completed", true},
+		{"running", "failed", true},
+		{"running", "cancelled", true},
+		{"running", "running", false},
+		{"cancelled", "running", false},
+		{"cancelled", "completed", false},
+		{"completed", "failed", false},
+		{"failed", "cancelled", false},
+		{"running", "paused", false}, // Unknown status
+	}
+	db := openTestDB(t, &models.Scan{})
+	for _, tt := range tests {
+		scan := models.Scan{RootDomainID: 1, ScanType: "root_domain", Status: tt.from, StartedAt: time.Now()}
+		if err := db.Create(&scan).Error; err != nil {
+			t.Fatalf("create scan: %v", err)
+		}
+		if got := updateScanStatus(db, scan.ID, tt.to, "summary"); got != tt.want {
+			t.Errorf("%s -> %s: updateScanStatus = %t, want %t", tt.from, tt.to, got, tt.want)
+		}
+		var stored models.Scan
+		db.First(&stored, scan.ID)
+		wantStatus := tt.from
+		if tt.want {
+			wantStatus = tt.to
+		}
+		if stored.Status != wantStatus {
+			t.Errorf("%s -> %s: status = %q, want %q", tt.from, tt.to, stored.Status, wantStatus)
+		}
+		if terminal := tt.to != "running"; tt.want && terminal && stored.CompletedAt == nil {
+			t.Errorf("%s -> %s: completed_at not set", tt.from, tt.to)
+		}
+	}
+}
+
+// TestUpdateScanStatusConcurrentWriters races a cancellation against late writers finishing the same
+// running scan: exactly one terminal status wins and the others are refused, never overwriting it.
+func TestUpdateScanStatusConcurrentWriters(t *testing.T) {
+	db := openTestDB(t, &models.Scan{})
+	statuses := []string{"cancelled", "completed", "failed", "running", "completed", "running"}
+	for round := 0; round < 20; round++ {
+		scan := models.Scan{RootDomainID: 1, ScanType: "root_domain", Status: "running", StartedAt: time.Now()}
+		if err := db.Create(&scan).Error; err != nil {
+			t.Fatalf("create scan: %v", err)
+		}
+
+		start := make(chan struct{})
+		applied := make([]bool, len(statuses))
+		var wg sync.WaitGroup
+		for i, status := range statuses {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				applied[i] = updateScanStatus(db, scan.ID, status)
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		winner := ""
+		for i, ok := range applied {
+			if !ok {
+				continue
+			}
+			if winner != "" {
+				t.Fatalf("round %d: both %q and %q were applied", round, winner, statuses[i])
+			}
+			winner = statuses[i]
+		}
+		if winner == "" || winner == "running" {
+			t.Fatalf("round %d: applied status = %q, want one terminal status", round, winner)
+		}
+		var stored models.Scan
+		db.First(&stored, scan.ID)
+		if stored.Status != winner {
+			t.Errorf("round %d: status = %q, want the applied %q", round, stored.Status, winner)
+		}
+
+		// Late writers after the scan ended change nothing either
+		for _, status := range statuses {
+			if updateScanStatus(db, scan.ID, status) {
+				t.Errorf("round %d: %q applied after the scan ended as %q", round, status, winner)
+			}
+		}
+	}
+}
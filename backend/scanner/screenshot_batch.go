@@ -0,0 +1,240 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"rewrite-go/config"
+	"rewrite-go/jobs"
+	"rewrite-go/metrics"
+	"rewrite-go/models"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"gorm.io/gorm"
+)
+
+// ScanTypeScreenshot is the scan type of on-demand screenshot batches (see RunScreenshotBatch). They own
+// their captures like any scan, so the files are listed, served and pruned with the scan.
+const ScanTypeScreenshot = "screenshot"
+
+// Screenshot batch limits; the default concurrency is overridable via SCREENSHOT_BATCH_CONCURRENCY
+const (
+	defaultScreenshotBatchConcurrency = 3
+	MaxScreenshotBatchConcurrency     = 20
+	MaxScreenshotBatchURLs            = 500
+)
+
+// ScreenshotStatusBlocked marks batch URLs refused by the SSRF guard. They are not captured or recorded.
+const ScreenshotStatusBlocked = "blocked"
+
+// ErrUnsafeScreenshotURL is returned by CheckScreenshotURL for URLs the server must not navigate to.
+var ErrUnsafeScreenshotURL = errors.New("URL is not allowed")
+
+// ScreenshotBatchResult is the outcome of one URL of a screenshot batch.
+type ScreenshotBatchResult struct {
+	URL          string `json:"url"`
+	Status       string `json:"status"` // "captured", "skipped", "failed" or "blocked"
+	ScreenshotID uint   `json:"screenshot_id,omitempty"`
+	FilePath     string `json:"file_path,omitempty"`
+	SkipReason   string `json:"skip_reason,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ScreenshotBatchConcurrency returns the number of parallel captures of a batch: requested if set,
+// SCREENSHOT_BATCH_CONCURRENCY otherwise, at most MaxScreenshotBatchConcurrency. Captures also count
+// against the process-wide outbound connection cap.
+func ScreenshotBatchConcurrency(requested int) int {
+	concurrency := requested
+	if concurrency <= 0 {
+		concurrency = config.GetInt("SCREENSHOT_BATCH_CONCURRENCY", defaultScreenshotBatchConcurrency)
+	}
+	return max(1, min(concurrency, MaxScreenshotBatchConcurrency))
+}
+
+// CheckScreenshotURL guards against server-side request forgery through batch screenshots: the URL must
+// be http(s) without credentials, and every address its host resolves to must be a public unicast
+// address (see blockedAddress). Batch captures run the same check on every request the page makes (see
+// guardBrowserRequests).
+func CheckScreenshotURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("%w: must be an absolute http(s) URL", ErrUnsafeScreenshotURL)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%w: credentials in URLs are not supported", ErrUnsafeScreenshotURL)
+	}
+
+	host := parsed.Hostname()
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if blockedAddress(ip) {
+			return fmt.Errorf("%w: %s resolves to non-public address %s", ErrUnsafeScreenshotURL, host, ip)
+		}
+	}
+	return nil
+}
+
+// screenshotGuardKey marks contexts whose captures pass every browser request through CheckScreenshotURL.
+type screenshotGuardKey struct{}
+
+// withScreenshotGuard returns ctx with guardBrowserRequests enabled for its captures.
+func withScreenshotGuard(ctx context.Context) context.Context {
+	return context.WithValue(ctx, screenshotGuardKey{}, true)
+}
+
+// screenshotGuarded reports whether captures under ctx guard their browser requests.
+func screenshotGuarded(ctx context.Context) bool {
+	guarded, _ := ctx.Value(screenshotGuardKey{}).(bool)
+	return guarded
+}
+
+// guardBrowserRequests pauses every request of the page in taskCtx, including redirects and subresources,
+// and fails the ones CheckScreenshotURL refuses, so a public page cannot pull the browser onto internal
+// addresses. The host is resolved again right before the request continues; Chrome still resolves it
+// itself, so a rebinding DNS server with a zero TTL can only be narrowed, not ruled out.
+func guardBrowserRequests(taskCtx context.Context) chromedp.Action {
+	chromedp.ListenTarget(taskCtx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		go func() { // Commands can't be sent from the listener itself
+			executor := cdp.WithExecutor(taskCtx, chromedp.FromContext(taskCtx).Target)
+			var err error
+			if checkErr := CheckScreenshotURL(taskCtx, paused.Request.URL); checkErr != nil {
+				log.Printf("Blocking browser request to %s: %v", paused.Request.URL, checkErr)
+				err = fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient).Do(executor)
+			} else {
+				err = fetch.ContinueRequest(paused.RequestID).Do(executor)
+			}
+			if err != nil && taskCtx.Err() == nil {
+				log.Printf("Error resolving paused browser request to %s: %v", paused.Request.URL, err)
+			}
+		}()
+	})
+	return fetch.Enable()
+}
+
+// RunScreenshotBatch captures the targets with a pool of concurrency workers for a scan of type
+// ScanTypeScreenshot, records every capture and completes the scan. With guard, for URLs given by API
+// users, every URL passes CheckScreenshotURL right before it is captured, and so does every request the
+// browser makes for it; without, targets are captured like in a scan's screenshot phase. Results are in
+// target order. The scan runs as a cancellable job; URLs not reached before cancellation are reported
+// failed.
+func RunScreenshotBatch(ctx context.Context, db *gorm.DB, scanID uint, targets []ExistingScreenshotTarget, concurrency int, guard bool) []ScreenshotBatchResult {
+	if guard {
+		ctx = withScreenshotGuard(ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	job := jobs.StartScan(scanID, fmt.Sprintf("Screenshot batch of %d URLs", len(targets)), cancel)
+	updateScanStatus(db, scanID, "running")
+
+	results := make([]ScreenshotBatchResult, len(targets))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done, captured, blocked := 0, 0, 0
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				result := captureBatchTarget(ctx, db, scanID, targets[index])
+				mu.Lock()
+				results[index] = result
+				done++
+				switch result.Status {
+				case ScreenshotStatusCaptured:
+					captured++
+				case ScreenshotStatusBlocked:
+					blocked++
+				}
+				job.SetProgress(done, len(targets))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range targets {
+		if ctx.Err() != nil {
+			results[i] = ScreenshotBatchResult{URL: targets[i].URL, Status: ScreenshotStatusFailed, Error: "batch cancelled"}
+			continue
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	summary := fmt.Sprintf("Captured %d of %d screenshots", captured, len(targets))
+	if blocked > 0 {
+		summary += fmt.Sprintf(", %d URLs blocked", blocked)
+	}
+	if ctx.Err() != nil {
+		updateScanStatus(db, scanID, "cancelled", summary+" before the batch was cancelled")
+		job.FinishWithStatus(jobs.StatusCancelled, summary)
+	} else {
+		updateScanStatus(db, scanID, "completed", summary)
+		job.Finish(nil)
+	}
+	log.Printf("Screenshot batch %d: %s.", scanID, summary)
+	return results
+}
+
+// captureBatchTarget screenshots one batch target and records it, unless the SSRF guard of a guarded
+// batch refuses the URL.
+func captureBatchTarget(ctx context.Context, db *gorm.DB, scanID uint, target ExistingScreenshotTarget) ScreenshotBatchResult {
+	result := ScreenshotBatchResult{URL: target.URL}
+	if screenshotGuarded(ctx) {
+		if err := CheckScreenshotURL(ctx, target.URL); err != nil {
+			result.Status = ScreenshotStatusBlocked
+			if !errors.Is(err, ErrUnsafeScreenshotURL) {
+				result.Status = ScreenshotStatusFailed // Not resolvable, nothing to capture
+			}
+			log.Printf("Not screenshotting %s (Scan ID: %d): %v", target.URL, scanID, err)
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	screenshot := models.Screenshot{
+		SubdomainID: target.SubdomainID,
+		EndpointID:  target.EndpointID,
+		URL:         target.URL,
+		ScanID:      scanID,
+		Viewport:    ScreenshotViewportDesktop,
+	}
+	if err := captureScreenshotWithRetries(ctx, &screenshot); err != nil {
+		result.Status = ScreenshotStatusFailed
+		result.Error = err.Error()
+		return result
+	}
+	metrics.Screenshots.Inc(screenshot.Status)
+	if err := db.Create(&screenshot).Error; err != nil {
+		log.Printf("Error saving screenshot metadata for %s (Scan ID: %d): %v", target.URL, scanID, err)
+	}
+
+	result.Status = screenshot.Status
+	result.ScreenshotID = screenshot.ID
+	result.FilePath = screenshot.FilePath
+	result.SkipReason = screenshot.SkipReason
+	result.Error = screenshot.Error
+	return result
+}
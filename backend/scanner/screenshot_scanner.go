@@ -2,18 +2,27 @@ package scanner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"mime"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"rewrite-go/config"
 	"rewrite-go/database"
+	"rewrite-go/metrics"
 	"rewrite-go/models"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/device"
+	"gorm.io/gorm"
 )
 
 // List of common user agents
@@ -34,16 +43,186 @@ var userAgents = []string{
 	"Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Mobile Safari/537.36",
 }
 
+// Screenshot size limits, overridable via SCREENSHOT_MAX_BYTES / SCREENSHOT_MAX_HEIGHT settings
+const (
+	defaultScreenshotMaxBytes  = 10 * 1024 * 1024 // Captures larger than this are not written to disk
+	defaultScreenshotMaxHeight = 10000            // Full-page captures are clipped to this many CSS pixels
+)
+
+// Retries of transient capture failures, the count overridable via the SCREENSHOT_RETRIES setting
+const (
+	defaultScreenshotRetries = 2
+	screenshotRetryBaseDelay = 5 * time.Second // Doubled on every retry
+	screenshotRetryMaxDelay  = 60 * time.Second
+)
+
 // Seed the random number generator once
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+// Screenshot capture outcomes (models.Screenshot.Status)
+const (
+	ScreenshotStatusCaptured = "captured"
+	ScreenshotStatusSkipped  = "skipped" // Reached, but not saved (see SkipReason)
+	ScreenshotStatusFailed   = "failed"  // Capture failed (see Error and FailureKind), retried at the end of the scan if the template enables it
+)
+
+// Kinds of capture failures (models.Screenshot.FailureKind)
+const (
+	ScreenshotFailureUnreachable = "unreachable" // DNS failure, connection refused or no route: the host is dead, not retried
+	ScreenshotFailureTransient   = "transient"   // Timeouts, resets and TLS errors, retried with backoff
+	ScreenshotFailureError       = "error"       // Anything else, e.g. the file could not be saved; not retried
+)
+
+const screenshotRetryWorkers = 3 // Failed screenshots retried in parallel
+
+// Screenshot viewports (models.Screenshot.Viewport). Templates with ScreenshotMobile capture live hosts on
+// both; every other capture is desktop.
+const (
+	ScreenshotViewportDesktop = "desktop"
+	ScreenshotViewportMobile  = "mobile" // Emulates mobileScreenshotDevice: screen size, touch and user agent
+)
+
+// mobileScreenshotDevice is the device mobile screenshots emulate.
+var mobileScreenshotDevice = device.IPhone13
+
+// Chrome network errors (net::ERR_*) by failure kind
+var (
+	unreachableNetErrors = []string{
+		"ERR_NAME_NOT_RESOLVED", "ERR_NAME_RESOLUTION_FAILED", "ERR_CONNECTION_REFUSED",
+		"ERR_ADDRESS_UNREACHABLE", "ERR_ADDRESS_INVALID", "ERR_INTERNET_DISCONNECTED",
+	}
+	transientNetErrors = []string{
+		"ERR_TIMED_OUT", "ERR_CONNECTION_TIMED_OUT", "ERR_CONNECTION_RESET", "ERR_CONNECTION_CLOSED",
+		"ERR_CONNECTION_ABORTED", "ERR_CONNECTION_FAILED", "ERR_EMPTY_RESPONSE", "ERR_NETWORK_CHANGED",
+		"ERR_SSL_PROTOCOL_ERROR", "ERR_HTTP2_PROTOCOL_ERROR", "ERR_QUIC_PROTOCOL_ERROR",
+	}
+)
+
+// screenshotFailureKind classifies a failed chromedp run. Timeouts of the capture itself count as transient.
+func screenshotFailureKind(err error) string {
+	msg := err.Error()
+	for _, code := range unreachableNetErrors {
+		if strings.Contains(msg, code) {
+			return ScreenshotFailureUnreachable
+		}
+	}
+	for _, code := range transientNetErrors {
+		if strings.Contains(msg, code) {
+			return ScreenshotFailureTransient
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(msg, "deadline exceeded") {
+		return ScreenshotFailureTransient
+	}
+	return ScreenshotFailureError
+}
+
+// scanScreenshotURLs holds, per running scan (by ID), the URLs its phases already screenshotted as a
+// *sync.Map, so that an asset reached by several phases is captured once.
+var scanScreenshotURLs sync.Map
+
+// registerScanScreenshots starts tracking the URLs screenshotted by a scan. The returned func stops it.
+func registerScanScreenshots(scanID uint) func() {
+	scanScreenshotURLs.Store(scanID, &sync.Map{})
+	return func() { scanScreenshotURLs.Delete(scanID) }
+}
+
+// claimScanScreenshot reports whether a scan phase should screenshot targetURL, recording it so that
+// later phases of the same scan skip it. URLs are compared by scheme, host and normalized path, the way
+// endpoints are identified. Scans not registered with registerScanScreenshots screenshot everything.
+func claimScanScreenshot(scanID uint, targetURL string) bool {
+	seen, ok := scanScreenshotURLs.Load(scanID)
+	if !ok {
+		return true
+	}
+	key := targetURL
+	if parsed, err := url.Parse(targetURL); err == nil {
+		key = strings.ToLower(parsed.Scheme+"://"+parsed.Host) + NormalizeEndpointPath(parsed.EscapedPath())
+	}
+	_, loaded := seen.(*sync.Map).LoadOrStore(key, struct{}{})
+	return !loaded
+}
+
 // TakeScreenshot captures a screenshot of the given URL and saves it.
-// It also records the screenshot metadata in the database.
+// It also records the screenshot metadata in the database, including failed captures.
 func TakeScreenshot(ctx context.Context, targetURL string, scanID uint, subdomainID *uint, endpointID *uint) error {
+	_, err := takeScreenshot(ctx, targetURL, scanID, subdomainID, endpointID, ScreenshotViewportDesktop)
+	return err
+}
+
+// takeScreenshot is TakeScreenshot on the given viewport, also returning the recorded screenshot.
+func takeScreenshot(ctx context.Context, targetURL string, scanID uint, subdomainID *uint, endpointID *uint, viewport string) (*models.Screenshot, error) {
+	screenshot := &models.Screenshot{
+		SubdomainID: subdomainID,
+		EndpointID:  endpointID,
+		URL:         targetURL,
+		ScanID:      scanID,
+		Viewport:    viewport,
+	}
+	if err := captureScreenshotWithRetries(ctx, screenshot); err != nil {
+		return nil, err
+	}
+	metrics.Screenshots.Inc(screenshot.Status)
+
+	// Save screenshot metadata to the database
+	if result := database.GetDB().Create(screenshot); result.Error != nil {
+		log.Printf("Error saving screenshot metadata for %s to database: %v", targetURL, result.Error)
+		// Log the error but don't stop the scan
+	}
+
+	return screenshot, nil // Screenshot taken (or failed non-fatally)
+}
+
+// captureScreenshotWithRetries captures screenshot.URL, retrying transient failures up to SCREENSHOT_RETRIES
+// times with exponential backoff. Every attempt is counted in screenshot.Attempts; the record holds the
+// outcome of the last one.
+func captureScreenshotWithRetries(ctx context.Context, screenshot *models.Screenshot) error {
+	maxRetries := config.GetInt("SCREENSHOT_RETRIES", defaultScreenshotRetries)
+	for retry := 0; ; retry++ {
+		screenshot.Attempts++
+		if err := captureScreenshot(ctx, screenshot); err != nil {
+			return err
+		}
+		if screenshot.Status != ScreenshotStatusFailed || screenshot.FailureKind != ScreenshotFailureTransient ||
+			retry >= maxRetries || ctx.Err() != nil {
+			return nil
+		}
+
+		delay := min(screenshotRetryBaseDelay<<retry, screenshotRetryMaxDelay)
+		log.Printf("Screenshot of %s failed (%s), retrying in %s (retry %d/%d)", screenshot.URL, screenshot.Error, delay, retry+1, maxRetries)
+		select {
+		case <-ctx.Done():
+			return nil // Keep the failure recorded by the last attempt
+		case <-time.After(delay):
+		}
+	}
+}
+
+// browserAllocatorOptions are the headless Chrome options of screenshots and session recording.
+func browserAllocatorOptions(userAgent string) []chromedp.ExecAllocatorOption {
+	return append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", true),
+		chromedp.Flag("ignore-certificate-errors", !tlsVerifyEnabled()), // Invalid certificates fail the capture with TLS_VERIFY
+		chromedp.Flag("disable-gpu", true),
+		chromedp.Flag("no-sandbox", true), // Often needed in containerized environments
+		chromedp.Flag("disable-dev-shm-usage", true),
+		chromedp.UserAgent(userAgent),
+	)
+}
+
+// captureScreenshot captures screenshot.URL once on screenshot.Viewport and records the outcome in
+// screenshot: the file path and "captured", "skipped" with SkipReason, or "failed" with Error and
+// FailureKind. Only setup errors are returned.
+func captureScreenshot(ctx context.Context, screenshot *models.Screenshot) error {
+	targetURL, scanID := screenshot.URL, screenshot.ScanID
+	mobile := screenshot.Viewport == ScreenshotViewportMobile
+	screenshot.FilePath, screenshot.SkipReason, screenshot.Error, screenshot.FailureKind = "", "", "", ""
+	screenshot.CapturedAt = time.Now()
+
 	// Ensure the screenshots directory exists
-	screenshotDir := filepath.Join(".", "data", "screenshots", fmt.Sprintf("scan_%d", scanID))
+	screenshotDir := filepath.Join(config.ScanDir(scanID), "screenshots")
 	if err := os.MkdirAll(screenshotDir, 0755); err != nil {
 		return fmt.Errorf("failed to create screenshot directory %s: %w", screenshotDir, err)
 	}
@@ -57,23 +236,28 @@ func TakeScreenshot(ctx context.Context, targetURL string, scanID uint, subdomai
 	if len(safeFilename) > 100 { // Limit filename length
 		safeFilename = safeFilename[:100]
 	}
+	if mobile {
+		safeFilename += "_mobile"
+	}
 	filename := fmt.Sprintf("%s_%d.png", safeFilename, time.Now().UnixNano())
 	filePath := filepath.Join(screenshotDir, filename)
 
 	// Select a random user agent
 	randomUserAgent := userAgents[rand.Intn(len(userAgents))]
-	log.Printf("Using User-Agent: %s for %s", randomUserAgent, targetURL)
+	if mobile {
+		log.Printf("Emulating %s for %s", mobileScreenshotDevice, targetURL) // The device's user agent replaces the random one
+	} else {
+		log.Printf("Using User-Agent: %s for %s", randomUserAgent, targetURL)
+	}
 
 	// Create a new chromedp context with random user agent
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("ignore-certificate-errors", true), // Ignore SSL errors
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true), // Often needed in containerized environments
-		chromedp.Flag("disable-dev-shm-usage", true),
-		chromedp.UserAgent(randomUserAgent), // Set the random user agent
-	)
-	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	allocOptions := browserAllocatorOptions(randomUserAgent)
+	guarded := screenshotGuarded(ctx)
+	if guarded {
+		// Cross-site frames would run in their own renderer target, out of reach of the request guard
+		allocOptions = append(allocOptions, chromedp.Flag("disable-site-isolation-trials", true))
+	}
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, allocOptions...)
 	defer cancelAlloc()
 
 	taskCtx, cancelTask := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
@@ -83,20 +267,73 @@ func TakeScreenshot(ctx context.Context, targetURL string, scanID uint, subdomai
 	taskCtx, cancelTimeout := context.WithTimeout(taskCtx, 120*time.Second) // 120-second timeout (increased from 60)
 	defer cancelTimeout()
 
+	maxBytes := config.GetInt("SCREENSHOT_MAX_BYTES", defaultScreenshotMaxBytes)
+	maxHeight := config.GetInt("SCREENSHOT_MAX_HEIGHT", defaultScreenshotMaxHeight)
+	fullPage := config.GetBool("SCREENSHOT_FULL_PAGE", false)
+
+	// The navigation holds one outbound connection slot, however many requests the page makes. Only the
+	// navigation itself waits for the politeness delay of the host.
+	hostname := ""
+	if parsed, err := url.Parse(targetURL); err == nil {
+		hostname = parsed.Hostname()
+	}
+	err := hostLimiter.wait(ctx, hostname, scanHostDelay(scanID))
+	var release func()
+	if err == nil {
+		release, err = outboundLimiter.acquire(ctx)
+	}
+	if err != nil {
+		screenshot.Status = ScreenshotStatusFailed
+		screenshot.Error = err.Error()
+		screenshot.FailureKind = ScreenshotFailureError
+		return nil
+	}
+	defer release()
+
+	var emulation chromedp.Action = chromedp.Tasks{} // Desktop captures keep the browser's default window
+	if mobile {
+		emulation = chromedp.Emulate(mobileScreenshotDevice)
+	}
+	var requestGuard chromedp.Action = chromedp.Tasks{}
+	if guarded {
+		requestGuard = guardBrowserRequests(taskCtx)
+	}
+
 	var buf []byte
 	log.Printf("Attempting to take screenshot of: %s", targetURL)
-	err := chromedp.Run(taskCtx,
+	err = chromedp.Run(taskCtx,
+		requestGuard,
+		emulation,
+		// Authenticated scans restore their recorded session first (see registerScanSession)
+		scanSession(scanID).browserState(),
 		chromedp.Navigate(targetURL),
 		// Wait for the page to load (adjust time as needed, or use other wait conditions)
 		// chromedp.Sleep(5*time.Second), // Simple wait
 		chromedp.WaitVisible(`body`, chromedp.ByQuery), // Wait for body element
 		// Capture screenshot
 		chromedp.ActionFunc(func(ctx context.Context) error {
-			var err error
-			buf, err = page.CaptureScreenshot().
+			capture := page.CaptureScreenshot().
 				WithFormat(page.CaptureScreenshotFormatPng).
-				WithQuality(80). // Adjust quality (0-100)
-				Do(ctx)
+				WithQuality(80) // Adjust quality (0-100)
+
+			if fullPage {
+				// Capture the whole page, but clip the height so infinite-scroll pages can't produce huge images
+				_, _, _, _, _, contentSize, err := page.GetLayoutMetrics().Do(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to get layout metrics: %w", err)
+				}
+				height := contentSize.Height
+				if maxHeight > 0 && height > float64(maxHeight) {
+					log.Printf("Clipping full-page screenshot of %s from %.0fpx to %dpx height", targetURL, height, maxHeight)
+					height = float64(maxHeight)
+				}
+				capture = capture.
+					WithCaptureBeyondViewport(true).
+					WithClip(&page.Viewport{X: 0, Y: 0, Width: contentSize.Width, Height: height, Scale: 1})
+			}
+
+			var err error
+			buf, err = capture.Do(ctx)
 			if err != nil {
 				return fmt.Errorf("failed to capture screenshot: %w", err)
 			}
@@ -105,55 +342,420 @@ func TakeScreenshot(ctx context.Context, targetURL string, scanID uint, subdomai
 	)
 
 	if err != nil {
-		// Don't treat screenshot failure as a fatal scan error, just log it
+		// Don't treat screenshot failure as a fatal scan error, just record it
 		log.Printf("Error taking screenshot for %s: %v", targetURL, err)
+		screenshot.Status = ScreenshotStatusFailed
+		screenshot.Error = err.Error()
+		screenshot.FailureKind = screenshotFailureKind(err)
 		return nil // Return nil to allow the scan to continue
 	}
 
+	// Skip saving oversized captures, but record them so users know the page was reached
+	if maxBytes > 0 && len(buf) > maxBytes {
+		reason := fmt.Sprintf("capture size %d bytes exceeds limit of %d bytes", len(buf), maxBytes)
+		log.Printf("Skipping screenshot for %s: %s", targetURL, reason)
+		screenshot.Status = ScreenshotStatusSkipped
+		screenshot.SkipReason = reason
+		return nil
+	}
+
 	// Save the screenshot buffer to a file
 	if err := os.WriteFile(filePath, buf, 0644); err != nil {
 		log.Printf("Error saving screenshot file %s: %v", filePath, err)
+		screenshot.Status = ScreenshotStatusFailed
+		screenshot.Error = fmt.Sprintf("failed to save screenshot file: %v", err)
+		screenshot.FailureKind = ScreenshotFailureError
 		return nil // Continue scan even if saving fails
 	}
 
 	log.Printf("Successfully saved screenshot for %s to %s", targetURL, filePath)
+	screenshot.Status = ScreenshotStatusCaptured
+	screenshot.FilePath = filePath // Store the relative path
+	return nil
+}
 
-	// Save screenshot metadata to the database
-	screenshot := models.Screenshot{
-		SubdomainID: subdomainID,
-		EndpointID:  endpointID,
-		URL:         targetURL,
-		FilePath:    filePath, // Store the relative path
-		ScanID:      scanID,
-		CapturedAt:  time.Now(),
+// RetryFailedScreenshots captures every failed screenshot of a scan once more (with the usual retries of
+// transient failures), updating the records in place. Screenshots of unreachable hosts are left failed.
+// Returns how many were retried and how many of those were captured this time.
+func RetryFailedScreenshots(ctx context.Context, db *gorm.DB, scanID uint) (retried int, recovered int) {
+	var failed []models.Screenshot
+	if err := db.Where("scan_id = ? AND status = ? AND (failure_kind IS NULL OR failure_kind <> ?)", scanID, ScreenshotStatusFailed, ScreenshotFailureUnreachable).
+		Find(&failed).Error; err != nil {
+		log.Printf("Error fetching failed screenshots of scan %d: %v", scanID, err)
+		return 0, 0
 	}
+	if len(failed) == 0 {
+		return 0, 0
+	}
+	log.Printf("Retrying %d failed screenshots for scan %d...", len(failed), scanID)
 
-	db := database.GetDB()
-	if result := db.Create(&screenshot); result.Error != nil {
-		log.Printf("Error saving screenshot metadata for %s to database: %v", targetURL, result.Error)
-		// Log the error but don't stop the scan
+	shots := make(chan *models.Screenshot)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < screenshotRetryWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shot := range shots {
+				if err := captureScreenshotWithRetries(ctx, shot); err != nil {
+					log.Printf("Error retrying screenshot of %s (Scan ID: %d): %v", shot.URL, scanID, err)
+					continue
+				}
+				metrics.Screenshots.Inc(shot.Status)
+				if err := db.Save(shot).Error; err != nil {
+					log.Printf("Error saving retried screenshot of %s (Scan ID: %d): %v", shot.URL, scanID, err)
+					continue
+				}
+				mu.Lock()
+				retried++
+				if shot.Status != ScreenshotStatusFailed {
+					recovered++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range failed {
+		if ctx.Err() != nil {
+			break // Scan cancelled, leave the rest failed
+		}
+		shots <- &failed[i]
 	}
+	close(shots)
+	wg.Wait()
+	return retried, recovered
+}
+
+// Endpoint screenshot criteria a template can select (ScanTemplate.ScreenshotCriteria).
+// With criteria set, an endpoint is only screenshotted if it matches at least one of them.
+const (
+	ScreenshotCriterionOKHTML     = "ok_html"    // 200 response with an HTML content type
+	ScreenshotCriterionCaptured   = "captured"   // Request/response pair captured (status code listed in CAPTURE_STATUS_CODES)
+	ScreenshotCriterionParameters = "parameters" // Has at least one discovered parameter
+)
+
+// ScreenshotCriteria lists the valid endpoint screenshot criteria.
+var ScreenshotCriteria = []string{ScreenshotCriterionOKHTML, ScreenshotCriterionCaptured, ScreenshotCriterionParameters}
 
-	return nil // Screenshot taken (or failed non-fatally)
+// ParseScreenshotCriteria splits and validates a comma-separated criteria list. An empty list means no filtering.
+func ParseScreenshotCriteria(value string) ([]string, error) {
+	var criteria []string
+	for _, entry := range strings.Split(value, ",") {
+		criterion := strings.ToLower(strings.TrimSpace(entry))
+		if criterion == "" {
+			continue
+		}
+		valid := false
+		for _, known := range ScreenshotCriteria {
+			if criterion == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown screenshot criterion '%s' (allowed: %s)", entry, strings.Join(ScreenshotCriteria, ", "))
+		}
+		criteria = append(criteria, criterion)
+	}
+	return criteria, nil
 }
 
-// ShouldScreenshot checks if a URL should be screenshotted based on its extension.
-// It screenshots any URL unless it explicitly ends with one of the excludedExtensions.
-func ShouldScreenshot(urlStr string) bool {
-	lowerURL := strings.ToLower(urlStr)
-	if strings.Contains(lowerURL, "?") {
-		lowerURL = lowerURL[:strings.Index(lowerURL, "?")] // Ignore query parameters for extension check
+// templateScreenshotCriteria returns a template's endpoint screenshot criteria, ignoring invalid entries.
+func templateScreenshotCriteria(scanTemplate *models.ScanTemplate) []string {
+	criteria, err := ParseScreenshotCriteria(scanTemplate.ScreenshotCriteria)
+	if err != nil {
+		log.Printf("Warning: Template %d has invalid screenshot criteria, screenshotting all endpoints: %v", scanTemplate.ID, err)
+		return nil
+	}
+	return criteria
+}
+
+// maxScreenshotPaths caps the paths a template screenshots on every host (ScanTemplate.ScreenshotPaths).
+const maxScreenshotPaths = 20
+
+// ParseScreenshotPaths splits and validates a comma-separated list of paths, e.g. "/login,/admin,/.git/".
+// Paths must start with "/" and may have a query; duplicates are dropped.
+func ParseScreenshotPaths(value string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		p := strings.TrimSpace(entry)
+		if p == "" || seen[p] {
+			continue
+		}
+		parsed, err := url.Parse(p)
+		if err != nil || !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || parsed.Fragment != "" || strings.ContainsAny(p, " \t") {
+			return nil, fmt.Errorf("invalid screenshot path '%s', expected a path starting with '/' such as /login", p)
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+	if len(paths) > maxScreenshotPaths {
+		return nil, fmt.Errorf("too many screenshot paths (%d), at most %d are allowed", len(paths), maxScreenshotPaths)
+	}
+	return paths, nil
+}
+
+// templateScreenshotPaths returns the paths a template screenshots on every host, ignoring invalid lists.
+func templateScreenshotPaths(scanTemplate *models.ScanTemplate) []string {
+	paths, err := ParseScreenshotPaths(scanTemplate.ScreenshotPaths)
+	if err != nil {
+		log.Printf("Warning: Template %d has invalid screenshot paths, not screenshotting any: %v", scanTemplate.ID, err)
+		return nil
+	}
+	return paths
+}
+
+// screenshotReached reports whether the scan screenshotted targetURL and reached it, i.e. the capture did
+// not fail.
+func screenshotReached(db *gorm.DB, scanID uint, targetURL string) bool {
+	var reached int64
+	db.Model(&models.Screenshot{}).Where("scan_id = ? AND url = ? AND status <> ?", scanID, targetURL, ScreenshotStatusFailed).Count(&reached)
+	return reached > 0
+}
+
+// screenshotHostPaths screenshots the template's paths on a host that answered at baseURL (scheme and
+// host), skipping URLs the scan already screenshotted. Returns the URLs it attempted.
+func screenshotHostPaths(ctx context.Context, scanID uint, baseURL string, subdomainID uint, paths []string) []string {
+	var attempted []string
+	for _, p := range paths {
+		targetURL := strings.TrimSuffix(baseURL, "/") + p
+		if !ShouldScreenshot(targetURL) || !claimScanScreenshot(scanID, targetURL) {
+			continue
+		}
+		attempted = append(attempted, targetURL)
+		if err := TakeScreenshot(ctx, targetURL, scanID, &subdomainID, nil); err != nil {
+			log.Printf("Screenshot attempt finished for %s (Subdomain ID: %d, Scan ID: %d) - see previous logs for details.", targetURL, subdomainID, scanID)
+		}
+	}
+	return attempted
+}
+
+// screenshotHostMobile screenshots a host's base URL, whose desktop capture reached it, on the mobile
+// viewport. Callers run it after the desktop capture in the same task, so that templates with
+// ScreenshotMobile take longer rather than run twice as many browsers at a time.
+func screenshotHostMobile(ctx context.Context, scanID uint, targetURL string, subdomainID uint) {
+	if _, err := takeScreenshot(ctx, targetURL, scanID, &subdomainID, nil, ScreenshotViewportMobile); err != nil {
+		log.Printf("Mobile screenshot attempt finished for %s (Subdomain ID: %d, Scan ID: %d) - see previous logs for details.", targetURL, subdomainID, scanID)
+	}
+}
+
+// endpointScreenshotFacts are the endpoint properties screenshot criteria are evaluated against.
+type endpointScreenshotFacts struct {
+	StatusCode    int
+	ContentType   string
+	Captured      bool
+	HasParameters bool
+}
+
+// matchesScreenshotCriteria reports whether an endpoint matches any of the criteria (always true without criteria).
+func matchesScreenshotCriteria(criteria []string, facts endpointScreenshotFacts) bool {
+	if len(criteria) == 0 {
+		return true
+	}
+	for _, criterion := range criteria {
+		switch criterion {
+		case ScreenshotCriterionOKHTML:
+			if mediaType, _, err := mime.ParseMediaType(facts.ContentType); err == nil && facts.StatusCode == 200 && htmlMediaTypes[mediaType] {
+				return true
+			}
+		case ScreenshotCriterionCaptured:
+			if facts.Captured {
+				return true
+			}
+		case ScreenshotCriterionParameters:
+			if facts.HasParameters {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExistingScreenshotTarget is an existing asset URL screenshotted at the start of a scan.
+// Exactly one of SubdomainID and EndpointID is set.
+type ExistingScreenshotTarget struct {
+	URL         string `json:"url"`
+	SubdomainID *uint  `json:"subdomain_id,omitempty"`
+	EndpointID  *uint  `json:"endpoint_id,omitempty"`
+}
+
+// ExistingScreenshotTargets lists the existing subdomain and endpoint URLs a screenshot-enabled scan
+// captures before discovery. All assets of the root domain are included, unless targetOnly is set and
+// the scan targets a single subdomain, in which case only that subdomain and its endpoints are.
+// Endpoints are limited to those matching the screenshot criteria, if any. Subdomains matching an
+// out-of-scope rule of the organization are left out with their endpoints.
+func ExistingScreenshotTargets(db *gorm.DB, rootDomainID uint, scanType string, targetHost string, targetOnly bool, criteria []string) ([]ExistingScreenshotTarget, error) {
+	subdomainQuery := db.Where("root_domain_id = ?", rootDomainID)
+	if targetOnly && scanType == "subdomain" {
+		subdomainQuery = subdomainQuery.Where("hostname = ?", targetHost)
+	}
+	var subdomains []models.Subdomain
+	if err := subdomainQuery.Order("hostname").Find(&subdomains).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch existing subdomains: %w", err)
 	}
 
-	// Check for extensions to exclude
-	excludedExtensions := []string{
+	var targets []ExistingScreenshotTarget
+	outOfScope := outOfScopePatterns(db, rootDomainID)
+	subdomainIDs := make([]uint, 0, len(subdomains))
+	for _, sub := range subdomains {
+		if isOutOfScope(sub.Hostname, outOfScope) {
+			continue // Neither the host nor its endpoints
+		}
+		subdomainIDs = append(subdomainIDs, sub.ID)
+		subID := sub.ID
+		for _, urlStr := range []string{"http://" + sub.Hostname, "https://" + sub.Hostname} {
+			if ShouldScreenshot(urlStr) {
+				targets = append(targets, ExistingScreenshotTarget{URL: urlStr, SubdomainID: &subID})
+			}
+		}
+	}
+	if len(subdomainIDs) == 0 {
+		return targets, nil
+	}
+
+	var endpoints []models.Endpoint
+	if err := db.Preload("Subdomain").Where("subdomain_id IN ?", subdomainIDs).Order("id").Find(&endpoints).Error; err != nil {
+		return targets, fmt.Errorf("failed to fetch existing endpoints: %w", err)
+	}
+	capturedIDs, parameterIDs := make(map[uint]bool), make(map[uint]bool)
+	if len(criteria) > 0 && len(endpoints) > 0 {
+		var ids []uint
+		if err := db.Model(&models.RequestResponse{}).Distinct("endpoint_id").
+			Joins("JOIN endpoints ON endpoints.id = request_responses.endpoint_id").
+			Where("endpoints.subdomain_id IN ?", subdomainIDs).Pluck("endpoint_id", &ids).Error; err != nil {
+			return targets, fmt.Errorf("failed to fetch captured endpoints: %w", err)
+		}
+		for _, id := range ids {
+			capturedIDs[id] = true
+		}
+		ids = nil
+		if err := db.Model(&models.Parameter{}).Distinct("endpoint_id").
+			Joins("JOIN endpoints ON endpoints.id = parameters.endpoint_id").
+			Where("endpoints.subdomain_id IN ?", subdomainIDs).Pluck("endpoint_id", &ids).Error; err != nil {
+			return targets, fmt.Errorf("failed to fetch endpoint parameters: %w", err)
+		}
+		for _, id := range ids {
+			parameterIDs[id] = true
+		}
+	}
+	for _, ep := range endpoints {
+		if ep.Subdomain == nil || ep.Subdomain.Hostname == "" || ep.Path == "" {
+			continue // Skip if essential info is missing
+		}
+		facts := endpointScreenshotFacts{StatusCode: ep.StatusCode, ContentType: ep.ContentType, Captured: capturedIDs[ep.ID], HasParameters: parameterIDs[ep.ID]}
+		if !matchesScreenshotCriteria(criteria, facts) {
+			continue
+		}
+		path := ep.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		endpointID := ep.ID
+		for _, urlStr := range []string{"http://" + ep.Subdomain.Hostname + path, "https://" + ep.Subdomain.Hostname + path} {
+			if ShouldScreenshotContent(urlStr, ep.ContentType) {
+				targets = append(targets, ExistingScreenshotTarget{URL: urlStr, EndpointID: &endpointID})
+			}
+		}
+	}
+	return targets, nil
+}
+
+// htmlMediaTypes are the media types of HTML pages.
+var htmlMediaTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+}
+
+// Screenshot eligibility, overridable via the SCREENSHOT_EXCLUDED_EXTENSIONS / SCREENSHOT_CONTENT_TYPES settings
+var (
+	// defaultScreenshotExcludedExtensions are the extensions of files not worth rendering in a browser
+	defaultScreenshotExcludedExtensions = []string{
 		".js", ".css", ".json", ".xml", ".txt", ".pdf", ".doc", ".docx", ".xls", ".xlsx",
 		".ppt", ".pptx", ".zip", ".rar", ".tar", ".gz", ".7z", ".jpg", ".jpeg", ".gif",
 		".png", ".svg", ".ico", ".woff", ".woff2", ".ttf", ".eot", ".mp4", ".mp3", ".avi",
 		".mov", ".csv", ".map", ".yaml", ".yml", ".md",
 	}
-	for _, ext := range excludedExtensions {
-		if strings.HasSuffix(lowerURL, ext) {
+	// defaultScreenshotContentTypes are the media types worth rendering in a browser, see htmlMediaTypes
+	defaultScreenshotContentTypes = []string{"text/html", "application/xhtml+xml"}
+)
+
+// ScreenshotExcludedExtensions returns the lowercase extensions, with their dot, of URLs that are not
+// screenshotted: the SCREENSHOT_EXCLUDED_EXTENSIONS setting, "none" for no exclusions, or the built-in list.
+func ScreenshotExcludedExtensions() []string {
+	value := strings.TrimSpace(config.Get("SCREENSHOT_EXCLUDED_EXTENSIONS"))
+	if value == "" {
+		return defaultScreenshotExcludedExtensions
+	}
+	extensions := []string{}
+	if strings.EqualFold(value, "none") {
+		return extensions
+	}
+	for _, entry := range strings.Split(value, ",") {
+		if ext := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(entry)), "."); ext != "" {
+			extensions = append(extensions, "."+ext)
+		}
+	}
+	return extensions
+}
+
+// ScreenshotContentTypes returns the media types of responses that are screenshotted: the
+// SCREENSHOT_CONTENT_TYPES setting, or the built-in HTML types.
+func ScreenshotContentTypes() []string {
+	var mediaTypes []string
+	for _, entry := range strings.Split(config.Get("SCREENSHOT_CONTENT_TYPES"), ",") {
+		if mediaType := strings.ToLower(strings.TrimSpace(entry)); mediaType != "" {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	if len(mediaTypes) == 0 {
+		return defaultScreenshotContentTypes
+	}
+	return mediaTypes
+}
+
+// ShouldScreenshotContent checks if an endpoint should be screenshotted based on its captured
+// Content-Type, one of ScreenshotContentTypes: by default only HTML is rendered, so API responses
+// (JSON, binary, ...) are skipped. Falls back to the extension heuristic of ShouldScreenshot if the
+// content type is unknown.
+func ShouldScreenshotContent(urlStr string, contentType string) bool {
+	if strings.TrimSpace(contentType) == "" {
+		return ShouldScreenshot(urlStr)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ShouldScreenshot(urlStr) // Unparseable header, treat as not probed
+	}
+	for _, allowed := range ScreenshotContentTypes() {
+		if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldScreenshot checks if a URL should be screenshotted based on its extension.
+// It screenshots any URL unless its path ends with one of the ScreenshotExcludedExtensions. Only the
+// path counts, so "/download?file=x.pdf", "/#x.pdf" and a host like "docs.example.md" are screenshotted.
+func ShouldScreenshot(urlStr string) bool {
+	urlPath := urlStr
+	if parsed, err := url.Parse(urlStr); err == nil {
+		urlPath = parsed.Path
+	} else if i := strings.IndexAny(urlPath, "?#"); i >= 0 {
+		urlPath = urlPath[:i]
+	}
+	// Path parameters as in "/report.pdf;jsessionid=1" are not part of the extension
+	lastSegment := urlPath[strings.LastIndex(urlPath, "/")+1:]
+	if i := strings.Index(lastSegment, ";"); i >= 0 {
+		lastSegment = lastSegment[:i]
+	}
+	ext := strings.ToLower(path.Ext(lastSegment))
+	if ext == "" {
+		return true
+	}
+
+	for _, excluded := range ScreenshotExcludedExtensions() {
+		if ext == excluded {
 			return false // Don't screenshot if it has an excluded extension
 		}
 	}
@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"rewrite-go/config"
+	"testing"
+)
+
+// setConfig sets a setting for the test, restoring the previous value afterwards.
+func setConfig(t *testing.T, key, value string) {
+	t.Helper()
+	previous := config.Get(key)
+	if err := config.Merge(map[string]string{key: value}); err != nil {
+		t.Fatalf("set %s: %v", key, err)
+	}
+	t.Cleanup(func() { _ = config.Merge(map[string]string{key: previous}) })
+}
+
+func TestShouldScreenshot(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/", true},
+		{"https://example.com/login", true},
+		{"https://example.com/index.html", true},
+		{"https://example.com/app.js", false},
+		{"https://example.com/report.PDF", false},
+		{"https://example.com/archive.tar.gz", false},
+
+		// Only the path counts, not the query, fragment or host
+		{"https://example.com/download?file=x.pdf", true},
+		{"https://example.com/page#x.pdf", true},
+		{"https://docs.example.md/", true},
+		{"https://example.com/report.pdf?download=1", false},
+
+		// Dots in directories and path parameters
+		{"https://example.com/v1.2/users", true},
+		{"https://example.com/report.pdf;jsessionid=1", false},
+		{"https://example.com/page;v=1.pdf", true},
+
+		// Unparseable URLs fall back to cutting the query
+		{"https://example.com/%zz.css?x", false},
+		{"https://example.com/%zz?f=x.css", true},
+	}
+	for _, tt := range tests {
+		if got := ShouldScreenshot(tt.url); got != tt.want {
+			t.Errorf("ShouldScreenshot(%q) = %t, want %t", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestShouldScreenshotConfiguredExtensions(t *testing.T) {
+	setConfig(t, "SCREENSHOT_EXCLUDED_EXTENSIONS", " .PHP, asp ,")
+	for url, want := range map[string]bool{
+		"https://example.com/index.php":  false,
+		"https://example.com/old.ASP":    false,
+		"https://example.com/report.pdf": true, // No longer in the list
+		"https://example.com/app.js":     true,
+	} {
+		if got := ShouldScreenshot(url); got != want {
+			t.Errorf("ShouldScreenshot(%q) = %t, want %t", url, got, want)
+		}
+	}
+
+	setConfig(t, "SCREENSHOT_EXCLUDED_EXTENSIONS", "none")
+	if len(ScreenshotExcludedExtensions()) != 0 {
+		t.Errorf("ScreenshotExcludedExtensions() = %v, want none", ScreenshotExcludedExtensions())
+	}
+	if !ShouldScreenshot("https://example.com/app.js") {
+		t.Error("ShouldScreenshot(app.js) = false with no exclusions")
+	}
+}
+
+func TestShouldScreenshotContent(t *testing.T) {
+	tests := []struct {
+		url, contentType string
+		want             bool
+	}{
+		{"https://example.com/", "text/html", true},
+		{"https://example.com/", "Text/HTML; charset=UTF-8", true},
+		{"https://example.com/", "application/xhtml+xml", true},
+		{"https://example.com/api", "application/json", false},
+		{"https://example.com/logo", "image/png", false},
+
+		// The content type wins over the extension
+		{"https://example.com/page.js", "text/html", true},
+		{"https://example.com/page.html", "application/pdf", false},
+
+		// Unknown or unparseable content types fall back to the extension
+		{"https://example.com/page", "", true},
+		{"https://example.com/app.js", "  ", false},
+		{"https://example.com/app.js", "text/html; =broken", false},
+		{"https://example.com/page", "text/html; =broken", true},
+	}
+	for _, tt := range tests {
+		if got := ShouldScreenshotContent(tt.url, tt.contentType); got != tt.want {
+			t.Errorf("ShouldScreenshotContent(%q, %q) = %t, want %t", tt.url, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestShouldScreenshotContentConfiguredTypes(t *testing.T) {
+	setConfig(t, "SCREENSHOT_CONTENT_TYPES", "text/html, Application/PDF")
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/pdf", true},
+		{"text/html; charset=utf-8", true},
+		{"application/xhtml+xml", false}, // Only the configured types
+	}
+	for _, tt := range tests {
+		if got := ShouldScreenshotContent("https://example.com/doc", tt.contentType); got != tt.want {
+			t.Errorf("ShouldScreenshotContent(%q) = %t, want %t", tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultSensitivePaths are probed by the sensitive_files tool unless its wordlist or paths option lists
+// others. They are also the bundled "sensitive-files" wordlist.
+var defaultSensitivePaths = []string{
+	"/.env", "/.git/config", "/.git/HEAD", "/.svn/entries", "/.DS_Store", "/.htpasswd", "/.aws/credentials",
+	"/.npmrc", "/docker-compose.yml", "/web.config", "/config.php.bak", "/wp-config.php.bak",
+	"/backup.zip", "/backup.tar.gz", "/backup.sql", "/dump.sql", "/phpinfo.php", "/info.php", "/server-status",
+}
+
+// maxSensitivePaths caps the paths the sensitive_files tool probes on every host.
+const maxSensitivePaths = 1000
+
+// sensitiveFilesPaths reads the "sensitive_files" tool from a template's URL scan config and returns the
+// paths it probes on every saved host:
+//
+//	paths=/.env,/.git/config,/backup.zip   paths to probe instead of defaultSensitivePaths
+//	wordlist=common-dirs                   bundled wordlist or file in WORDLIST_DIR with one path per line (see loadWordlist),
+//	                                       probed with the paths instead of defaultSensitivePaths
+//
+// A leading '/' is added to paths lacking one. Invalid paths and unreadable wordlists are dropped with a
+// warning; with nothing valid left the defaults are used. Returns false if the tool is absent or disabled.
+func sensitiveFilesPaths(scanTemplate *models.ScanTemplate) ([]string, bool) {
+	var section models.ScanSectionConfig
+	if scanTemplate.URLScanConfig == "" || json.Unmarshal([]byte(scanTemplate.URLScanConfig), &section) != nil {
+		return nil, false
+	}
+	toolCfg, ok := section.Tools["sensitive_files"]
+	if !ok || !toolCfg.Enabled {
+		return nil, false
+	}
+	options := parseToolOptions(toolCfg.Options)
+	var entries []string
+	if raw, ok := options["wordlist"]; ok {
+		wordlist, err := loadWordlist(fmt.Sprint(raw))
+		if err != nil {
+			log.Printf("Warning: Ignoring the sensitive_files wordlist of template %d: %v", scanTemplate.ID, err)
+		}
+		entries = append(entries, wordlist...)
+	}
+	if raw, ok := options["paths"]; ok {
+		entries = append(entries, strings.Split(fmt.Sprint(raw), ",")...)
+	}
+	if len(entries) == 0 {
+		return defaultSensitivePaths, true
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		p := strings.TrimSpace(entry)
+		if p != "" && !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		if p == "" || seen[p] {
+			continue
+		}
+		if strings.HasPrefix(p, "//") || strings.ContainsAny(p, " \t#") {
+			log.Printf("Warning: Ignoring sensitive file path '%s': must be a path without spaces or fragment", p)
+			continue
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		log.Printf("Warning: Template %d lists no valid sensitive file paths, probing the defaults.", scanTemplate.ID)
+		return defaultSensitivePaths, true
+	}
+	if len(paths) > maxSensitivePaths {
+		log.Printf("Warning: Template %d lists %d sensitive file paths, probing the first %d.", scanTemplate.ID, len(paths), maxSensitivePaths)
+		paths = paths[:maxSensitivePaths]
+	}
+	return paths, true
+}
+
+// probeSensitiveFiles requests paths over https and http on every saved subdomain (hostname -> ID) and
+// records the ones served with status 200 as SensitiveFiles. Responses matching the host's soft-404
+// signature and empty bodies are not hits. A scheme is given up on a host after its first failed request.
+// Requests use the tech detection client and limits. Returns the number of hits.
+func probeSensitiveFiles(ctx context.Context, db *gorm.DB, scanID uint, subdomains map[string]uint, paths []string) int {
+	workers := max(1, config.GetInt("TECH_DETECT_WORKERS", defaultTechDetectWorkers))
+	perHost := max(1, config.GetInt("TECH_DETECT_PER_HOST", defaultTechDetectPerHost))
+	rateLimitRetries := config.GetInt("RATE_LIMIT_RETRIES", defaultRateLimitRetries)
+	hostDelay := scanHostDelay(scanID)
+
+	bases := make([]string, 0, len(subdomains)*2)
+	for hostname := range subdomains {
+		bases = append(bases, "https://"+hostname, "http://"+hostname)
+	}
+	signatures := calibrateSoft404(bases, techDetectTimeout, hostDelay)
+
+	httpClient := newTechDetectClient(workers*perHost, perHost, hostDelay)
+	defer httpClient.CloseIdleConnections()
+
+	var mu sync.Mutex
+	var hits []models.SensitiveFile
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(bases)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for base := range work {
+				hostname := base[strings.Index(base, "://")+3:]
+				sig, calibrated := signatures[base]
+				for _, p := range paths {
+					page, err := fetchTechPage(ctx, httpClient, base+p, rateLimitRetries, nil)
+					if err != nil {
+						break // Unreachable over this scheme, or the host stopped answering
+					}
+					if page.StatusCode != 200 || len(page.Body) == 0 || (calibrated && sig.matches(page.StatusCode, string(page.Body), p)) {
+						continue
+					}
+					contentType, _, _ := mime.ParseMediaType(page.Header.Get("Content-Type"))
+					now := time.Now()
+					log.Printf("Sensitive file found: %s%s (Scan ID: %d, Content-Type: %s, %d bytes)", base, p, scanID, contentType, len(page.Body))
+					mu.Lock()
+					hits = append(hits, models.SensitiveFile{
+						SubdomainID:   subdomains[hostname],
+						URL:           base + p,
+						Path:          p,
+						StatusCode:    page.StatusCode,
+						ContentType:   contentType,
+						ContentLength: len(page.Body),
+						ScanID:        &scanID,
+						DiscoveredAt:  now,
+						LastSeenAt:    &now,
+					})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+feed:
+	for _, base := range bases {
+		select {
+		case work <- base:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if len(hits) == 0 {
+		log.Printf("No sensitive files found on %d subdomains (Scan ID: %d, %d paths).", len(subdomains), scanID, len(paths))
+		return 0
+	}
+	// Files found before keep their DiscoveredAt
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subdomain_id"}, {Name: "url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status_code", "content_type", "content_length", "scan_id", "last_seen_at"}),
+	}).CreateInBatches(hits, 500).Error; err != nil {
+		log.Printf("Error saving sensitive files of scan %d: %v", scanID, err)
+		return 0
+	}
+	log.Printf("Found %d sensitive files on %d subdomains (Scan ID: %d, %d paths).", len(hits), len(subdomains), scanID, len(paths))
+	return len(hits)
+}
@@ -0,0 +1,283 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"rewrite-go/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+	"gorm.io/gorm"
+)
+
+// Login sequence actions (models.SessionLoginStep.Action)
+const (
+	SessionStepNavigate    = "navigate"
+	SessionStepFill        = "fill"
+	SessionStepClick       = "click"
+	SessionStepWaitVisible = "wait_visible"
+	SessionStepSleep       = "sleep"
+)
+
+// Login sequence limits
+const (
+	MaxSessionSteps      = 50
+	maxSessionSleepMs    = 30000
+	sessionRecordTimeout = 2 * time.Minute
+)
+
+// ValidateSessionSteps checks a login sequence before it is stored: known actions with the fields they
+// need, and at least one navigation before anything else.
+func ValidateSessionSteps(steps []models.SessionLoginStep) error {
+	if len(steps) == 0 {
+		return errors.New("at least one step is required")
+	}
+	if len(steps) > MaxSessionSteps {
+		return fmt.Errorf("at most %d steps are allowed", MaxSessionSteps)
+	}
+	if steps[0].Action != SessionStepNavigate {
+		return errors.New("the first step must be a navigate step")
+	}
+	for i, step := range steps {
+		switch step.Action {
+		case SessionStepNavigate:
+			parsed, err := url.Parse(step.URL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+				return fmt.Errorf("step %d: navigate needs an absolute http(s) url", i+1)
+			}
+		case SessionStepFill, SessionStepClick, SessionStepWaitVisible:
+			if strings.TrimSpace(step.Selector) == "" {
+				return fmt.Errorf("step %d: %s needs a selector", i+1, step.Action)
+			}
+		case SessionStepSleep:
+			if step.Ms <= 0 || step.Ms > maxSessionSleepMs {
+				return fmt.Errorf("step %d: sleep needs ms between 1 and %d", i+1, maxSessionSleepMs)
+			}
+		default:
+			return fmt.Errorf("step %d: unknown action '%s' (allowed: navigate, fill, click, wait_visible, sleep)", i+1, step.Action)
+		}
+	}
+	return nil
+}
+
+// RecordedSession is the browser state captured by RecordSession.
+type RecordedSession struct {
+	Cookies      []models.SessionCookie       `json:"cookies"`
+	LocalStorage map[string]map[string]string `json:"local_storage"` // Origin -> key -> value
+}
+
+// RecordSession replays a login sequence in headless Chrome and returns the cookies of the browser and
+// the local storage of the page the sequence ends on. Like batch screenshots, navigate steps must pass
+// CheckScreenshotURL, and so does every request the browser makes, including redirects and navigations
+// started by clicks (see guardBrowserRequests). Fails if a step fails or the sequence takes longer than
+// two minutes.
+func RecordSession(ctx context.Context, steps []models.SessionLoginStep) (*RecordedSession, error) {
+	if err := ValidateSessionSteps(steps); err != nil {
+		return nil, err
+	}
+	allocOptions := append(browserAllocatorOptions(userAgents[rand.Intn(len(userAgents))]),
+		chromedp.Flag("disable-site-isolation-trials", true)) // Keeps cross-site frames in reach of the request guard
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, allocOptions...)
+	defer cancelAlloc()
+	taskCtx, cancelTask := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	defer cancelTask()
+	taskCtx, cancelTimeout := context.WithTimeout(taskCtx, sessionRecordTimeout)
+	defer cancelTimeout()
+	if err := chromedp.Run(taskCtx, guardBrowserRequests(taskCtx)); err != nil {
+		return nil, fmt.Errorf("failed to guard browser requests: %w", err)
+	}
+
+	for i, step := range steps {
+		var action chromedp.Action
+		switch step.Action {
+		case SessionStepNavigate:
+			if err := CheckScreenshotURL(ctx, step.URL); err != nil {
+				return nil, fmt.Errorf("step %d: %w", i+1, err)
+			}
+			action = chromedp.Navigate(step.URL)
+		case SessionStepFill:
+			action = chromedp.SendKeys(step.Selector, step.Value, chromedp.ByQuery)
+		case SessionStepClick:
+			action = chromedp.Click(step.Selector, chromedp.ByQuery)
+		case SessionStepWaitVisible:
+			action = chromedp.WaitVisible(step.Selector, chromedp.ByQuery)
+		case SessionStepSleep:
+			action = chromedp.Sleep(time.Duration(step.Ms) * time.Millisecond)
+		}
+		if err := chromedp.Run(taskCtx, action); err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, step.Action, err)
+		}
+	}
+
+	recorded := &RecordedSession{LocalStorage: make(map[string]map[string]string)}
+	var pageStorage struct {
+		Origin string            `json:"origin"`
+		Items  map[string]string `json:"items"`
+	}
+	err := chromedp.Run(taskCtx,
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			cookies, err := storage.GetCookies().Do(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to read cookies: %w", err)
+			}
+			for _, cookie := range cookies {
+				recorded.Cookies = append(recorded.Cookies, models.SessionCookie{
+					Name: cookie.Name, Value: cookie.Value, Domain: cookie.Domain, Path: cookie.Path,
+					HTTPOnly: cookie.HTTPOnly, Secure: cookie.Secure, SameSite: string(cookie.SameSite),
+					Expires: sessionCookieExpiry(cookie),
+				})
+			}
+			return nil
+		}),
+		chromedp.Evaluate(`({origin: location.origin, items: Object.assign({}, window.localStorage)})`, &pageStorage),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(pageStorage.Items) > 0 {
+		recorded.LocalStorage[pageStorage.Origin] = pageStorage.Items
+	}
+	return recorded, nil
+}
+
+// sessionCookieExpiry returns the expiry of a recorded cookie, 0 for session cookies.
+func sessionCookieExpiry(cookie *network.Cookie) float64 {
+	if cookie.Session {
+		return 0
+	}
+	return cookie.Expires
+}
+
+// scanSessions holds the recorded session of running scans by scan ID, see registerScanSession.
+var scanSessions sync.Map
+
+// registerScanSession loads the recorded session of a scan started with one (Scan.SessionID), so that
+// screenshots, katana and the known endpoint refresh send its cookies. The returned func unregisters it.
+// A session that can't be loaded is logged and the scan runs unauthenticated.
+func registerScanSession(db *gorm.DB, scanID uint) func() {
+	var scan models.Scan
+	if err := db.Select("session_id").First(&scan, scanID).Error; err != nil || scan.SessionID == nil {
+		return func() {}
+	}
+	var session models.Session
+	if err := db.First(&session, *scan.SessionID).Error; err != nil {
+		log.Printf("Warning: Session %d of scan %d could not be loaded, scanning unauthenticated: %v", *scan.SessionID, scanID, err)
+		return func() {}
+	}
+	recorded := &RecordedSession{}
+	if err := json.Unmarshal([]byte(session.Cookies), &recorded.Cookies); err != nil {
+		log.Printf("Warning: Session %d of scan %d has no readable cookies, scanning unauthenticated: %v", session.ID, scanID, err)
+		return func() {}
+	}
+	if session.LocalStorage != "" {
+		_ = json.Unmarshal([]byte(session.LocalStorage), &recorded.LocalStorage)
+	}
+	log.Printf("Scan %d uses session %d '%s' (%d cookies).", scanID, session.ID, session.Name, len(recorded.Cookies))
+	scanSessions.Store(scanID, recorded)
+	return func() { scanSessions.Delete(scanID) }
+}
+
+// scanSession returns the recorded session of a scan, nil if it runs unauthenticated.
+func scanSession(scanID uint) *RecordedSession {
+	if session, ok := scanSessions.Load(scanID); ok {
+		return session.(*RecordedSession)
+	}
+	return nil
+}
+
+// browserState returns an action restoring the session in a new browser: the cookies are set, and the
+// local storage of each recorded origin is filled in before the page's own scripts run. Chrome only sends
+// the cookies to the domains they belong to. A nil session restores nothing.
+func (s *RecordedSession) browserState() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if s == nil {
+			return nil
+		}
+		params := make([]*network.CookieParam, 0, len(s.Cookies))
+		for _, cookie := range s.Cookies {
+			param := &network.CookieParam{
+				Name: cookie.Name, Value: cookie.Value, Path: cookie.Path,
+				Secure: cookie.Secure, HTTPOnly: cookie.HTTPOnly, SameSite: network.CookieSameSite(cookie.SameSite),
+			}
+			if strings.HasPrefix(cookie.Domain, ".") {
+				param.Domain = cookie.Domain
+			} else {
+				// Host-only cookie; setting it by URL keeps it from applying to subdomains
+				param.URL = "https://" + cookie.Domain + cookie.Path
+			}
+			if cookie.Expires > 0 {
+				expires := cdp.TimeSinceEpoch(time.Unix(int64(cookie.Expires), 0))
+				param.Expires = &expires
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			if err := storage.SetCookies(params).Do(ctx); err != nil {
+				return fmt.Errorf("failed to restore session cookies: %w", err)
+			}
+		}
+		if len(s.LocalStorage) > 0 {
+			data, err := json.Marshal(s.LocalStorage)
+			if err != nil {
+				return err
+			}
+			script := fmt.Sprintf(`(function(s){var items=s[location.origin];if(!items)return;for(var k in items){try{localStorage.setItem(k,items[k])}catch(e){}}})(%s)`, data)
+			if _, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx); err != nil {
+				return fmt.Errorf("failed to restore session local storage: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// cookieHeader returns a Cookie header value with the session cookies that belong to rootDomain or its
+// subdomains. Katana sends the same headers to every host, so cookies of a single host also go to the
+// other hosts of the root domain it crawls; cookies of other domains (e.g. an SSO provider) are left out.
+func (s *RecordedSession) cookieHeader(rootDomain string) string {
+	if s == nil {
+		return ""
+	}
+	var pairs []string
+	for _, cookie := range s.Cookies {
+		domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+		if domain == rootDomain || strings.HasSuffix(domain, "."+rootDomain) {
+			pairs = append(pairs, cookie.Name+"="+cookie.Value)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "; ")
+}
+
+// cookieJar returns a jar holding the session cookies, for plain HTTP clients. Nil without a session.
+func (s *RecordedSession) cookieJar() http.CookieJar {
+	if s == nil {
+		return nil
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil
+	}
+	for _, cookie := range s.Cookies {
+		host := strings.TrimPrefix(cookie.Domain, ".")
+		httpCookie := &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: cookie.Path, Secure: cookie.Secure, HttpOnly: cookie.HTTPOnly}
+		if strings.HasPrefix(cookie.Domain, ".") {
+			httpCookie.Domain = host
+		}
+		jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: "/"}, []*http.Cookie{httpCookie})
+	}
+	return jar
+}
@@ -7,19 +7,24 @@ import (
 	"errors" // Ensure errors package is imported
 	"fmt"
 	"io"
-	"io/ioutil" // Added for TempFile
 	"log"
-	"net"               // Added for IP parsing
-	"os"                // Import os package for file operations
+	"net" // Added for IP parsing
+	"os"  // Import os package for file operations
+	"path/filepath"
 	"rewrite-go/config" // Import the config package
 	"rewrite-go/database"
+	"rewrite-go/jobs"
+	"rewrite-go/metrics"
 	"rewrite-go/models"
+	"sort"
 	"strconv" // Add strconv import
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/projectdiscovery/subfinder/v2/pkg/passive"
 	"github.com/projectdiscovery/subfinder/v2/pkg/runner"
+	"github.com/projectdiscovery/subfinder/v2/pkg/subscraping"
 	"gopkg.in/yaml.v3" // Import yaml package
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause" // Import the clause package
@@ -57,6 +62,23 @@ func getBoolOption(options map[string]interface{}, key string, defaultValue bool
 	return defaultValue
 }
 
+// Helper function to extract a string option restricted to a set of allowed values.
+// Unknown values are logged and replaced by defaultValue.
+func getChoiceOption(options map[string]interface{}, key string, allowed []string, defaultValue string) string {
+	val, ok := options[key]
+	if !ok {
+		return defaultValue
+	}
+	choice := strings.ToLower(strings.TrimSpace(fmt.Sprint(val)))
+	for _, a := range allowed {
+		if choice == a {
+			return choice
+		}
+	}
+	log.Printf("Warning: Ignoring invalid %s '%v' (allowed: %s), using '%s'", key, val, strings.Join(allowed, ", "), defaultValue)
+	return defaultValue
+}
+
 // Helper function to parse generic tool options into a map[string]interface{}
 // This is a basic example; more robust parsing might be needed for complex options.
 func parseToolOptions(options []string) map[string]interface{} {
@@ -88,39 +110,232 @@ func parseToolOptions(options []string) map[string]interface{} {
 	return parsed
 }
 
+// apiKeysToCheck maps subfinder source names to the settings key holding their primary
+// key/ID/username/email, and apiSecondaryKeys to the second key required by multi-key sources.
+// Both come from the settings catalog (config.Settings).
+var apiKeysToCheck, apiSecondaryKeys = config.SubfinderKeys()
+
+// SubfinderSourceStatus describes whether an API-key subfinder source will be usable.
+type SubfinderSourceStatus struct {
+	Source     string   `json:"source"`
+	ConfigKeys []string `json:"config_keys,omitempty"` // Settings keys the source reads
+	Status     string   `json:"status"`                // "ready", "missing_key", "incomplete" or "invalid_key"
+	Detail     string   `json:"detail,omitempty"`
+}
+
+// looksLikeAPIKey performs a cheap sanity check on a configured credential value.
+func looksLikeAPIKey(value string) bool {
+	return len(value) >= 4 && !strings.ContainsAny(value, " \t\r\n")
+}
+
+// SubfinderSourceInfo describes a subfinder enumeration source available in this build.
+type SubfinderSourceInfo struct {
+	Name      string `json:"name"`
+	IsDefault bool   `json:"is_default"` // Used when a template selects no sources explicitly
+	NeedsKey  bool   `json:"needs_key"`  // Requires an API key (see CheckSubfinderSources)
+}
+
+// SubfinderSources lists the enumeration sources compiled into subfinder, sorted by name.
+// These are the names accepted by the "sources" and "excludeSources" subfinder options.
+func SubfinderSources() []SubfinderSourceInfo {
+	sources := make([]SubfinderSourceInfo, 0, len(passive.AllSources))
+	for _, source := range passive.AllSources {
+		sources = append(sources, SubfinderSourceInfo{
+			Name:      strings.ToLower(source.Name()),
+			IsDefault: source.IsDefault(),
+			NeedsKey:  source.NeedsKey(),
+		})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+	return sources
+}
+
+// subfinderSourceListOption reads a comma-separated list of source names, dropping unknown ones.
+func subfinderSourceListOption(options map[string]interface{}, key string) []string {
+	raw, ok := options[key]
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, entry := range strings.Split(fmt.Sprint(raw), ",") {
+		name := strings.ToLower(strings.TrimSpace(entry))
+		if name == "" {
+			continue
+		}
+		if passive.NameSourceMap[name] == nil {
+			log.Printf("Warning: Ignoring unknown subfinder source '%s' in %s", entry, key)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// selectedSubfinderSources mirrors subfinder's own source selection (sources, all, excludeSources)
+// so that an empty selection can be reported as an error; subfinder exits the process in that case.
+func selectedSubfinderSources(sources, excludeSources []string, all bool) []string {
+	selected := make(map[string]struct{})
+	switch {
+	case all:
+		for name := range passive.NameSourceMap {
+			selected[name] = struct{}{}
+		}
+	case len(sources) > 0:
+		for _, name := range sources {
+			selected[name] = struct{}{}
+		}
+	default:
+		for _, source := range passive.AllSources {
+			if source.IsDefault() {
+				selected[strings.ToLower(source.Name())] = struct{}{}
+			}
+		}
+	}
+	for _, name := range excludeSources {
+		delete(selected, name)
+	}
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// subfinderSourceCounts counts, per source, the subdomains it reported.
+// A subdomain found by several sources counts for each of them.
+func subfinderSourceCounts(sourceMap map[string]map[string]struct{}) map[string]int {
+	counts := make(map[string]int)
+	for _, sources := range sourceMap {
+		for source := range sources {
+			counts[source]++
+		}
+	}
+	return counts
+}
+
+// saveSubfinderSources records which subfinder sources contributed results on the scan record.
+func saveSubfinderSources(db *gorm.DB, scanID uint, counts map[string]int) {
+	data, err := json.Marshal(counts)
+	if err != nil {
+		log.Printf("Warning: Failed to marshal subfinder sources for scan %d: %v", scanID, err)
+		return
+	}
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Update("subfinder_sources", string(data)).Error; err != nil {
+		log.Printf("Warning: Failed to save subfinder sources for scan %d: %v", scanID, err)
+	}
+}
+
+// CheckSubfinderSources reports, for every API-key subfinder source among selected (the
+// sources a template queries, see SubfinderSettings.SelectedSources), whether the configured
+// credentials (settings or SUBFINDER_PROVIDER_CONFIG) look usable. No network requests are made.
+func CheckSubfinderSources(selected []string) []SubfinderSourceStatus {
+	isSelected := make(map[string]bool, len(selected))
+	for _, name := range selected {
+		isSelected[name] = true
+	}
+
+	var userProviders map[string][]string
+	if userConfigPath := strings.TrimSpace(config.Get("SUBFINDER_PROVIDER_CONFIG")); userConfigPath != "" {
+		loaded, err := loadProviderConfigFile(userConfigPath)
+		if err != nil {
+			log.Printf("Warning: Failed to load SUBFINDER_PROVIDER_CONFIG '%s': %v", userConfigPath, err)
+		} else {
+			userProviders = loaded
+		}
+	}
+
+	statuses := make([]SubfinderSourceStatus, 0, len(apiKeysToCheck))
+	for source, configKey := range apiKeysToCheck {
+		if !isSelected[source] {
+			continue
+		}
+		status := SubfinderSourceStatus{Source: source, ConfigKeys: []string{configKey}}
+		secondaryKey, hasSecondary := apiSecondaryKeys[source]
+		if hasSecondary {
+			status.ConfigKeys = append(status.ConfigKeys, secondaryKey)
+		}
+
+		primary := strings.TrimSpace(config.Get(configKey))
+		secondary := ""
+		if hasSecondary {
+			secondary = strings.TrimSpace(config.Get(secondaryKey))
+		}
+
+		switch {
+		case len(userProviders[source]) > 0:
+			status.Status = "ready"
+			status.Detail = "Keys provided by SUBFINDER_PROVIDER_CONFIG"
+		case primary == "" && secondary == "":
+			status.Status = "missing_key"
+		case primary == "" || (hasSecondary && secondary == ""):
+			status.Status = "incomplete"
+			status.Detail = "Source requires both " + strings.Join(status.ConfigKeys, " and ")
+		case !looksLikeAPIKey(primary) || (hasSecondary && !looksLikeAPIKey(secondary)):
+			status.Status = "invalid_key"
+			status.Detail = "Configured value is too short or contains whitespace"
+		default:
+			status.Status = "ready"
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Sources only present in the user provider config
+	for source, keys := range userProviders {
+		if _, known := apiKeysToCheck[source]; known || len(keys) == 0 || !isSelected[source] {
+			continue
+		}
+		statuses = append(statuses, SubfinderSourceStatus{Source: source, Status: "ready", Detail: "Keys provided by SUBFINDER_PROVIDER_CONFIG"})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Source < statuses[j].Source })
+	return statuses
+}
+
+// loadProviderConfigFile reads a subfinder provider-config.yaml (source -> list of keys).
+func loadProviderConfigFile(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	providers := make(map[string][]string)
+	if err := yaml.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("invalid provider config YAML: %w", err)
+	}
+	return providers, nil
+}
+
+// subfinderSourceIssues summarizes per-source statistics from a subfinder run, listing
+// sources that reported errors (often rate limiting or rejected keys). Sources skipped for
+// missing keys are reported by CheckSubfinderSources instead.
+func subfinderSourceIssues(stats map[string]subscraping.Statistics) []string {
+	var issues []string
+	for source, stat := range stats {
+		if stat.Errors > 0 {
+			issues = append(issues, fmt.Sprintf("%s (%d errors)", source, stat.Errors))
+		}
+	}
+	sort.Strings(issues)
+	return issues
+}
+
 // runSubfinder executes subfinder for the given domain using provided configuration.
+// The provider config file holding API keys is written to tempDir ("" for the system default) and removed afterwards.
 // Renamed config parameter to toolOptions to avoid collision with imported config package.
-func runSubfinder(ctx context.Context, domain string, toolOptions map[string]interface{}) (map[string]struct{}, error) {
+// Also returns the sources that reported errors, so throttled sources can be surfaced.
+func runSubfinder(ctx context.Context, domain string, toolOptions map[string]interface{}, tempDir string) (map[string]struct{}, map[string]int, []string, error) {
 	// Extract specific options with defaults using the new parameter name
-	threads := getIntOption(toolOptions, "threads", 10)
-	timeout := getIntOption(toolOptions, "timeout", 30)
-	// Match the key used in parseToolOptions (which removes dashes)
-	maxEnumTime := getIntOption(toolOptions, "maxEnumerationTime", 5) // Assuming key is maxEnumerationTime after parsing
+	settings := resolveSubfinderSettings(toolOptions)
+	threads, timeout, maxEnumTime := settings.Threads, settings.Timeout, settings.MaxEnumerationTime
+	sources, excludeSources, allSources := settings.Sources, settings.ExcludeSources, settings.All
+	if len(settings.SelectedSources) == 0 {
+		return nil, nil, nil, errors.New("no subfinder sources selected, check the sources and excludeSources options")
+	}
 
 	// --- Load API Keys from Config and Prepare Provider Config File ---
 	providerConfigMap := make(map[string][]string)
 	providerConfigFile := "" // Path to the temporary config file
 
-	// Define keys to check based on frontend settings and subfinder provider names
-	apiKeysToCheck := map[string]string{
-		"shodan":         "SHODAN_API_KEY",
-		"censys":         "CENSYS_API_ID", // Needs ID and Secret
-		"binaryedge":     "BINARYEDGE_API_KEY",
-		"virustotal":     "VIRUSTOTAL_API_KEY",
-		"securitytrails": "SECURITYTRAILS_API_KEY",
-		"chaos":          "CHAOS_API_KEY",
-		"github":         "GITHUB_TOKEN",
-		"passivetotal":   "PASSIVETOTAL_USERNAME", // Needs Username and Key
-		"zoomeye":        "ZOOMEYE_API_KEY",
-		"fofa":           "FOFA_EMAIL", // Needs Email and Key
-		"hunter":         "HUNTER_API_KEY",
-		"quake":          "QUAKE_API_KEY",
-		"netlas":         "NETLAS_API_KEY",
-		"intelx":         "INTELX_API_KEY", // Needs Key (Host optional, defaults usually ok)
-		"leakix":         "LEAKIX_API_KEY",
-		// Add others like anubis, bevigil, criminalip, fullhunt, publicwww, shodan-idb if needed
-	}
-
 	log.Println("Loading API keys for Subfinder sources...")
 	for source, configKey := range apiKeysToCheck {
 		// Use the imported 'config' package
@@ -128,23 +343,22 @@ func runSubfinder(ctx context.Context, domain string, toolOptions map[string]int
 		if apiKey != "" {
 			// Handle multi-key providers
 			if source == "censys" {
-				apiSecret := config.Get("CENSYS_API_SECRET")
+				apiSecret := config.Get(apiSecondaryKeys[source])
 				if apiSecret != "" {
 					providerConfigMap[source] = []string{apiKey, apiSecret} // ID, Secret
 					log.Printf("  - Loaded Censys API ID and Secret")
 				} else {
 					log.Printf("  - Warning: Censys API ID found but Secret is missing.")
 				}
-			} else if source == "passivetotal" {
-				apiKeyVal := config.Get("PASSIVETOTAL_API_KEY")
-				if apiKeyVal != "" {
-					providerConfigMap[source] = []string{apiKey, apiKeyVal} // Username, Key
-					log.Printf("  - Loaded PassiveTotal Username and Key")
-				} else {
-					log.Printf("  - Warning: PassiveTotal Username found but Key is missing.")
+			} else if source == "zoomeyeapi" {
+				// Subfinder reads ZoomEye keys as host:key
+				if !strings.Contains(apiKey, ":") {
+					apiKey = "zoomeye.org:" + apiKey
 				}
+				providerConfigMap[source] = []string{apiKey}
+				log.Printf("  - Loaded ZoomEye API Key")
 			} else if source == "fofa" {
-				apiKeyVal := config.Get("FOFA_API_KEY")
+				apiKeyVal := config.Get(apiSecondaryKeys[source])
 				if apiKeyVal != "" {
 					providerConfigMap[source] = []string{apiKey, apiKeyVal} // Email, Key
 					log.Printf("  - Loaded Fofa Email and Key")
@@ -166,13 +380,27 @@ func runSubfinder(ctx context.Context, domain string, toolOptions map[string]int
 		}
 	}
 
+	// Merge a user-supplied provider config, if configured. Sources defined there take
+	// precedence over keys generated from settings; other generated sources are kept.
+	if userConfigPath := strings.TrimSpace(config.Get("SUBFINDER_PROVIDER_CONFIG")); userConfigPath != "" {
+		userProviders, err := loadProviderConfigFile(userConfigPath)
+		if err != nil {
+			log.Printf("Warning: Failed to load SUBFINDER_PROVIDER_CONFIG '%s': %v. Using generated provider config only.", userConfigPath, err)
+		} else {
+			for source, keys := range userProviders {
+				providerConfigMap[source] = keys
+			}
+			log.Printf("Merged %d sources from user provider config %s", len(userProviders), userConfigPath)
+		}
+	}
+
 	// Create temporary YAML file if any keys were loaded
 	if len(providerConfigMap) > 0 {
 		yamlData, err := yaml.Marshal(providerConfigMap)
 		if err != nil {
 			log.Printf("Warning: Failed to marshal provider config to YAML: %v. Proceeding without API keys.", err)
 		} else {
-			tmpFile, err := os.CreateTemp("", "subfinder-provider-*.yaml")
+			tmpFile, err := os.CreateTemp(tempDir, "subfinder-provider-*.yaml")
 			if err != nil {
 				log.Printf("Warning: Failed to create temporary provider config file: %v. Proceeding without API keys.", err)
 			} else {
@@ -197,22 +425,31 @@ func runSubfinder(ctx context.Context, domain string, toolOptions map[string]int
 	}
 	// --- End API Key Loading and File Creation ---
 
-	log.Printf("Configuring Subfinder: Threads=%d, Timeout=%ds, MaxEnumTime=%dm", threads, timeout, maxEnumTime)
+	log.Printf("Configuring Subfinder: Threads=%d, Timeout=%ds, MaxEnumTime=%dm, Sources=%s",
+		threads, timeout, maxEnumTime, strings.Join(settings.SelectedSources, ","))
 	subfinderOpts := &runner.Options{
 		Threads:            threads,
 		Timeout:            timeout,
 		MaxEnumerationTime: maxEnumTime,
+		Sources:            sources,
+		ExcludeSources:     excludeSources,
+		All:                allSources,
 		Silent:             true,               // Keep silent to avoid cluttering logs
 		ProviderConfig:     providerConfigFile, // Pass the *path* to the config file
 	}
 
 	subfinderRunner, err := runner.NewRunner(subfinderOpts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create subfinder runner: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to create subfinder runner: %w", err)
 	}
 
 	output := &bytes.Buffer{} // Discard output, we use the map
 	sourceMap, err := subfinderRunner.EnumerateSingleDomainWithCtx(ctx, domain, []io.Writer{output})
+	sourceIssues := subfinderSourceIssues(subfinderRunner.GetStatistics())
+	if len(sourceIssues) > 0 {
+		log.Printf("Subfinder sources with errors for %s: %s", domain, strings.Join(sourceIssues, ", "))
+	}
+	sourceCounts := subfinderSourceCounts(sourceMap)
 	if err != nil {
 		// Don't treat context deadline exceeded as fatal, just return what was found
 		uniqueSubdomains := make(map[string]struct{}) // Initialize map even on error
@@ -223,9 +460,9 @@ func runSubfinder(ctx context.Context, domain string, toolOptions map[string]int
 		}
 		if errors.Is(err, context.DeadlineExceeded) {
 			log.Printf("Subfinder timed out for domain %s, returning partial results (%d found)", domain, len(uniqueSubdomains))
-			return uniqueSubdomains, nil // Return potentially partial results
+			return uniqueSubdomains, sourceCounts, sourceIssues, nil // Return potentially partial results
 		}
-		return uniqueSubdomains, fmt.Errorf("failed to enumerate domain %s: %w", domain, err) // Return found results along with error
+		return uniqueSubdomains, sourceCounts, sourceIssues, fmt.Errorf("failed to enumerate domain %s: %w", domain, err) // Return found results along with error
 	}
 
 	// Extract unique subdomains from the sourceMap
@@ -234,22 +471,27 @@ func runSubfinder(ctx context.Context, domain string, toolOptions map[string]int
 		uniqueSubdomains[subdomain] = struct{}{}
 	}
 
-	return uniqueSubdomains, nil
+	return uniqueSubdomains, sourceCounts, sourceIssues, nil
 }
 
 // verifyActiveSubdomains uses httpx library to check which subdomains are responding.
-func verifyActiveSubdomains(ctx context.Context, subdomains map[string]struct{}) (map[string]struct{}, error) {
+// The httpx input file is written to tempDir ("" for the system default) and removed afterwards.
+// It also returns the hostnames named by the TLS certificates the hosts presented (subject
+// alternative names and common name, lowercased, wildcard labels stripped), whatever their domain.
+// If addresses is not nil, the first IPv4 address httpx resolved for each active host is stored in it.
+func verifyActiveSubdomains(ctx context.Context, subdomains map[string]struct{}, tempDir string, addresses map[string]string) (map[string]struct{}, map[string]struct{}, error) {
 	activeSubdomains := make(map[string]struct{})
+	certNames := make(map[string]struct{})
 	if len(subdomains) == 0 {
-		return activeSubdomains, nil
+		return activeSubdomains, certNames, nil
 	}
 
 	log.Printf("Verifying %d potential subdomains using httpx...", len(subdomains))
 
 	// --- Create Temporary Input File for httpx ---
-	tmpFile, err := ioutil.TempFile("", "httpx-input-*.txt")
+	tmpFile, err := os.CreateTemp(tempDir, "httpx-input-*.txt")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary input file for httpx: %w", err)
+		return nil, nil, fmt.Errorf("failed to create temporary input file for httpx: %w", err)
 	}
 	defer os.Remove(tmpFile.Name()) // Clean up the file afterwards
 
@@ -257,43 +499,53 @@ func verifyActiveSubdomains(ctx context.Context, subdomains map[string]struct{})
 	for host := range subdomains {
 		if _, err := tmpFile.WriteString(host + "\n"); err != nil {
 			tmpFile.Close() // Close before returning error
-			return nil, fmt.Errorf("failed to write to temporary httpx input file: %w", err)
+			return nil, nil, fmt.Errorf("failed to write to temporary httpx input file: %w", err)
 		}
 		hostsList = append(hostsList, host)
 	}
 	if err := tmpFile.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close temporary httpx input file: %w", err)
+		return nil, nil, fmt.Errorf("failed to close temporary httpx input file: %w", err)
 	}
 	// --- End Temp File Creation ---
 
+	var mu sync.Mutex // OnResult is called from httpx's worker goroutines
+
 	// Configure httpx options
 	// We want basic probing, silent operation, and capture results via callback
+	// Options recorded in the scan's config come from httpxVerifySettings
 	options := httpxrunner.Options{
-		Methods:         "GET",          // Use GET for basic check
-		InputFile:       tmpFile.Name(), // Use the temporary file path
-		Threads:         50,             // Increase threads for faster checking
-		Timeout:         10,             // Timeout in seconds (int)
-		Retries:         1,              // Number of retries
+		Methods:         "GET",                       // Use GET for basic check
+		InputFile:       tmpFile.Name(),              // Use the temporary file path
+		Threads:         httpxVerifySettings.Threads, // Increase threads for faster checking
+		Timeout:         httpxVerifySettings.Timeout, // Timeout in seconds (int)
+		Retries:         httpxVerifySettings.Retries, // Number of retries
 		NoColor:         true,
 		Silent:          true,  // Keep httpx quiet
 		ExtractTitle:    false, // Don't need title
 		StatusCode:      true,  // Get status code
 		ContentLength:   false, // Don't need content length
-		FollowRedirects: true,  // Follow redirects to catch more live hosts
+		FollowRedirects: httpxVerifySettings.FollowRedirects,
 		RandomAgent:     true,
+		TLSGrab:         httpxVerifySettings.TLSGrab,
 		// Define the callback to process results
 		OnResult: func(result httpxrunner.Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			if result.TLSData != nil {
+				for _, name := range append([]string{result.TLSData.SubjectCN}, result.TLSData.SubjectAN...) {
+					if name = normalizeCertName(name); name != "" {
+						certNames[name] = struct{}{}
+					}
+				}
+			}
 			// Check if the probe was successful (no error and maybe filter by status code if needed)
 			// For now, any successful probe (non-error) marks it as active.
 			// You could add checks like result.StatusCode < 400 if needed.
 			if result.Err == nil && result.StatusCode > 0 { // Check for error and valid status code
-				// Use a mutex if running httpx concurrently within this function,
-				// but httpx runner handles internal concurrency.
-				// We just need to safely add to our result map.
-				// Since OnResult might be called concurrently, protect the map write.
-				// (Although, with a single runner instance, maybe not strictly needed? Better safe)
-				// Let's assume httpx calls this sequentially or handles safety. If issues arise, add mutex here.
 				activeSubdomains[result.Input] = struct{}{} // Use result.Input (original hostname)
+				if addresses != nil && len(result.A) > 0 {
+					addresses[result.Input] = result.A[0]
+				}
 				// log.Printf("httpx verified active: %s (Status: %d)", result.Input, result.StatusCode) // Optional detailed logging
 			} else if result.Err != nil {
 				// log.Printf("httpx error for %s: %v", result.Input, result.Err) // Optional error logging
@@ -306,7 +558,7 @@ func verifyActiveSubdomains(ctx context.Context, subdomains map[string]struct{})
 	// Create and run httpx runner
 	runner, err := httpxrunner.New(&options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create httpx runner: %w", err)
+		return nil, nil, fmt.Errorf("failed to create httpx runner: %w", err)
 	}
 	defer runner.Close()
 
@@ -316,11 +568,170 @@ func verifyActiveSubdomains(ctx context.Context, subdomains map[string]struct{})
 	// Error handling happens within the OnResult callback or via panics/logs from the runner itself.
 
 	log.Printf("httpx verification complete. Found %d active subdomains.", len(activeSubdomains))
-	return activeSubdomains, nil // Assume success unless OnResult logged errors or runner panicked
+	return activeSubdomains, certNames, nil // Assume success unless OnResult logged errors or runner panicked
+}
+
+// verifySubdomainTarget checks with httpx that the target of a subdomain scan answers and records the
+// outcome as the subdomain's IsActive. If the check itself fails the target is scanned as if it answered.
+func verifySubdomainTarget(ctx context.Context, db *gorm.DB, rootDomainID uint, scanID uint, hostname string, tempDir string, addresses map[string]string) bool {
+	active, _, err := verifyActiveSubdomains(ctx, map[string]struct{}{hostname: {}}, tempDir, addresses)
+	if err != nil {
+		log.Printf("Warning: Could not verify subdomain %s (Scan ID: %d), scanning it anyway: %v", hostname, scanID, err)
+		return true
+	}
+	_, reachable := active[hostname]
+	// saveSubdomains only refreshes last_seen_at of known subdomains
+	if err := db.Model(&models.Subdomain{}).Where("root_domain_id = ? AND hostname = ?", rootDomainID, hostname).
+		Update("is_active", reachable).Error; err != nil {
+		log.Printf("Warning: Could not update whether subdomain %s is active (Scan ID: %d): %v", hostname, scanID, err)
+	}
+	if !reachable {
+		log.Printf("Subdomain %s did not answer (Scan ID: %d), skipping the phases scanning it.", hostname, scanID)
+	}
+	return reachable
+}
+
+// maxCertNameRounds bounds how often subdomains named by TLS certificates are verified in turn, so hosts
+// whose certificates keep naming new hosts cannot prolong a scan indefinitely.
+const maxCertNameRounds = 2
+
+// normalizeCertName turns a certificate subject name into a hostname: lowercased, without a trailing
+// dot and with a leading wildcard label removed ("*.dev.example.com" names dev.example.com's
+// subdomains, so dev.example.com itself is worth probing). Names that are no hostnames return "".
+func normalizeCertName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || strings.ContainsAny(name, "*/:@ ") || !strings.Contains(name, ".") || net.ParseIP(name) != nil {
+		return ""
+	}
+	return name
+}
+
+// inScopeCertNames returns the certificate names that are rootDomain or one of its subdomains and not in known.
+func inScopeCertNames(certNames map[string]struct{}, rootDomain string, known map[string]struct{}) map[string]struct{} {
+	found := make(map[string]struct{})
+	for name := range certNames {
+		if name != rootDomain && !strings.HasSuffix(name, "."+rootDomain) {
+			continue
+		}
+		if _, ok := known[name]; !ok {
+			found[name] = struct{}{}
+		}
+	}
+	return found
+}
+
+// ScanCancelledBeforeStartSummary is the summary of a scan cancelled while pending, which never ran.
+const ScanCancelledBeforeStartSummary = "Cancelled by user before it started"
+
+// CancelScan marks a pending or running scan cancelled and cancels its job, if running in this process.
+// A running scan stops at its next phase boundary; a pending one is never started and gets
+// ScanCancelledBeforeStartSummary. Returns false if the scan was already finished.
+func CancelScan(scanID uint) bool {
+	db := database.GetDB()
+	// Only from pending, so a scan that started in the meantime is cancelled as running below
+	now := time.Now()
+	result := db.Model(&models.Scan{}).Where("id = ? AND status = ?", scanID, "pending").
+		Updates(map[string]interface{}{"status": "cancelled", "results_summary": ScanCancelledBeforeStartSummary, "completed_at": &now})
+	if result.Error != nil {
+		log.Printf("Error cancelling pending scan %d: %v", scanID, result.Error)
+	}
+	if result.Error == nil && result.RowsAffected > 0 {
+		log.Printf("Updated scan %d status to cancelled before it started", scanID)
+	} else if !updateScanStatus(db, scanID, "cancelled", "Cancelled by user") {
+		return false
+	}
+	if _, err := jobs.Cancel(jobs.ScanJobID(scanID)); err != nil && !errors.Is(err, jobs.ErrNotFound) {
+		log.Printf("Warning: Failed to cancel job of scan %d: %v", scanID, err)
+	}
+	return true
+}
+
+// scanCancelled reports whether a scan's job context was cancelled, logging the skipped phase.
+func scanCancelled(jobCtx context.Context, scanID uint, nextPhase string) bool {
+	if jobCtx.Err() == nil {
+		return false
+	}
+	log.Printf("Scan %d was cancelled, stopping before %s.", scanID, nextPhase)
+	return true
+}
+
+// finishScanJob finishes a scan's job using the final status recorded in the database.
+func finishScanJob(db *gorm.DB, job *jobs.Job, scanID uint) {
+	var scan models.Scan
+	if err := db.Select("status", "results_summary", "scan_type", "started_at").First(&scan, scanID).Error; err != nil {
+		job.Finish(err)
+		return
+	}
+	recordScanMetrics(db, &scan, scanID)
+	switch scan.Status {
+	case "completed":
+		job.FinishWithStatus(jobs.StatusCompleted, "")
+	case "cancelled":
+		job.FinishWithStatus(jobs.StatusCancelled, scan.ResultsSummary)
+	case "failed":
+		job.FinishWithStatus(jobs.StatusFailed, scan.ResultsSummary)
+	default:
+		job.FinishWithStatus(jobs.StatusFailed, fmt.Sprintf("Scan ended with status '%s'", scan.Status))
+	}
+}
+
+// cleanupScanDir removes a finished scan's temporary files, and its directory if nothing else was stored.
+func cleanupScanDir(scanID uint) {
+	scanDir := config.ScanDir(scanID)
+	if err := os.RemoveAll(filepath.Join(scanDir, "tmp")); err != nil {
+		log.Printf("Warning: Could not remove temporary files of scan %d: %v", scanID, err)
+	}
+	_ = os.Remove(scanDir) // Fails while screenshots or katana output are kept
+}
+
+// recordScanMetrics records a finished scan's status, duration and newly discovered assets.
+func recordScanMetrics(db *gorm.DB, scan *models.Scan, scanID uint) {
+	metrics.ScansFinished.Inc(scan.Status)
+	if !scan.StartedAt.IsZero() {
+		metrics.ScanDuration.Observe(time.Since(scan.StartedAt).Seconds(), scan.ScanType, scan.Status)
+	}
+
+	// Assets first discovered by this scan; re-observed ones keep their original discovered_at
+	var newSubdomains, newEndpoints int64
+	if err := db.Model(&models.Subdomain{}).Where("scan_id = ? AND discovered_at >= ?", scanID, scan.StartedAt).Count(&newSubdomains).Error; err != nil {
+		log.Printf("Error counting new subdomains of scan %d for metrics: %v", scanID, err)
+	}
+	if err := db.Model(&models.Endpoint{}).Where("scan_id = ? AND discovered_at >= ?", scanID, scan.StartedAt).Count(&newEndpoints).Error; err != nil {
+		log.Printf("Error counting new endpoints of scan %d for metrics: %v", scanID, err)
+	}
+	metrics.SubdomainsDiscovered.Add(float64(newSubdomains))
+	metrics.EndpointsDiscovered.Add(float64(newEndpoints))
+}
+
+// scanStatusTransitions lists the statuses a scan may move to from each state.
+// Terminal states (completed, failed, cancelled) have no outgoing transitions, so a
+// late-finishing goroutine can never resurrect a scan the user stopped.
+var scanStatusTransitions = map[string][]string{
+	"pending": {"running", "completed", "failed", "cancelled"},
+	"running": {"completed", "failed", "cancelled"},
+}
+
+// scanStatusSources returns the statuses from which a transition to target is allowed.
+func scanStatusSources(target string) []string {
+	var sources []string
+	for from, targets := range scanStatusTransitions {
+		for _, t := range targets {
+			if t == target {
+				sources = append(sources, from)
+				break
+			}
+		}
+	}
+	sort.Strings(sources)
+	return sources
 }
 
 // updateScanStatus updates the status and potentially summary/completion time of a scan.
-func updateScanStatus(db *gorm.DB, scanID uint, status string, errMsg ...string) {
+// The update is conditional on the current status (see scanStatusTransitions) and is
+// applied atomically, so concurrent writers cannot overwrite a terminal status.
+// Returns false if the transition was rejected or the update failed.
+func updateScanStatus(db *gorm.DB, scanID uint, status string, errMsg ...string) bool {
 	updateData := map[string]interface{}{"status": status}
 	message := ""
 	if len(errMsg) > 0 && errMsg[0] != "" {
@@ -334,15 +745,48 @@ func updateScanStatus(db *gorm.DB, scanID uint, status string, errMsg ...string)
 		// Only update StartedAt if it's not already set (or handle re-runs if needed)
 		// For simplicity, we'll just set it here. GORM might handle default values too.
 		updateData["started_at"] = now
-	} else if status == "completed" || status == "failed" {
+	} else if status == "completed" || status == "failed" || status == "cancelled" {
 		updateData["completed_at"] = &now // CompletedAt is a pointer (*time.Time)
 	}
 
-	// Perform the update
-	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Updates(updateData).Error; err != nil {
-		log.Printf("Error updating scan %d status to %s (message: %s): %v", scanID, status, message, err)
-	} else {
-		log.Printf("Updated scan %d status to %s", scanID, status)
+	fromStatuses := scanStatusSources(status)
+	if len(fromStatuses) == 0 {
+		log.Printf("Error: Unknown scan status '%s' for scan %d, not updating", status, scanID)
+		return false
+	}
+
+	// Perform the conditional update (compare-and-set on the current status)
+	result := db.Model(&models.Scan{}).Where("id = ? AND status IN ?", scanID, fromStatuses).Updates(updateData)
+	if result.Error != nil {
+		log.Printf("Error updating scan %d status to %s (message: %s): %v", scanID, status, message, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		var current models.Scan
+		db.Select("status").First(&current, scanID)
+		log.Printf("Refusing scan %d status transition %q -> %q", scanID, current.Status, status)
+		return false
+	}
+	log.Printf("Updated scan %d status to %s", scanID, status)
+	return true
+}
+
+// saveTargetSnapshot stores the resolved target set on the scan record.
+// Lists are sorted so that two runs over the same DB state produce identical snapshots.
+func saveTargetSnapshot(db *gorm.DB, scanID uint, snapshot *models.ScanTargetSnapshot) {
+	sort.Strings(snapshot.SeedURLs)
+	sort.Strings(snapshot.ExistingAssetURLs)
+	sort.Strings(snapshot.PathURLs)
+	sort.Strings(snapshot.TechDetectURLs)
+	sort.Strings(snapshot.TruncatedSeedURLs)
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Printf("Error marshalling target snapshot for scan %d: %v", scanID, err)
+		return
+	}
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Update("target_snapshot", string(data)).Error; err != nil {
+		log.Printf("Error saving target snapshot for scan %d: %v", scanID, err)
 	}
 }
 
@@ -355,6 +799,9 @@ func saveSubdomains(db *gorm.DB, rootDomainID uint, scanID uint, subdomains map[
 	}
 
 	var modelsToCreate []models.Subdomain
+	seenAt := time.Now()
+	deniedSuffixes := deniedHostSuffixes()
+	outOfScope := outOfScopePatterns(db, rootDomainID)
 	for sub := range subdomains {
 		// --- IP Address Filtering ---
 		// Check if the 'sub' string is a valid IP address. If so, skip it.
@@ -363,14 +810,23 @@ func saveSubdomains(db *gorm.DB, rootDomainID uint, scanID uint, subdomains map[
 			continue // Don't save IP addresses as subdomains
 		}
 		// --- End IP Filtering ---
+		if isDeniedHostname(sub, deniedSuffixes) {
+			log.Printf("Skipping %s: matches HOSTNAME_DENY_SUFFIXES", sub)
+			continue
+		}
+		if isOutOfScope(sub, outOfScope) {
+			log.Printf("Skipping %s: matches an out-of-scope rule of the organization", sub)
+			continue
+		}
 
 		// Correct field name is Hostname, ScanID is a pointer
 		modelsToCreate = append(modelsToCreate, models.Subdomain{
 			Hostname:     sub,
 			RootDomainID: rootDomainID,
-			ScanID:       &scanID,    // Pass address of scanID
-			DiscoveredAt: time.Now(), // Set discovery time
-			IsActive:     true,       // Assume active initially, maybe verify later?
+			ScanID:       &scanID, // Pass address of scanID
+			DiscoveredAt: seenAt,  // Set discovery time (kept on conflict)
+			LastSeenAt:   &seenAt, // Refreshed on conflict
+			IsActive:     true,    // Assume active initially, maybe verify later?
 		})
 	}
 
@@ -382,10 +838,10 @@ func saveSubdomains(db *gorm.DB, rootDomainID uint, scanID uint, subdomains map[
 	// For SQLite/MySQL: Clauses(clause.Insert{Modifier: "IGNORE"}) - Check GORM docs for specifics
 	// Use GORM's batch insert with conflict handling (ignore duplicates based on hostname and root_domain_id)
 	// This requires a unique constraint on (hostname, root_domain_id) in the DB schema.
-	log.Printf("Attempting to save %d discovered subdomains for scan %d (duplicates will be ignored)...", len(modelsToCreate), scanID)
+	log.Printf("Attempting to save %d discovered subdomains for scan %d (duplicates only refresh last_seen_at)...", len(modelsToCreate), scanID)
 	result := db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "hostname"}, {Name: "root_domain_id"}}, // Specify conflict columns
-		DoNothing: true,                                                          // Ignore duplicates
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen_at"}),            // Keep discovered_at, mark as re-observed
 	}).Create(&modelsToCreate)
 	if result.Error != nil {
 		return savedSubdomainIDs, fmt.Errorf("failed to save subdomains: %w", result.Error)
@@ -412,6 +868,7 @@ func saveSubdomains(db *gorm.DB, rootDomainID uint, scanID uint, subdomains map[
 		for _, sub := range fetchedSubdomains {
 			savedSubdomainIDs[sub.Hostname] = sub.ID
 		}
+		notifyNewSubdomains(newSubdomainEvents(fetchedSubdomains, seenAt, scanID, SubdomainSourceDiscovery))
 		log.Printf("Fetched %d subdomain IDs for potential screenshot linking (Scan ID: %d).", len(savedSubdomainIDs), scanID)
 	}
 
@@ -420,115 +877,45 @@ func saveSubdomains(db *gorm.DB, rootDomainID uint, scanID uint, subdomains map[
 
 // ExecuteSubdomainScan performs subdomain enumeration or targets a specific subdomain based on scanType.
 func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint, scanID uint, scanTemplate *models.ScanTemplate) {
+	runSubdomainScan(targetHost, scanType, rootDomainID, scanID, scanTemplate, "")
+}
+
+// ResumeSubdomainScan runs a failed or interrupted scan, set back to pending, again from resumeFrom (one of
+// ResumeStages). The stages before it are skipped: the subdomains and endpoints they saved are the input of
+// the remaining ones.
+func ResumeSubdomainScan(targetHost string, scanType string, rootDomainID uint, scanID uint, scanTemplate *models.ScanTemplate, resumeFrom string) {
+	runSubdomainScan(targetHost, scanType, rootDomainID, scanID, scanTemplate, resumeFrom)
+}
+
+// runSubdomainScan runs a scan from resumeFrom, or from the start if it is empty.
+func runSubdomainScan(targetHost string, scanType string, rootDomainID uint, scanID uint, scanTemplate *models.ScanTemplate, resumeFrom string) {
 	db := database.GetDB()
 	if scanTemplate == nil {
 		log.Printf("Error: ExecuteSubdomainScan called with nil scanTemplate for Scan ID: %d", scanID)
 		updateScanStatus(db, scanID, "failed", "Internal error: Scan template missing")
 		return
 	}
-
-	// --- Parse Scan Template Configuration (using shared models) ---
-	var subdomainSection models.ScanSectionConfig // Use shared model
-	var urlSection models.ScanSectionConfig       // Use shared model
-	// Parameter section parsing would go here if needed
-
-	// Default values (will be used if section is disabled or parsing fails)
-	subfinderEnabled := true                                                                          // Assume enabled by default for root_domain scans
-	subfinderOptions := map[string]interface{}{"threads": 10, "timeout": 30, "maxEnumerationTime": 5} // Default options
-
-	urlScanEnabled := true
-	// Default options for Katana (assuming it's the primary URL tool)
-	katanaOptions := map[string]interface{}{"maxDepth": 3, "concurrency": 10, "parallelism": 10, "rateLimit": 150, "timeout": 10}
-	katanaOutputFile := "" // Initialize output file path
-
-	// Parse Subdomain Config only if it's a root domain scan
-	if scanType == "root_domain" {
-		if scanTemplate.SubdomainScanConfig != "" {
-			err := json.Unmarshal([]byte(scanTemplate.SubdomainScanConfig), &subdomainSection) // Unmarshal into models.ScanSectionConfig
-			if err != nil {
-				log.Printf("Warning: Failed to parse SubdomainScanConfig JSON for template %d: %v. Using defaults.", scanTemplate.ID, err)
-			} else {
-				if !subdomainSection.Enabled {
-					subfinderEnabled = false
-					log.Printf("Subdomain discovery disabled by template %d.", scanTemplate.ID)
-				} else {
-					if toolCfg, ok := subdomainSection.Tools["subfinder"]; ok {
-						subfinderEnabled = toolCfg.Enabled
-						if subfinderEnabled {
-							subfinderOptions = parseToolOptions(toolCfg.Options)
-							// Ensure defaults are present if not specified in options
-							if _, ok := subfinderOptions["threads"]; !ok {
-								subfinderOptions["threads"] = 10
-							}
-							if _, ok := subfinderOptions["timeout"]; !ok {
-								subfinderOptions["timeout"] = 30
-							}
-							if _, ok := subfinderOptions["maxEnumerationTime"]; !ok {
-								subfinderOptions["maxEnumerationTime"] = 5
-							}
-						}
-					} else {
-						subfinderEnabled = false // Tool not defined in config
-					}
-				}
-			}
-		} else {
-			log.Printf("Scan template %d has no SubdomainScanConfig. Using defaults (Subfinder enabled for root domain scan).", scanTemplate.ID)
-		}
-	} else {
-		// If it's a subdomain scan, disable discovery tools regardless of template
-		subfinderEnabled = false
-		log.Printf("Subdomain discovery skipped for specific subdomain scan (Scan ID: %d, Target: %s)", scanID, targetHost)
+	if err := CheckTemplateWordlists(scanTemplate); err != nil {
+		log.Printf("Error: Scan %d cannot start, template %d has an invalid wordlist: %v", scanID, scanTemplate.ID, err)
+		updateScanStatus(db, scanID, "failed", fmt.Sprintf("Invalid wordlist: %v", err))
+		return
 	}
 
-	// Parse URL Config (applies to both scan types)
-	if scanTemplate.URLScanConfig != "" {
-		err := json.Unmarshal([]byte(scanTemplate.URLScanConfig), &urlSection) // Unmarshal into models.ScanSectionConfig
-		if err != nil {
-			log.Printf("Warning: Failed to parse URLScanConfig JSON for template %d: %v. Using defaults.", scanTemplate.ID, err)
-			// Keep default value (urlScanEnabled=true) if parsing fails
-		} else {
-			urlScanEnabled = urlSection.Enabled // Check if the whole section is enabled
-			if urlScanEnabled {
-				// Assuming 'katana' is the primary tool for URL scanning based on the key used in db.go
-				if toolCfg, ok := urlSection.Tools["katana"]; ok && toolCfg.Enabled {
-					katanaOptions = parseToolOptions(toolCfg.Options) // Parse general options first
-
-					// Check specifically for the outputFile option to enable file output
-					for _, opt := range toolCfg.Options {
-						if strings.HasPrefix(opt, "outputFile") { // Check if option exists (e.g., "outputFile=true", "outputFile")
-							katanaOutputFile = fmt.Sprintf("/tmp/scan_%d_katana_results.txt", scanID)
-							log.Printf("Katana output file enabled by template, will write to: %s", katanaOutputFile)
-							break // Found the option, no need to check further
-						}
-					}
-
-					// Ensure defaults for other options are present if not specified
-					if _, ok := katanaOptions["maxDepth"]; !ok {
-						katanaOptions["maxDepth"] = 3
-					}
-					if _, ok := katanaOptions["concurrency"]; !ok {
-						katanaOptions["concurrency"] = 10
-					}
-					if _, ok := katanaOptions["parallelism"]; !ok {
-						katanaOptions["parallelism"] = 10
-					}
-					if _, ok := katanaOptions["rateLimit"]; !ok {
-						katanaOptions["rateLimit"] = 150
-					}
-					if _, ok := katanaOptions["timeout"]; !ok {
-						katanaOptions["timeout"] = 10
-					}
-				} else {
-					urlScanEnabled = false // Disable URL scan if section enabled but katana tool is not defined or disabled
-					log.Printf("URL scanning disabled for template %d (Katana tool not enabled).", scanTemplate.ID)
-				}
-			} else {
-				log.Printf("URL scanning disabled by template %d.", scanTemplate.ID)
-			}
-		}
-	} else {
-		log.Printf("Scan template %d has no URLScanConfig. Using defaults.", scanTemplate.ID)
+	// --- Parse Scan Template Configuration (see ResolveTemplateConfig) ---
+	templateConfig := ResolveTemplateConfig(scanTemplate, scanType)
+	applyScanOverrides(db, scanID, &templateConfig) // One-off option changes given when the scan was started
+	saveEffectiveConfig(db, scanID, templateConfig)
+	for _, note := range templateConfig.Notes {
+		log.Printf("Scan %d (template %d): %s", scanID, scanTemplate.ID, note)
+	}
+	subfinderEnabled := templateConfig.SubfinderEnabled
+	subfinderOptions := templateConfig.SubfinderOptions
+	urlScanEnabled := templateConfig.URLScanEnabled
+	katanaOptions := templateConfig.KatanaOptions
+	katanaOutputFile := ""
+	if templateConfig.KatanaOutputFile {
+		katanaOutputFile = filepath.Join(config.ScanDir(scanID), "katana_results.txt")
+		log.Printf("Katana output file enabled by template, will write to: %s", katanaOutputFile)
 	}
 
 	// Parse Parameter Config (Example structure - adapt if needed)
@@ -537,213 +924,341 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 	// arjunOptions := map[string]interface{}{} // Default options for arjun
 	// if scanTemplate.ParameterScanConfig != "" { ... parse ... }
 
-	updateScanStatus(db, scanID, "running")
+	// Register with the job registry; cancelling the job (see CancelScan) stops the scan at its next phase
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	defer jobCancel()
+	job := jobs.StartScan(scanID, fmt.Sprintf("%s scan of %s", scanType, targetHost), jobCancel)
+	defer finishScanJob(db, job, scanID)
+
+	scanStartedAt := time.Now() // Assets discovered or changed from here on are new to this scan
+	resuming := resumeFrom != ""
+	if resuming {
+		// A resumed scan keeps the start of its first run, so its earlier stages' assets still count as new
+		var scan models.Scan
+		if err := db.Select("started_at").First(&scan, scanID).Error; err == nil {
+			scanStartedAt = scan.StartedAt
+		}
+	} else {
+		resumeFrom = PhaseDiscovery
+	}
+	if !updateScanStatus(db, scanID, "running") {
+		log.Printf("Scan %d is no longer pending (cancelled?), not starting it.", scanID)
+		return
+	}
+	if resuming {
+		db.Model(&models.Scan{}).Where("id = ?", scanID).Update("started_at", scanStartedAt)
+		log.Printf("Resuming scan %d from its %s stage.", scanID, resumeFrom)
+	}
+	saveToolVersions(db, scanID) // Record which tool versions produced this scan
+	// Time spent per phase, see GET /api/scans/:id/timing
+	timer := newPhaseTimer(db, scanID)
+	defer timer.stop()
+
+	// Requests of every phase to the same host are spaced by the scan's politeness delay
+	hostDelay, unregisterHostDelay := registerScanHostDelay(scanID, scanTemplate)
+	defer unregisterHostDelay()
+	if hostDelay > 0 {
+		log.Printf("Scan %d waits %s between requests to the same host.", scanID, hostDelay)
+	}
+	defer registerScanSession(db, scanID)() // Authenticated scans crawl and screenshot with a recorded session
+	defer registerScanScreenshots(scanID)() // Every phase screenshots a URL at most once per scan
+
+	// Temporary tool input files live in the scan directory and go once the scan ends
+	scanTempDir := filepath.Join(config.ScanDir(scanID), "tmp")
+	if err := os.MkdirAll(scanTempDir, 0700); err != nil {
+		log.Printf("Warning: Could not create scan directory %s, using the system temp directory: %v", scanTempDir, err)
+		scanTempDir = ""
+	}
+	defer cleanupScanDir(scanID)
 	log.Printf("Starting scan for %s (Type: %s, Scan ID: %d, Template: %s)", targetHost, scanType, scanID, scanTemplate.Name)
 
-	// --- Screenshot Existing Assets (if enabled) ---
-	// This part screenshots assets *before* discovery/targeting the specific subdomain.
-	// Keep this logic as is, it screenshots based on rootDomainID.
-	var initialScreenshotWG sync.WaitGroup
-	if scanTemplate.ScreenshotEnabled {
-		log.Printf("Screenshotting enabled: Fetching existing assets for scan %d...", scanID)
-
-		// Fetch existing subdomains
-		var existingSubdomainsDB []models.Subdomain
-		if err := db.Where("root_domain_id = ?", rootDomainID).Find(&existingSubdomainsDB).Error; err != nil {
-			log.Printf("Error fetching existing subdomains for screenshotting (Scan ID: %d): %v", scanID, err)
-			// Optionally add to scanErrors? For now, just log.
-		} else {
-			log.Printf("Found %d existing subdomains to potentially screenshot.", len(existingSubdomainsDB))
-			for _, sub := range existingSubdomainsDB {
-				// Need a loop variable copy for the goroutine
-				currentSub := sub
-				urlsToTry := []string{
-					fmt.Sprintf("http://%s", currentSub.Hostname),
-					fmt.Sprintf("https://%s", currentSub.Hostname),
+	// Snapshot of the resolved targets, filled in by each target-gathering step below
+	targetSnapshot := &models.ScanTargetSnapshot{}
+	if resuming {
+		targetSnapshot = resumedTargetSnapshot(db, scanID, resumeFrom)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex // Mutex to protect access to shared resources (scanErrors, maps)
+	var scanErrors []string
+	var subfinderSourceErrors []string            // Sources that reported errors during subfinder enumeration
+	activeSubdomains := make(map[string]struct{}) // Map of active subdomains found/targeted
+	savedSubdomainMap := make(map[string]uint)    // Map of hostname -> saved ID
+	targetUnreachable := false                    // Subdomain scan target that did not answer, see VERIFY_SUBDOMAIN_TARGET
+
+	// Scan.ResumePhase follows the first stage that has not completed without errors, see POST /api/scans/:id/resume
+	resumePhase := resumeFrom
+	setResumePhase(db, scanID, resumePhase)
+	runStage := func(stage string) bool { return resumeStageIndex(stage) >= resumeStageIndex(resumeFrom) }
+	completeStage := func(stage string, next string, errorsBefore int) {
+		mu.Lock()
+		failed := len(scanErrors) > errorsBefore
+		mu.Unlock()
+		if resumePhase != stage || failed {
+			return // This stage or an earlier one has to run again
+		}
+		resumePhase = next
+		setResumePhase(db, scanID, next)
+	}
+
+	if runStage(PhaseDiscovery) {
+		// --- Screenshot Existing Assets (if enabled) ---
+		// This part screenshots assets *before* discovery/targeting the specific subdomain.
+		// By default every asset of the root domain is included; templates with ScreenshotTargetOnly
+		// restrict subdomain scans to the target subdomain (see ExistingScreenshotTargets).
+		var initialScreenshotWG sync.WaitGroup
+		if scanTemplate.ScreenshotEnabled {
+			timer.start(PhaseExistingScreenshots)
+			log.Printf("Screenshotting enabled: Fetching existing assets for scan %d...", scanID)
+
+			existingTargets, err := ExistingScreenshotTargets(db, rootDomainID, scanType, targetHost, scanTemplate.ScreenshotTargetOnly, templateScreenshotCriteria(scanTemplate))
+			if err != nil {
+				log.Printf("Error fetching existing assets for screenshotting (Scan ID: %d): %v", scanID, err)
+				// Optionally add to scanErrors? For now, just log.
+			}
+			log.Printf("Found %d existing asset URLs to screenshot.", len(existingTargets))
+			for _, target := range existingTargets {
+				targetSnapshot.ExistingAssetURLs = append(targetSnapshot.ExistingAssetURLs, target.URL)
+				if !claimScanScreenshot(scanID, target.URL) {
+					continue
 				}
-				for _, urlStr := range urlsToTry {
-					if ShouldScreenshot(urlStr) {
-						initialScreenshotWG.Add(1)
-						go func(targetURL string, subID uint) {
-							defer initialScreenshotWG.Done()
-							screenshotCtx := context.Background()
-							err := TakeScreenshot(screenshotCtx, targetURL, scanID, &subID, nil)
-							if err != nil {
-								log.Printf("Initial screenshot attempt finished for %s (Subdomain ID: %d, Scan ID: %d) - see previous logs for details.", targetURL, subID, scanID)
-							}
-						}(urlStr, currentSub.ID)
+				initialScreenshotWG.Add(1)
+				go func(target ExistingScreenshotTarget) {
+					defer initialScreenshotWG.Done()
+					screenshotCtx := context.Background()
+					screenshot, err := takeScreenshot(screenshotCtx, target.URL, scanID, target.SubdomainID, target.EndpointID, ScreenshotViewportDesktop)
+					if err != nil {
+						log.Printf("Initial screenshot attempt finished for %s (Scan ID: %d) - see previous logs for details.", target.URL, scanID)
+					} else if scanTemplate.ScreenshotMobile && target.SubdomainID != nil && screenshot.Status != ScreenshotStatusFailed {
+						screenshotHostMobile(screenshotCtx, scanID, target.URL, *target.SubdomainID)
 					}
-				}
+				}(target)
 			}
+			// Wait for initial screenshots before proceeding with discovery phases?
+			// This ensures existing assets are attempted even if discovery is off.
+			log.Printf("Waiting for initial screenshot tasks to complete for scan %d...", scanID)
+			initialScreenshotWG.Wait()
+			log.Printf("Initial screenshot tasks finished for scan %d.", scanID)
+			timer.stop()
 		}
+		// --- End Screenshot Existing Assets ---
 
-		// Fetch existing endpoints (and their subdomains for URL construction)
-		var existingEndpointsDB []models.Endpoint
-		// Get Subdomain IDs first
-		subdomainIDs := make([]uint, len(existingSubdomainsDB))
-		for i, sub := range existingSubdomainsDB {
-			subdomainIDs[i] = sub.ID
+		if scanCancelled(jobCtx, scanID, "subdomain discovery") {
+			return
 		}
+		job.SetPhase("subdomain discovery")
 
-		if len(subdomainIDs) > 0 {
-			if err := db.Preload("Subdomain").Where("subdomain_id IN ?", subdomainIDs).Find(&existingEndpointsDB).Error; err != nil {
-				log.Printf("Error fetching existing endpoints for screenshotting (Scan ID: %d): %v", scanID, err)
-			} else {
-				log.Printf("Found %d existing endpoints to potentially screenshot.", len(existingEndpointsDB))
-				for _, ep := range existingEndpointsDB {
-					// Need loop variable copy
-					currentEp := ep
-					if currentEp.Subdomain.Hostname == "" || currentEp.Path == "" {
-						continue // Skip if essential info is missing
-					}
-					// Construct URL (try https first, then http?) - Let's try both like subdomains
-					path := currentEp.Path
-					if !strings.HasPrefix(path, "/") {
-						path = "/" + path
-					}
-					urlsToTry := []string{
-						fmt.Sprintf("http://%s%s", currentEp.Subdomain.Hostname, path),
-						fmt.Sprintf("https://%s%s", currentEp.Subdomain.Hostname, path),
+		// Context with timeout for the entire subdomain scan phase (consider making this configurable too?)
+		ctx, cancel := context.WithTimeout(jobCtx, 15*time.Minute) // Increased default timeout slightly
+		defer cancel()
+
+		allSubdomains := make(map[string]struct{})
+		var verifiedAddresses map[string]string // Hostname -> IPv4 address httpx resolved, if VERIFY_STORE_IPS
+		if config.GetBool("VERIFY_STORE_IPS", true) {
+			verifiedAddresses = make(map[string]string)
+		}
+
+		if scanType == "root_domain" {
+			// --- Root Domain Scan: Discover and Verify ---
+			// Use the 'allSubdomains' map declared earlier (line 633)
+			// allSubdomains := make(map[string]struct{}) // REMOVE THIS REDECLARATION
+
+			// Run Subfinder (if enabled in parsed config)
+			if subfinderEnabled {
+				timer.start(PhaseDiscovery)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					log.Printf("Running subfinder for %s...", targetHost)
+					subfinderTimeout := time.Duration(getIntOption(subfinderOptions, "maxEnumerationTime", 5)+1) * time.Minute
+					subfinderCtx, subfinderCancel := context.WithTimeout(ctx, subfinderTimeout)
+					defer subfinderCancel()
+					subs, sourceCounts, sourceIssues, err := runSubfinder(subfinderCtx, targetHost, subfinderOptions, scanTempDir)
+					if sourceCounts != nil {
+						saveSubfinderSources(db, scanID, sourceCounts)
 					}
-					for _, urlStr := range urlsToTry {
-						if ShouldScreenshot(urlStr) {
-							initialScreenshotWG.Add(1)
-							go func(targetURL string, endpointID uint) {
-								defer initialScreenshotWG.Done()
-								screenshotCtx := context.Background()
-								err := TakeScreenshot(screenshotCtx, targetURL, scanID, nil, &endpointID)
-								if err != nil {
-									log.Printf("Initial screenshot attempt finished for %s (Endpoint ID: %d, Scan ID: %d) - see previous logs for details.", targetURL, endpointID, scanID)
-								}
-							}(urlStr, currentEp.ID)
+					mu.Lock()
+					subfinderSourceErrors = sourceIssues
+					if err != nil {
+						log.Printf("Subfinder error for %s: %v", targetHost, err)
+						scanErrors = append(scanErrors, fmt.Sprintf("Subfinder: %v", err))
+					} else if subs != nil {
+						log.Printf("Subfinder found %d results for %s.", len(subs), targetHost)
+						for sub := range subs {
+							allSubdomains[sub] = struct{}{}
 						}
 					}
-				}
+					mu.Unlock()
+				}()
+			} else {
+				log.Printf("Subfinder skipped for scan %d (disabled in template or not root_domain scan).", scanID)
 			}
-		}
-		// Wait for initial screenshots before proceeding with discovery phases?
-		// This ensures existing assets are attempted even if discovery is off.
-		log.Printf("Waiting for initial screenshot tasks to complete for scan %d...", scanID)
-		initialScreenshotWG.Wait()
-		log.Printf("Initial screenshot tasks finished for scan %d.", scanID)
-	}
-	// --- End Screenshot Existing Assets ---
 
-	// Context with timeout for the entire subdomain scan phase (consider making this configurable too?)
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute) // Increased default timeout slightly
-	defer cancel()
+			wg.Wait() // Wait for discovery phase
 
-	allSubdomains := make(map[string]struct{})
-	var wg sync.WaitGroup
-	var mu sync.Mutex // Mutex to protect access to shared resources (scanErrors, maps)
-	var scanErrors []string
-	activeSubdomains := make(map[string]struct{}) // Map of active subdomains found/targeted
-	savedSubdomainMap := make(map[string]uint)    // Map of hostname -> saved ID
+			// Ensure the root domain itself is included
+			mu.Lock()
+			if _, exists := allSubdomains[targetHost]; !exists {
+				log.Printf("Explicitly adding root domain '%s' to potential list for scan %d", targetHost, scanID)
+				allSubdomains[targetHost] = struct{}{}
+			}
+			mu.Unlock()
+			outOfScope := outOfScopePatterns(db, rootDomainID)
+			dropOutOfScopeHosts(allSubdomains, outOfScope, scanID) // Excluded hosts are not even verified
 
-	if scanType == "root_domain" {
-		// --- Root Domain Scan: Discover and Verify ---
-		// Use the 'allSubdomains' map declared earlier (line 633)
-		// allSubdomains := make(map[string]struct{}) // REMOVE THIS REDECLARATION
-
-		// Run Subfinder (if enabled in parsed config)
-		if subfinderEnabled {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				log.Printf("Running subfinder for %s...", targetHost)
-				subfinderTimeout := time.Duration(getIntOption(subfinderOptions, "maxEnumerationTime", 5)+1) * time.Minute
-				subfinderCtx, subfinderCancel := context.WithTimeout(ctx, subfinderTimeout)
-				defer subfinderCancel()
-				subs, err := runSubfinder(subfinderCtx, targetHost, subfinderOptions)
+			log.Printf("Found %d unique potential subdomains in total for %s (Scan ID: %d). Verifying active hosts...", len(allSubdomains), targetHost, scanID)
+
+			// Verify Active Subdomains using httpx
+			timer.start(PhaseVerification)
+			verifiedSubs, certNames, verifyErr := verifyActiveSubdomains(ctx, allSubdomains, scanTempDir, verifiedAddresses)
+			if verifyErr != nil {
+				log.Printf("Error verifying active subdomains for scan %d: %v", scanID, verifyErr)
 				mu.Lock()
-				if err != nil {
-					log.Printf("Subfinder error for %s: %v", targetHost, err)
-					scanErrors = append(scanErrors, fmt.Sprintf("Subfinder: %v", err))
-				} else if subs != nil {
-					log.Printf("Subfinder found %d results for %s.", len(subs), targetHost)
-					for sub := range subs {
-						allSubdomains[sub] = struct{}{}
-					}
-				}
+				scanErrors = append(scanErrors, fmt.Sprintf("Subdomain verification: %v", verifyErr))
 				mu.Unlock()
-			}()
+			}
+			activeSubdomains = verifiedSubs // Assign verified results
+
+			// Certificates presented during verification often name subdomains no source reported. In-scope
+			// names are verified like the others; certificates of those hosts are followed up to
+			// maxCertNameRounds times.
+			certNameCount := 0
+			for round := 0; verifyErr == nil && round < maxCertNameRounds && ctx.Err() == nil; round++ {
+				newNames := inScopeCertNames(certNames, targetHost, allSubdomains)
+				dropOutOfScopeHosts(newNames, outOfScope, scanID)
+				if len(newNames) == 0 {
+					break
+				}
+				log.Printf("Found %d new subdomains of %s in TLS certificates (Scan ID: %d). Verifying...", len(newNames), targetHost, scanID)
+				for name := range newNames {
+					allSubdomains[name] = struct{}{}
+				}
+				certNameCount += len(newNames)
+				var verifiedNames map[string]struct{}
+				verifiedNames, certNames, verifyErr = verifyActiveSubdomains(ctx, newNames, scanTempDir, verifiedAddresses)
+				if verifyErr != nil {
+					log.Printf("Error verifying subdomains from TLS certificates for scan %d: %v", scanID, verifyErr)
+					mu.Lock()
+					scanErrors = append(scanErrors, fmt.Sprintf("TLS certificate subdomain verification: %v", verifyErr))
+					mu.Unlock()
+					break
+				}
+				for name := range verifiedNames {
+					activeSubdomains[name] = struct{}{}
+				}
+			}
+			if certNameCount > 0 {
+				log.Printf("TLS certificates named %d new subdomains of %s (Scan ID: %d).", certNameCount, targetHost, scanID)
+			}
+
+			// Ensure the root domain itself is considered "active" if it was in the original list
+			mu.Lock()
+			if _, existsInOriginal := allSubdomains[targetHost]; existsInOriginal {
+				if _, existsInActive := activeSubdomains[targetHost]; !existsInActive {
+					log.Printf("Explicitly re-adding root domain '%s' to active list for saving (Scan ID: %d)", targetHost, scanID)
+					activeSubdomains[targetHost] = struct{}{}
+				}
+			}
+			mu.Unlock()
+			timer.stop()
+
+		} else if scanType == "subdomain" {
+			// --- Specific Subdomain Scan: Target is the only active one ---
+			log.Printf("Targeting specific subdomain: %s (Scan ID: %d)", targetHost, scanID)
+			activeSubdomains[targetHost] = struct{}{} // Only target the input host
+			if isOutOfScope(targetHost, outOfScopePatterns(db, rootDomainID)) {
+				log.Printf("Target %s of scan %d matches an out-of-scope rule of the organization, it is not requested.", targetHost, scanID)
+			} else if config.GetBool("VERIFY_SUBDOMAIN_TARGET", true) {
+				timer.start(PhaseVerification)
+				targetUnreachable = !verifySubdomainTarget(ctx, db, rootDomainID, scanID, targetHost, scanTempDir, verifiedAddresses)
+				timer.stop()
+				if targetUnreachable {
+					delete(activeSubdomains, targetHost)
+				}
+			}
 		} else {
-			log.Printf("Subfinder skipped for scan %d (disabled in template or not root_domain scan).", scanID)
+			// Should not happen if called correctly from handler
+			log.Printf("Error: Unknown scanType '%s' for scan ID %d", scanType, scanID)
+			updateScanStatus(db, scanID, "failed", fmt.Sprintf("Internal error: Unknown scanType '%s'", scanType))
+			return
 		}
 
-		wg.Wait() // Wait for discovery phase
-
-		// Ensure the root domain itself is included
-		mu.Lock()
-		if _, exists := allSubdomains[targetHost]; !exists {
-			log.Printf("Explicitly adding root domain '%s' to potential list for scan %d", targetHost, scanID)
-			allSubdomains[targetHost] = struct{}{}
+		// --- Save Active/Targeted Subdomains ---
+		if len(activeSubdomains) > 0 {
+			timer.start(PhaseSave)
+			log.Printf("Saving %d active/targeted subdomains for %s (Scan ID: %d)", len(activeSubdomains), targetHost, scanID)
+			var saveErr error
+			savedSubdomainMap, saveErr = saveSubdomains(db, rootDomainID, scanID, activeSubdomains) // Use activeSubdomains map
+			if saveErr != nil {
+				log.Printf("Error saving active subdomains or fetching their IDs for scan %d: %v", scanID, saveErr)
+				mu.Lock()
+				scanErrors = append(scanErrors, fmt.Sprintf("Subdomain Save/ID Fetch: %v", saveErr))
+				mu.Unlock()
+			}
+			if len(verifiedAddresses) > 0 {
+				saveVerifiedAddresses(db, scanID, savedSubdomainMap, verifiedAddresses)
+			}
+			timer.stop()
+		} else {
+			log.Printf("No active/targeted subdomains to save for scan %d.", scanID)
 		}
-		mu.Unlock()
-
-		log.Printf("Found %d unique potential subdomains in total for %s (Scan ID: %d). Verifying active hosts...", len(allSubdomains), targetHost, scanID)
 
-		// Verify Active Subdomains using httpx
-		verifiedSubs, verifyErr := verifyActiveSubdomains(ctx, allSubdomains)
-		if verifyErr != nil {
-			log.Printf("Error verifying active subdomains for scan %d: %v", scanID, verifyErr)
-			mu.Lock()
-			scanErrors = append(scanErrors, fmt.Sprintf("Subdomain verification: %v", verifyErr))
-			mu.Unlock()
+		if scanCancelled(jobCtx, scanID, "DNS enrichment, TLS checks, sensitive files and screenshots") {
+			return
 		}
-		activeSubdomains = verifiedSubs // Assign verified results
 
-		// Ensure the root domain itself is considered "active" if it was in the original list
-		mu.Lock()
-		if _, existsInOriginal := allSubdomains[targetHost]; existsInOriginal {
-			if _, existsInActive := activeSubdomains[targetHost]; !existsInActive {
-				log.Printf("Explicitly re-adding root domain '%s' to active list for saving (Scan ID: %d)", targetHost, scanID)
-				activeSubdomains[targetHost] = struct{}{}
-			}
+		// --- DNS Enrichment (if the template enables the "dns" tool) ---
+		if dnsConfig, enabled := dnsEnrichmentConfig(scanTemplate); enabled && len(savedSubdomainMap) > 0 {
+			log.Printf("Resolving IP addresses for %d subdomains (Scan ID: %d)...", len(savedSubdomainMap), scanID)
+			job.SetPhase("DNS enrichment")
+			timer.start(PhaseDNS)
+			enrichSubdomainIPs(db, scanID, savedSubdomainMap, dnsConfig)
+			timer.stop()
 		}
-		mu.Unlock()
 
-	} else if scanType == "subdomain" {
-		// --- Specific Subdomain Scan: Target is the only active one ---
-		log.Printf("Targeting specific subdomain: %s (Scan ID: %d)", targetHost, scanID)
-		activeSubdomains[targetHost] = struct{}{} // Only target the input host
-	} else {
-		// Should not happen if called correctly from handler
-		log.Printf("Error: Unknown scanType '%s' for scan ID %d", scanType, scanID)
-		updateScanStatus(db, scanID, "failed", fmt.Sprintf("Internal error: Unknown scanType '%s'", scanType))
-		return
-	}
+		// --- TLS Checks (if TLS_VERIFY requires valid certificates) ---
+		if tlsVerifyEnabled() && len(savedSubdomainMap) > 0 {
+			log.Printf("Checking the TLS certificates of %d subdomains (Scan ID: %d)...", len(savedSubdomainMap), scanID)
+			job.SetPhase("TLS checks")
+			timer.start(PhaseTLS)
+			checkSubdomainsTLS(jobCtx, db, scanID, savedSubdomainMap)
+			timer.stop()
+		}
 
-	// --- Save Active/Targeted Subdomains ---
-	if len(activeSubdomains) > 0 {
-		log.Printf("Saving %d active/targeted subdomains for %s (Scan ID: %d)", len(activeSubdomains), targetHost, scanID)
-		var saveErr error
-		savedSubdomainMap, saveErr = saveSubdomains(db, rootDomainID, scanID, activeSubdomains) // Use activeSubdomains map
-		if saveErr != nil {
-			log.Printf("Error saving active subdomains or fetching their IDs for scan %d: %v", scanID, saveErr)
-			mu.Lock()
-			scanErrors = append(scanErrors, fmt.Sprintf("Subdomain Save/ID Fetch: %v", saveErr))
-			mu.Unlock()
+		// --- Sensitive Files (if the template enables the "sensitive_files" tool) ---
+		if paths, enabled := sensitiveFilesPaths(scanTemplate); enabled && len(savedSubdomainMap) > 0 {
+			log.Printf("Probing %d subdomains for %d sensitive file paths (Scan ID: %d)...", len(savedSubdomainMap), len(paths), scanID)
+			job.SetPhase("sensitive files")
+			timer.start(PhaseSensitiveFiles)
+			probeSensitiveFiles(jobCtx, db, scanID, savedSubdomainMap, paths)
+			timer.stop()
 		}
-	} else {
-		log.Printf("No active/targeted subdomains to save for scan %d.", scanID)
-	}
 
-	// --- Take Screenshots (if enabled and subdomains were saved/fetched) ---
-	if scanTemplate.ScreenshotEnabled && len(savedSubdomainMap) > 0 {
-		log.Printf("Screenshotting enabled for scan %d. Starting screenshot process for %d saved/fetched subdomains.", scanID, len(savedSubdomainMap))
-		var screenshotWG sync.WaitGroup
+		// --- Take Screenshots (if enabled and subdomains were saved/fetched) ---
+		if scanTemplate.ScreenshotEnabled && len(savedSubdomainMap) > 0 {
+			log.Printf("Screenshotting enabled for scan %d. Starting screenshot process for %d saved/fetched subdomains.", scanID, len(savedSubdomainMap))
+			job.SetPhase("screenshots")
+			timer.start(PhaseScreenshots)
+			var screenshotWG sync.WaitGroup
+			// Template paths such as /login are screenshotted on the hosts whose base URL answered
+			screenshotPaths := templateScreenshotPaths(scanTemplate)
 
-		for hostname, subID := range savedSubdomainMap { // Iterate over the map of saved hostnames and their IDs
-			urlsToTry := []string{
-				fmt.Sprintf("http://%s", hostname), // Use hostname from the map key
-				fmt.Sprintf("https://%s", hostname),
-			}
+			for hostname, subID := range savedSubdomainMap { // Iterate over the map of saved hostnames and their IDs
+				urlsToTry := []string{
+					fmt.Sprintf("http://%s", hostname), // Use hostname from the map key
+					fmt.Sprintf("https://%s", hostname),
+				}
 
-			for _, urlStr := range urlsToTry {
-				if ShouldScreenshot(urlStr) {
+				for _, urlStr := range urlsToTry {
+					if !ShouldScreenshot(urlStr) {
+						continue
+					}
+					claimed := claimScanScreenshot(scanID, urlStr)
+					if !claimed && len(screenshotPaths) == 0 {
+						continue
+					}
 					screenshotWG.Add(1)
-					go func(targetURL string, currentSubID uint) {
+					go func(targetURL string, currentSubID uint, claimed bool) {
 						defer screenshotWG.Done()
 						// semaphore <- struct{}{} // Acquire semaphore slot
 						// defer func() { <-semaphore }() // Release semaphore slot
@@ -751,29 +1266,64 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 						// Use a separate context for each screenshot task? Or reuse the main scan context?
 						// Reusing main context might cause issues if it times out early.
 						// Create a new background context for robustness.
-						screenshotCtx := context.Background()                                       // Use background context for independence
-						err := TakeScreenshot(screenshotCtx, targetURL, scanID, &currentSubID, nil) // Pass subdomain ID
-						if err != nil {
-							// TakeScreenshot already logs errors, no need to log again unless adding context
-							log.Printf("Screenshot attempt finished for %s (Subdomain ID: %d, Scan ID: %d) - see previous logs for details.", targetURL, currentSubID, scanID)
-							// Optionally add screenshot errors to scanErrors?
-							// mu.Lock()
-							// scanErrors = append(scanErrors, fmt.Sprintf("Screenshot %s: %v", targetURL, err))
-							// mu.Unlock()
+						screenshotCtx := context.Background() // Use background context for independence
+						var reached bool
+						if claimed {
+							screenshot, err := takeScreenshot(screenshotCtx, targetURL, scanID, &currentSubID, nil, ScreenshotViewportDesktop) // Pass subdomain ID
+							if err != nil {
+								// TakeScreenshot already logs errors, no need to log again unless adding context
+								log.Printf("Screenshot attempt finished for %s (Subdomain ID: %d, Scan ID: %d) - see previous logs for details.", targetURL, currentSubID, scanID)
+								// Optionally add screenshot errors to scanErrors?
+								// mu.Lock()
+								// scanErrors = append(scanErrors, fmt.Sprintf("Screenshot %s: %v", targetURL, err))
+								// mu.Unlock()
+							}
+							reached = err == nil && screenshot.Status != ScreenshotStatusFailed
+							if reached && scanTemplate.ScreenshotMobile {
+								screenshotHostMobile(screenshotCtx, scanID, targetURL, currentSubID)
+							}
+						} else {
+							reached = screenshotReached(db, scanID, targetURL) // Captured with the existing assets
+						}
+						if reached && len(screenshotPaths) > 0 {
+							pathURLs := screenshotHostPaths(screenshotCtx, scanID, targetURL, currentSubID, screenshotPaths)
+							mu.Lock()
+							targetSnapshot.PathURLs = append(targetSnapshot.PathURLs, pathURLs...)
+							mu.Unlock()
 						}
-					}(urlStr, subID)
+					}(urlStr, subID, claimed)
 				}
 			}
+			log.Printf("Waiting for screenshot tasks to complete for scan %d...", scanID)
+			screenshotWG.Wait()
+			log.Printf("Screenshot tasks finished for scan %d.", scanID)
+			timer.stop()
+		} else if scanTemplate.ScreenshotEnabled {
+			log.Printf("Screenshotting enabled for scan %d, but no active subdomains were successfully saved with IDs.", scanID)
+		} else {
+			log.Printf("Screenshotting disabled for scan %d.", scanID)
 		}
-		log.Printf("Waiting for screenshot tasks to complete for scan %d...", scanID)
-		screenshotWG.Wait()
-		log.Printf("Screenshot tasks finished for scan %d.", scanID)
-	} else if scanTemplate.ScreenshotEnabled {
-		log.Printf("Screenshotting enabled for scan %d, but no active subdomains were successfully saved with IDs.", scanID)
+		// --- End Screenshotting ---
 	} else {
-		log.Printf("Screenshotting disabled for scan %d.", scanID)
+		// Discovery completed in an earlier run: continue with the subdomains it saved
+		log.Printf("Subdomain discovery of scan %d completed before it was resumed, continuing with its saved subdomains.", scanID)
+		var loadErr error
+		savedSubdomainMap, loadErr = resumedScanSubdomains(db, rootDomainID, scanType, targetHost, scanStartedAt)
+		if loadErr != nil {
+			log.Printf("Error loading the saved subdomains of scan %d: %v", scanID, loadErr)
+			scanErrors = append(scanErrors, fmt.Sprintf("Subdomain Load: %v", loadErr))
+		}
+		for host := range savedSubdomainMap {
+			activeSubdomains[host] = struct{}{}
+		}
+		if scanType == "subdomain" && config.GetBool("VERIFY_SUBDOMAIN_TARGET", true) {
+			// The earlier run marked the target inactive if it did not answer
+			var inactive int64
+			db.Model(&models.Subdomain{}).Where("root_domain_id = ? AND hostname = ? AND is_active = ?", rootDomainID, targetHost, false).Count(&inactive)
+			targetUnreachable = inactive > 0
+		}
 	}
-	// --- End Screenshotting ---
+	completeStage(PhaseDiscovery, PhaseURLScan, 0)
 
 	// Update final status
 	finalStatus := "completed" // Assume success initially
@@ -786,8 +1336,19 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 		log.Printf("Subdomain scan %d completed successfully.", scanID)
 	}
 
+	if scanCancelled(jobCtx, scanID, "URL crawl") {
+		return
+	}
+
 	// --- Prepare for and Execute URL Scan (if enabled) ---
-	if urlScanEnabled {
+	errorsBefore := len(scanErrors)
+	if !runStage(PhaseURLScan) {
+		log.Printf("URL scan of scan %d completed before it was resumed, skipping.", scanID)
+	} else if targetUnreachable {
+		log.Printf("URL Scan skipped for scan %d (target %s did not answer).", scanID, targetHost)
+	} else if urlScanEnabled {
+		job.SetPhase("URL crawl")
+		timer.start(PhaseURLScan)
 		// Prepare the map of existing/target subdomains for URL scanner
 		urlScanSubdomainMap := &sync.Map{}
 		for host, id := range savedSubdomainMap {
@@ -812,9 +1373,24 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 			seedURLs = append(seedURLs, fmt.Sprintf("https://%s", targetHost))
 		}
 
-		log.Printf("Starting URL scan phase for scan %d with %d seeds.", scanID, len(seedURLs))
-		// Pass the correct targetHost (which is the root domain name for context)
-		urlScanErr := ExecuteURLScan(seedURLs, targetHost, rootDomainID, scanID, urlScanSubdomainMap, scanTemplate, katanaOptions, katanaOutputFile)
+		var urlScanErr error
+		if templateConfig.Katana.Mode == URLScanModeKnown {
+			// Known endpoints are re-requested instead of crawling; the root domain name gives the scope
+			job.SetPhase("known endpoint refresh")
+			rootDomainName := targetHost
+			if scanType == "subdomain" {
+				db.Model(&models.RootDomain{}).Where("id = ?", rootDomainID).Pluck("domain", &rootDomainName)
+			}
+			targetSnapshot.RefreshedEndpoints, urlScanErr = RefreshKnownEndpoints(jobCtx, targetHost, rootDomainName, rootDomainID, scanID, urlScanSubdomainMap, scanTemplate, katanaOptions)
+		} else {
+			targetSnapshot.SeedURLs = append(targetSnapshot.SeedURLs, seedURLs...)
+
+			log.Printf("Starting URL scan phase for scan %d with %d seeds.", scanID, len(seedURLs))
+			// Pass the correct targetHost (which is the root domain name for context)
+			var truncatedSeeds []string
+			truncatedSeeds, urlScanErr = ExecuteURLScan(seedURLs, targetHost, rootDomainID, scanID, urlScanSubdomainMap, scanTemplate, katanaOptions, katanaOutputFile)
+			targetSnapshot.TruncatedSeedURLs = append(targetSnapshot.TruncatedSeedURLs, truncatedSeeds...)
+		}
 		if urlScanErr != nil {
 			log.Printf("URL scan phase for scan %d finished with error: %v", scanID, urlScanErr)
 			mu.Lock()
@@ -823,17 +1399,61 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 		} else {
 			log.Printf("URL scan phase for scan %d finished.", scanID)
 		}
+		timer.stop()
 	} else {
 		log.Printf("URL Scan skipped for scan %d (disabled in template).", scanID)
 	}
 
+	// --- Content Discovery (if the template enables the "content_discovery" tool) ---
+	// Requests wordlist paths crawling cannot reach, like unlinked admin panels and backups
+	if settings, enabled := contentDiscoveryConfig(scanTemplate); enabled && runStage(PhaseURLScan) && !targetUnreachable && len(savedSubdomainMap) > 0 {
+		if scanCancelled(jobCtx, scanID, "content discovery") {
+			return
+		}
+		job.SetPhase("content discovery")
+		timer.start(PhaseContentDiscovery)
+		rootDomainName := targetHost
+		if scanType == "subdomain" {
+			db.Model(&models.RootDomain{}).Where("id = ?", rootDomainID).Pluck("domain", &rootDomainName)
+		}
+		if _, err := ExecuteContentDiscovery(jobCtx, db, rootDomainName, rootDomainID, scanID, savedSubdomainMap, scanTemplate, settings); err != nil {
+			log.Printf("Content discovery for scan %d finished with error: %v", scanID, err)
+			mu.Lock()
+			scanErrors = append(scanErrors, fmt.Sprintf("Content Discovery: %v", err))
+			mu.Unlock()
+		}
+		timer.stop()
+	}
+	completeStage(PhaseURLScan, PhaseTech, errorsBefore)
+
+	if scanCancelled(jobCtx, scanID, "technology detection") {
+		return
+	}
+
 	// --- Execute Technology Detection (if enabled) ---
-	if scanTemplate.TechDetectEnabled {
+	var techMetrics *models.TechDetectMetrics
+	errorsBefore = len(scanErrors)
+	if !runStage(PhaseTech) {
+		log.Printf("Technology detection of scan %d completed before it was resumed, skipping.", scanID)
+	} else if targetUnreachable {
+		log.Printf("Technology detection skipped for scan %d (target %s did not answer).", scanID, targetHost)
+	} else if scanTemplate.TechDetectEnabled {
+		job.SetPhase("technology detection")
+		timer.start(PhaseTech)
 		log.Printf("Technology detection enabled for scan %d. Gathering target URLs...", scanID)
 
 		// --- Gather Target URLs ---
 		var urlsToScanSet map[string]struct{} // Use a set to avoid duplicates
 
+		// With TechDetectNewOnly, assets already known before this scan (and unchanged by it) are skipped
+		newOnly := scanTemplate.TechDetectNewOnly
+		isNewAsset := func(discoveredAt time.Time, changedAt *time.Time) bool {
+			return !newOnly || !discoveredAt.Before(scanStartedAt) || (changedAt != nil && !changedAt.Before(scanStartedAt))
+		}
+		if newOnly {
+			log.Printf("Technology detection for scan %d limited to assets discovered or changed since %s.", scanID, scanStartedAt.Format(time.RFC3339))
+		}
+
 		if scanType == "root_domain" {
 			// Fetch all subdomains and endpoints for the root domain ID from the DB
 			// (This logic remains the same as before for root domain scans)
@@ -862,10 +1482,16 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 
 			urlsToScanSet = make(map[string]struct{})
 			for _, sub := range allDbSubdomains {
+				if !isNewAsset(sub.DiscoveredAt, nil) {
+					continue
+				}
 				urlsToScanSet["http://"+sub.Hostname] = struct{}{}
 				urlsToScanSet["https://"+sub.Hostname] = struct{}{}
 			}
 			for _, ep := range allDbEndpoints {
+				if !isNewAsset(ep.DiscoveredAt, ep.ChangedAt) {
+					continue
+				}
 				if ep.Subdomain.Hostname != "" && ep.Path != "" {
 					path := ep.Path
 					if !strings.HasPrefix(path, "/") {
@@ -878,21 +1504,31 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 		} else { // scanType == "subdomain"
 			// Only target the specific subdomain and its discovered endpoints
 			urlsToScanSet = make(map[string]struct{})
-			urlsToScanSet["http://"+targetHost] = struct{}{}
-			urlsToScanSet["https://"+targetHost] = struct{}{}
 
 			// Fetch endpoints ONLY for the target subdomain ID
 			targetSubdomainID, ok := savedSubdomainMap[targetHost]
+			targetIsNew := true
 			if !ok {
 				log.Printf("Warning: Could not find saved ID for target subdomain %s for tech scan (Scan ID: %d). Fetching endpoints might fail.", targetHost, scanID)
 				// Attempt to fetch ID again? Or skip endpoint tech scan? Let's try fetching.
 				var subModel models.Subdomain
 				if res := db.Where("hostname = ? AND root_domain_id = ?", targetHost, rootDomainID).First(&subModel); res.Error == nil {
 					targetSubdomainID = subModel.ID
+					targetIsNew = isNewAsset(subModel.DiscoveredAt, nil)
 					ok = true
 				} else {
 					log.Printf("Error re-fetching ID for target subdomain %s: %v", targetHost, res.Error)
 				}
+			} else if newOnly {
+				var subModel models.Subdomain
+				if res := db.Select("discovered_at").First(&subModel, targetSubdomainID); res.Error == nil {
+					targetIsNew = isNewAsset(subModel.DiscoveredAt, nil)
+				}
+			}
+
+			if targetIsNew {
+				urlsToScanSet["http://"+targetHost] = struct{}{}
+				urlsToScanSet["https://"+targetHost] = struct{}{}
 			}
 
 			if ok {
@@ -904,7 +1540,7 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 					mu.Unlock()
 				} else {
 					for _, ep := range targetEndpoints {
-						if ep.Path != "" {
+						if ep.Path != "" && isNewAsset(ep.DiscoveredAt, ep.ChangedAt) {
 							path := ep.Path
 							if !strings.HasPrefix(path, "/") {
 								path = "/" + path
@@ -923,12 +1559,14 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 		for urlStr := range urlsToScanSet {
 			finalUrlsToScan = append(finalUrlsToScan, urlStr)
 		}
+		targetSnapshot.TechDetectURLs = append(targetSnapshot.TechDetectURLs, finalUrlsToScan...)
 
 		if len(finalUrlsToScan) == 0 {
 			log.Printf("No target URLs gathered for technology detection (Scan ID: %d). Skipping phase.", scanID)
 		} else {
 			log.Printf("Starting technology detection phase for scan %d on %d unique URLs.", scanID, len(finalUrlsToScan))
-			techScanErr := ExecuteTechScan(finalUrlsToScan, scanID, rootDomainID) // Pass rootDomainID for context
+			var techScanErr error
+			techMetrics, techScanErr = ExecuteTechScan(jobCtx, finalUrlsToScan, scanID, rootDomainID) // Pass rootDomainID for context
 			if techScanErr != nil {
 				log.Printf("Technology detection phase for scan %d finished with error: %v", scanID, techScanErr)
 				mu.Lock()
@@ -937,10 +1575,29 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 			} else {
 				log.Printf("Technology detection phase for scan %d finished.", scanID)
 			}
+			applyScanTagRules(db, scanID, rootDomainID)
 		}
+		timer.stop()
 	} else {
 		log.Printf("Technology detection skipped for scan %d (disabled in template).", scanID)
 	}
+	completeStage(PhaseTech, PhaseScreenshotRetry, errorsBefore)
+
+	// --- Retry Failed Screenshots (if enabled) ---
+	// Runs after the heavy phases, when captures that timed out under load are more likely to succeed
+	if scanTemplate.ScreenshotEnabled && scanTemplate.ScreenshotRetry {
+		if scanCancelled(jobCtx, scanID, "screenshot retry") {
+			return
+		}
+		job.SetPhase("screenshot retry")
+		timer.start(PhaseScreenshotRetry)
+		retried, recovered := RetryFailedScreenshots(jobCtx, db, scanID)
+		timer.stop()
+		if retried > 0 {
+			log.Printf("Screenshot retry for scan %d recovered %d of %d failed screenshots.", scanID, recovered, retried)
+		}
+	}
+	completeStage(PhaseScreenshotRetry, "", len(scanErrors))
 
 	// --- Update Final Status ---
 	finalStatus = "completed" // Use '=' as it's already declared
@@ -956,5 +1613,20 @@ func ExecuteSubdomainScan(targetHost string, scanType string, rootDomainID uint,
 	}
 	mu.Unlock() // Unlock after checking scanErrors
 
-	updateScanStatus(db, scanID, finalStatus, errMsg)
+	if techMetrics != nil {
+		errMsg += "; Tech detect: " + FormatTechDetectMetrics(techMetrics)
+	}
+	if targetUnreachable {
+		errMsg += fmt.Sprintf("; Target %s did not answer, it was not scanned", targetHost)
+	}
+	if len(subfinderSourceErrors) > 0 {
+		// Not fatal, but explains why fewer subdomains than expected may have been found
+		errMsg += "; Subfinder source errors (possibly rate limited, consider adding API keys): " + strings.Join(subfinderSourceErrors, ", ")
+	}
+
+	saveTargetSnapshot(db, scanID, targetSnapshot)
+	if updateScanStatus(db, scanID, finalStatus, errMsg) && scanType == "root_domain" {
+		// Chain follow-up scans unless the scan was cancelled while running
+		enqueueFollowUpScans(db, scanID, rootDomainID, targetHost)
+	}
 }
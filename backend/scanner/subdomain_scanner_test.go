@@ -0,0 +1,22 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/projectdiscovery/subfinder/v2/pkg/passive"
+)
+
+// TestSubfinderKeySources checks that every API key of the settings catalog belongs to a source compiled
+// into subfinder, so keys are neither dropped from the provider config nor from CheckSubfinderSources.
+func TestSubfinderKeySources(t *testing.T) {
+	for source, key := range apiKeysToCheck {
+		if passive.NameSourceMap[source] == nil {
+			t.Errorf("%s belongs to %q, which is not a subfinder source", key, source)
+		}
+	}
+	for source, key := range apiSecondaryKeys {
+		if _, ok := apiKeysToCheck[source]; !ok {
+			t.Errorf("%s is the second key of %q, which has no primary key", key, source)
+		}
+	}
+}
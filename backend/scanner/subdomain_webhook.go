@@ -0,0 +1,167 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sources of new subdomains reported by the webhook (NewSubdomainEvent.Source)
+const (
+	SubdomainSourceDiscovery = "discovery" // Enumeration and verification of a subdomain scan
+	SubdomainSourceURLScan   = "url_scan"  // Hosts found while crawling
+)
+
+const (
+	subdomainWebhookEvent          = "subdomains.discovered"
+	defaultSubdomainWebhookDelay   = 10
+	defaultSubdomainWebhookBatch   = 100
+	subdomainWebhookRequestTimeout = 15 * time.Second
+)
+
+// NewSubdomainEvent is a subdomain reported by the webhook the first time it is saved.
+type NewSubdomainEvent struct {
+	ID           uint      `json:"id"`
+	Hostname     string    `json:"hostname"`
+	RootDomainID uint      `json:"root_domain_id"`
+	ScanID       uint      `json:"scan_id"`
+	Source       string    `json:"source"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
+// subdomainWebhookPayload is the JSON body POSTed to SUBDOMAIN_WEBHOOK_URL.
+type subdomainWebhookPayload struct {
+	Event      string              `json:"event"`
+	SentAt     time.Time           `json:"sent_at"`
+	Subdomains []NewSubdomainEvent `json:"subdomains"`
+}
+
+// subdomainWebhook collects new subdomains across all scans until a batch is sent.
+var subdomainWebhook struct {
+	mu      sync.Mutex
+	pending []NewSubdomainEvent
+	timer   *time.Timer // Sends the pending batch, set while one is waiting
+	sendMu  sync.Mutex  // Serializes requests, so batches arrive in order
+}
+
+var subdomainWebhookClient = &http.Client{Timeout: subdomainWebhookRequestTimeout}
+
+// subdomainWebhookURL returns SUBDOMAIN_WEBHOOK_URL, empty when the webhook is disabled.
+func subdomainWebhookURL() string {
+	return strings.TrimSpace(config.Get("SUBDOMAIN_WEBHOOK_URL"))
+}
+
+// newSubdomainEvents returns the events for the saved subdomains that were created by the save at seenAt.
+// A subdomain keeps the discovered_at of the save that created it, so one refreshed by the upsert has an
+// earlier one.
+func newSubdomainEvents(saved []models.Subdomain, seenAt time.Time, scanID uint, source string) []NewSubdomainEvent {
+	var events []NewSubdomainEvent
+	for _, sub := range saved {
+		if !sub.DiscoveredAt.Equal(seenAt) {
+			continue
+		}
+		events = append(events, NewSubdomainEvent{
+			ID:           sub.ID,
+			Hostname:     sub.Hostname,
+			RootDomainID: sub.RootDomainID,
+			ScanID:       scanID,
+			Source:       source,
+			DiscoveredAt: sub.DiscoveredAt,
+		})
+	}
+	return events
+}
+
+// notifyNewSubdomains queues new subdomains for the webhook, if SUBDOMAIN_WEBHOOK_URL is set. The first
+// queued subdomain starts a window of SUBDOMAIN_WEBHOOK_DELAY_SECONDS during which further ones are
+// collected into the same request; a full batch of SUBDOMAIN_WEBHOOK_MAX_BATCH is sent right away.
+// Never blocks on the request.
+func notifyNewSubdomains(events []NewSubdomainEvent) {
+	if len(events) == 0 || subdomainWebhookURL() == "" {
+		return
+	}
+	delay := time.Duration(config.GetInt("SUBDOMAIN_WEBHOOK_DELAY_SECONDS", defaultSubdomainWebhookDelay)) * time.Second
+	maxBatch := config.GetInt("SUBDOMAIN_WEBHOOK_MAX_BATCH", defaultSubdomainWebhookBatch)
+
+	subdomainWebhook.mu.Lock()
+	defer subdomainWebhook.mu.Unlock()
+	subdomainWebhook.pending = append(subdomainWebhook.pending, events...)
+	if delay <= 0 || len(subdomainWebhook.pending) >= maxBatch {
+		if subdomainWebhook.timer != nil {
+			subdomainWebhook.timer.Stop()
+			subdomainWebhook.timer = nil
+		}
+		batch := subdomainWebhook.pending
+		subdomainWebhook.pending = nil
+		go sendSubdomainWebhook(batch, maxBatch)
+		return
+	}
+	if subdomainWebhook.timer == nil {
+		subdomainWebhook.timer = time.AfterFunc(delay, flushSubdomainWebhook)
+	}
+}
+
+// flushSubdomainWebhook sends the pending subdomains when their window ends.
+func flushSubdomainWebhook() {
+	subdomainWebhook.mu.Lock()
+	batch := subdomainWebhook.pending
+	subdomainWebhook.pending = nil
+	subdomainWebhook.timer = nil
+	subdomainWebhook.mu.Unlock()
+	sendSubdomainWebhook(batch, config.GetInt("SUBDOMAIN_WEBHOOK_MAX_BATCH", defaultSubdomainWebhookBatch))
+}
+
+// sendSubdomainWebhook POSTs the subdomains in requests of at most maxBatch. Failures are logged and the
+// subdomains dropped; they remain in the database and the organization delta feed.
+func sendSubdomainWebhook(events []NewSubdomainEvent, maxBatch int) {
+	if len(events) == 0 {
+		return
+	}
+	webhookURL := subdomainWebhookURL()
+	if webhookURL == "" {
+		return // Disabled while the batch was waiting
+	}
+	if maxBatch <= 0 {
+		maxBatch = defaultSubdomainWebhookBatch
+	}
+
+	subdomainWebhook.sendMu.Lock()
+	defer subdomainWebhook.sendMu.Unlock()
+	for start := 0; start < len(events); start += maxBatch {
+		end := min(start+maxBatch, len(events))
+		if err := postSubdomainWebhook(webhookURL, events[start:end]); err != nil {
+			log.Printf("Subdomain webhook: failed to report %d new subdomains: %v", end-start, err)
+			continue
+		}
+		log.Printf("Subdomain webhook: reported %d new subdomains", end-start)
+	}
+}
+
+// postSubdomainWebhook sends one batch, failing on a non-2xx response.
+func postSubdomainWebhook(webhookURL string, events []NewSubdomainEvent) error {
+	body, err := json.Marshal(subdomainWebhookPayload{Event: subdomainWebhookEvent, SentAt: time.Now(), Subdomains: events})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := subdomainWebhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
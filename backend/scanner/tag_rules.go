@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"rewrite-go/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxTagLength = 64
+
+// tagPattern is the form of a normalized tag, e.g. "wordpress" or "admin-panel".
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]*$`)
+
+// TagRuleResult is the outcome of applying one tag rule.
+type TagRuleResult struct {
+	RuleID  uint   `json:"rule_id"`
+	Tag     string `json:"tag"`
+	Matched int    `json:"matched"` // Subdomains running a matching technology
+	Tagged  int64  `json:"tagged"`  // Of those, subdomains that did not have the tag yet
+}
+
+// NormalizeTag returns the tag lowercased and trimmed, or an error if it isn't a valid tag.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", fmt.Errorf("tag is empty")
+	}
+	if len(tag) > maxTagLength {
+		return "", fmt.Errorf("tag is longer than %d characters", maxTagLength)
+	}
+	if !tagPattern.MatchString(tag) {
+		return "", fmt.Errorf("tag %q may only contain letters, digits, '.', '_', ':' and '-'", tag)
+	}
+	return tag, nil
+}
+
+// ApplyTagRules applies every tag rule to the subdomains of the root domain, or of all root domains if
+// rootDomainID is nil. A subdomain matches a rule if a matching technology was detected on it or on one of
+// its endpoints. Tags are only added: a subdomain keeps its tags when the technology is no longer detected.
+func ApplyTagRules(db *gorm.DB, rootDomainID *uint) ([]TagRuleResult, error) {
+	var rules []models.TagRule
+	if err := db.Order("id").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tag rules: %w", err)
+	}
+	results := make([]TagRuleResult, 0, len(rules))
+	for _, rule := range rules {
+		result, err := applyTagRule(db, rule, rootDomainID)
+		if err != nil {
+			return results, fmt.Errorf("tag rule %d (%s): %w", rule.ID, rule.Tag, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// applyScanTagRules applies the tag rules to the root domain after a scan's technology detection. Failures
+// are logged and don't fail the scan.
+func applyScanTagRules(db *gorm.DB, scanID uint, rootDomainID uint) {
+	results, err := ApplyTagRules(db, &rootDomainID)
+	if err != nil {
+		log.Printf("Error applying tag rules after technology detection (Scan ID: %d): %v", scanID, err)
+		return
+	}
+	var tagged int64
+	for _, result := range results {
+		tagged += result.Tagged
+	}
+	if tagged > 0 {
+		log.Printf("Tag rules added %d subdomain tags after technology detection (Scan ID: %d).", tagged, scanID)
+	}
+}
+
+// applyTagRule tags the subdomains matching one rule.
+func applyTagRule(db *gorm.DB, rule models.TagRule, rootDomainID *uint) (TagRuleResult, error) {
+	result := TagRuleResult{RuleID: rule.ID, Tag: rule.Tag}
+
+	technologies := db.Model(&models.Technology{}).Select("id")
+	if rule.Technology != "" {
+		technologies = WhereTechnologyName(technologies, rule.Technology)
+	}
+	if rule.Category != "" {
+		technologies = technologies.Where("LOWER(category) = ?", strings.ToLower(rule.Category))
+	}
+	onSubdomain := db.Model(&models.SubdomainTechnology{}).Select("subdomain_id").Where("technology_id IN (?)", technologies)
+	onEndpoint := db.Model(&models.EndpointTechnology{}).Select("endpoints.subdomain_id").
+		Joins("JOIN endpoints ON endpoints.id = endpoint_technologies.endpoint_id").
+		Where("endpoint_technologies.technology_id IN (?)", technologies)
+
+	query := db.Model(&models.Subdomain{}).Where("id IN (?) OR id IN (?)", onSubdomain, onEndpoint)
+	if rootDomainID != nil {
+		query = query.Where("root_domain_id = ?", *rootDomainID)
+	}
+	var subdomainIDs []uint
+	if err := query.Pluck("id", &subdomainIDs).Error; err != nil {
+		return result, err
+	}
+	result.Matched = len(subdomainIDs)
+	if len(subdomainIDs) == 0 {
+		return result, nil
+	}
+
+	now := time.Now()
+	tags := make([]models.SubdomainTag, len(subdomainIDs))
+	for i, id := range subdomainIDs {
+		tags[i] = models.SubdomainTag{SubdomainID: id, Tag: rule.Tag, TagRuleID: &rule.ID, CreatedAt: now}
+	}
+	// Subdomains that already have the tag, from this rule or another one, keep it as it is
+	created := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subdomain_id"}, {Name: "tag"}},
+		DoNothing: true,
+	}).CreateInBatches(tags, 500)
+	if created.Error != nil {
+		return result, created.Error
+	}
+	result.Tagged = created.RowsAffected
+	return result, nil
+}
@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"context"
+	"encoding/json"
 	"errors" // Ensure errors is imported
 	"fmt"
 	"io" // Re-add io for sequential processing
@@ -9,111 +10,285 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url" // Added for URL parsing
+	"rewrite-go/config"
 	"rewrite-go/database"
 	"rewrite-go/models"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	wappalyzergo "github.com/projectdiscovery/wappalyzergo" // Revert alias
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const techDetectTimeout = 30 // Timeout in seconds for fetching a single URL
 
-// ExecuteTechScan performs technology detection on a list of URLs sequentially.
-func ExecuteTechScan(urls []string, scanID uint, rootDomainID uint) error {
+// Tech detection concurrency, overridable via TECH_DETECT_WORKERS / TECH_DETECT_PER_HOST settings
+const (
+	defaultTechDetectWorkers = 10 // Number of URLs fetched in parallel
+	defaultTechDetectPerHost = 2  // Maximum parallel requests to a single host
+)
+
+// techDetectUserAgents are browser user agents picked at random for tech detection requests.
+var techDetectUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.1 Safari/605.1.15",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 13_1) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.1 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/109.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:109.0) Gecko/20100101 Firefox/109.0",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/109.0",
+}
+
+// techPage is a page fetched for fingerprinting, with the body read up to techDetectMaxBody bytes.
+type techPage struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+const techDetectMaxBody = 1 * 1024 * 1024 // Body bytes read for fingerprinting
+
+// newTechDetectClient returns the HTTP client used for tech detection. Redirects are not followed,
+// so each URL is fingerprinted as served, and certificates are only verified with TLS_VERIFY.
+// Requests count against the shared outbound connection cap and are spaced hostDelay apart per host.
+func newTechDetectClient(maxIdleConns, perHost int, hostDelay time.Duration) *http.Client {
+	return techDetectClient(techDetectTransport(maxIdleConns, perHost), hostDelay)
+}
+
+// techDetectTransport returns the connection settings of newTechDetectClient.
+func techDetectTransport(maxIdleConns, perHost int) *http.Transport {
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: perHost,
+		MaxConnsPerHost:     perHost,
+		IdleConnTimeout:     90 * time.Second,
+		TLSClientConfig:     scanTLSConfig(),
+	}
+}
+
+// techDetectClient is newTechDetectClient over the given transport.
+func techDetectClient(transport *http.Transport, hostDelay time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   time.Duration(techDetectTimeout) * time.Second,
+		Transport: newLimitedTransport(transport, hostDelay),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// fetchTechPage GETs a URL with a random browser user agent for fingerprinting. If hostSlot is
+// non-nil, the returned semaphore for the URL's host is held while the request is in flight.
+func fetchTechPage(ctx context.Context, client *http.Client, urlStr string, rateLimitRetries int, hostSlot func(host string) chan struct{}) (*techPage, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", urlStr, err)
+	}
+	// Select a random user agent
+	req.Header.Set("User-Agent", techDetectUserAgents[rand.Intn(len(techDetectUserAgents))])
+
+	if hostSlot != nil {
+		sem := hostSlot(req.URL.Host)
+		sem <- struct{}{}
+		defer func() { <-sem }()
+	}
+	resp, err := doWithRateLimitBackoff(client, req, rateLimitRetries) // Host slot stays held while backing off
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", urlStr, err)
+	}
+
+	// Read body
+	limitedReader := &io.LimitedReader{R: resp.Body, N: techDetectMaxBody} // Limit read size
+	data, err := io.ReadAll(limitedReader)
+	resp.Body.Close() // Close body immediately
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read body for %s: %w", urlStr, err)
+	}
+	return &techPage{StatusCode: resp.StatusCode, Header: resp.Header, Body: data}, nil
+}
+
+// techFetchResult holds the outcome of fetching and fingerprinting a single URL. Only the parts of the
+// response stored in its models.TechFingerprint are kept, not the body.
+type techFetchResult struct {
+	URL         string
+	Techs       map[string]struct{}
+	StatusCode  int
+	ContentType string
+	BodyBytes   int
+	Headers     string // Response headers, formatted like those of captures
+	Duration    time.Duration
+	Err         error
+}
+
+// FingerprintTechnology is a technology of a stored fingerprint, see models.TechFingerprint. The
+// confidence and the matched patterns are not part of wappalyzergo's output.
+type FingerprintTechnology struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version,omitempty"`
+	Categories  []string `json:"categories"`
+	Website     string   `json:"website,omitempty"`
+	CPE         string   `json:"cpe,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// ExecuteTechScan performs technology detection on a list of URLs using a pool of workers.
+// Throughput metrics are stored on the scan record and returned even when some URLs fail.
+// Cancelling ctx aborts the requests in flight and skips the remaining URLs; the technologies detected
+// so far are still saved and ctx's error is returned.
+func ExecuteTechScan(ctx context.Context, urls []string, scanID uint, rootDomainID uint) (*models.TechDetectMetrics, error) {
 	db := database.GetDB()
+	urls = dropOutOfScopeURLs(urls, outOfScopePatterns(db, rootDomainID), "technology detection URLs", scanID)
 	if len(urls) == 0 {
 		log.Printf("No URLs provided for technology detection (Scan ID: %d). Skipping.", scanID)
-		return nil
+		return nil, nil
 	}
-	log.Printf("Starting technology detection for %d URLs (Scan ID: %d)", len(urls), scanID)
+
+	workers := config.GetInt("TECH_DETECT_WORKERS", defaultTechDetectWorkers)
+	if workers < 1 {
+		workers = 1
+	}
+	perHost := config.GetInt("TECH_DETECT_PER_HOST", defaultTechDetectPerHost)
+	if perHost < 1 {
+		perHost = 1
+	}
+	rateLimitRetries := config.GetInt("RATE_LIMIT_RETRIES", defaultRateLimitRetries)
+	log.Printf("Starting technology detection for %d URLs (Scan ID: %d, Workers: %d, Per-host limit: %d, Per-host delay: %s)", len(urls), scanID, workers, perHost, scanHostDelay(scanID))
 
 	wappalyzerClient, err := wappalyzergo.New()
 	if err != nil {
 		log.Printf("Error creating Wappalyzer client for scan %d: %v", scanID, err)
-		return fmt.Errorf("failed to create wappalyzer client: %w", err)
+		return nil, fmt.Errorf("failed to create wappalyzer client: %w", err)
 	}
 
 	// Seed the random number generator
 	rand.Seed(time.Now().UnixNano())
 
-	// Define a list of common user agents
-	userAgents := []string{
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.1 Safari/605.1.15",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 13_1) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.1 Safari/605.1.15",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/109.0",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:109.0) Gecko/20100101 Firefox/109.0",
-		"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/109.0",
-	}
-
-	// --- Sequential Processing ---
-	// Store results keyed by the original URL processed
-	allResultsByURL := make(map[string]map[string]struct{})
-	var scanErrors []error
-
-	httpClient := &http.Client{
-		Timeout: time.Duration(techDetectTimeout) * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	// One client for all workers so keep-alive connections are reused across URLs on the same host
+	httpClient := newTechDetectClient(workers*perHost, perHost, scanHostDelay(scanID))
+	defer httpClient.CloseIdleConnections()
+
+	// Per-host semaphores, created lazily
+	var hostLimitsMu sync.Mutex
+	hostLimits := make(map[string]chan struct{})
+	acquireHost := func(host string) chan struct{} {
+		hostLimitsMu.Lock()
+		defer hostLimitsMu.Unlock()
+		sem, ok := hostLimits[host]
+		if !ok {
+			sem = make(chan struct{}, perHost)
+			hostLimits[host] = sem
+		}
+		return sem
 	}
 
-	log.Printf("Processing %d URLs sequentially for technology detection (Scan ID: %d)...", len(urls), scanID)
-
-	for _, urlStr := range urls {
-		var detectedTechs map[string]struct{}
-		var fetchErr error
+	// fetchAndFingerprint processes a single URL
+	fetchAndFingerprint := func(urlStr string) techFetchResult {
+		started := time.Now()
+		res := techFetchResult{URL: urlStr}
 
-		// Process the single provided URL
-		req, err := http.NewRequestWithContext(context.Background(), "GET", urlStr, nil)
+		page, err := fetchTechPage(ctx, httpClient, urlStr, rateLimitRetries, acquireHost)
+		res.Duration = time.Since(started)
 		if err != nil {
-			fetchErr = fmt.Errorf("failed to create request for %s: %w", urlStr, err)
-			log.Printf("Error processing URL %s (Scan ID: %d): %v", urlStr, scanID, fetchErr)
-			scanErrors = append(scanErrors, fmt.Errorf("url %s: %w", urlStr, fetchErr))
-			continue // Move to next URL
+			res.Err = err
+			return res
 		}
-		// Select a random user agent
-		randomUserAgent := userAgents[rand.Intn(len(userAgents))]
-		req.Header.Set("User-Agent", randomUserAgent)
-		// log.Printf("Using User-Agent: %s for URL: %s", randomUserAgent, urlStr) // Optional: Log the user agent being used
 
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			fetchErr = fmt.Errorf("failed to fetch %s: %w", urlStr, err)
-			log.Printf("Error processing URL %s (Scan ID: %d): %v", urlStr, scanID, fetchErr)
-			scanErrors = append(scanErrors, fmt.Errorf("url %s: %w", urlStr, fetchErr))
-			continue // Move to next URL
+		// Run Wappalyzer fingerprinting
+		res.Techs = wappalyzerClient.Fingerprint(page.Header, page.Body)
+		res.StatusCode, res.ContentType, res.BodyBytes = page.StatusCode, page.Header.Get("Content-Type"), len(page.Body)
+		headers := make(map[string]string, len(page.Header))
+		for name := range page.Header {
+			headers[name] = strings.Join(page.Header.Values(name), ", ")
+		}
+		res.Headers = formatHeaders(headers)
+		if len(res.Techs) > 0 {
+			log.Printf("Detected %d technologies on %s (Scan ID: %d)", len(res.Techs), urlStr, scanID)
+		} else {
+			// Log that no techs were detected, but don't treat as a fatal error for the scan job
+			log.Printf("Info: No technologies detected on %s (Scan ID: %d, Status: %d)", urlStr, scanID, page.StatusCode)
 		}
+		return res
+	}
 
-		// Read body
-		limitedReader := &io.LimitedReader{R: resp.Body, N: 1 * 1024 * 1024} // Limit read size
-		data, err := io.ReadAll(limitedReader)
-		resp.Body.Close() // Close body immediately
-		if err != nil && err != io.EOF {
-			fetchErr = fmt.Errorf("failed to read body for %s: %w", urlStr, err)
-			log.Printf("Error processing URL %s (Scan ID: %d): %v", urlStr, scanID, fetchErr)
-			scanErrors = append(scanErrors, fmt.Errorf("url %s: %w", urlStr, fetchErr))
-			continue // Move to next URL
+	// --- Parallel Processing ---
+	jobs := make(chan string)
+	results := make(chan techFetchResult)
+	var workerWG sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workerWG.Add(1)
+		go func() {
+			defer workerWG.Done()
+			for urlStr := range jobs {
+				if ctx.Err() != nil {
+					continue // Cancelled, drain the queued URLs
+				}
+				results <- fetchAndFingerprint(urlStr)
+			}
+		}()
+	}
+	go func() {
+	feed:
+		for _, urlStr := range urls {
+			select {
+			case jobs <- urlStr:
+			case <-ctx.Done():
+				break feed
+			}
 		}
+		close(jobs)
+		workerWG.Wait()
+		close(results)
+	}()
 
-		// Run Wappalyzer fingerprinting
-		fingerprints := wappalyzerClient.Fingerprint(resp.Header, data)
+	// Store results keyed by the original URL processed
+	allResultsByURL := make(map[string]map[string]struct{})
+	var fingerprinted []techFetchResult
+	var scanErrors []error
+	metrics := &models.TechDetectMetrics{TotalURLs: len(urls), Workers: workers, PerHostLimit: perHost}
+	var totalFetch time.Duration
+	phaseStarted := time.Now()
 
-		if len(fingerprints) > 0 {
-			detectedTechs = fingerprints
-			log.Printf("Detected %d technologies on %s (Scan ID: %d)", len(detectedTechs), urlStr, scanID)
-			allResultsByURL[urlStr] = detectedTechs // Store results keyed by URL
-		} else {
-			// Log that no techs were detected, but don't treat as a fatal error for the scan job
-			log.Printf("Info: No technologies detected on %s (Scan ID: %d, Status: %d)", urlStr, scanID, resp.StatusCode)
+	for res := range results {
+		if res.Err != nil && ctx.Err() != nil {
+			continue // Aborted by the cancellation, not a failure of the URL
+		}
+		totalFetch += res.Duration
+		if ms := res.Duration.Milliseconds(); ms > metrics.MaxFetchMs {
+			metrics.MaxFetchMs = ms
+		}
+		if res.Err != nil {
+			log.Printf("Error processing URL %s (Scan ID: %d): %v", res.URL, scanID, res.Err)
+			scanErrors = append(scanErrors, fmt.Errorf("url %s: %w", res.URL, res.Err))
+			metrics.Failed++
+			continue
 		}
-	} // end loop (urlStr)
+		metrics.Succeeded++
+		fingerprinted = append(fingerprinted, res)
+		if len(res.Techs) > 0 {
+			allResultsByURL[res.URL] = res.Techs
+		}
+	}
+
+	// --- Aggregate Metrics ---
+	elapsed := time.Since(phaseStarted)
+	metrics.DurationSeconds = elapsed.Seconds()
+	if elapsed > 0 {
+		metrics.URLsPerSecond = float64(metrics.TotalURLs) / elapsed.Seconds()
+	}
+	// Rates cover the URLs processed, fewer than TotalURLs if the scan was cancelled
+	if processed := metrics.Succeeded + metrics.Failed; processed > 0 {
+		metrics.SuccessRate = float64(metrics.Succeeded) / float64(processed)
+		metrics.AvgFetchMs = totalFetch.Milliseconds() / int64(processed)
+	}
+	saveTechDetectMetrics(db, scanID, metrics)
+	log.Printf("Technology detection metrics for scan %d: %s", scanID, FormatTechDetectMetrics(metrics))
 
 	// --- Save Results ---
 	saveErr := saveTechnologies(db, allResultsByURL, scanID, rootDomainID) // Pass the URL-keyed map
@@ -122,16 +297,124 @@ func ExecuteTechScan(urls []string, scanID uint, rootDomainID uint) error {
 		scanErrors = append(scanErrors, fmt.Errorf("failed to save technologies: %w", saveErr))
 	}
 
+	saveTechFingerprints(db, wappalyzerClient, fingerprinted, scanID, rootDomainID)
+
 	// --- Final Error Handling ---
+	if ctx.Err() != nil {
+		log.Printf("Technology detection for scan %d cancelled after %d of %d URLs.", scanID, metrics.Succeeded+metrics.Failed, metrics.TotalURLs)
+		return metrics, fmt.Errorf("technology detection cancelled after %d of %d URLs: %w", metrics.Succeeded+metrics.Failed, metrics.TotalURLs, ctx.Err())
+	}
 	if len(scanErrors) > 0 {
 		log.Printf("Technology detection for scan %d finished with %d errors.", scanID, len(scanErrors))
 		// Combine errors? For now, return the first one.
 		// Consider using multierr package if more granular error reporting is needed.
-		return fmt.Errorf("technology detection encountered errors: %w", scanErrors[0])
+		return metrics, fmt.Errorf("technology detection encountered errors: %w", scanErrors[0])
 	}
 
 	log.Printf("Technology detection for scan %d completed successfully.", scanID)
-	return nil
+	return metrics, nil
+}
+
+// FormatTechDetectMetrics renders tech detection metrics as a one-line summary.
+func FormatTechDetectMetrics(m *models.TechDetectMetrics) string {
+	return fmt.Sprintf("%d URLs in %.1fs (%.2f URLs/sec, %.0f%% success, avg %dms, max %dms)",
+		m.TotalURLs, m.DurationSeconds, m.URLsPerSecond, m.SuccessRate*100, m.AvgFetchMs, m.MaxFetchMs)
+}
+
+// saveTechDetectMetrics stores the tech detection metrics on the scan record for later review.
+func saveTechDetectMetrics(db *gorm.DB, scanID uint, metrics *models.TechDetectMetrics) {
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		log.Printf("Error marshalling tech detection metrics for scan %d: %v", scanID, err)
+		return
+	}
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Update("tech_detect_metrics", string(data)).Error; err != nil {
+		log.Printf("Error saving tech detection metrics for scan %d: %v", scanID, err)
+	}
+}
+
+// WhereTechnologyName limits a technologies query to the given name, with any version: technology detection
+// saves technologies as "name:version" when it detected a version.
+func WhereTechnologyName(query *gorm.DB, name string) *gorm.DB {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return query.Where("LOWER(name) = ? OR SUBSTR(LOWER(name), 1, ?) = ?", name, len(name)+1, name+":")
+}
+
+// SplitTechnologyVersion splits a saved technology name into the technology and its version, empty if
+// none was detected.
+func SplitTechnologyVersion(name string) (string, string) {
+	technology, version, _ := strings.Cut(name, ":")
+	return technology, version
+}
+
+// saveTechFingerprints records the full fingerprint of every URL fetched, replacing the one of an earlier
+// scan. URLs of hosts without a subdomain record are skipped.
+func saveTechFingerprints(db *gorm.DB, wappalyzerClient *wappalyzergo.Wappalyze, results []techFetchResult, scanID uint, rootDomainID uint) {
+	if len(results) == 0 {
+		return
+	}
+	var subdomains []models.Subdomain
+	if err := db.Select("id", "hostname").Where("root_domain_id = ?", rootDomainID).Find(&subdomains).Error; err != nil {
+		log.Printf("Error fetching subdomains to save the fingerprints of scan %d: %v", scanID, err)
+		return
+	}
+	subdomainIDs := make(map[string]uint, len(subdomains))
+	for _, sub := range subdomains {
+		subdomainIDs[sub.Hostname] = sub.ID
+	}
+
+	apps := wappalyzerClient.GetCompiledFingerprints().Apps
+	now := time.Now()
+	fingerprints := make([]models.TechFingerprint, 0, len(results))
+	for _, res := range results {
+		parsedURL, err := url.Parse(res.URL)
+		if err != nil {
+			continue
+		}
+		subdomainID, ok := subdomainIDs[parsedURL.Hostname()]
+		if !ok {
+			continue
+		}
+		technologies := make([]FingerprintTechnology, 0, len(res.Techs))
+		for app := range res.Techs {
+			name, version := SplitTechnologyVersion(app)
+			technology := FingerprintTechnology{Name: name, Version: version, Categories: []string{}}
+			if fingerprint, ok := apps[name]; ok {
+				info := wappalyzergo.AppInfoFromFingerprint(fingerprint)
+				technology.Categories = info.Categories
+				technology.Website, technology.CPE, technology.Description = info.Website, info.CPE, info.Description
+			}
+			technologies = append(technologies, technology)
+		}
+		sort.Slice(technologies, func(i, j int) bool { return technologies[i].Name < technologies[j].Name })
+		data, err := json.Marshal(technologies)
+		if err != nil {
+			log.Printf("Error encoding the fingerprint of %s (Scan ID: %d): %v", res.URL, scanID, err)
+			continue
+		}
+		fingerprints = append(fingerprints, models.TechFingerprint{
+			SubdomainID:     subdomainID,
+			URL:             res.URL,
+			StatusCode:      res.StatusCode,
+			ContentType:     res.ContentType,
+			BodyBytes:       res.BodyBytes,
+			ResponseHeaders: res.Headers,
+			Technologies:    string(data),
+			ScanID:          &scanID,
+			FingerprintedAt: now,
+		})
+	}
+	if len(fingerprints) == 0 {
+		return
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subdomain_id"}, {Name: "url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status_code", "content_type", "body_bytes", "response_headers", "technologies", "scan_id", "fingerprinted_at"}),
+	}).CreateInBatches(fingerprints, 200).Error; err != nil {
+		log.Printf("Error saving the fingerprints of scan %d: %v", scanID, err)
+		return
+	}
+	log.Printf("Saved the fingerprints of %d URLs for scan %d.", len(fingerprints), scanID)
 }
 
 // saveTechnologies saves the detected technologies using join table entries.
@@ -175,32 +458,35 @@ func saveTechnologies(db *gorm.DB, resultsByURL map[string]map[string]struct{},
 	}
 
 	// Ensure a Subdomain entry exists for the root domain itself for linking
-	var rootSubdomain models.Subdomain
-	err := tx.Where("root_domain_id = ? AND hostname = ?", rootDomainID, rootDomain.Domain).First(&rootSubdomain).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		log.Printf("Creating missing Subdomain entry for root domain host: %s", rootDomain.Domain)
-		rootSubdomain = models.Subdomain{
-			RootDomainID: rootDomainID,
-			Hostname:     rootDomain.Domain,
-			IsActive:     true, // Assume active
-			DiscoveredAt: time.Now(),
-			ScanID:       &scanID, // Associate with this scan
-		}
-		if err := tx.Create(&rootSubdomain).Error; err != nil {
-			return fmt.Errorf("failed to create subdomain entry for root domain %s: %w", rootDomain.Domain, err)
+	rootSubdomain, _, err := EnsureRootSubdomain(tx, &rootDomain, &scanID)
+	if err != nil {
+		return err
+	}
+	subdomainIDMap[rootSubdomain.Hostname] = rootSubdomain.ID
+
+	// GET endpoints of the root domain by subdomain and path, to link technologies to the endpoint they were detected on
+	var domainEndpoints []models.Endpoint
+	if err := tx.Select("endpoints.id", "endpoints.subdomain_id", "endpoints.path").
+		Joins("JOIN subdomains ON subdomains.id = endpoints.subdomain_id").
+		Where("subdomains.root_domain_id = ? AND endpoints.method = ?", rootDomainID, "GET").
+		Find(&domainEndpoints).Error; err != nil {
+		log.Printf("Warning: Error fetching endpoints for root domain %d: %v", rootDomainID, err)
+		// Continue, technologies are still linked to their subdomains
+	}
+	endpointIDMap := make(map[uint]map[string]uint)
+	for _, ep := range domainEndpoints {
+		if endpointIDMap[ep.SubdomainID] == nil {
+			endpointIDMap[ep.SubdomainID] = make(map[string]uint)
 		}
-		subdomainIDMap[rootSubdomain.Hostname] = rootSubdomain.ID // Add to map
-	} else if err != nil {
-		return fmt.Errorf("failed to query subdomain entry for root domain %s: %w", rootDomain.Domain, err)
-	} else {
-		// Ensure it's in the map if fetched successfully
-		subdomainIDMap[rootSubdomain.Hostname] = rootSubdomain.ID
+		endpointIDMap[ep.SubdomainID][NormalizeEndpointPath(ep.Path)] = ep.ID
 	}
 
 	// --- Process and Save Technologies ---
 	var joinEntriesToCreate []models.SubdomainTechnology
+	var endpointEntriesToCreate []models.EndpointTechnology
 	processedTechs := make(map[string]uint) // Cache found/created tech IDs: name -> ID
 	now := time.Now()
+	linkedEndpoints := make(map[[2]uint]bool) // (EndpointID, TechnologyID) pairs, detected over both http and https
 
 	for urlStr, techs := range resultsByURL {
 		// --- Extract Hostname from URL ---
@@ -225,6 +511,7 @@ func saveTechnologies(db *gorm.DB, resultsByURL map[string]map[string]struct{},
 			log.Printf("Warning: Could not find Subdomain ID for host '%s' (from URL '%s') in map for RootDomainID %d. Skipping tech linking for this URL.", host, urlStr, rootDomainID)
 			continue
 		}
+		endpointID, onEndpoint := endpointIDMap[subdomainID][NormalizeEndpointPath(parsedURL.EscapedPath())]
 
 		for techName := range techs {
 			normalizedTechName := strings.ToLower(techName)
@@ -260,10 +547,20 @@ func saveTechnologies(db *gorm.DB, resultsByURL map[string]map[string]struct{},
 				SubdomainID:  subdomainID,
 				TechnologyID: technologyID,
 				DetectedAt:   now,
+				URL:          urlStr,
 				// ScanID: &scanID, // Add ScanID if the join table schema supports it
 				// Confidence: // Add confidence if wappalyzergo provides it
 			}
 			joinEntriesToCreate = append(joinEntriesToCreate, joinEntry)
+
+			if onEndpoint && !linkedEndpoints[[2]uint{endpointID, technologyID}] {
+				linkedEndpoints[[2]uint{endpointID, technologyID}] = true
+				endpointEntriesToCreate = append(endpointEntriesToCreate, models.EndpointTechnology{
+					EndpointID:   endpointID,
+					TechnologyID: technologyID,
+					DetectedAt:   now,
+				})
+			}
 		}
 	}
 
@@ -295,6 +592,17 @@ func saveTechnologies(db *gorm.DB, resultsByURL map[string]map[string]struct{},
 
 	log.Printf("Successfully saved %d technology relationships for scan %d.", result.RowsAffected, scanID)
 
+	if len(endpointEntriesToCreate) > 0 {
+		// A rescan refreshes detected_at of the links it finds again
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "endpoint_id"}, {Name: "technology_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"detected_at"}),
+		}).CreateInBatches(endpointEntriesToCreate, 100).Error; err != nil {
+			return fmt.Errorf("failed to save endpoint technology relationships: %w", err)
+		}
+		log.Printf("Linked technologies to endpoints %d times for scan %d.", len(endpointEntriesToCreate), scanID)
+	}
+
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
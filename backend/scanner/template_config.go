@@ -0,0 +1,448 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"rewrite-go/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/subfinder/v2/pkg/passive"
+	"gorm.io/gorm"
+)
+
+// TemplateConfig is the tool configuration a scan runs with once its template is parsed: the sections
+// enabled, the tool options with defaults filled in, and the settings the tools read from those options.
+type TemplateConfig struct {
+	SubfinderEnabled bool                   `json:"subfinder_enabled"`
+	SubfinderOptions map[string]interface{} `json:"subfinder_options"`
+	Subfinder        SubfinderSettings      `json:"subfinder"`
+	URLScanEnabled   bool                   `json:"url_scan_enabled"`
+	KatanaOptions    map[string]interface{} `json:"katana_options"`
+	Katana           KatanaSettings         `json:"katana"`
+	KatanaOutputFile bool                   `json:"katana_output_file"` // The outputFile option writes katana results to the scan directory
+	HttpxEnabled     bool                   `json:"httpx_enabled"`      // Root domain scans verify discovered subdomains with httpx
+	Httpx            HttpxSettings          `json:"httpx"`              // Options httpx verifies them with
+	Notes            []string               `json:"notes"`              // Defaults and fallbacks applied while parsing
+}
+
+// SubfinderSettings are the subfinder settings runSubfinder reads from the subfinder options.
+type SubfinderSettings struct {
+	Threads            int      `json:"threads"`
+	Timeout            int      `json:"timeout"`
+	MaxEnumerationTime int      `json:"max_enumeration_time"`
+	Sources            []string `json:"sources"`
+	ExcludeSources     []string `json:"exclude_sources"`
+	All                bool     `json:"all"`
+	SelectedSources    []string `json:"selected_sources"` // The sources subfinder queries given the above
+}
+
+// KatanaSettings are the URL phase settings ExecuteURLScan and RefreshKnownEndpoints read from the
+// katana options. The rate limit is lowered further at run time if a politeness delay applies.
+type KatanaSettings struct {
+	Mode           string `json:"mode"`
+	MaxDepth       int    `json:"max_depth"`
+	Concurrency    int    `json:"concurrency"`
+	Parallelism    int    `json:"parallelism"`
+	RateLimit      int    `json:"rate_limit"`
+	Timeout        int    `json:"timeout"`
+	Soft404        bool   `json:"soft404"`
+	CrawlDuration  int    `json:"crawl_duration"`
+	FieldScope     string `json:"field_scope"`
+	Strategy       string `json:"strategy"`
+	NoScope        bool   `json:"no_scope"`
+	BodyReadSize   int    `json:"body_read_size"`
+	FormExtraction bool   `json:"form_extraction"`
+	RedirectPolicy string `json:"redirect_policy"`
+}
+
+// HttpxSettings are the httpx options verifyActiveSubdomains probes discovered subdomains with. Templates
+// can't change them; they are part of TemplateConfig so a scan records them with the other tools.
+type HttpxSettings struct {
+	Threads         int  `json:"threads"`
+	Timeout         int  `json:"timeout"`
+	Retries         int  `json:"retries"`
+	FollowRedirects bool `json:"follow_redirects"` // Follow redirects to catch more live hosts
+	TLSGrab         bool `json:"tls_grab"`         // Keep the certificate of https hosts, its SANs often name more subdomains
+}
+
+// httpxVerifySettings are the HttpxSettings of every scan.
+var httpxVerifySettings = HttpxSettings{Threads: 50, Timeout: 10, Retries: 1, FollowRedirects: true, TLSGrab: true}
+
+// Default tool options, used when a template leaves them out or its section can't be parsed
+var (
+	defaultSubfinderOptions = map[string]interface{}{"threads": 10, "timeout": 30, "maxEnumerationTime": 5}
+	defaultKatanaOptions    = map[string]interface{}{"maxDepth": 3, "concurrency": 10, "parallelism": 10, "rateLimit": 150, "timeout": 10}
+)
+
+// withDefaults returns a copy of options with the defaults added for keys it lacks.
+func withDefaults(options map[string]interface{}, defaults map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(options)+len(defaults))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range options {
+		merged[key] = value
+	}
+	return merged
+}
+
+// ResolveTemplateConfig parses the subdomain and URL sections of a template the way ExecuteSubdomainScan
+// does for a scan of scanType ("root_domain" or "subdomain"). Sections that fail to parse fall back to the
+// defaults; every such fallback is described in Notes.
+func ResolveTemplateConfig(scanTemplate *models.ScanTemplate, scanType string) TemplateConfig {
+	cfg := TemplateConfig{
+		SubfinderEnabled: true, // Enabled by default for root_domain scans
+		SubfinderOptions: withDefaults(nil, defaultSubfinderOptions),
+		URLScanEnabled:   true,
+		KatanaOptions:    withDefaults(nil, defaultKatanaOptions),
+		Notes:            []string{},
+	}
+
+	// Parse Subdomain Config only if it's a root domain scan
+	if scanType == "root_domain" {
+		if scanTemplate.SubdomainScanConfig != "" {
+			var subdomainSection models.ScanSectionConfig
+			if err := json.Unmarshal([]byte(scanTemplate.SubdomainScanConfig), &subdomainSection); err != nil {
+				cfg.Notes = append(cfg.Notes, fmt.Sprintf("Failed to parse SubdomainScanConfig JSON: %v. Using defaults.", err))
+			} else if !subdomainSection.Enabled {
+				cfg.SubfinderEnabled = false
+				cfg.Notes = append(cfg.Notes, "Subdomain discovery disabled by template.")
+			} else if toolCfg, ok := subdomainSection.Tools["subfinder"]; ok {
+				cfg.SubfinderEnabled = toolCfg.Enabled
+				if cfg.SubfinderEnabled {
+					cfg.SubfinderOptions = withDefaults(parseToolOptions(toolCfg.Options), defaultSubfinderOptions)
+				}
+			} else {
+				cfg.SubfinderEnabled = false // Tool not defined in config
+				cfg.Notes = append(cfg.Notes, "Subdomain discovery disabled (subfinder tool not defined).")
+			}
+		} else {
+			cfg.Notes = append(cfg.Notes, "Template has no SubdomainScanConfig. Using defaults (Subfinder enabled for root domain scan).")
+		}
+	} else {
+		// If it's a subdomain scan, disable discovery tools regardless of template
+		cfg.SubfinderEnabled = false
+		cfg.Notes = append(cfg.Notes, "Subdomain discovery skipped for specific subdomain scans.")
+	}
+
+	// Parse URL Config (applies to both scan types)
+	if scanTemplate.URLScanConfig != "" {
+		var urlSection models.ScanSectionConfig
+		if err := json.Unmarshal([]byte(scanTemplate.URLScanConfig), &urlSection); err != nil {
+			// Keep URL scanning enabled with the defaults if parsing fails
+			cfg.Notes = append(cfg.Notes, fmt.Sprintf("Failed to parse URLScanConfig JSON: %v. Using defaults.", err))
+		} else if !urlSection.Enabled {
+			cfg.URLScanEnabled = false
+			cfg.Notes = append(cfg.Notes, "URL scanning disabled by template.")
+		} else if toolCfg, ok := urlSection.Tools["katana"]; ok && toolCfg.Enabled {
+			cfg.KatanaOptions = withDefaults(parseToolOptions(toolCfg.Options), defaultKatanaOptions)
+			// The outputFile option (e.g. "outputFile=true", "outputFile") enables file output
+			for _, opt := range toolCfg.Options {
+				if strings.HasPrefix(opt, "outputFile") {
+					cfg.KatanaOutputFile = true
+					break
+				}
+			}
+		} else {
+			cfg.URLScanEnabled = false // Section enabled but katana is not defined or disabled
+			cfg.Notes = append(cfg.Notes, "URL scanning disabled (Katana tool not enabled).")
+		}
+	} else {
+		cfg.Notes = append(cfg.Notes, "Template has no URLScanConfig. Using defaults.")
+	}
+
+	cfg.Subfinder = resolveSubfinderSettings(cfg.SubfinderOptions)
+	cfg.Katana = resolveKatanaSettings(cfg.KatanaOptions)
+	cfg.HttpxEnabled, cfg.Httpx = scanType == "root_domain", httpxVerifySettings
+	if cfg.SubfinderEnabled && len(cfg.Subfinder.SelectedSources) == 0 {
+		cfg.Notes = append(cfg.Notes, "No subfinder sources selected, subdomain discovery will fail. Check the sources and excludeSources options.")
+	}
+	if bodyReadSize := getIntOption(cfg.KatanaOptions, "bodyReadSize", defaultKatanaBodyReadSize); cfg.URLScanEnabled && bodyReadSize <= 0 {
+		cfg.Notes = append(cfg.Notes, fmt.Sprintf("Ignoring invalid bodyReadSize %d, using %d bytes.", bodyReadSize, defaultKatanaBodyReadSize))
+	}
+	return cfg
+}
+
+// resolveSubfinderSettings reads the subfinder settings from the subfinder options.
+func resolveSubfinderSettings(options map[string]interface{}) SubfinderSettings {
+	settings := SubfinderSettings{
+		Threads: getIntOption(options, "threads", 10),
+		Timeout: getIntOption(options, "timeout", 30),
+		// Match the key used in parseToolOptions (which removes dashes)
+		MaxEnumerationTime: getIntOption(options, "maxEnumerationTime", 5),
+		// Source selection, e.g. sources=crtsh,github or excludeSources=waybackarchive; all=true adds the slow sources
+		Sources:        subfinderSourceListOption(options, "sources"),
+		ExcludeSources: subfinderSourceListOption(options, "excludeSources"),
+		All:            getBoolOption(options, "all", false),
+	}
+	settings.SelectedSources = selectedSubfinderSources(settings.Sources, settings.ExcludeSources, settings.All)
+	return settings
+}
+
+// resolveKatanaSettings reads the URL phase settings from the katana options.
+func resolveKatanaSettings(options map[string]interface{}) KatanaSettings {
+	settings := KatanaSettings{
+		Mode:           getChoiceOption(options, "mode", urlScanModes, URLScanModeCrawl),
+		MaxDepth:       getIntOption(options, "maxDepth", 3),
+		Concurrency:    getIntOption(options, "concurrency", 10),
+		Parallelism:    getIntOption(options, "parallelism", 10),
+		RateLimit:      getIntOption(options, "rateLimit", 150),
+		Timeout:        getIntOption(options, "timeout", 10),
+		Soft404:        getBoolOption(options, "soft404", true),
+		CrawlDuration:  getIntOption(options, "crawlDuration", defaultSeedCrawlDuration), // Per-seed crawl deadline in seconds (0 = unlimited)
+		FieldScope:     getChoiceOption(options, "fieldScope", katanaFieldScopes, "rdn"), // Which hosts katana follows, relative to each seed
+		Strategy:       getChoiceOption(options, "strategy", katanaStrategies, "depth-first"),
+		NoScope:        getBoolOption(options, "noScope", false), // Follow links to any host; results outside the root domain are still not stored
+		BodyReadSize:   getIntOption(options, "bodyReadSize", defaultKatanaBodyReadSize),
+		FormExtraction: getBoolOption(options, "formExtraction", false), // Store form actions as endpoints with their fields as parameters
+		// Whether redirects leaving the root domain become external links instead of the endpoint's response
+		RedirectPolicy: getChoiceOption(options, "redirectPolicy", redirectPolicies, RedirectPolicySameScope),
+	}
+	// Bodies are truncated at bodyReadSize bytes, so links past the limit are missed
+	if settings.BodyReadSize <= 0 {
+		settings.BodyReadSize = defaultKatanaBodyReadSize
+	}
+	return settings
+}
+
+// TemplateOverrides are per-scan tool options by tool name ("subfinder" or "katana"), merged over the
+// options of the scan's template, see TemplateConfig.ApplyOverrides.
+type TemplateOverrides map[string]map[string]interface{}
+
+// Kinds of overridable option values
+const (
+	optionInt     = "int"     // Non-negative whole number
+	optionBool    = "bool"    // true or false
+	optionChoice  = "choice"  // One of the option's choices
+	optionSources = "sources" // Subfinder source names, comma-separated or as a list
+)
+
+// overridableOption describes an option that can be overridden per scan.
+type overridableOption struct {
+	kind    string
+	choices []string
+}
+
+// overridableOptions are the options the scanner reads, by tool; only these can be overridden.
+var overridableOptions = map[string]map[string]overridableOption{
+	"subfinder": {
+		"threads":            {kind: optionInt},
+		"timeout":            {kind: optionInt},
+		"maxEnumerationTime": {kind: optionInt},
+		"sources":            {kind: optionSources},
+		"excludeSources":     {kind: optionSources},
+		"all":                {kind: optionBool},
+	},
+	"katana": {
+		"mode":           {kind: optionChoice, choices: urlScanModes},
+		"maxDepth":       {kind: optionInt},
+		"concurrency":    {kind: optionInt},
+		"parallelism":    {kind: optionInt},
+		"rateLimit":      {kind: optionInt},
+		"timeout":        {kind: optionInt},
+		"soft404":        {kind: optionBool},
+		"crawlDuration":  {kind: optionInt},
+		"fieldScope":     {kind: optionChoice, choices: katanaFieldScopes},
+		"strategy":       {kind: optionChoice, choices: katanaStrategies},
+		"noScope":        {kind: optionBool},
+		"bodyReadSize":   {kind: optionInt},
+		"formExtraction": {kind: optionBool},
+		"redirectPolicy": {kind: optionChoice, choices: redirectPolicies},
+		"outputFile":     {kind: optionBool},
+	},
+}
+
+// NormalizeTemplateOverrides validates overrides against the options the scanner reads and returns them
+// with the values converted to the types the scanner expects (JSON numbers to ints, source lists to
+// comma-separated names).
+func NormalizeTemplateOverrides(overrides TemplateOverrides) (TemplateOverrides, error) {
+	normalized := make(TemplateOverrides, len(overrides))
+	for tool, options := range overrides {
+		known, ok := overridableOptions[tool]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool '%s' (allowed: subfinder, katana)", tool)
+		}
+		normalized[tool] = make(map[string]interface{}, len(options))
+		for key, value := range options {
+			option, ok := known[key]
+			if !ok {
+				return nil, fmt.Errorf("unknown %s option '%s'", tool, key)
+			}
+			converted, err := option.normalize(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s option '%s': %w", tool, key, err)
+			}
+			normalized[tool][key] = converted
+		}
+	}
+	return normalized, nil
+}
+
+// CheckTemplateChoiceOptions checks that the katana options of a template taking one of a fixed set of
+// values (such as fieldScope and strategy) have one of them. The scanner falls back to the default for
+// any other value, so templates are checked when they are saved instead.
+func CheckTemplateChoiceOptions(scanTemplate *models.ScanTemplate) error {
+	var section models.ScanSectionConfig
+	if scanTemplate.URLScanConfig == "" || json.Unmarshal([]byte(scanTemplate.URLScanConfig), &section) != nil {
+		return nil
+	}
+	toolCfg, ok := section.Tools["katana"]
+	if !ok || !toolCfg.Enabled {
+		return nil
+	}
+	options := parseToolOptions(toolCfg.Options)
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		option, ok := overridableOptions["katana"][key]
+		if !ok || option.kind != optionChoice {
+			continue
+		}
+		value := options[key]
+		if _, err := option.normalize(strings.TrimSpace(fmt.Sprint(value))); err != nil {
+			return fmt.Errorf("url_scan_config tool katana: invalid option '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// normalize checks a decoded JSON value against the option's kind and converts it.
+func (o overridableOption) normalize(value interface{}) (interface{}, error) {
+	switch o.kind {
+	case optionInt:
+		number, ok := value.(float64)
+		if !ok || number < 0 || number != float64(int(number)) {
+			return nil, fmt.Errorf("must be a non-negative whole number")
+		}
+		return int(number), nil
+	case optionBool:
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return value, nil
+	case optionChoice:
+		choice, ok := value.(string)
+		if ok {
+			for _, allowed := range o.choices {
+				if strings.EqualFold(choice, allowed) {
+					return allowed, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(o.choices, ", "))
+	default: // optionSources
+		var entries []string
+		switch v := value.(type) {
+		case string:
+			entries = strings.Split(v, ",")
+		case []interface{}:
+			for _, entry := range v {
+				name, ok := entry.(string)
+				if !ok {
+					return nil, fmt.Errorf("must be a list of source names")
+				}
+				entries = append(entries, name)
+			}
+		default:
+			return nil, fmt.Errorf("must be a list of source names")
+		}
+		var names []string
+		for _, entry := range entries {
+			name := strings.ToLower(strings.TrimSpace(entry))
+			if name == "" {
+				continue
+			}
+			if passive.NameSourceMap[name] == nil {
+				return nil, fmt.Errorf("unknown subfinder source '%s'", entry)
+			}
+			names = append(names, name)
+		}
+		return strings.Join(names, ","), nil
+	}
+}
+
+// ApplyOverrides merges normalized overrides over the tool options and resolves the settings again.
+// Overrides of a disabled tool are kept in its options but noted as having no effect.
+func (cfg *TemplateConfig) ApplyOverrides(overrides TemplateOverrides) {
+	tools := make([]string, 0, len(overrides))
+	for tool := range overrides {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		options := overrides[tool]
+		if len(options) == 0 {
+			continue
+		}
+		target, enabled := cfg.KatanaOptions, cfg.URLScanEnabled
+		if tool == "subfinder" {
+			target, enabled = cfg.SubfinderOptions, cfg.SubfinderEnabled
+		}
+		keys := make([]string, 0, len(options))
+		for key, value := range options {
+			target[key] = value
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		cfg.Notes = append(cfg.Notes, fmt.Sprintf("Scan overrides %s options: %s.", tool, strings.Join(keys, ", ")))
+		if !enabled {
+			cfg.Notes = append(cfg.Notes, fmt.Sprintf("The %s overrides have no effect, %s is disabled for this scan.", tool, tool))
+		}
+		if value, ok := options["outputFile"].(bool); ok && tool == "katana" {
+			cfg.KatanaOutputFile = value
+		}
+	}
+	cfg.Subfinder = resolveSubfinderSettings(cfg.SubfinderOptions)
+	cfg.Katana = resolveKatanaSettings(cfg.KatanaOptions)
+}
+
+// applyScanOverrides merges the overrides given when the scan was started (Scan.TemplateOverrides) into cfg.
+func applyScanOverrides(db *gorm.DB, scanID uint, cfg *TemplateConfig) {
+	var data string
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Pluck("template_overrides", &data).Error; err != nil {
+		log.Printf("Error loading template overrides for scan %d: %v", scanID, err)
+		return
+	}
+	if data == "" {
+		return
+	}
+	var overrides TemplateOverrides
+	if err := json.Unmarshal([]byte(data), &overrides); err != nil {
+		log.Printf("Warning: Ignoring unreadable template overrides of scan %d: %v", scanID, err)
+		return
+	}
+	overrides, err := NormalizeTemplateOverrides(overrides)
+	if err != nil {
+		log.Printf("Warning: Ignoring invalid template overrides of scan %d: %v", scanID, err)
+		return
+	}
+	cfg.ApplyOverrides(overrides)
+}
+
+// saveEffectiveConfig stores the configuration a scan runs with on the scan record (Scan.EffectiveConfig),
+// so a run can be reproduced even after its template changed.
+func saveEffectiveConfig(db *gorm.DB, scanID uint, cfg TemplateConfig) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		log.Printf("Warning: Failed to marshal effective config for scan %d: %v", scanID, err)
+		return
+	}
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Update("effective_config", string(data)).Error; err != nil {
+		log.Printf("Warning: Failed to save effective config for scan %d: %v", scanID, err)
+	}
+}
+
+// TemplateHostDelay returns the delay between requests to the same host for scans using a template: its
+// HostRequestDelayMs if set, HOST_REQUEST_DELAY_MS otherwise.
+func TemplateHostDelay(scanTemplate *models.ScanTemplate) time.Duration {
+	if scanTemplate != nil && scanTemplate.HostRequestDelayMs > 0 {
+		return time.Duration(min(scanTemplate.HostRequestDelayMs, MaxHostRequestDelayMs)) * time.Millisecond
+	}
+	return defaultHostDelay()
+}
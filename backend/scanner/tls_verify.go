@@ -0,0 +1,180 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	tlsCheckTimeout = 10 * time.Second // Connecting to a host and completing the handshake
+	tlsCheckWorkers = 10               // Hosts checked in parallel
+)
+
+// tlsVerifyEnabled reports whether the TLS_VERIFY setting requires valid certificates from scan targets.
+func tlsVerifyEnabled() bool {
+	return config.GetBool("TLS_VERIFY", false)
+}
+
+// scanTLSConfig returns the TLS config of requests to scan targets, which only verifies certificates with TLS_VERIFY.
+func scanTLSConfig() *tls.Config {
+	return &tls.Config{InsecureSkipVerify: !tlsVerifyEnabled()}
+}
+
+// scanTransport returns a copy of http.DefaultTransport using scanTLSConfig.
+func scanTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = scanTLSConfig()
+	return transport
+}
+
+// checkHostTLS completes a TLS handshake with port 443 of hostname, verifying its certificate. ok is false
+// if the host doesn't serve TLS there; otherwise verifyErr is nil for a valid certificate or says why it
+// is invalid. The connection counts against the outbound connection cap and waits hostDelay for the host.
+func checkHostTLS(ctx context.Context, hostname string, hostDelay time.Duration) (verifyErr error, ok bool) {
+	if err := hostLimiter.wait(ctx, hostname, hostDelay); err != nil {
+		return nil, false
+	}
+	release, err := outboundLimiter.acquire(ctx)
+	if err != nil {
+		return nil, false
+	}
+	defer release()
+
+	dialCtx, cancel := context.WithTimeout(ctx, tlsCheckTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: hostname}}
+	conn, err := dialer.DialContext(dialCtx, "tcp", net.JoinHostPort(hostname, "443"))
+	if err == nil {
+		conn.Close()
+		return nil, true
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return certErr.Err, true
+	}
+	return nil, false // Unreachable, or not speaking TLS
+}
+
+// checkSubdomainsTLS checks the certificates of the saved subdomains (hostname -> ID) and records the outcome
+// as their TLSCheck. Hosts not serving TLS on port 443 keep their previous check, if any.
+func checkSubdomainsTLS(ctx context.Context, db *gorm.DB, scanID uint, subdomains map[string]uint) {
+	hostDelay := scanHostDelay(scanID)
+	var mu sync.Mutex
+	var checks []models.TLSCheck
+	invalid := 0
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(tlsCheckWorkers, len(subdomains)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hostname := range work {
+				verifyErr, ok := checkHostTLS(ctx, hostname, hostDelay)
+				if !ok {
+					continue
+				}
+				check := models.TLSCheck{SubdomainID: subdomains[hostname], Valid: verifyErr == nil, ScanID: &scanID, CheckedAt: time.Now()}
+				mu.Lock()
+				if verifyErr != nil {
+					check.Error = verifyErr.Error()
+					invalid++
+					log.Printf("Invalid TLS certificate on %s (Scan ID: %d): %v", hostname, scanID, verifyErr)
+				}
+				checks = append(checks, check)
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for hostname := range subdomains {
+		select {
+		case work <- hostname:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if len(checks) == 0 {
+		log.Printf("None of the %d subdomains of scan %d completed a TLS handshake on port 443.", len(subdomains), scanID)
+		return
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subdomain_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"valid", "error", "scan_id", "checked_at"}),
+	}).CreateInBatches(checks, 500).Error; err != nil {
+		log.Printf("Error saving TLS checks of scan %d: %v", scanID, err)
+		return
+	}
+	log.Printf("TLS checks for scan %d: %d of %d hosts presented an invalid certificate.", scanID, invalid, len(checks))
+}
+
+// unverifiedTLSHosts returns the hosts of the root domain whose last TLS check failed, or nil unless
+// TLS_VERIFY is on.
+func unverifiedTLSHosts(db *gorm.DB, rootDomainID uint, scanID uint) map[string]struct{} {
+	if !tlsVerifyEnabled() {
+		return nil
+	}
+	var invalidHosts []string
+	if err := db.Model(&models.TLSCheck{}).
+		Joins("JOIN subdomains ON subdomains.id = tls_checks.subdomain_id").
+		Where("subdomains.root_domain_id = ? AND tls_checks.valid = ?", rootDomainID, false).
+		Pluck("subdomains.hostname", &invalidHosts).Error; err != nil {
+		log.Printf("Warning: Could not load the failed TLS checks for scan %d, crawling every host: %v", scanID, err)
+		return nil
+	}
+	invalid := make(map[string]struct{}, len(invalidHosts))
+	for _, host := range invalidHosts {
+		invalid[host] = struct{}{}
+	}
+	return invalid
+}
+
+// skipUnverifiedTLSSeeds drops the https seeds on the hosts returned by unverifiedTLSHosts.
+func skipUnverifiedTLSSeeds(seedURLs []string, invalid map[string]struct{}, scanID uint) []string {
+	if len(invalid) == 0 {
+		return seedURLs
+	}
+	kept := make([]string, 0, len(seedURLs))
+	for _, seed := range seedURLs {
+		if parsed, err := url.Parse(seed); err == nil && parsed.Scheme == "https" {
+			if _, skip := invalid[parsed.Hostname()]; skip {
+				continue
+			}
+		}
+		kept = append(kept, seed)
+	}
+	if skipped := len(seedURLs) - len(kept); skipped > 0 {
+		log.Printf("Skipping %d seeds of scan %d on hosts with an invalid TLS certificate.", skipped, scanID)
+	}
+	return kept
+}
+
+// katanaUnverifiedTLSRegexes translates the hosts returned by unverifiedTLSHosts into katana OutOfScope
+// regexes for their https URLs. Katana accepts any certificate, so this keeps links from reaching them.
+// Katana ignores OutOfScope with noScope, and hosts that were never checked, such as ones outside the
+// saved subdomains, are crawled whatever their certificate.
+func katanaUnverifiedTLSRegexes(invalid map[string]struct{}) []string {
+	regexes := make([]string, 0, len(invalid))
+	for host := range invalid {
+		regexes = append(regexes, `(?i)^https://([^/?#@]*@)?`+regexp.QuoteMeta(host)+`\.?(:[0-9]+)?([/?#]|$)`)
+	}
+	sort.Strings(regexes)
+	return regexes
+}
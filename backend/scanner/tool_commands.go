@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToolCommand is the command line reproducing a tool's run in a scan with the standalone CLI.
+type ToolCommand struct {
+	Tool    string `json:"tool"`
+	Command string `json:"command"`
+}
+
+// ToolCommands returns the CLI equivalents of the tools a scan with cfg runs, in the order they run:
+// subfinder on the root domain, httpx on the discovered hosts and katana on the seed URLs. The host and
+// seed lists are files the caller fills in (hosts.txt and seeds.txt). Options the CLIs lack (e.g. soft-404
+// filtering or redirect policies) and adjustments made at run time (politeness delays, session scoping)
+// are not reflected.
+func ToolCommands(cfg TemplateConfig, rootDomain string) []ToolCommand {
+	var commands []ToolCommand
+	if cfg.SubfinderEnabled {
+		s := cfg.Subfinder
+		args := []string{"subfinder", "-d", rootDomain, "-t", fmt.Sprint(s.Threads), "-timeout", fmt.Sprint(s.Timeout), "-max-time", fmt.Sprint(s.MaxEnumerationTime)}
+		if len(s.Sources) > 0 {
+			args = append(args, "-s", strings.Join(s.Sources, ","))
+		}
+		if len(s.ExcludeSources) > 0 {
+			args = append(args, "-es", strings.Join(s.ExcludeSources, ","))
+		}
+		if s.All {
+			args = append(args, "-all")
+		}
+		commands = append(commands, ToolCommand{Tool: "subfinder", Command: strings.Join(append(args, "-silent"), " ")})
+	}
+	if cfg.HttpxEnabled {
+		h := cfg.Httpx
+		args := []string{"httpx", "-l", "hosts.txt", "-x", "GET", "-threads", fmt.Sprint(h.Threads), "-timeout", fmt.Sprint(h.Timeout), "-retries", fmt.Sprint(h.Retries), "-sc", "-random-agent"}
+		if h.FollowRedirects {
+			args = append(args, "-fr")
+		}
+		if h.TLSGrab {
+			args = append(args, "-tls-grab")
+		}
+		commands = append(commands, ToolCommand{Tool: "httpx", Command: strings.Join(append(args, "-silent"), " ")})
+	}
+	if cfg.URLScanEnabled && cfg.Katana.Mode == URLScanModeCrawl {
+		k := cfg.Katana
+		args := []string{"katana", "-list", "seeds.txt", "-d", fmt.Sprint(k.MaxDepth), "-c", fmt.Sprint(k.Concurrency), "-p", fmt.Sprint(k.Parallelism),
+			"-rl", fmt.Sprint(k.RateLimit), "-timeout", fmt.Sprint(k.Timeout), "-fs", k.FieldScope, "-s", k.Strategy, "-mrs", fmt.Sprint(k.BodyReadSize)}
+		if k.CrawlDuration > 0 {
+			args = append(args, "-ct", fmt.Sprintf("%ds", k.CrawlDuration))
+		}
+		if k.NoScope {
+			args = append(args, "-ns")
+		}
+		if k.FormExtraction {
+			args = append(args, "-fx")
+		}
+		commands = append(commands, ToolCommand{Tool: "katana", Command: strings.Join(append(args, "-silent"), " ")})
+	}
+	return commands
+}
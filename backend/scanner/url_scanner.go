@@ -2,18 +2,28 @@ package scanner
 
 import (
 	"context" // Ensure context is imported
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
+	"math/rand"
+	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	appconfig "rewrite-go/config" // Aliased, ExecuteURLScan's options parameter is named config
 	"rewrite-go/database"
 	"rewrite-go/models"
-
-	// "strconv" // Removed
-	// "strings" // Removed unused import
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/projectdiscovery/katana/pkg/engine/standard"
+	"github.com/projectdiscovery/katana/pkg/navigation"
 	"github.com/projectdiscovery/katana/pkg/output"
 	"github.com/projectdiscovery/katana/pkg/types"
 
@@ -25,22 +35,228 @@ import (
 
 // --- URL Scan Specific Structs and Functions ---
 
+const defaultSeedCrawlDuration = 600 // Default per-seed crawl deadline in seconds, overridable via the "crawlDuration" Katana option
+
+const defaultKatanaBodyReadSize = 1 * 1024 * 1024 // Bytes of each response body read, overridable via the "bodyReadSize" Katana option
+
+const defaultURLSaveWorkers = 1 // Goroutines saving URL scan results, overridable via the URL_SAVE_WORKERS setting
+
 // urlScanResult holds processed data from a Katana result.
 type urlScanResult struct {
 	Hostname string // Store the actual hostname found
 	Endpoint models.Endpoint
 	Params   []models.Parameter
-	FullURL  string // Store the original full URL for screenshotting
+	FullURL  string                  // Store the original full URL for screenshotting
+	Capture  *models.RequestResponse // Captured request/response pair, nil unless the status code is configured for capture
+	// URL outside the root domain the endpoint redirected to, recorded as an external link (redirectPolicy
+	// "same-scope")
+	ExternalTarget string
+}
+
+// Katana redirect policies, selected with the "redirectPolicy" option of the katana tool config
+const (
+	RedirectPolicyFollowAll = "follow-all" // Store the page a redirect ends at under the redirecting URL, wherever it is
+	RedirectPolicySameScope = "same-scope" // Store redirects as they are and only follow the ones staying in scope
+)
+
+// redirectPolicies are the redirect policies the URL phase accepts.
+var redirectPolicies = []string{RedirectPolicySameScope, RedirectPolicyFollowAll}
+
+// parseCaptureStatusCodes parses the CAPTURE_STATUS_CODES setting, a comma-separated list of
+// 2xx/3xx status codes or classes (e.g. "200,301" or "2xx,3xx"), into the set of codes to capture.
+// Invalid entries, including codes outside 2xx/3xx that a config.json written before they were refused
+// may hold, are logged and ignored; an empty setting disables capture.
+func parseCaptureStatusCodes(value string) map[int]struct{} {
+	codes := make(map[int]struct{})
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "2xx" || entry == "3xx" {
+			base := int(entry[0]-'0') * 100
+			for code := base; code < base+100; code++ {
+				codes[code] = struct{}{}
+			}
+			continue
+		}
+		code, err := strconv.Atoi(entry)
+		if err != nil || code < 200 || code > 399 {
+			log.Printf("Warning: Ignoring invalid status code entry '%s'", entry)
+			continue
+		}
+		codes[code] = struct{}{}
+	}
+	return codes
+}
+
+// formatHeaders renders a header map as sorted "Name: value" lines.
+func formatHeaders(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + ": " + headers[name] + "\n")
+	}
+	return sb.String()
+}
+
+// soft404Signature describes how a host responds to a path that does not exist.
+// Hosts that answer every path with the same page (often a 200) produce endpoints that are pure noise.
+type soft404Signature struct {
+	StatusCode    int
+	ContentLength int
+	BodyHash      string
+	Words         map[string]struct{} // Distinct words of the page, for pages that vary between requests
+}
+
+// Soft-404 pages that are not identical to the calibration response match if their length is within
+// soft404LengthTolerance of it (at least soft404LengthToleranceBytes) and they share soft404MinSimilarity
+// of their distinct words, e.g. pages embedding a timestamp or a request ID.
+const (
+	soft404LengthTolerance      = 0.05
+	soft404LengthToleranceBytes = 64
+	soft404MinSimilarity        = 0.9
+)
+
+// soft404Fingerprint hashes a response body after stripping the requested path,
+// so pages that reflect the path back ("/foo not found") still match the calibration response.
+// It also returns the stripped body.
+func soft404Fingerprint(body string, requestPath string) (string, int, string) {
+	if requestPath != "" && requestPath != "/" {
+		body = strings.ReplaceAll(body, requestPath, "")
+	}
+	sum := sha256.Sum256([]byte(body))
+	return body, len(body), hex.EncodeToString(sum[:])
+}
+
+// soft404Words returns the distinct whitespace-separated words of body.
+func soft404Words(body string) map[string]struct{} {
+	words := make(map[string]struct{})
+	for _, word := range strings.Fields(body) {
+		words[word] = struct{}{}
+	}
+	return words
+}
+
+// matches reports whether a crawled response looks like the host's soft-404 page: same status code, and
+// either the same body or a body of about the same length with mostly the same words. A length match
+// alone is not enough, real pages of the same size are common.
+func (sig soft404Signature) matches(statusCode int, body string, requestPath string) bool {
+	if statusCode != sig.StatusCode {
+		return false
+	}
+	stripped, length, hash := soft404Fingerprint(body, requestPath)
+	if hash == sig.BodyHash {
+		return true
+	}
+	tolerance := max(soft404LengthToleranceBytes, int(float64(sig.ContentLength)*soft404LengthTolerance))
+	if length < sig.ContentLength-tolerance || length > sig.ContentLength+tolerance {
+		return false
+	}
+	return wordSimilarity(sig.Words, soft404Words(stripped)) >= soft404MinSimilarity
+}
+
+// wordSimilarity is the Jaccard index of two word sets: 1 for the same words, 0 for none in common.
+func wordSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range a {
+		if _, ok := b[word]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// calibrateSoft404 requests a random nonexistent path on every seed host and records the response signature.
+// Only hosts that answer with a success status are returned; real 404s are already filtered by status code.
+// Requests to the same host are spaced hostDelay apart.
+func calibrateSoft404(seedURLs []string, timeout int, hostDelay time.Duration) map[string]soft404Signature {
+	signatures := make(map[string]soft404Signature)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 10) // Limit concurrent calibration requests
+
+	httpClient := &http.Client{Timeout: time.Duration(timeout) * time.Second, Transport: newLimitedTransport(nil, hostDelay)}
+	defer httpClient.CloseIdleConnections()
+
+	seenBases := make(map[string]struct{})
+	for _, seed := range seedURLs {
+		parsedSeed, err := url.Parse(seed)
+		if err != nil || parsedSeed.Host == "" {
+			continue
+		}
+		base := parsedSeed.Scheme + "://" + parsedSeed.Host
+		if _, seen := seenBases[base]; seen {
+			continue
+		}
+		seenBases[base] = struct{}{}
+
+		wg.Add(1)
+		go func(base string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			randomPath := fmt.Sprintf("/%x", rand.Int63())
+			resp, err := httpClient.Get(base + randomPath)
+			if err != nil {
+				return // Host unreachable; Katana will not get anything from it either
+			}
+			data, err := io.ReadAll(io.LimitReader(resp.Body, 1*1024*1024))
+			resp.Body.Close()
+			if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 400 {
+				return
+			}
+
+			stripped, length, hash := soft404Fingerprint(string(data), randomPath)
+			mu.Lock()
+			signatures[base] = soft404Signature{StatusCode: resp.StatusCode, ContentLength: length, BodyHash: hash, Words: soft404Words(stripped)}
+			mu.Unlock()
+			log.Printf("Soft-404 calibration: %s answers nonexistent paths with status %d (%d bytes)", base, resp.StatusCode, length)
+		}(base)
+	}
+	wg.Wait()
+
+	return signatures
 }
 
 // processKatanaOutput is the callback function for Katana results.
 // It parses the URL, extracts relevant information, and sends it to a channel for processing.
 // It should NOT modify existingSubdomains map.
-func processKatanaOutput(result output.Result, rootDomain string, rootDomainID uint, scanID uint, resultsChan chan<- urlScanResult, existingSubdomains *sync.Map) { // existingSubdomains map is read-only here now
+// soft404Signatures is read-only here; results matching their host's signature are dropped.
+// Only 2xx/3xx responses are kept; those whose status code is in captureStatusCodes also carry their
+// request/response pair.
+// With redirects set (redirectPolicy "same-scope"), katana does not follow redirects: the redirect
+// response is stored as it is, a target in scope is queued on redirects, and a target outside the root
+// domain is recorded as an external link without ever being requested.
+func processKatanaOutput(result output.Result, rootDomain string, rootDomainID uint, scanID uint, resultsChan chan<- urlScanResult, existingSubdomains *sync.Map, soft404Signatures map[string]soft404Signature, captureStatusCodes map[int]struct{}, deniedSuffixes []string, outOfScope []string, redirects *redirectFollowUps) { // existingSubdomains map is read-only here now
 	// Basic filtering
-	if result.Request == nil || result.Response == nil || result.Response.StatusCode < 200 || result.Response.StatusCode >= 400 {
+	if result.Request == nil || result.Response == nil {
+		return
+	}
+	statusCode, contentType := result.Response.StatusCode, result.Response.Headers["Content-Type"]
+	externalTarget := ""
+	if redirects != nil {
+		if target := redirectLocation(result.Response.Resp); target != nil {
+			switch {
+			case !isUnderRootDomain(target.Hostname(), rootDomain):
+				externalTarget = target.String()
+			case !isDeniedHostname(target.Hostname(), deniedSuffixes) && !isOutOfScope(target.Hostname(), outOfScope):
+				redirects.add(target.String())
+			}
+		}
+	}
+	if statusCode < 200 || statusCode >= 400 {
 		return
 	}
+	_, capture := captureStatusCodes[statusCode]
 
 	parsedURL, err := url.Parse(result.Request.URL)
 	if err != nil {
@@ -48,27 +264,29 @@ func processKatanaOutput(result output.Result, rootDomain string, rootDomainID u
 		return
 	}
 
+	// Drop responses that match the host's soft-404 page
+	if sig, ok := soft404Signatures[parsedURL.Scheme+"://"+parsedURL.Host]; ok && externalTarget == "" && parsedURL.Path != "" && parsedURL.Path != "/" {
+		if sig.matches(result.Response.StatusCode, result.Response.Body, parsedURL.Path) {
+			return
+		}
+	}
+
 	hostname := parsedURL.Hostname()
 	if hostname == "" {
 		log.Printf("Could not extract hostname from URL: %s", result.Request.URL)
 		return
 	}
 
-	// Check if the hostname belongs to the target root domain using publicsuffix
-	parsedHostDomain, err := publicsuffix.Parse(hostname)
-	if err != nil {
-		// log.Printf("Could not parse hostname %s for root domain check: %v", hostname, err)
-		return // Skip if we can't parse
+	// Katana's scope (fieldScope/noScope) decides which links are followed; this check decides what is stored.
+	// Results are only saved under the target root domain, so hosts reached via "dn" or noScope are dropped here.
+	if !isUnderRootDomain(hostname, rootDomain) {
+		return // Skip URLs not belonging to the target root domain
 	}
-	// Handle cases like "domain.co.uk" where SLD is "domain"
-	hostRootDomain := parsedHostDomain.SLD + "." + parsedHostDomain.TLD
-	if parsedHostDomain.SLD == "" { // Handle cases like "com.au" if parsed directly
-		hostRootDomain = hostname
+	if isDeniedHostname(hostname, deniedSuffixes) {
+		return // Internal or unwanted hosts (HOSTNAME_DENY_SUFFIXES) are never stored
 	}
-
-	if hostRootDomain != rootDomain {
-		// log.Printf("Skipping URL %s: Host %s (root: %s) does not belong to target root domain %s", result.Request.URL, hostname, hostRootDomain, rootDomain)
-		return // Skip URLs not belonging to the target root domain
+	if isOutOfScope(hostname, outOfScope) {
+		return // Hosts excluded by the organization's scope rules neither
 	}
 
 	// Don't modify existingSubdomains here. Let saveURLScanResults handle it.
@@ -77,14 +295,15 @@ func processKatanaOutput(result output.Result, rootDomain string, rootDomainID u
 		Hostname: hostname,           // Pass the actual hostname
 		FullURL:  result.Request.URL, // Store the original URL
 		Endpoint: models.Endpoint{
-			// SubdomainID will be filled later by saveURLScanResults
-			Path:         parsedURL.Path,
+			// SubdomainID will be filled later by saveURLScanResults, which also normalizes the path
+			Path:         parsedURL.EscapedPath(),
 			Method:       result.Request.Method,
-			StatusCode:   result.Response.StatusCode,
-			ContentType:  result.Response.Headers["Content-Type"],
+			StatusCode:   statusCode,
+			ContentType:  contentType,
 			DiscoveredAt: time.Now(),
 			ScanID:       &scanID,
 		},
+		ExternalTarget: externalTarget,
 	}
 
 	// Extract Parameters
@@ -102,21 +321,228 @@ func processKatanaOutput(result output.Result, rootDomain string, rootDomainID u
 	}
 	// TODO: Potentially parse body for parameters if needed and available in result
 
+	if capture {
+		res.Capture = &models.RequestResponse{
+			RequestHeaders:  formatHeaders(result.Request.Headers),
+			RequestBody:     result.Request.Body,
+			ResponseHeaders: formatHeaders(result.Response.Headers),
+			ResponseBody:    result.Response.Body, // Already capped by Katana's BodyReadSize
+			CapturedAt:      time.Now(),
+		}
+	}
+
 	resultsChan <- res
+
+	// Forms found on the page (only extracted with the formExtraction option) add their action as an
+	// endpoint with the form fields as parameters. Actions are not requested, so they have no status code.
+	for _, form := range result.Response.Forms {
+		if formResult, ok := formActionResult(form, hostname, scanID); ok {
+			resultsChan <- formResult
+		}
+	}
+}
+
+// saveEndpointStatus records an endpoint's response in a scan. A second observation in the same scan
+// (e.g. by the crawl and the known endpoint refresh) replaces the first.
+func saveEndpointStatus(db *gorm.DB, endpointID, scanID uint, statusCode int, contentType string, observedAt time.Time) {
+	entry := models.EndpointStatusHistory{
+		EndpointID:  endpointID,
+		ScanID:      &scanID,
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		ObservedAt:  observedAt,
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint_id"}, {Name: "scan_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status_code", "content_type", "observed_at"}),
+	}).Create(&entry).Error; err != nil {
+		log.Printf("Error recording status history of endpoint ID %d: %v", endpointID, err)
+	}
+}
+
+// saveExternalLink records that an endpoint redirected to an out-of-scope URL, or refreshes the record if
+// it is known.
+func saveExternalLink(db *gorm.DB, rootDomainID uint, endpointID uint, statusCode int, targetURL string, scanID uint, seenAt time.Time) {
+	targetHost := ""
+	if parsed, err := url.Parse(targetURL); err == nil {
+		targetHost = parsed.Hostname()
+	}
+	link := models.ExternalLink{
+		RootDomainID: rootDomainID,
+		EndpointID:   endpointID,
+		TargetURL:    targetURL,
+		TargetHost:   targetHost,
+		StatusCode:   statusCode,
+		ScanID:       &scanID,
+		DiscoveredAt: seenAt,
+		LastSeenAt:   &seenAt,
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint_id"}, {Name: "target_url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status_code", "scan_id", "last_seen_at"}), // Keep discovered_at as first seen
+	}).Create(&link).Error; err != nil {
+		log.Printf("Error saving external link %s of endpoint ID %d: %v", targetURL, endpointID, err)
+	}
+}
+
+// isUnderRootDomain reports whether hostname belongs to rootDomain, by its registrable domain.
+func isUnderRootDomain(hostname string, rootDomain string) bool {
+	parsedHostDomain, err := publicsuffix.Parse(hostname)
+	if err != nil {
+		return false // Can't tell, treat as out of scope
+	}
+	// Handle cases like "domain.co.uk" where SLD is "domain"
+	hostRootDomain := parsedHostDomain.SLD + "." + parsedHostDomain.TLD
+	if parsedHostDomain.SLD == "" { // Handle cases like "com.au" if parsed directly
+		hostRootDomain = hostname
+	}
+	return hostRootDomain == rootDomain
+}
+
+// redirectLocation returns the absolute URL a redirect response points to, or nil if resp is not a
+// redirect with a usable Location header.
+func redirectLocation(resp *http.Response) *url.URL {
+	if resp == nil || resp.Request == nil || resp.Request.URL == nil || resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil
+	}
+	target, err := resp.Request.URL.Parse(location)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return nil
+	}
+	target.Fragment = ""
+	return target
+}
+
+// redirectFollowUps collects the in-scope redirect targets of a crawl that does not follow redirects, to
+// be crawled as seeds once the seeds are done. Every URL is queued once.
+type redirectFollowUps struct {
+	mu      sync.Mutex
+	seen    map[string]bool
+	pending []string
+}
+
+// newRedirectFollowUps returns an empty queue that never queues the given seeds.
+func newRedirectFollowUps(seeds []string) *redirectFollowUps {
+	r := &redirectFollowUps{seen: make(map[string]bool, len(seeds))}
+	for _, seed := range seeds {
+		r.seen[seed] = true
+	}
+	return r
+}
+
+// add queues targetURL unless it was queued before.
+func (r *redirectFollowUps) add(targetURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.seen[targetURL] {
+		r.seen[targetURL] = true
+		r.pending = append(r.pending, targetURL)
+	}
+}
+
+// take returns and clears the queued URLs.
+func (r *redirectFollowUps) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := r.pending
+	r.pending = nil
+	return pending
+}
+
+// formActionResult turns an extracted form into a result for its action URL. Only actions on the host of
+// the page are kept, so forms never introduce hosts the crawl did not reach.
+func formActionResult(form navigation.Form, pageHostname string, scanID uint) (urlScanResult, bool) {
+	actionURL, err := url.Parse(form.Action)
+	if err != nil || !actionURL.IsAbs() || actionURL.Hostname() != pageHostname {
+		return urlScanResult{}, false
+	}
+	method := strings.ToUpper(strings.TrimSpace(form.Method))
+	if method == "" {
+		method = "GET"
+	}
+	path := actionURL.EscapedPath() // Normalized by saveURLScanResults
+
+	paramType := "body"
+	if method == "GET" {
+		paramType = "query"
+	}
+	res := urlScanResult{
+		Hostname: pageHostname,
+		FullURL:  actionURL.String(),
+		Endpoint: models.Endpoint{
+			Path:         path,
+			Method:       method,
+			DiscoveredAt: time.Now(),
+			ScanID:       &scanID,
+		},
+	}
+	seen := make(map[string]bool)
+	for _, name := range form.Parameters {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		res.Params = append(res.Params, models.Parameter{Name: name, ParamType: paramType, DiscoveredAt: time.Now()})
+	}
+	return res, true
+}
+
+// startURLSaveWorkers starts the URL_SAVE_WORKERS goroutines saving the results sent to resultsChan,
+// adding them to wg. With more than one worker, results are dispatched by endpoint so that the same
+// endpoint is never found-or-created by two workers at once. Subdomains may be created by several
+// workers, which the upsert in saveURLScanResults tolerates.
+func startURLSaveWorkers(db *gorm.DB, rootDomain string, rootDomainID uint, scanID uint, resultsChan <-chan urlScanResult, wg *sync.WaitGroup, existingSubdomains *sync.Map, screenshotEnabled bool, screenshotCriteria []string) {
+	workers := appconfig.GetInt("URL_SAVE_WORKERS", defaultURLSaveWorkers)
+	if workers <= 1 {
+		wg.Add(1)
+		go saveURLScanResults(db, rootDomain, rootDomainID, scanID, resultsChan, wg, existingSubdomains, screenshotEnabled, screenshotCriteria)
+		return
+	}
+	log.Printf("URL Scan: Saving results of scan %d with %d workers.", scanID, workers)
+
+	shards := make([]chan urlScanResult, workers)
+	for i := range shards {
+		shards[i] = make(chan urlScanResult, cap(resultsChan))
+		wg.Add(1)
+		go saveURLScanResults(db, rootDomain, rootDomainID, scanID, shards[i], wg, existingSubdomains, screenshotEnabled, screenshotCriteria)
+	}
+	go func() {
+		for res := range resultsChan {
+			shards[urlResultShard(res, workers)] <- res
+		}
+		for _, shard := range shards {
+			close(shard)
+		}
+	}()
+}
+
+// urlResultShard picks the save worker of a result from the endpoint it belongs to, using the path
+// saveURLScanResults stores.
+func urlResultShard(res urlScanResult, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(res.Hostname + " " + res.Endpoint.Method + " " + NormalizeEndpointPath(res.Endpoint.Path)))
+	return int(h.Sum32() % uint32(workers))
 }
 
 // saveURLScanResults processes results from the channel and saves them to the DB.
 // Added screenshotEnabled bool parameter.
-func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanID uint, resultsChan <-chan urlScanResult, wg *sync.WaitGroup, existingSubdomains *sync.Map, screenshotEnabled bool) {
+func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanID uint, resultsChan <-chan urlScanResult, wg *sync.WaitGroup, existingSubdomains *sync.Map, screenshotEnabled bool, screenshotCriteria []string) {
 	defer wg.Done()
 	var newSubdomainsToCreate []models.Subdomain
-	var endpointsToCreate []models.Endpoint                  // Holds endpoints collected during the run
-	var endpointOriginalURLs = make(map[int]string)          // Map index in endpointsToCreate to its original URL
-	var endpointParamsMap = make(map[int][]models.Parameter) // Map index in endpointsToCreate to its params
-	var endpointHostnameMap = make(map[int]string)           // Map index in endpointsToCreate to its hostname
+	var endpointsToCreate []models.Endpoint                        // Holds endpoints collected during the run
+	var endpointOriginalURLs = make(map[int]string)                // Map index in endpointsToCreate to its original URL
+	var endpointParamsMap = make(map[int][]models.Parameter)       // Map index in endpointsToCreate to its params
+	var endpointHostnameMap = make(map[int]string)                 // Map index in endpointsToCreate to its hostname
+	var endpointCaptureMap = make(map[int]*models.RequestResponse) // Map index in endpointsToCreate to its captured request/response
+	var endpointExternalMap = make(map[int]string)                 // Map index in endpointsToCreate to its out-of-scope redirect target
 
-	subdomainMap := make(map[string]uint) // Map hostname to known Subdomain ID (from DB or newly created)
-	var screenshotWG sync.WaitGroup       // WaitGroup for screenshot goroutines
+	subdomainMap := make(map[string]uint)      // Map hostname to known Subdomain ID (from DB or newly created)
+	seenHostnames := make(map[string]struct{}) // Hostnames observed during this crawl, for last_seen_at
+	var screenshotWG sync.WaitGroup            // WaitGroup for screenshot goroutines
 
 	// Load existing subdomain IDs from DB into both maps
 	var existingDBSubdomains []models.Subdomain
@@ -126,11 +552,13 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 		existingSubdomains.Store(sub.Hostname, sub.ID) // Store actual uint ID
 	}
 
-	endpointIndex := 0 // Counter for maps keyed by index
+	endpointIndex := 0   // Counter for maps keyed by index
+	seenAt := time.Now() // Observation time recorded as last_seen_at
 
 	// --- Collect results from channel ---
 	for res := range resultsChan {
 		currentHostname := res.Hostname
+		seenHostnames[currentHostname] = struct{}{}
 
 		// Use LoadOrStore to atomically check/create placeholder uint(0)
 		// This map tracks subdomains seen *during this URL scan* or loaded from DB.
@@ -143,9 +571,10 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 			continue // Skip this result as the map state is corrupted
 		}
 
-		// If LoadOrStore stored uint(0), it means it was new *to this map*.
+		// If LoadOrStore stored uint(0), it means it was new *to this map*. A loaded uint(0) is a
+		// subdomain another save worker has yet to create, which this one needs the ID of too.
 		// Add it to the creation list if it's not the root domain.
-		if !loaded && currentHostname != rootDomain {
+		if (!loaded || idVal == uint(0)) && currentHostname != rootDomain {
 			// Check again to prevent duplicates in the slice if processed concurrently
 			isAlreadyInCreateList := false
 			for _, existingSub := range newSubdomainsToCreate {
@@ -156,7 +585,7 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 			}
 			if !isAlreadyInCreateList {
 				newSubdomainsToCreate = append(newSubdomainsToCreate, models.Subdomain{
-					Hostname: currentHostname, RootDomainID: rootDomainID, ScanID: &scanID, DiscoveredAt: time.Now(), IsActive: true,
+					Hostname: currentHostname, RootDomainID: rootDomainID, ScanID: &scanID, DiscoveredAt: seenAt, LastSeenAt: &seenAt, IsActive: true,
 				})
 			}
 		}
@@ -167,6 +596,12 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 		endpointParamsMap[endpointIndex] = res.Params
 		endpointHostnameMap[endpointIndex] = currentHostname // Store hostname for this endpoint index
 		endpointOriginalURLs[endpointIndex] = res.FullURL    // Store original URL
+		if res.Capture != nil {
+			endpointCaptureMap[endpointIndex] = res.Capture
+		}
+		if res.ExternalTarget != "" {
+			endpointExternalMap[endpointIndex] = res.ExternalTarget
+		}
 		endpointIndex++
 	}
 	// --- End collecting results ---
@@ -176,7 +611,7 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 		log.Printf("URL Scan: Saving %d new subdomains for scan %d...", len(newSubdomainsToCreate), scanID)
 		result := db.Clauses(clause.OnConflict{
 			Columns:   []clause.Column{{Name: "hostname"}, {Name: "root_domain_id"}},
-			DoUpdates: clause.AssignmentColumns([]string{"scan_id", "discovered_at", "is_active"}),
+			DoUpdates: clause.AssignmentColumns([]string{"scan_id", "last_seen_at", "is_active"}), // Keep discovered_at as first seen
 		}).Create(&newSubdomainsToCreate) // Create the list
 
 		if result.Error != nil {
@@ -198,6 +633,7 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 			}
 			if len(hostnames) > 0 {
 				db.Where("root_domain_id = ? AND hostname IN ?", rootDomainID, hostnames).Find(&createdSubs)
+				notifyNewSubdomains(newSubdomainEvents(createdSubs, seenAt, scanID, SubdomainSourceURLScan))
 				for _, sub := range createdSubs {
 					// Ensure map has the latest ID
 					if _, ok := subdomainMap[sub.Hostname]; !ok || subdomainMap[sub.Hostname] == 0 {
@@ -222,11 +658,26 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 	}
 	// --- End Batch Create New Subdomains ---
 
+	// --- Refresh last_seen_at for Re-observed Subdomains ---
+	if len(seenHostnames) > 0 {
+		hostnames := make([]string, 0, len(seenHostnames))
+		for hostname := range seenHostnames {
+			hostnames = append(hostnames, hostname)
+		}
+		if err := db.Model(&models.Subdomain{}).
+			Where("root_domain_id = ? AND hostname IN ?", rootDomainID, hostnames).
+			Update("last_seen_at", seenAt).Error; err != nil {
+			log.Printf("Warning: Failed to update last_seen_at for subdomains in scan %d: %v", scanID, err)
+		}
+	}
+
 	// --- Prepare Final Endpoint List for Batch Create ---
 	var finalEndpointsToCreate []models.Endpoint
-	var finalEndpointParamsMap = make(map[int][]models.Parameter) // Map final index to original params
-	var finalEndpointURLsMap = make(map[int]string)               // Map final index to original URL
-	finalEndpointIndex := 0                                       // Index for the final lists
+	var finalEndpointParamsMap = make(map[int][]models.Parameter)       // Map final index to original params
+	var finalEndpointURLsMap = make(map[int]string)                     // Map final index to original URL
+	var finalEndpointCaptureMap = make(map[int]*models.RequestResponse) // Map final index to captured request/response
+	var finalEndpointExternalMap = make(map[int]string)                 // Map final index to out-of-scope redirect target
+	finalEndpointIndex := 0                                             // Index for the final lists
 
 	// Note: The root domain check previously here is now implicitly handled
 	// by the full refresh of subdomainMap above.
@@ -259,18 +710,18 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 
 		ep.SubdomainID = resolvedSubID // Set the resolved ID
 
-		// Clean up path if it contains the full URL
-		parsedFinalURL, err := url.Parse(ep.Path)
-		if err == nil && parsedFinalURL.IsAbs() {
-			ep.Path = parsedFinalURL.Path
-			if ep.Path == "" {
-				ep.Path = "/"
-			}
-		}
+		// Store the normalized path, so that e.g. "/admin/" and "/admin" are the same endpoint
+		ep.Path = NormalizeEndpointPath(ep.Path)
 
 		finalEndpointsToCreate = append(finalEndpointsToCreate, ep)
 		finalEndpointParamsMap[finalEndpointIndex] = endpointParamsMap[i]  // Use the new index for params map
 		finalEndpointURLsMap[finalEndpointIndex] = endpointOriginalURLs[i] // Use the new index for URL map
+		if capture, ok := endpointCaptureMap[i]; ok {
+			finalEndpointCaptureMap[finalEndpointIndex] = capture
+		}
+		if target, ok := endpointExternalMap[i]; ok {
+			finalEndpointExternalMap[finalEndpointIndex] = target
+		}
 		finalEndpointIndex++
 	}
 	// --- End Preparing Final Endpoint List ---
@@ -283,10 +734,21 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 
 		// Assign fields that should always be updated if found, or set if created
 		updateAttrs := models.Endpoint{
-			StatusCode:   ep.StatusCode,
-			ContentType:  ep.ContentType,
-			DiscoveredAt: ep.DiscoveredAt, // Update discovery time
-			ScanID:       ep.ScanID,       // Update last scan ID
+			StatusCode:  ep.StatusCode,
+			ContentType: ep.ContentType,
+			LastSeenAt:  &seenAt,   // Mark as re-observed; DiscoveredAt is only set on create
+			ScanID:      ep.ScanID, // Update last scan ID
+		}
+		requested := ep.StatusCode != 0 // Form actions are not requested and keep any known response
+
+		// Record a change if the endpoint already exists and now answers differently
+		if requested {
+			if err := db.Model(&models.Endpoint{}).
+				Where("subdomain_id = ? AND path = ? AND method = ? AND (status_code <> ? OR content_type <> ?)",
+					ep.SubdomainID, ep.Path, ep.Method, ep.StatusCode, ep.ContentType).
+				Update("changed_at", seenAt).Error; err != nil {
+				log.Printf("Error recording change of endpoint %s %s for subdomain %d: %v", ep.Method, ep.Path, ep.SubdomainID, err)
+			}
 		}
 
 		// Find based on unique key, create with all fields if not found, update specific fields if found
@@ -313,8 +775,29 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 			continue
 		}
 
+		// --- Record the Response in the Endpoint's Status History ---
+		if requested {
+			saveEndpointStatus(db, ep.ID, scanID, ep.StatusCode, ep.ContentType, seenAt)
+		}
+
+		// --- Save Captured Request/Response (if its status code was configured for capture) ---
+		if capture, ok := finalEndpointCaptureMap[i]; ok {
+			capture.EndpointID = ep.ID
+			if err := db.Create(capture).Error; err != nil {
+				log.Printf("Error saving request/response capture for endpoint ID %d: %v", ep.ID, err)
+			}
+		}
+
+		// --- Record the Redirect Target Outside the Root Domain (redirectPolicy "same-scope") ---
+		if target, ok := finalEndpointExternalMap[i]; ok {
+			saveExternalLink(db, rootDomainID, ep.ID, ep.StatusCode, target, scanID, seenAt)
+		}
+
 		// --- Take Screenshot (if enabled and eligible) ---
-		if screenshotEnabled && ShouldScreenshot(originalURL) {
+		_, captured := finalEndpointCaptureMap[i]
+		_, external := finalEndpointExternalMap[i] // The browser would end up on the out-of-scope page
+		facts := endpointScreenshotFacts{StatusCode: ep.StatusCode, ContentType: ep.ContentType, Captured: captured, HasParameters: len(finalEndpointParamsMap[i]) > 0}
+		if screenshotEnabled && requested && !external && ShouldScreenshotContent(originalURL, ep.ContentType) && matchesScreenshotCriteria(screenshotCriteria, facts) && claimScanScreenshot(scanID, originalURL) {
 			screenshotWG.Add(1)
 			go func(targetURL string, currentEndpointID uint) {
 				defer screenshotWG.Done()
@@ -361,59 +844,141 @@ func saveURLScanResults(db *gorm.DB, rootDomain string, rootDomainID uint, scanI
 
 } // <<< Correct closing brace for saveURLScanResults
 
+// katanaFieldScopes are the named scopes katana accepts for fieldScope:
+// "rdn" the seed's root domain, "fqdn" the seed's exact hostname, "dn" any host containing the seed's domain keyword.
+var katanaFieldScopes = []string{"rdn", "fqdn", "dn"}
+
+// katanaStrategies are the crawl orders katana accepts for strategy.
+var katanaStrategies = []string{"depth-first", "breadth-first"}
+
 // ExecuteURLScan performs URL crawling starting from a list of seed URLs, using provided configuration.
 // Added scanTemplate parameter.
-func ExecuteURLScan(seedURLs []string, rootDomain string, rootDomainID uint, scanID uint, existingSubdomains *sync.Map, scanTemplate *models.ScanTemplate, config map[string]interface{}, outputFile string) error {
+// Returns the seeds whose crawl was cut short by the per-seed crawl duration limit.
+func ExecuteURLScan(seedURLs []string, rootDomain string, rootDomainID uint, scanID uint, existingSubdomains *sync.Map, scanTemplate *models.ScanTemplate, config map[string]interface{}, outputFile string) ([]string, error) {
 	log.Printf("Starting URL scan for scan %d with %d seed URLs...", scanID, len(seedURLs))
 	if outputFile != "" {
 		log.Printf("URL scan %d will output results to: %s", scanID, outputFile)
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			log.Printf("Warning: Could not create directory for katana output %s: %v", outputFile, err)
+		}
 	}
 	if scanTemplate == nil {
-		return fmt.Errorf("internal error: ExecuteURLScan called with nil scanTemplate for Scan ID: %d", scanID)
+		return nil, fmt.Errorf("internal error: ExecuteURLScan called with nil scanTemplate for Scan ID: %d", scanID)
 	}
 	if len(seedURLs) == 0 {
 		log.Printf("No seed URLs provided for URL scan %d. Skipping.", scanID)
-		return nil
+		return nil, nil
 	}
 
 	db := database.GetDB()
+	outOfScope := outOfScopePatterns(db, rootDomainID)
+	if seedURLs = dropOutOfScopeURLs(seedURLs, outOfScope, "seed URLs", scanID); len(seedURLs) == 0 {
+		log.Printf("Every seed URL of scan %d is out of scope. Skipping the URL scan.", scanID)
+		return nil, nil
+	}
+	invalidTLSHosts := unverifiedTLSHosts(db, rootDomainID, scanID)
+	if seedURLs = skipUnverifiedTLSSeeds(seedURLs, invalidTLSHosts, scanID); len(seedURLs) == 0 {
+		log.Printf("Every seed URL of scan %d is on a host with an invalid TLS certificate. Skipping the URL scan.", scanID)
+		return nil, nil
+	}
 	resultsChan := make(chan urlScanResult, 100) // Buffered channel
 	var saveWg sync.WaitGroup
 
-	// Start a goroutine to save results from the channel
-	saveWg.Add(1)
-	// Pass rootDomain string and screenshotEnabled flag to saveURLScanResults
-	go saveURLScanResults(db, rootDomain, rootDomainID, scanID, resultsChan, &saveWg, existingSubdomains, scanTemplate.ScreenshotEnabled)
+	// Start the goroutines saving results from the channel
+	startURLSaveWorkers(db, rootDomain, rootDomainID, scanID, resultsChan, &saveWg, existingSubdomains, scanTemplate.ScreenshotEnabled, templateScreenshotCriteria(scanTemplate))
 
-	// Extract Katana options from the config map using helpers
-	maxDepth := getIntOption(config, "maxDepth", 3)
-	concurrency := getIntOption(config, "concurrency", 10)
-	parallelism := getIntOption(config, "parallelism", 10)
-	rateLimit := getIntOption(config, "rateLimit", 150)
-	timeout := getIntOption(config, "timeout", 10)
-	// TODO: Add other Katana options if needed (e.g., strategy, fieldScope)
+	// Extract Katana options from the config map, see resolveKatanaSettings
+	settings := resolveKatanaSettings(config)
+	maxDepth, concurrency, parallelism := settings.MaxDepth, settings.Concurrency, settings.Parallelism
+	rateLimit, timeout := settings.RateLimit, settings.Timeout
+	soft404Enabled := settings.Soft404
+	crawlDuration := settings.CrawlDuration
+	captureStatusCodes := parseCaptureStatusCodes(appconfig.Get("CAPTURE_STATUS_CODES")) // Request/response pairs are only stored for these codes
+	deniedSuffixes := deniedHostSuffixes()
+	fieldScope, strategy, noScope := settings.FieldScope, settings.Strategy, settings.NoScope
+	bodyReadSize := settings.BodyReadSize
+	formExtraction := settings.FormExtraction
+	var redirects *redirectFollowUps // Katana follows redirects itself unless the policy is "same-scope"
+	if settings.RedirectPolicy == RedirectPolicySameScope {
+		redirects = newRedirectFollowUps(seedURLs)
+	}
 
-	log.Printf("Configuring Katana: Depth=%d, Concurrency=%d, Parallelism=%d, RateLimit=%d, Timeout=%ds",
-		maxDepth, concurrency, parallelism, rateLimit, timeout)
+	// Katana builds its HTTP client internally, so its requests can't wait on hostLimiter. As seeds are
+	// crawled one at a time, capping katana's overall rate at the per-host rate keeps each host's rate
+	// polite; the requests are charged to hostLimiter so other phases back off meanwhile.
+	hostDelay := scanHostDelay(scanID)
+	rateLimitMinute := 0
+	if hostDelay > 0 {
+		if perSecond := int(time.Second / hostDelay); perSecond >= 1 {
+			if rateLimit == 0 || perSecond < rateLimit { // 0 is unlimited, not the lower rate
+				rateLimit = perSecond
+			}
+		} else {
+			rateLimit, rateLimitMinute = 0, max(1, int(time.Minute/hostDelay))
+		}
+	}
+
+	// Katana sends the session's cookies to every host it requests, so an authenticated crawl must not
+	// leave the root domain
+	session := scanSession(scanID)
+	if session != nil && (noScope || fieldScope == "dn") {
+		log.Printf("Scan %d crawls with a session, restricting katana to the root domain (fieldScope=rdn, noScope=false).", scanID)
+		fieldScope, noScope = "rdn", false
+	}
+	// Katana skips the URLs matching its OutOfScope regexes before requesting them, but ignores them with
+	// noScope; a field scope matching any host crawls the same hosts and keeps the regexes applied.
+	if noScope && len(outOfScope) > 0 {
+		fieldScope, noScope = ".*", false
+	}
+	var customHeaders []string
+	if cookie := session.cookieHeader(rootDomain); cookie != "" {
+		customHeaders = append(customHeaders, "Cookie: "+cookie)
+	}
+
+	log.Printf("Configuring Katana: Depth=%d, Concurrency=%d, Parallelism=%d, RateLimit=%d, RateLimitMinute=%d, Timeout=%ds, Soft404=%t, CrawlDuration=%ds, FieldScope=%s, Strategy=%s, NoScope=%t, BodyReadSize=%d, FormExtraction=%t, RedirectPolicy=%s, HostDelay=%s",
+		maxDepth, concurrency, parallelism, rateLimit, rateLimitMinute, timeout, soft404Enabled, crawlDuration, fieldScope, strategy, noScope, bodyReadSize, formExtraction, settings.RedirectPolicy, hostDelay)
+
+	// Pre-crawl soft-404 calibration (per seed host)
+	soft404Signatures := make(map[string]soft404Signature)
+	if soft404Enabled {
+		soft404Signatures = calibrateSoft404(seedURLs, timeout, hostDelay)
+		log.Printf("Soft-404 calibration for scan %d: %d hosts answer nonexistent paths with a success page.", scanID, len(soft404Signatures))
+	}
 
 	// Base Katana options
 	options := &types.Options{
 		MaxDepth:     maxDepth,
-		FieldScope:   "rdn",           // Keep scope as root domain name (or make configurable via map?)
-		BodyReadSize: 1 * 1024 * 1024, // Keep body read size limit (or make configurable?)
+		FieldScope:   fieldScope,
+		BodyReadSize: bodyReadSize,
 		Timeout:      timeout,
 		Concurrency:  concurrency,
 		Parallelism:  parallelism,
 		RateLimit:    rateLimit,
-		Strategy:     "depth-first", // Keep strategy (or make configurable?)
-		Silent:       true,          // Keep silent
-		NoScope:      false,         // Keep scope enforced
-		OutputFile:   outputFile,    // Set the output file path
+		Strategy:     strategy,
+		Silent:       true, // Keep silent
+		NoScope:      noScope,
+		// Hosts the organization excluded, and https on hosts with an invalid certificate, are never requested
+		OutOfScope: append(katanaOutOfScopeRegexes(outOfScope), katanaUnverifiedTLSRegexes(invalidTLSHosts)...),
+		// With "same-scope", redirects are returned as they are and followed by crawling in-scope targets as seeds
+		DisableRedirects: redirects != nil,
+		// Katana extracts the forms of each page into the result (see formActionResult)
+		FormExtraction: formExtraction,
+		OutputFile:     outputFile, // Set the output file path
+		// Katana applies CrawlDuration as a context deadline on each Crawl call, i.e. per seed
+		CrawlDuration: time.Duration(crawlDuration) * time.Second,
+		// Used by katana only when RateLimit is 0
+		RateLimitMinute: rateLimitMinute,
+		CustomHeaders:   customHeaders, // Session cookies of authenticated scans
 		OnResult: func(result output.Result) { // Callback for each found URL
+			if result.Request != nil {
+				if parsed, err := url.Parse(result.Request.URL); err == nil {
+					hostLimiter.charge(parsed.Hostname(), hostDelay)
+				}
+			}
 			// Technology detection removed from here
 			// log.Printf("sumshi") // Removed debug log
 			// Send to processing channel (without fingerprints)
-			processKatanaOutput(result, rootDomain, rootDomainID, scanID, resultsChan, existingSubdomains)
+			processKatanaOutput(result, rootDomain, rootDomainID, scanID, resultsChan, existingSubdomains, soft404Signatures, captureStatusCodes, deniedSuffixes, outOfScope, redirects)
 		},
 	}
 
@@ -421,7 +986,7 @@ func ExecuteURLScan(seedURLs []string, rootDomain string, rootDomainID uint, sca
 	if err != nil {
 		close(resultsChan) // Close channel before returning error
 		saveWg.Wait()      // Wait for saver to finish
-		return fmt.Errorf("failed to create crawler options: %w", err)
+		return nil, fmt.Errorf("failed to create crawler options: %w", err)
 	}
 	defer crawlerOptions.Close()
 
@@ -429,18 +994,34 @@ func ExecuteURLScan(seedURLs []string, rootDomain string, rootDomainID uint, sca
 	if err != nil {
 		close(resultsChan)
 		saveWg.Wait()
-		return fmt.Errorf("failed to create standard crawler: %w", err)
+		return nil, fmt.Errorf("failed to create standard crawler: %w", err)
 	}
 	defer crawler.Close()
 
 	// Crawl each seed URL provided
 	var crawlErr error
-	for _, seed := range seedURLs {
-		err = crawler.Crawl(seed) // Use Crawl method per seed URL
-		if err != nil {
-			log.Printf("Could not crawl seed %s for scan %d: %v", seed, scanID, err)
-			// Collect errors? For now, just log and continue with other seeds.
-			crawlErr = err // Store last error?
+	var truncatedSeeds []string
+	// With "same-scope" redirects, each round crawls the in-scope redirect targets found by the previous
+	// one, up to maxDepth rounds as every redirect is one more hop
+	for round, crawlSeeds := 0, seedURLs; len(crawlSeeds) > 0; round++ {
+		for _, seed := range crawlSeeds {
+			seedStarted := time.Now()
+			err = crawler.Crawl(seed) // Use Crawl method per seed URL
+			if err != nil {
+				log.Printf("Could not crawl seed %s for scan %d: %v", seed, scanID, err)
+				// Collect errors? For now, just log and continue with other seeds.
+				crawlErr = err // Store last error?
+			}
+			if crawlDuration > 0 && time.Since(seedStarted) >= time.Duration(crawlDuration)*time.Second {
+				log.Printf("Crawl of seed %s for scan %d was cut short after %ds, moving on to the next seed.", seed, scanID, crawlDuration)
+				truncatedSeeds = append(truncatedSeeds, seed)
+			}
+		}
+		crawlSeeds = nil
+		if redirects != nil && round < maxDepth {
+			if crawlSeeds = skipUnverifiedTLSSeeds(redirects.take(), invalidTLSHosts, scanID); len(crawlSeeds) > 0 {
+				log.Printf("Crawling %d in-scope redirect targets for scan %d.", len(crawlSeeds), scanID)
+			}
 		}
 	}
 	if crawlErr != nil {
@@ -451,6 +1032,6 @@ func ExecuteURLScan(seedURLs []string, rootDomain string, rootDomainID uint, sca
 	close(resultsChan)
 	saveWg.Wait()
 
-	log.Printf("URL scan %d finished.", scanID)
-	return nil // Return nil even if crawler had errors, as some results might have been saved
+	log.Printf("URL scan %d finished (%d seeds cut short).", scanID, len(truncatedSeeds))
+	return truncatedSeeds, nil // Return nil even if crawler had errors, as some results might have been saved
 }
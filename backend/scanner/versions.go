@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"encoding/json"
+	"log"
+	"rewrite-go/models"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// scanToolModules maps the short tool names stored on a scan to their Go module paths.
+var scanToolModules = map[string]string{
+	"subfinder":    "github.com/projectdiscovery/subfinder/v2",
+	"httpx":        "github.com/projectdiscovery/httpx",
+	"katana":       "github.com/projectdiscovery/katana",
+	"wappalyzergo": "github.com/projectdiscovery/wappalyzergo",
+	"chromedp":     "github.com/chromedp/chromedp",
+}
+
+var (
+	toolVersions     map[string]string
+	toolVersionsOnce sync.Once
+)
+
+// ToolVersions returns the versions of the scanning libraries compiled into this binary,
+// read from the embedded build info. Tools that cannot be resolved are reported as "unknown".
+func ToolVersions() map[string]string {
+	toolVersionsOnce.Do(func() {
+		toolVersions = map[string]string{"go": runtime.Version()}
+		for name := range scanToolModules {
+			toolVersions[name] = "unknown"
+		}
+
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			log.Println("Warning: Build info unavailable, scan tool versions will be reported as unknown")
+			return
+		}
+		for _, dep := range info.Deps {
+			for name, modulePath := range scanToolModules {
+				if dep.Path != modulePath {
+					continue
+				}
+				version := dep.Version
+				if dep.Replace != nil && dep.Replace.Version != "" {
+					version = dep.Replace.Version
+				}
+				toolVersions[name] = version
+			}
+		}
+	})
+
+	// Return a copy to prevent external modification
+	versions := make(map[string]string, len(toolVersions))
+	for k, v := range toolVersions {
+		versions[k] = v
+	}
+	return versions
+}
+
+// saveToolVersions records the scanning tool versions on the scan record.
+func saveToolVersions(db *gorm.DB, scanID uint) {
+	data, err := json.Marshal(ToolVersions())
+	if err != nil {
+		log.Printf("Warning: Failed to marshal tool versions for scan %d: %v", scanID, err)
+		return
+	}
+	if err := db.Model(&models.Scan{}).Where("id = ?", scanID).Update("tool_versions", string(data)).Error; err != nil {
+		log.Printf("Warning: Failed to save tool versions for scan %d: %v", scanID, err)
+	}
+}
@@ -0,0 +1,180 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rewrite-go/config"
+	"rewrite-go/models"
+	"sort"
+	"strings"
+)
+
+// maxWordlistEntries caps the entries read from a wordlist file.
+const maxWordlistEntries = 100000
+
+// bundledWordlists are the wordlists tools can select by name with their wordlist option instead of a file.
+var bundledWordlists = map[string][]string{
+	"sensitive-files": defaultSensitivePaths,
+	"common-dirs": {
+		"/admin", "/administrator", "/api", "/app", "/assets", "/backup", "/backups", "/bin", "/cgi-bin", "/config",
+		"/console", "/dashboard", "/data", "/debug", "/dev", "/docs", "/download", "/downloads", "/files", "/images",
+		"/include", "/includes", "/internal", "/login", "/logs", "/manager", "/old", "/panel", "/private", "/public",
+		"/scripts", "/server-info", "/server-status", "/setup", "/static", "/swagger", "/swagger-ui", "/temp", "/test",
+		"/tmp", "/upload", "/uploads", "/v1", "/v2", "/wp-admin", "/wp-content", "/wp-includes",
+	},
+	"backup-files": {
+		"/backup.zip", "/backup.tar.gz", "/backup.tgz", "/backup.sql", "/backup.rar", "/backup.7z", "/site.zip",
+		"/site.tar.gz", "/www.zip", "/www.tar.gz", "/html.zip", "/web.zip", "/db.sql", "/database.sql", "/dump.sql",
+		"/data.sql", "/index.php.bak", "/index.php~", "/config.php.bak", "/config.php~", "/wp-config.php.bak",
+		"/wp-config.php~", "/.env.bak", "/.env.old", "/web.config.bak",
+	},
+}
+
+// BundledWordlists returns the names of the bundled wordlists, sorted.
+func BundledWordlists() []string {
+	names := make([]string, 0, len(bundledWordlists))
+	for name := range bundledWordlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wordlistPath resolves a wordlist option that is not a bundled wordlist to its file: a path relative to
+// WORDLIST_DIR. Wordlist entries are sent to scan targets, so absolute paths and paths leaving the directory
+// are refused rather than disclosing other files on the server.
+func wordlistPath(value string) (string, error) {
+	dir := config.WordlistDir()
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return "", fmt.Errorf("wordlist '%s' must not contain '..'", value)
+		}
+	}
+	if value == "" {
+		return "", fmt.Errorf("empty wordlist, use a file in %s or one of: %s", dir, strings.Join(BundledWordlists(), ", "))
+	}
+	if filepath.IsAbs(value) || strings.HasPrefix(value, "/") || strings.HasPrefix(value, `\`) || filepath.VolumeName(value) != "" {
+		return "", fmt.Errorf("wordlist '%s' must be a path relative to %s or one of: %s", value, dir, strings.Join(BundledWordlists(), ", "))
+	}
+	path := filepath.Join(dir, value)
+	if !withinDir(dir, path) {
+		return "", fmt.Errorf("wordlist '%s' is outside %s", value, dir)
+	}
+	return path, nil
+}
+
+// withinDir reports whether path is dir or below it.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// loadWordlist returns the entries of a wordlist option: the name of a bundled wordlist or the path of a
+// file in WORDLIST_DIR (see wordlistPath) with one entry per line. Blank lines and lines starting with #
+// are skipped.
+func loadWordlist(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if entries, ok := bundledWordlists[value]; ok {
+		return entries, nil
+	}
+	path, err := wordlistPath(value)
+	if err != nil {
+		return nil, err
+	}
+	// Symbolic links must not lead out of the directory either
+	realDir, err := filepath.EvalSymlinks(config.WordlistDir())
+	if err != nil {
+		return nil, fmt.Errorf("cannot read wordlist '%s': %w", value, err)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read wordlist '%s': %w", value, err)
+	}
+	if !withinDir(realDir, realPath) {
+		return nil, fmt.Errorf("wordlist '%s' is outside %s", value, config.WordlistDir())
+	}
+	file, err := os.Open(realPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read wordlist: %w", err)
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("wordlist %s is not a regular file", value)
+	}
+
+	var entries []string
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(entries) == maxWordlistEntries {
+			return nil, fmt.Errorf("wordlist %s has more than %d entries", value, maxWordlistEntries)
+		}
+		entries = append(entries, line)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read wordlist %s: %w", value, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("wordlist %s is empty", value)
+	}
+	return entries, nil
+}
+
+// templateWordlistOptions calls fn with the section and tool name and wordlist option of every enabled
+// tool of a template that has one.
+func templateWordlistOptions(scanTemplate *models.ScanTemplate, fn func(section, tool, value string) error) error {
+	sections := map[string]string{
+		"subdomain_scan_config": scanTemplate.SubdomainScanConfig,
+		"url_scan_config":       scanTemplate.URLScanConfig,
+		"parameter_scan_config": scanTemplate.ParameterScanConfig,
+	}
+	for name, raw := range sections {
+		var section models.ScanSectionConfig
+		if raw == "" || json.Unmarshal([]byte(raw), &section) != nil {
+			continue
+		}
+		for tool, toolCfg := range section.Tools {
+			value, ok := parseToolOptions(toolCfg.Options)["wordlist"]
+			if !ok || !toolCfg.Enabled {
+				continue
+			}
+			if err := fn(name, tool, fmt.Sprint(value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckTemplateWordlistNames checks that the wordlist option of every enabled tool of a template names a
+// bundled wordlist or a path inside WORDLIST_DIR, without reading any file. Templates are checked when they
+// are saved, so one naming a file that does not exist yet can still be saved.
+func CheckTemplateWordlistNames(scanTemplate *models.ScanTemplate) error {
+	return templateWordlistOptions(scanTemplate, func(section, tool, value string) error {
+		value = strings.TrimSpace(value)
+		if _, ok := bundledWordlists[value]; ok {
+			return nil
+		}
+		if _, err := wordlistPath(value); err != nil {
+			return fmt.Errorf("%s tool %s: %w", section, tool, err)
+		}
+		return nil
+	})
+}
+
+// CheckTemplateWordlists loads the wordlist option of every enabled tool of a template's scan sections, so
+// a missing or unreadable wordlist fails the scan at its start rather than in the phase using it.
+func CheckTemplateWordlists(scanTemplate *models.ScanTemplate) error {
+	return templateWordlistOptions(scanTemplate, func(section, tool, value string) error {
+		if _, err := loadWordlist(value); err != nil {
+			return fmt.Errorf("%s tool %s: %w", section, tool, err)
+		}
+		return nil
+	})
+}
@@ -6,6 +6,8 @@ import type {
 	Parameter,
 	RequestResponse,
 	Scan,
+	ScanSubdomainsPage,
+	ScanEndpointsPage,
 	ApiError,
 	GraphData,
 	GraphNode,
@@ -49,17 +51,17 @@ async function fetchApi<T>(endpoint: string, options: RequestInit = {}): Promise
         if (text) {
             data = JSON.parse(text);
         } else {
-            data = { detail: response.statusText || 'Error' }; // Use status text if no body
+            data = { message: response.statusText || 'Error' }; // Use status text if no body
         }
     } catch (e) {
-        // If JSON parsing fails, use the status text as the error detail
-        data = { detail: response.statusText || `HTTP error ${response.status}` };
+        // If JSON parsing fails, use the status text as the error message
+        data = { message: response.statusText || `HTTP error ${response.status}` };
     }
 
 
     if (!response.ok) {
         // Throw the custom HttpError with status and data
-        const errorMessage = (data as ApiError)?.detail || `HTTP error ${response.status}`;
+        const errorMessage = (data as ApiError)?.message || `HTTP error ${response.status}`;
         throw new HttpError(errorMessage, response.status, data);
     }
 
@@ -87,14 +89,14 @@ async function postFormData<T>(endpoint: string, formData: FormData, options: Re
         if (text) {
             data = JSON.parse(text);
         } else {
-            data = { detail: response.statusText || 'Success' }; // Assume success if no body
+            data = { message: response.statusText || 'Success' }; // Assume success if no body
         }
     } catch (e) {
-        data = { detail: response.statusText || `HTTP error ${response.status}` };
+        data = { message: response.statusText || `HTTP error ${response.status}` };
     }
 
     if (!response.ok) {
-        const errorMessage = (data as ApiError)?.detail || `HTTP error ${response.status}`;
+        const errorMessage = (data as ApiError)?.message || `HTTP error ${response.status}`;
         throw new HttpError(errorMessage, response.status, data);
     }
 
@@ -160,6 +162,11 @@ export const scansApi = {
         return fetchApi<Scan[]>(`/scans${query}`);
     },
     getScan: (id: number) => fetchApi<Scan>(`/scans/${id}`),
+    // Subdomains and endpoints a scan discovered, a page at a time (page_size up to 1000)
+    getScanSubdomains: (id: number, page = 1, pageSize = 100) =>
+        fetchApi<ScanSubdomainsPage>(`/scans/${id}/subdomains?page=${page}&page_size=${pageSize}`),
+    getScanEndpoints: (id: number, page = 1, pageSize = 100) =>
+        fetchApi<ScanEndpointsPage>(`/scans/${id}/endpoints?page=${page}&page_size=${pageSize}`),
     // New function to start scans (root or subdomain)
     startScan: (scanData: { rootDomainId: number; subdomainId?: number; scanTemplateId?: number }) => {
         const body = {
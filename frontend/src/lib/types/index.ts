@@ -42,6 +42,7 @@ export interface Subdomain {
     discovered_at: string;
     technologies?: Technology[];
     latest_screenshot_path?: string | null; // Add screenshot path
+    latest_mobile_screenshot_path?: string | null; // Mobile viewport capture, if the template takes one
 }
 
 export interface Endpoint {
@@ -90,21 +91,20 @@ export interface Scan {
     completed_at: string | null;
     status: 'running' | 'completed' | 'failed';
     results_summary: string | null; // This is likely JSON string, might need parsing
-    discovered_subdomains?: DiscoveredSubdomain[]; // Optional for older scans?
-    discovered_endpoints?: DiscoveredEndpoint[]; // Optional for older scans?
+    discovered_subdomain_count: number;
+    discovered_endpoint_count: number;
 }
 
-// Type for subdomains returned within a Scan result
+// Type for subdomains listed by /scans/:id/subdomains
 export interface DiscoveredSubdomain {
     id: number;
     hostname: string;
     ip_address: string | null;
     is_active: boolean;
     discovered_at: string | null;
-    scan_id: number;
 }
 
-// Type for endpoints returned within a Scan result
+// Type for endpoints listed by /scans/:id/endpoints
 export interface DiscoveredEndpoint {
     id: number;
     subdomain_id: number;
@@ -113,8 +113,23 @@ export interface DiscoveredEndpoint {
     status_code: number | null;
     content_type: string | null;
     discovered_at: string | null;
+    hostname: string; // Hostname for constructing full URL
+}
+
+// A page of the subdomains or endpoints a scan discovered
+export interface ScanItemsPage {
     scan_id: number;
-    subdomain_hostname: string | null; // Hostname for constructing full URL
+    page: number;
+    page_size: number;
+    total: number;
+}
+
+export interface ScanSubdomainsPage extends ScanItemsPage {
+    subdomains: DiscoveredSubdomain[];
+}
+
+export interface ScanEndpointsPage extends ScanItemsPage {
+    endpoints: DiscoveredEndpoint[];
 }
 
 // --- Scan Template Types ---
@@ -146,8 +161,11 @@ export interface ScanTemplate {
 
 // --- End Scan Template Types ---
 
+// Error envelope returned by every failed API request
 export interface ApiError {
-    detail: string;
+    code?: string;
+    message: string;
+    details?: string;
 }
 
 export interface GraphNode {
@@ -6,10 +6,17 @@ interface Params {
 }
 
 export const load: PageLoad = async ({ params }: { params: Params }) => {
-    const scan = await scansApi.getScan(parseInt(params.id))
-    
+    const id = parseInt(params.id)
+    const [scan, subdomains, endpoints] = await Promise.all([
+        scansApi.getScan(id),
+        scansApi.getScanSubdomains(id, 1, 1000),
+        scansApi.getScanEndpoints(id, 1, 1000)
+    ])
+
     return {
         scan,
+        subdomains,
+        endpoints,
         status: scan.status
     }
 }